@@ -0,0 +1,329 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// RFC 5227 - 1.1. Conventions and Terminology Used in This Document
+const (
+	acdProbeWait        = 1 * time.Second
+	acdProbeNum         = 3
+	acdProbeMin         = 1 * time.Second
+	acdProbeMax         = 2 * time.Second
+	acdAnnounceWait     = 2 * time.Second
+	acdAnnounceNum      = 2
+	acdAnnounceInterval = 2 * time.Second
+	acdDefendInterval   = 10 * time.Second
+)
+
+type acdState struct {
+	sync.Mutex
+
+	// conflict notification channels of probes in progress, by address
+	probes map[tcpip.Address][]chan net.HardwareAddr
+
+	// addresses being defended, with their last defense time
+	active map[tcpip.Address]time.Time
+}
+
+// watch starts defending an address in use (RFC 5227 - 2.4).
+func (acd *acdState) watch(addr tcpip.Address) {
+	acd.Lock()
+	defer acd.Unlock()
+
+	if acd.active == nil {
+		acd.active = make(map[tcpip.Address]time.Time)
+	}
+
+	if _, ok := acd.active[addr]; !ok {
+		acd.active[addr] = time.Time{}
+	}
+}
+
+// unwatch stops defending an address.
+func (acd *acdState) unwatch(addr tcpip.Address) {
+	acd.Lock()
+	defer acd.Unlock()
+
+	delete(acd.active, addr)
+}
+
+// watching returns whether an address is being defended.
+func (acd *acdState) watching(addr tcpip.Address) bool {
+	acd.Lock()
+	defer acd.Unlock()
+
+	_, ok := acd.active[addr]
+
+	return ok
+}
+
+// addProbe registers a conflict notification channel for an address probe.
+func (acd *acdState) addProbe(addr tcpip.Address, conflict chan net.HardwareAddr) {
+	acd.Lock()
+	defer acd.Unlock()
+
+	if acd.probes == nil {
+		acd.probes = make(map[tcpip.Address][]chan net.HardwareAddr)
+	}
+
+	acd.probes[addr] = append(acd.probes[addr], conflict)
+}
+
+// removeProbe unregisters a conflict notification channel, leaving other
+// probes of the same address in place.
+func (acd *acdState) removeProbe(addr tcpip.Address, conflict chan net.HardwareAddr) {
+	acd.Lock()
+	defer acd.Unlock()
+
+	probes := acd.probes[addr]
+
+	for i, ch := range probes {
+		if ch == conflict {
+			probes = append(probes[:i], probes[i+1:]...)
+			break
+		}
+	}
+
+	if len(probes) == 0 {
+		delete(acd.probes, addr)
+	} else {
+		acd.probes[addr] = probes
+	}
+}
+
+func (iface *Interface) sendARP(op header.ARPOp, sender tcpip.Address, target tcpip.Address) error {
+	buf := make([]byte, header.ARPSize)
+
+	arp := header.ARP(buf)
+	arp.SetIPv4OverEthernet()
+	arp.SetOp(op)
+
+	copy(arp.HardwareAddressSender(), iface.NIC.MAC)
+	copy(arp.ProtocolAddressSender(), sender)
+	copy(arp.ProtocolAddressTarget(), target)
+
+	payload := bufferv2.MakeWithData(buf)
+
+	if err := iface.Stack.WritePacketToRemote(iface.nicid, header.EthernetBroadcastAddress, header.ARPProtocolNumber, payload); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	return nil
+}
+
+// handleARP implements RFC 5227 conflict detection on incoming ARP packets.
+func (iface *Interface) handleARP(arp header.ARP) {
+	sender := tcpip.Address(arp.ProtocolAddressSender())
+	target := tcpip.Address(arp.ProtocolAddressTarget())
+
+	if bytes.Equal(arp.HardwareAddressSender(), iface.NIC.MAC) {
+		return
+	}
+
+	mac := net.HardwareAddr(append([]byte{}, arp.HardwareAddressSender()...))
+
+	probed := sender
+
+	if sender == header.IPv4Any {
+		probed = target
+	}
+
+	iface.acd.Lock()
+	defer iface.acd.Unlock()
+
+	for _, conflict := range iface.acd.probes[probed] {
+		select {
+		case conflict <- mac:
+		default:
+		}
+	}
+
+	if _, ok := iface.acd.active[sender]; ok {
+		go iface.defend(sender, mac)
+	}
+}
+
+// detectConflict probes an IPv4 address (RFC 5227 - 2.1.1), the hardware
+// address of a conflicting host is returned if found.
+func (iface *Interface) detectConflict(ctx context.Context, addr tcpip.Address) (mac net.HardwareAddr, err error) {
+	conflict := make(chan net.HardwareAddr, 1)
+
+	iface.acd.addProbe(addr, conflict)
+	defer iface.acd.removeProbe(addr, conflict)
+
+	rng := iface.Stack.Rand()
+	wait := time.Duration(rng.Int63n(int64(acdProbeWait)))
+
+	for i := 0; i <= acdProbeNum; i++ {
+		if i == acdProbeNum {
+			wait = acdAnnounceWait
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case mac = <-conflict:
+			return
+		case <-time.After(wait):
+		}
+
+		if i == acdProbeNum {
+			break
+		}
+
+		if err = iface.sendARP(header.ARPRequest, header.IPv4Any, addr); err != nil {
+			return
+		}
+
+		wait = acdProbeMin + time.Duration(rng.Int63n(int64(acdProbeMax-acdProbeMin)))
+	}
+
+	return
+}
+
+// DetectAddressConflict probes an IPv4 address with ARP (RFC 5227 - 2.1.1),
+// it returns true if another host on the link is using, or probing, the same
+// address. The probing duration, which is randomized as mandated by RFC 5227,
+// is bounded by the argument timeout (when non-zero) and context.
+func (iface *Interface) DetectAddressConflict(ctx context.Context, ip tcpip.Address, timeout time.Duration) (bool, error) {
+	if len(ip) != header.IPv4AddressSize {
+		return false, fmt.Errorf("invalid address %s", ip)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	mac, err := iface.detectConflict(ctx, ip)
+
+	if err != nil {
+		return false, err
+	}
+
+	return mac != nil, nil
+}
+
+// announce sends ARP announcements for an IPv4 address (RFC 5227 - 2.3).
+func (iface *Interface) announce(addr tcpip.Address, num int) (err error) {
+	for i := 0; i < num; i++ {
+		if i > 0 && !iface.sleep(acdAnnounceInterval) {
+			return
+		}
+
+		if err = iface.sendARP(header.ARPRequest, addr, addr); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AnnounceARP sends a gratuitous ARP announcement (RFC 5227 - 3) for the
+// interface IPv4 address, so that peers and switches update their caches.
+// Announcements are sent automatically whenever the address is configured.
+func (iface *Interface) AnnounceARP() error {
+	addr, err := iface.localAddress()
+
+	if err != nil {
+		return err
+	}
+
+	return iface.announce(addr, 1)
+}
+
+func (iface *Interface) addressConflict(addr tcpip.Address, mac net.HardwareAddr) {
+	if fn := iface.opts.OnAddressConflict; fn != nil {
+		fn(addr, mac)
+	}
+}
+
+// withdraw removes a conflicting IPv4 address in use, along with its subnet
+// route, from the interface (RFC 5227 - 2.4 (a)).
+func (iface *Interface) withdraw(addr tcpip.Address) {
+	if !iface.acd.watching(addr) {
+		return
+	}
+
+	for _, pa := range iface.Stack.AllAddresses()[iface.nicid] {
+		if pa.Protocol == ipv4.ProtocolNumber && pa.AddressWithPrefix.Address == addr {
+			iface.removeAddress(ipv4.ProtocolNumber, pa.AddressWithPrefix)
+			return
+		}
+	}
+}
+
+// defend handles conflicts on an IPv4 address in use (RFC 5227 - 2.4).
+func (iface *Interface) defend(addr tcpip.Address, mac net.HardwareAddr) {
+	iface.addressConflict(addr, mac)
+
+	if iface.opts.WithdrawOnConflict {
+		iface.withdraw(addr)
+		return
+	}
+
+	iface.acd.Lock()
+	defer iface.acd.Unlock()
+
+	lastDefense, ok := iface.acd.active[addr]
+
+	if !ok {
+		return
+	}
+
+	if time.Since(lastDefense) < acdDefendInterval {
+		return
+	}
+
+	iface.acd.active[addr] = time.Now()
+	iface.announce(addr, 1)
+}
+
+// startACD probes the interface IPv4 address and configures it in absence of
+// conflicts (or regardless of them when WithdrawOnConflict is false).
+func (iface *Interface) startACD() {
+	ctx, cancel := iface.context()
+	defer cancel()
+
+	addr := iface.address.Address
+	mac, err := iface.detectConflict(ctx, addr)
+
+	if err != nil {
+		return
+	}
+
+	if mac != nil {
+		iface.addressConflict(addr, mac)
+
+		if iface.opts.WithdrawOnConflict {
+			return
+		}
+	}
+
+	if err = iface.configureProtocol(ipv4.ProtocolNumber, iface.address, iface.gateway); err != nil {
+		return
+	}
+
+	iface.acd.watch(addr)
+	iface.announce(addr, acdAnnounceNum)
+}
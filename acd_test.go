@@ -0,0 +1,155 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func TestDetectAddressConflict(t *testing.T) {
+	_, b := testPair(t, nil)
+
+	conflict, err := b.DetectAddressConflict(context.Background(), testAddress("10.0.0.1"), 10*time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conflict {
+		t.Fatal("conflict not detected")
+	}
+}
+
+func TestDetectAddressConflictConcurrent(t *testing.T) {
+	_, b := testPair(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	free := make(chan error, 1)
+
+	// a probe for a free address must not be affected by a concurrent
+	// conflicting one
+	go func() {
+		conflict, err := b.DetectAddressConflict(ctx, testAddress("10.0.0.3"), 0)
+
+		if err == nil && conflict {
+			err = errors.New("unexpected conflict")
+		}
+
+		free <- err
+	}()
+
+	conflict, err := b.DetectAddressConflict(context.Background(), testAddress("10.0.0.1"), 10*time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conflict {
+		t.Fatal("conflict not detected")
+	}
+
+	// the free address probe is expected to be interrupted by the context
+	if err = <-free; err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
+
+func TestDuplicateAddressDetection(t *testing.T) {
+	conflicts := make(chan tcpip.Address, 1)
+
+	_, b := testPair(t, func(n int, opts *Options) {
+		opts.IPv6 = &IPConfig{Address: "fd00::1/64"}
+
+		if n == 1 {
+			opts.DisableDAD = true
+			return
+		}
+
+		opts.OnAddressConflict = func(addr tcpip.Address, _ net.HardwareAddr) {
+			select {
+			case conflicts <- addr:
+			default:
+			}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := b.WaitDAD(ctx); !errors.Is(err, ErrDuplicateAddress) {
+		t.Fatalf("unexpected DAD result, %v", err)
+	}
+
+	select {
+	case addr := <-conflicts:
+		if addr != testAddress("fd00::1") {
+			t.Fatalf("unexpected conflict address %s", addr)
+		}
+	case <-ctx.Done():
+		t.Fatal("conflict not reported")
+	}
+}
+
+func TestWithdrawOnConflict(t *testing.T) {
+	conflicts := make(chan tcpip.Address, 1)
+
+	a, b := testPair(t, func(n int, opts *Options) {
+		if n == 1 {
+			opts.WithdrawOnConflict = true
+			opts.OnAddressConflict = func(addr tcpip.Address, _ net.HardwareAddr) {
+				select {
+				case conflicts <- addr:
+				default:
+				}
+			}
+		}
+	})
+
+	addr := testAddress("10.0.0.1")
+	a.acd.watch(addr)
+
+	// another host announces the address in use
+	if err := b.sendARP(header.ARPRequest, addr, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-conflicts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("conflict not reported")
+	}
+
+	for i := 0; i < 50 && a.hasAddress(ipv4.ProtocolNumber, addr); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if a.hasAddress(ipv4.ProtocolNumber, addr) {
+		t.Fatal("conflicting address not withdrawn")
+	}
+
+	if _, err := a.localAddress(); !errors.Is(err, ErrNoAddress) {
+		t.Errorf("withdrawn address still in use, %v", err)
+	}
+
+	for _, route := range a.Stack.GetRouteTable() {
+		if route.Destination.Contains(addr) {
+			t.Errorf("unexpected route %s", route)
+		}
+	}
+}
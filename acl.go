@@ -0,0 +1,148 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"fmt"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// ACLAction represents the action taken on packets matching an ACL rule.
+type ACLAction int
+
+// ACL actions
+const (
+	Allow ACLAction = iota
+	Deny
+)
+
+// ACLRule represents a network Access Control List rule, zero value fields
+// match any packet.
+type ACLRule struct {
+	// ID is the rule identifier.
+	ID int
+
+	// SrcSubnet matches the IP source address.
+	SrcSubnet tcpip.Subnet
+	// DstSubnet matches the IP destination address.
+	DstSubnet tcpip.Subnet
+	// SrcPort matches the TCP or UDP source port.
+	SrcPort uint16
+	// DstPort matches the TCP or UDP destination port.
+	DstPort uint16
+	// Protocol matches the IP transport protocol.
+	Protocol tcpip.TransportProtocolNumber
+
+	// Action is the action taken on matching packets.
+	Action ACLAction
+}
+
+func matchSubnet(subnet tcpip.Subnet, addr tcpip.Address) bool {
+	return subnet == tcpip.Subnet{} || subnet.Contains(addr)
+}
+
+// matchPorts matches the rule ports, TCP and UDP packets whose ports are not
+// available (e.g. non-initial fragments) match any port so that they cannot
+// bypass Deny rules (RFC 1858 - 3).
+func (rule *ACLRule) matchPorts(f *frame) bool {
+	if rule.SrcPort == 0 && rule.DstPort == 0 || f.noPorts {
+		return true
+	}
+
+	return (rule.SrcPort == 0 || rule.SrcPort == f.srcPort) &&
+		(rule.DstPort == 0 || rule.DstPort == f.dstPort)
+}
+
+func (rule *ACLRule) match(f *frame) bool {
+	return matchSubnet(rule.SrcSubnet, f.srcAddr) &&
+		matchSubnet(rule.DstSubnet, f.dstAddr) &&
+		rule.matchPorts(f) &&
+		(rule.Protocol == 0 || rule.Protocol == f.transport)
+}
+
+type acl struct {
+	sync.RWMutex
+	rules []ACLRule
+}
+
+// allow evaluates ACL rules, in insertion order, against an Ethernet frame,
+// IEEE 802.1Q tagged frames are evaluated without their tag. Non-IP frames,
+// and IP frames not matching any rule, are allowed.
+//
+// TCP and UDP fragments lacking transport ports match all port rules, an
+// explicit Deny rule on the protocol is therefore required to discard all
+// fragments.
+func (a *acl) allow(buf []byte) bool {
+	a.RLock()
+	defer a.RUnlock()
+
+	if len(a.rules) == 0 {
+		return true
+	}
+
+	f, ok := parseFrame(untag(buf))
+
+	if !ok {
+		return false
+	}
+
+	if !f.isIP() {
+		return true
+	}
+
+	for _, rule := range a.rules {
+		if rule.match(&f) {
+			return rule.Action == Allow
+		}
+	}
+
+	return true
+}
+
+// AddACLRule appends a rule to the Access Control List evaluated on all
+// received and transmitted packets.
+func (iface *Interface) AddACLRule(rule ACLRule) error {
+	a := &iface.NIC.acl
+
+	if rule.Action != Allow && rule.Action != Deny {
+		return fmt.Errorf("invalid action %d", rule.Action)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	for _, r := range a.rules {
+		if r.ID == rule.ID {
+			return fmt.Errorf("duplicate rule ID %d", rule.ID)
+		}
+	}
+
+	a.rules = append(a.rules, rule)
+
+	return nil
+}
+
+// RemoveACLRule removes a rule from the Access Control List.
+func (iface *Interface) RemoveACLRule(id int) error {
+	a := &iface.NIC.acl
+
+	a.Lock()
+	defer a.Unlock()
+
+	for i, r := range a.rules {
+		if r.ID == id {
+			a.rules = append(a.rules[:i], a.rules[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("rule ID %d not found", id)
+}
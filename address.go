@@ -0,0 +1,158 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// parseInterfaceAddress parses an IPv4 or IPv6 address, optionally in CIDR
+// notation, for an address family enabled on the interface.
+func (iface *Interface) parseInterfaceAddress(s string) (proto tcpip.NetworkProtocolNumber, addr tcpip.AddressWithPrefix, err error) {
+	proto = ipv4.ProtocolNumber
+
+	if strings.Contains(s, ":") {
+		proto = ipv6.ProtocolNumber
+	}
+
+	if proto == ipv6.ProtocolNumber && iface.opts.IPv6 == nil {
+		return 0, addr, errors.New("IPv6 not enabled")
+	}
+
+	addr, err = parseAddress(s, proto)
+
+	return
+}
+
+// hasAddress returns whether the argument address is configured on the
+// interface. Stack.CheckLocalAddress() cannot be used to this end as, for
+// IPv4 or with spoofing enabled, it matches any address on the interface.
+func (iface *Interface) hasAddress(proto tcpip.NetworkProtocolNumber, addr tcpip.Address) bool {
+	for _, a := range iface.Stack.AllAddresses()[iface.nicid] {
+		if a.Protocol == proto && a.AddressWithPrefix.Address == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addAddress configures an additional address, along with its subnet route,
+// the address becomes the primary one of its family when none is set.
+func (iface *Interface) addAddress(proto tcpip.NetworkProtocolNumber, addr tcpip.AddressWithPrefix) (err error) {
+	if iface.hasAddress(proto, addr.Address) {
+		return fmt.Errorf("address %s already configured", addr.Address)
+	}
+
+	if err = iface.configureProtocol(proto, addr, ""); err != nil {
+		return
+	}
+
+	if proto == ipv4.ProtocolNumber && iface.opts.ACD {
+		iface.acd.watch(addr.Address)
+	}
+
+	iface.mu.Lock()
+	defer iface.mu.Unlock()
+
+	switch {
+	case proto == ipv4.ProtocolNumber && len(iface.address.Address) == 0:
+		iface.address = addr
+	case proto == ipv6.ProtocolNumber && len(iface.address6.Address) == 0:
+		iface.address6 = addr
+	}
+
+	return
+}
+
+// AddAddress configures an additional IPv4 or IPv6 address, optionally in
+// CIDR notation, on the interface. A route for the address subnet is added
+// unless the address is configured as a single host one.
+//
+// The address becomes the primary one of its family, used by functions
+// dialing or listening on the interface address, only when no other is set.
+func (iface *Interface) AddAddress(address string) error {
+	proto, addr, err := iface.parseInterfaceAddress(address)
+
+	if err != nil {
+		return err
+	}
+
+	return iface.addAddress(proto, addr)
+}
+
+// RemoveAddress removes an IPv4 or IPv6 address from the interface, along
+// with its subnet route when no other address on the same subnet remains.
+// When the primary address of its family is removed, another configured one
+// (if any) replaces it.
+func (iface *Interface) RemoveAddress(address string) error {
+	proto, addr, err := iface.parseInterfaceAddress(address)
+
+	if err != nil {
+		return err
+	}
+
+	return iface.removeAddress(proto, addr)
+}
+
+// removeAddress removes an address along with its subnet route, when not
+// shared, replacing the primary address of its family when necessary.
+func (iface *Interface) removeAddress(proto tcpip.NetworkProtocolNumber, addr tcpip.AddressWithPrefix) error {
+	if err := iface.Stack.RemoveAddress(iface.nicid, addr.Address); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	iface.acd.unwatch(addr.Address)
+
+	var next tcpip.AddressWithPrefix
+	subnet := addr.Subnet()
+	shared := false
+
+	for _, pa := range iface.Stack.AllAddresses()[iface.nicid] {
+		a := pa.AddressWithPrefix.Address
+
+		// the IPv4 broadcast endpoint is not an interface address
+		if pa.Protocol != proto || a == header.IPv4Broadcast || header.IsV6LinkLocalUnicastAddress(a) {
+			continue
+		}
+
+		if len(next.Address) == 0 {
+			next = pa.AddressWithPrefix
+		}
+
+		if pa.AddressWithPrefix.Subnet() == subnet {
+			shared = true
+		}
+	}
+
+	if !shared {
+		iface.Stack.RemoveRoutes(func(rt tcpip.Route) bool {
+			return rt.NIC == iface.nicid && rt.Destination == subnet && len(rt.Gateway) == 0
+		})
+	}
+
+	iface.mu.Lock()
+	defer iface.mu.Unlock()
+
+	switch {
+	case proto == ipv4.ProtocolNumber && iface.address.Address == addr.Address:
+		iface.address = next
+	case proto == ipv6.ProtocolNumber && iface.address6.Address == addr.Address:
+		iface.address6 = next
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func TestAddRemoveAddress(t *testing.T) {
+	a, b := testPair(t, nil)
+
+	if err := a.AddAddress("10.0.1.5/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.hasAddress(ipv4.ProtocolNumber, testAddress("10.0.1.5")) {
+		t.Fatal("secondary address not configured")
+	}
+
+	if err := a.AddAddress("10.0.1.5/24"); err == nil {
+		t.Error("duplicate address accepted")
+	}
+
+	// the secondary address is reachable on its own subnet
+	if err := b.AddAddress("10.0.1.6/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := a.ListenUDP("udp4", "10.0.1.5:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := b.DialUDP4("10.0.1.6:0", "10.0.1.5:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testEcho(t, client, server)
+
+	if err = a.RemoveAddress("10.0.1.5/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.hasAddress(ipv4.ProtocolNumber, testAddress("10.0.1.5")) {
+		t.Error("secondary address not removed")
+	}
+
+	// the primary address is retained
+	if addr := a.address.Address; addr != testAddress("10.0.0.1") {
+		t.Errorf("unexpected primary address %s", addr)
+	}
+
+	if err = a.RemoveAddress("10.0.1.5/24"); err == nil {
+		t.Error("removal of missing address succeeded")
+	}
+}
@@ -0,0 +1,318 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// BPFInstruction represents a classic BPF instruction, matching the Linux
+// struct sock_filter layout (e.g. as emitted by `tcpdump -dd`).
+type BPFInstruction struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// classic BPF instruction classes and fields
+const (
+	bpfLD   = 0x00
+	bpfLDX  = 0x01
+	bpfST   = 0x02
+	bpfSTX  = 0x03
+	bpfALU  = 0x04
+	bpfJMP  = 0x05
+	bpfRET  = 0x06
+	bpfMISC = 0x07
+
+	bpfW = 0x00
+	bpfH = 0x08
+	bpfB = 0x10
+
+	bpfIMM = 0x00
+	bpfABS = 0x20
+	bpfIND = 0x40
+	bpfMEM = 0x60
+	bpfLEN = 0x80
+	bpfMSH = 0xa0
+
+	bpfADD = 0x00
+	bpfSUB = 0x10
+	bpfMUL = 0x20
+	bpfDIV = 0x30
+	bpfOR  = 0x40
+	bpfAND = 0x50
+	bpfLSH = 0x60
+	bpfRSH = 0x70
+	bpfNEG = 0x80
+	bpfMOD = 0x90
+	bpfXOR = 0xa0
+
+	bpfJA   = 0x00
+	bpfJEQ  = 0x10
+	bpfJGT  = 0x20
+	bpfJGE  = 0x30
+	bpfJSET = 0x40
+
+	bpfK = 0x00
+	bpfX = 0x08
+	bpfA = 0x10
+
+	bpfTAX = 0x00
+	bpfTXA = 0x80
+
+	bpfMemWords = 16
+	bpfMaxInsns = 4096
+)
+
+// validateBPF checks a classic BPF program for out of bounds jumps and
+// memory accesses and for a terminating return instruction.
+func validateBPF(prog []BPFInstruction) error {
+	if len(prog) == 0 || len(prog) > bpfMaxInsns {
+		return errors.New("invalid program length")
+	}
+
+	for pc, ins := range prog {
+		switch ins.Code & 0x07 {
+		case bpfLD, bpfLDX:
+			if ins.Code&0xe0 == bpfMEM && ins.K >= bpfMemWords {
+				return fmt.Errorf("invalid memory access at %d", pc)
+			}
+		case bpfST, bpfSTX:
+			if ins.K >= bpfMemWords {
+				return fmt.Errorf("invalid memory access at %d", pc)
+			}
+		case bpfALU:
+			op := ins.Code & 0xf0
+
+			if (op == bpfDIV || op == bpfMOD) && ins.Code&bpfX == 0 && ins.K == 0 {
+				return fmt.Errorf("division by zero at %d", pc)
+			}
+		case bpfJMP:
+			next := pc + 1
+
+			if ins.Code&0xf0 == bpfJA {
+				if uint64(next)+uint64(ins.K) >= uint64(len(prog)) {
+					return fmt.Errorf("invalid jump at %d", pc)
+				}
+			} else if next+int(ins.Jt) >= len(prog) || next+int(ins.Jf) >= len(prog) {
+				return fmt.Errorf("invalid jump at %d", pc)
+			}
+		}
+	}
+
+	if prog[len(prog)-1].Code&0x07 != bpfRET {
+		return errors.New("program does not end with a return")
+	}
+
+	return nil
+}
+
+// bpfLoad reads a word, half-word or byte from the frame, false is returned on
+// out of bounds access.
+func bpfLoad(buf []byte, off uint32, size uint16) (val uint32, ok bool) {
+	n := uint32(4)
+
+	switch size {
+	case bpfH:
+		n = 2
+	case bpfB:
+		n = 1
+	}
+
+	if uint64(off)+uint64(n) > uint64(len(buf)) {
+		return
+	}
+
+	switch n {
+	case 4:
+		val = binary.BigEndian.Uint32(buf[off:])
+	case 2:
+		val = uint32(binary.BigEndian.Uint16(buf[off:]))
+	default:
+		val = uint32(buf[off])
+	}
+
+	return val, true
+}
+
+// runBPF executes a validated classic BPF program against a frame and
+// returns its result, out of bounds packet accesses terminate the program
+// with a zero result.
+func runBPF(prog []BPFInstruction, buf []byte) uint32 {
+	var a, x uint32
+	var mem [bpfMemWords]uint32
+	var ok bool
+
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+
+		switch ins.Code & 0x07 {
+		case bpfLD:
+			switch ins.Code & 0xe0 {
+			case bpfIMM:
+				a = ins.K
+			case bpfABS:
+				if a, ok = bpfLoad(buf, ins.K, ins.Code&0x18); !ok {
+					return 0
+				}
+			case bpfIND:
+				if a, ok = bpfLoad(buf, x+ins.K, ins.Code&0x18); !ok {
+					return 0
+				}
+			case bpfMEM:
+				a = mem[ins.K]
+			case bpfLEN:
+				a = uint32(len(buf))
+			default:
+				return 0
+			}
+		case bpfLDX:
+			switch ins.Code & 0xe0 {
+			case bpfIMM:
+				x = ins.K
+			case bpfMEM:
+				x = mem[ins.K]
+			case bpfLEN:
+				x = uint32(len(buf))
+			case bpfMSH:
+				b, ok := bpfLoad(buf, ins.K, bpfB)
+
+				if !ok {
+					return 0
+				}
+
+				x = (b & 0x0f) << 2
+			default:
+				return 0
+			}
+		case bpfST:
+			mem[ins.K] = a
+		case bpfSTX:
+			mem[ins.K] = x
+		case bpfALU:
+			v := ins.K
+
+			if ins.Code&bpfX != 0 {
+				v = x
+			}
+
+			switch ins.Code & 0xf0 {
+			case bpfADD:
+				a += v
+			case bpfSUB:
+				a -= v
+			case bpfMUL:
+				a *= v
+			case bpfDIV:
+				if v == 0 {
+					return 0
+				}
+
+				a /= v
+			case bpfMOD:
+				if v == 0 {
+					return 0
+				}
+
+				a %= v
+			case bpfOR:
+				a |= v
+			case bpfAND:
+				a &= v
+			case bpfXOR:
+				a ^= v
+			case bpfLSH:
+				a <<= v
+			case bpfRSH:
+				a >>= v
+			case bpfNEG:
+				a = -a
+			default:
+				return 0
+			}
+		case bpfJMP:
+			v := ins.K
+
+			if ins.Code&bpfX != 0 {
+				v = x
+			}
+
+			var cond bool
+
+			switch ins.Code & 0xf0 {
+			case bpfJA:
+				pc += int(ins.K)
+				continue
+			case bpfJEQ:
+				cond = a == v
+			case bpfJGT:
+				cond = a > v
+			case bpfJGE:
+				cond = a >= v
+			case bpfJSET:
+				cond = a&v != 0
+			default:
+				return 0
+			}
+
+			if cond {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfRET:
+			switch ins.Code & 0x18 {
+			case bpfK:
+				return ins.K
+			case bpfA:
+				return a
+			default:
+				return 0
+			}
+		case bpfMISC:
+			if ins.Code&0xf8 == bpfTXA {
+				a = x
+			} else {
+				x = a
+			}
+		}
+	}
+
+	return 0
+}
+
+// BPFMatch returns a receive filter match function (see RxFilter) which
+// executes a classic BPF program against each frame: frames accepted by the
+// program (non-zero result) are given the argument action, all others are
+// passed.
+//
+// Programs are compatible with those attached to Linux sockets (e.g. `tcpdump
+// -dd` output), Linux specific ancillary loads are not supported.
+func BPFMatch(prog []BPFInstruction, action FilterAction) (match func([]byte) FilterAction, err error) {
+	if err = validateBPF(prog); err != nil {
+		return
+	}
+
+	p := make([]BPFInstruction, len(prog))
+	copy(p, prog)
+
+	match = func(buf []byte) FilterAction {
+		if runBPF(p, buf) != 0 {
+			return action
+		}
+
+		return FilterPass
+	}
+
+	return
+}
@@ -0,0 +1,249 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// bridgeQueueSize is the forwarding queue length of each bridge port.
+const bridgeQueueSize = 64
+
+// ENET receive control register
+const (
+	enetRCR     = 0x0084
+	enetRCRPROM = 3
+)
+
+// BridgeStats represents the forwarding counters of a bridge port.
+type BridgeStats struct {
+	// Frames is the number of frames forwarded out of the port.
+	Frames uint64
+	// Bytes is the number of bytes forwarded out of the port.
+	Bytes uint64
+	// Dropped is the number of frames dropped as the port forwarding
+	// queue was full.
+	Dropped uint64
+}
+
+type bridgePort struct {
+	dev   *enet.ENET
+	tx    func(buf []byte)
+	queue chan []byte
+
+	frames  uint64
+	bytes   uint64
+	dropped uint64
+}
+
+func (port *bridgePort) forward(buf []byte) {
+	select {
+	case port.queue <- buf:
+	default:
+		atomic.AddUint64(&port.dropped, 1)
+	}
+}
+
+// start transmits forwarded frames until the argument channel is closed,
+// frames still queued are then discarded.
+func (port *bridgePort) start(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case buf := <-port.queue:
+			port.tx(buf)
+
+			atomic.AddUint64(&port.frames, 1)
+			atomic.AddUint64(&port.bytes, uint64(len(buf)))
+		}
+	}
+}
+
+func (port *bridgePort) stats() BridgeStats {
+	return BridgeStats{
+		Frames:  atomic.LoadUint64(&port.frames),
+		Bytes:   atomic.LoadUint64(&port.bytes),
+		Dropped: atomic.LoadUint64(&port.dropped),
+	}
+}
+
+type bridge struct {
+	sync.RWMutex
+
+	ports [2]*bridgePort
+	nic   *NIC
+
+	// closed on bridge shutdown
+	done chan struct{}
+	// port forwarding goroutines
+	wg sync.WaitGroup
+}
+
+// start starts the forwarding goroutine of each port.
+func (br *bridge) start() {
+	br.done = make(chan struct{})
+
+	for _, port := range br.ports {
+		br.wg.Add(1)
+
+		go func(port *bridgePort) {
+			defer br.wg.Done()
+			port.start(br.done)
+		}(port)
+	}
+}
+
+// close stops the port forwarding goroutines, waiting for them to return,
+// and closes the port queues.
+func (br *bridge) close() {
+	br.Lock()
+	defer br.Unlock()
+
+	select {
+	case <-br.done:
+		return
+	default:
+	}
+
+	close(br.done)
+	br.wg.Wait()
+
+	for _, port := range br.ports {
+		close(port.queue)
+	}
+}
+
+// rx forwards a frame received on a bridge port out of the other one, frames
+// addressed to the local interface, as well as broadcast and multicast ones,
+// are also passed to the local stack.
+func (br *bridge) rx(buf []byte, out *bridgePort) {
+	if len(buf) < header.EthernetMinimumSize {
+		return
+	}
+
+	br.RLock()
+	defer br.RUnlock()
+
+	select {
+	case <-br.done:
+		return
+	default:
+	}
+
+	dst := buf[0:6]
+	local := bytes.Equal(dst, br.nic.MAC)
+
+	if !local {
+		out.forward(buf)
+	}
+
+	if local || dst[0]&0x01 != 0 {
+		br.nic.Rx(buf)
+	}
+}
+
+type bridgeNotification struct {
+	br *bridge
+}
+
+func (n *bridgeNotification) WriteNotify() {
+	for buf := n.br.nic.Tx(); len(buf) > 0; buf = n.br.nic.next() {
+		for _, port := range n.br.ports {
+			port.tx(buf)
+		}
+	}
+}
+
+// Bridge initializes a transparent layer 2 bridge between two Ethernet
+// devices, along with a local interface configured with the argument
+// options.
+//
+// Frames received on either device are forwarded out of the other one,
+// through a bounded queue, while frames addressed to the local interface, as
+// well as broadcast and multicast ones, are also passed to the local stack.
+// Frames transmitted by the local stack are sent out of both devices.
+//
+// The devices are initialized with the local hardware address, in
+// promiscuous mode, the caller is responsible for starting them (see
+// enet.ENET.Start()). Closing the interface stops forwarding.
+func Bridge(nicA, nicB *enet.ENET, localOpts Options) (iface *Interface, err error) {
+	if nicA == nil || nicB == nil || nicA == nicB {
+		return nil, errors.New("invalid bridge ports")
+	}
+
+	if iface, err = InitWithOptions(nil, 1, &localOpts); err != nil {
+		return
+	}
+
+	br := &bridge{
+		nic: iface.NIC,
+	}
+
+	for i, dev := range []*enet.ENET{nicA, nicB} {
+		br.ports[i] = &bridgePort{
+			dev:   dev,
+			tx:    dev.Tx,
+			queue: make(chan []byte, bridgeQueueSize),
+		}
+	}
+
+	for i, port := range br.ports {
+		out := br.ports[1-i]
+
+		port.dev.MAC = iface.NIC.MAC
+		port.dev.RxHandler = func(buf []byte) {
+			br.rx(buf, out)
+		}
+		port.dev.Init()
+
+		promiscuous(port.dev)
+	}
+
+	br.start()
+
+	iface.Link.AddNotify(&bridgeNotification{
+		br: br,
+	})
+
+	iface.bridge = br
+
+	return
+}
+
+// promiscuous enables reception of all frames, regardless of their
+// destination address, on a physical device.
+func promiscuous(dev *enet.ENET) {
+	dev.Lock()
+	defer dev.Unlock()
+
+	rcr := dev.Base + enetRCR
+	writeRegister(rcr, readRegister(rcr)|1<<enetRCRPROM)
+}
+
+// BridgeStats returns the forwarding counters of both ports of a bridge
+// interface (see Bridge()), nil is returned for all other interfaces.
+func (iface *Interface) BridgeStats() (stats []BridgeStats) {
+	if iface.bridge == nil {
+		return
+	}
+
+	for _, port := range iface.bridge.ports {
+		stats = append(stats, port.stats())
+	}
+
+	return
+}
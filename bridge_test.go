@@ -0,0 +1,95 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+)
+
+// testBridge links two interfaces through a bridge with the argument local
+// interface, bridge ports transmit directly to the linked interfaces.
+func testBridge(t *testing.T, local *Interface, a *Interface, b *Interface) *bridge {
+	br := &bridge{
+		nic: local.NIC,
+	}
+
+	for i, host := range []*Interface{a, b} {
+		br.ports[i] = &bridgePort{
+			tx:    host.NIC.Rx,
+			queue: make(chan []byte, bridgeQueueSize),
+		}
+	}
+
+	br.start()
+
+	// forwarding stops once the wires are stopped and before the
+	// interfaces are closed
+	t.Cleanup(br.close)
+
+	local.Link.AddNotify(&bridgeNotification{br: br})
+
+	wire(t, a, func(buf []byte) { br.rx(buf, br.ports[1]) })
+	wire(t, b, func(buf []byte) { br.rx(buf, br.ports[0]) })
+
+	return br
+}
+
+func TestBridgeForwarding(t *testing.T) {
+	a := testInterface(t, testOptions(1))
+	b := testInterface(t, testOptions(2))
+	local := testInterface(t, testOptions(3))
+
+	// frames addressed to the local interface must not be forwarded
+	var leaked uint32
+
+	b.OnRxFrame(func(_ FrameInfo, buf []byte) {
+		if len(buf) >= 6 && bytes.Equal(buf[0:6], local.NIC.MAC) {
+			atomic.AddUint32(&leaked, 1)
+		}
+	})
+
+	br := testBridge(t, local, a, b)
+
+	// forwarded and locally delivered traffic
+	for _, dst := range []struct {
+		iface *Interface
+		addr  string
+	}{
+		{b, "10.0.0.2:7"},
+		{local, "10.0.0.3:7"},
+	} {
+		server, err := dst.iface.ListenUDP("udp4", dst.addr)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		client, err := a.DialUDP4("", dst.addr)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		testEcho(t, client, server)
+	}
+
+	for i, port := range br.ports {
+		if stats := port.stats(); stats.Frames == 0 || stats.Bytes == 0 {
+			t.Errorf("no frames forwarded out of port %d", i)
+		}
+	}
+
+	if n := atomic.LoadUint32(&leaked); n > 0 {
+		t.Errorf("%d local frames forwarded", n)
+	}
+}
@@ -0,0 +1,275 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+)
+
+// Capture file formats
+const (
+	// PCAP selects the libpcap file format.
+	PCAP = iota
+	// PCAPNG selects the pcapng file format.
+	PCAPNG
+)
+
+// pcap/pcapng constants
+const (
+	pcapMagic      = 0xa1b2c3d4
+	pcapLinkTypeEN = 1 // LINKTYPE_ETHERNET
+
+	pcapngSectionHeaderBlock        = 0x0a0d0d0a
+	pcapngInterfaceDescriptionBlock = 0x00000001
+	pcapngEnhancedPacketBlock       = 0x00000006
+	pcapngByteOrderMagic            = 0x1a2b3c4d
+	pcapngOptionEnd                 = 0
+	pcapngOptionIfTsResol           = 9
+	pcapngOptionEpbFlags            = 2
+)
+
+// Capture represents a packet capture configuration, frames received and
+// transmitted by the interface are written to Writer, one record for each
+// Write() invocation, in either PCAP or PCAPNG format with Ethernet link
+// type.
+type Capture struct {
+	// Writer is the capture destination (e.g. a file, a TCP connection or
+	// a CaptureRing).
+	Writer io.Writer
+	// Format is the capture file format (PCAP or PCAPNG).
+	Format int
+	// SnapLen is the maximum captured length of each frame, 0 captures
+	// frames in full.
+	SnapLen uint32
+}
+
+type capture struct {
+	sync.Mutex
+
+	cfg *Capture
+}
+
+// header returns the capture file header.
+func (c *Capture) header() []byte {
+	if c.Format == PCAPNG {
+		shb := make([]byte, 28)
+		binary.LittleEndian.PutUint32(shb[0:], pcapngSectionHeaderBlock)
+		binary.LittleEndian.PutUint32(shb[4:], uint32(len(shb)))
+		binary.LittleEndian.PutUint32(shb[8:], pcapngByteOrderMagic)
+		binary.LittleEndian.PutUint16(shb[12:], 1)
+		binary.LittleEndian.PutUint16(shb[14:], 0)
+		// unspecified section length
+		binary.LittleEndian.PutUint64(shb[16:], ^uint64(0))
+		binary.LittleEndian.PutUint32(shb[24:], uint32(len(shb)))
+
+		idb := make([]byte, 32)
+		binary.LittleEndian.PutUint32(idb[0:], pcapngInterfaceDescriptionBlock)
+		binary.LittleEndian.PutUint32(idb[4:], uint32(len(idb)))
+		binary.LittleEndian.PutUint16(idb[8:], pcapLinkTypeEN)
+		binary.LittleEndian.PutUint32(idb[12:], c.SnapLen)
+		// if_tsresol: microseconds
+		binary.LittleEndian.PutUint16(idb[16:], pcapngOptionIfTsResol)
+		binary.LittleEndian.PutUint16(idb[18:], 1)
+		idb[20] = 6
+		binary.LittleEndian.PutUint16(idb[24:], pcapngOptionEnd)
+		binary.LittleEndian.PutUint32(idb[28:], uint32(len(idb)))
+
+		return append(shb, idb...)
+	}
+
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], c.SnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], pcapLinkTypeEN)
+
+	return hdr
+}
+
+// record returns the capture record for a frame.
+func (c *Capture) record(buf []byte, t time.Time, tx bool) (rec []byte) {
+	n := uint32(len(buf))
+
+	if n > c.SnapLen {
+		buf = buf[:c.SnapLen]
+	}
+
+	us := uint64(t.UnixNano() / 1000)
+
+	if c.Format == PCAPNG {
+		pad := (4 - len(buf)%4) % 4
+		size := 28 + len(buf) + pad + 12 + 4
+
+		rec = make([]byte, size)
+		binary.LittleEndian.PutUint32(rec[0:], pcapngEnhancedPacketBlock)
+		binary.LittleEndian.PutUint32(rec[4:], uint32(size))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(us>>32))
+		binary.LittleEndian.PutUint32(rec[16:], uint32(us))
+		binary.LittleEndian.PutUint32(rec[20:], uint32(len(buf)))
+		binary.LittleEndian.PutUint32(rec[24:], n)
+		copy(rec[28:], buf)
+
+		// epb_flags: inbound (1) or outbound (2) direction
+		opt := rec[28+len(buf)+pad:]
+		binary.LittleEndian.PutUint16(opt[0:], pcapngOptionEpbFlags)
+		binary.LittleEndian.PutUint16(opt[2:], 4)
+
+		if tx {
+			binary.LittleEndian.PutUint32(opt[4:], 2)
+		} else {
+			binary.LittleEndian.PutUint32(opt[4:], 1)
+		}
+
+		binary.LittleEndian.PutUint32(rec[size-4:], uint32(size))
+
+		return
+	}
+
+	rec = make([]byte, 16+len(buf))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(us/1e6))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(us%1e6))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(buf)))
+	binary.LittleEndian.PutUint32(rec[12:], n)
+	copy(rec[16:], buf)
+
+	return
+}
+
+// write records a frame, capture is stopped on writer errors.
+func (c *capture) write(buf []byte, tx bool) {
+	if len(buf) == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.cfg == nil {
+		return
+	}
+
+	if _, err := c.cfg.Writer.Write(c.cfg.record(buf, time.Now(), tx)); err != nil {
+		c.cfg = nil
+	}
+}
+
+// StartCapture starts capturing frames received and transmitted by the
+// interface (see Capture), replacing any running capture.
+//
+// Frames are captured as seen by the interface: VLAN sub-interfaces capture
+// untagged frames while their parent captures tagged ones. As frames are
+// written synchronously, slow writers affect interface throughput.
+func (iface *Interface) StartCapture(c Capture) (err error) {
+	if c.Writer == nil {
+		return errors.New("missing writer")
+	}
+
+	if c.Format != PCAP && c.Format != PCAPNG {
+		return errors.New("invalid format")
+	}
+
+	if c.SnapLen == 0 {
+		c.SnapLen = enet.MTU
+	}
+
+	iface.NIC.capture.Lock()
+	defer iface.NIC.capture.Unlock()
+
+	if _, err = c.Writer.Write(c.header()); err != nil {
+		return
+	}
+
+	iface.NIC.capture.cfg = &c
+
+	return
+}
+
+// StopCapture stops the running capture, if any.
+func (iface *Interface) StopCapture() {
+	iface.NIC.capture.Lock()
+	defer iface.NIC.capture.Unlock()
+
+	iface.NIC.capture.cfg = nil
+}
+
+// CaptureRing implements an io.Writer retaining, besides the capture file
+// header, only the most recent capture records within a fixed size, for
+// continuous capture with on-demand retrieval.
+type CaptureRing struct {
+	sync.Mutex
+
+	size    int
+	used    int
+	header  []byte
+	records [][]byte
+}
+
+// NewCaptureRing returns a capture ring retaining up to size bytes of
+// records.
+func NewCaptureRing(size int) *CaptureRing {
+	return &CaptureRing{
+		size: size,
+	}
+}
+
+// Write implements io.Writer, the first write is retained as capture file
+// header while subsequent ones are treated as records.
+func (r *CaptureRing) Write(buf []byte) (n int, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	rec := make([]byte, len(buf))
+	copy(rec, buf)
+
+	if r.header == nil {
+		r.header = rec
+		return len(buf), nil
+	}
+
+	if len(rec) > r.size {
+		return len(buf), nil
+	}
+
+	for r.used+len(rec) > r.size {
+		r.used -= len(r.records[0])
+		r.records = r.records[1:]
+	}
+
+	r.records = append(r.records, rec)
+	r.used += len(rec)
+
+	return len(buf), nil
+}
+
+// WriteTo implements io.WriterTo, writing a valid capture file with the
+// retained records.
+func (r *CaptureRing) WriteTo(w io.Writer) (n int64, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, buf := range append([][]byte{r.header}, r.records...) {
+		var c int
+
+		c, err = w.Write(buf)
+		n += int64(c)
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,174 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+)
+
+// ENET checksum acceleration registers
+const (
+	enetECREn1588 = 5
+
+	enetTFWR       = 0x0144
+	enetTFWRStrFwd = 8
+
+	enetTACC       = 0x01c0
+	enetTACCProChk = 4
+
+	enetRACC       = 0x01c4
+	enetRACCIPDis  = 1
+	enetRACCProDis = 2
+)
+
+// checksumOffloadCapabilities are the link endpoint capabilities advertised
+// when checksum offload is enabled.
+const checksumOffloadCapabilities = stack.CapabilityTXChecksumOffload | stack.CapabilityRXChecksumOffload
+
+// enhancedDescriptors returns whether a physical device uses enhanced buffer
+// descriptors, which carry the protocol and IP header checksum insertion
+// flags (PINS, IINS) the accelerator requires to act on transmitted frames.
+func enhancedDescriptors(dev *enet.ENET) bool {
+	dev.Lock()
+	defer dev.Unlock()
+
+	return readRegister(dev.Base+enetECR)&(1<<enetECREn1588) != 0
+}
+
+// enableChecksumOffload configures the ENET checksum accelerator: received
+// frames with invalid IPv4 header or TCP/UDP/ICMP checksums are discarded,
+// while transmitted ones get their protocol checksum inserted.
+//
+// As the stack always computes the IPv4 header checksum, which the
+// accelerator requires to be cleared, only protocol checksum insertion is
+// enabled. Insertion requires store and forward transmission.
+func enableChecksumOffload(dev *enet.ENET) {
+	dev.Lock()
+	defer dev.Unlock()
+
+	writeRegister(dev.Base+enetTFWR, readRegister(dev.Base+enetTFWR)|1<<enetTFWRStrFwd)
+	writeRegister(dev.Base+enetTACC, readRegister(dev.Base+enetTACC)|1<<enetTACCProChk)
+	writeRegister(dev.Base+enetRACC, readRegister(dev.Base+enetRACC)|1<<enetRACCIPDis|1<<enetRACCProDis)
+}
+
+// offloadChecksum clears the protocol checksum field of outgoing TCP, UDP
+// and ICMP packets, as required by the ENET accelerator for its insertion.
+// Fragmented packets are left untouched as the accelerator ignores them.
+//
+// The stack leaves TCP and UDP checksums empty when offloaded, clearing is
+// required for ICMP and for packets built outside the transport endpoints
+// (e.g. DHCP). IPv6 packets with extension headers, which the accelerator
+// does not parse, get their checksum computed in software instead.
+func offloadChecksum(buf []byte) {
+	if len(buf) <= header.EthernetMinimumSize {
+		return
+	}
+
+	var payload []byte
+	var transport uint8
+
+	pkt := buf[header.EthernetMinimumSize:]
+
+	switch tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(buf[12:14])) {
+	case header.IPv4ProtocolNumber:
+		ip := header.IPv4(pkt)
+
+		if !ip.IsValid(len(pkt)) || ip.More() || ip.FragmentOffset() != 0 {
+			return
+		}
+
+		payload = pkt[ip.HeaderLength():ip.TotalLength()]
+		transport = ip.Protocol()
+	case header.IPv6ProtocolNumber:
+		ip := header.IPv6(pkt)
+
+		if !ip.IsValid(len(pkt)) {
+			return
+		}
+
+		if isExtensionHeader(ip.NextHeader()) {
+			fillChecksum(ip)
+			return
+		}
+
+		payload = ip.Payload()
+		transport = ip.NextHeader()
+	default:
+		return
+	}
+
+	switch {
+	case transport == uint8(header.TCPProtocolNumber) && len(payload) >= header.TCPMinimumSize:
+		header.TCP(payload).SetChecksum(0)
+	case transport == uint8(header.UDPProtocolNumber) && len(payload) >= header.UDPMinimumSize:
+		header.UDP(payload).SetChecksum(0)
+	case transport == uint8(header.ICMPv4ProtocolNumber) && len(payload) >= header.ICMPv4MinimumSize:
+		header.ICMPv4(payload).SetChecksum(0)
+	case transport == uint8(header.ICMPv6ProtocolNumber) && len(payload) >= header.ICMPv6MinimumSize:
+		header.ICMPv6(payload).SetChecksum(0)
+	}
+}
+
+func isExtensionHeader(next uint8) bool {
+	switch header.IPv6ExtensionHeaderIdentifier(next) {
+	case header.IPv6HopByHopOptionsExtHdrIdentifier, header.IPv6RoutingExtHdrIdentifier,
+		header.IPv6FragmentExtHdrIdentifier, header.IPv6DestinationOptionsExtHdrIdentifier:
+		return true
+	}
+
+	return false
+}
+
+// fillChecksum computes the TCP or UDP checksum of an IPv6 packet with
+// extension headers, fragmented packets are left untouched.
+func fillChecksum(ip header.IPv6) {
+	next := ip.NextHeader()
+	payload := ip.Payload()
+
+	for isExtensionHeader(next) {
+		if header.IPv6ExtensionHeaderIdentifier(next) == header.IPv6FragmentExtHdrIdentifier || len(payload) < 8 {
+			return
+		}
+
+		n := (int(payload[1]) + 1) * 8
+
+		if len(payload) < n {
+			return
+		}
+
+		next = payload[0]
+		payload = payload[n:]
+	}
+
+	proto := tcpip.TransportProtocolNumber(next)
+	xsum := header.PseudoHeaderChecksum(proto, ip.SourceAddress(), ip.DestinationAddress(), uint16(len(payload)))
+
+	switch {
+	case proto == header.TCPProtocolNumber && len(payload) >= header.TCPMinimumSize:
+		tcp := header.TCP(payload)
+		tcp.SetChecksum(0)
+		tcp.SetChecksum(^checksum.Checksum(payload, xsum))
+	case proto == header.UDPProtocolNumber && len(payload) >= header.UDPMinimumSize:
+		udp := header.UDP(payload)
+		udp.SetChecksum(0)
+
+		if xsum = ^checksum.Checksum(payload, xsum); xsum == 0 {
+			xsum = 0xffff
+		}
+
+		udp.SetChecksum(xsum)
+	}
+}
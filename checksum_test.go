@@ -0,0 +1,91 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// testUDP6Frame returns an Ethernet frame carrying an IPv6 UDP datagram,
+// with the argument checksum, optionally preceded by an empty Hop-by-Hop
+// Options extension header.
+func testUDP6Frame(hopByHop bool, xsum uint16) []byte {
+	payload := []byte("ping")
+	ext := 0
+	next := uint8(header.UDPProtocolNumber)
+
+	if hopByHop {
+		ext = 8
+		next = uint8(header.IPv6HopByHopOptionsExtHdrIdentifier)
+	}
+
+	udpLen := header.UDPMinimumSize + len(payload)
+	buf := make([]byte, header.EthernetMinimumSize+header.IPv6MinimumSize+ext+udpLen)
+	binary.BigEndian.PutUint16(buf[12:14], uint16(header.IPv6ProtocolNumber))
+
+	ip := header.IPv6(buf[header.EthernetMinimumSize:])
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength:     uint16(ext + udpLen),
+		TransportProtocol: tcpip.TransportProtocolNumber(next),
+		HopLimit:          64,
+		SrcAddr:           testAddress("fd00::1"),
+		DstAddr:           testAddress("fd00::2"),
+	})
+
+	opts := ip.Payload()
+
+	if hopByHop {
+		// next header and PadN option
+		copy(opts, []byte{uint8(header.UDPProtocolNumber), 0, 1, 4})
+	}
+
+	udp := header.UDP(opts[ext:])
+	udp.Encode(&header.UDPFields{
+		SrcPort:  1000,
+		DstPort:  7,
+		Length:   uint16(udpLen),
+		Checksum: xsum,
+	})
+	copy(udp.Payload(), payload)
+
+	return buf
+}
+
+func TestOffloadChecksum(t *testing.T) {
+	// the accelerator inserts checksums of packets without extension
+	// headers, which must be cleared
+	buf := testUDP6Frame(false, 0x1234)
+	offloadChecksum(buf)
+
+	if xsum := header.UDP(buf[len(buf)-header.UDPMinimumSize-4:]).Checksum(); xsum != 0 {
+		t.Errorf("checksum not cleared, %#x", xsum)
+	}
+
+	// packets with extension headers are not processed by the accelerator
+	buf = testUDP6Frame(true, 0)
+	offloadChecksum(buf)
+
+	ip := header.IPv6(buf[header.EthernetMinimumSize:])
+	udp := header.UDP(buf[len(buf)-header.UDPMinimumSize-4:])
+
+	if udp.Checksum() == 0 {
+		t.Fatal("checksum not computed")
+	}
+
+	xsum := header.PseudoHeaderChecksum(header.UDPProtocolNumber, ip.SourceAddress(), ip.DestinationAddress(), uint16(len(udp)))
+
+	if checksum.Checksum(udp, xsum) != 0xffff {
+		t.Errorf("invalid checksum %#x", udp.Checksum())
+	}
+}
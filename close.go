@@ -0,0 +1,145 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+)
+
+// ENET control register
+const (
+	enetECR        = 0x0024
+	enetECREtherEn = 1
+)
+
+// sleep pauses for the argument duration, false is returned when the
+// interface is closed in the meantime.
+func (iface *Interface) sleep(d time.Duration) bool {
+	select {
+	case <-iface.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// context returns a context canceled once the interface is closed, the
+// returned function releases it.
+func (iface *Interface) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-iface.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// detach stops reception on a physical device and disables its MAC.
+func detach(dev *enet.ENET) {
+	dev.Lock()
+	defer dev.Unlock()
+
+	dev.RxHandler = nil
+	ecr := dev.Base + enetECR
+	writeRegister(ecr, readRegister(ecr)&^(1<<enetECREtherEn))
+}
+
+// remove detaches a VLAN sub-interface NIC from its parent.
+func (t *vlanTable) remove(nic *NIC) {
+	t.Lock()
+	defer t.Unlock()
+
+	for vid, n := range t.nics {
+		if n == nic {
+			delete(t.nics, vid)
+		}
+	}
+}
+
+func (iface *Interface) close() (err error) {
+	close(iface.done)
+
+	// VLAN sub-interfaces are closed along with their parent
+	iface.NIC.vlans.RLock()
+	nics := iface.NIC.vlans.nics
+	iface.NIC.vlans.RUnlock()
+
+	for _, vlan := range Interfaces() {
+		if vlan == iface {
+			continue
+		}
+
+		for _, nic := range nics {
+			if vlan.NIC == nic {
+				vlan.Close()
+			}
+		}
+
+		vlan.NIC.vlans.remove(iface.NIC)
+	}
+
+	iface.stopLinkLocal()
+
+	if iface.NIC.Device != nil {
+		detach(iface.NIC.Device)
+	}
+
+	if iface.bridge != nil {
+		for _, port := range iface.bridge.ports {
+			detach(port.dev)
+		}
+
+		iface.bridge.close()
+	}
+
+	if iface.GENEVE != nil {
+		iface.GENEVE.parent.geneve.close(iface.GENEVE)
+	}
+
+	if tcpErr := iface.Stack.RemoveNIC(iface.nicid); tcpErr != nil {
+		err = fmt.Errorf("%v", tcpErr)
+	}
+
+	iface.Link.Close()
+	unregister(iface)
+
+	// the stack is released once no interface is using it
+	if !iface.sharedStack() {
+		iface.Stack.Close()
+		iface.Stack.Wait()
+	}
+
+	return
+}
+
+// Close shuts the interface down: background configuration (DHCP, DHCPv6,
+// link-local autoconfiguration) is stopped, the ENET device MAC is disabled
+// and its RxHandler detached, the NIC is removed from the stack and the
+// channel endpoint released. The stack itself is closed, aborting all its
+// endpoints, once no other interface (e.g. VLAN or GENEVE) is using it.
+//
+// VLAN sub-interfaces are closed along with their parent. The device can be
+// re-initialized, with a new interface, afterwards and reception must then be
+// re-activated with enet.ENET.Start().
+func (iface *Interface) Close() (err error) {
+	iface.closeOnce.Do(func() {
+		err = iface.close()
+	})
+
+	return
+}
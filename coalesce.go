@@ -0,0 +1,112 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"time"
+)
+
+// ENET interrupt coalescing registers
+const (
+	enetTXIC0 = 0x00f0
+	enetRXIC0 = 0x0100
+
+	enetICEN = 31
+	enetICCS = 30
+	enetICFT = 20
+	enetICTT = 0
+
+	// maximum frame count threshold
+	maxCoalescingFrames = 0xff
+	// maximum timer threshold, in units of 64 clock cycles
+	maxCoalescingTimer = 0xffff
+)
+
+// Coalescing represents the ENET interrupt coalescing configuration, the
+// receive (RXF) or transmit (TXF) frame interrupt is raised once either the
+// frame count or the timer threshold, started on the first frame, is
+// reached.
+//
+// A zero frame count disables coalescing for the corresponding direction.
+type Coalescing struct {
+	// RxFrames is the received frames threshold (up to 255).
+	RxFrames int
+	// RxTimeout is the receive timer threshold.
+	RxTimeout time.Duration
+
+	// TxFrames is the transmitted frames threshold (up to 255).
+	TxFrames int
+	// TxTimeout is the transmit timer threshold.
+	TxTimeout time.Duration
+}
+
+// coalescingRegister returns the interrupt coalescing register value for the
+// argument thresholds, clocked by the ENET system clock.
+func coalescingRegister(frames int, timeout time.Duration, rate uint32) (val uint32, err error) {
+	if frames == 0 {
+		return
+	}
+
+	if frames < 0 || frames > maxCoalescingFrames {
+		return 0, errors.New("invalid frame count threshold")
+	}
+
+	timer := uint64(timeout) * uint64(rate) / 64 / uint64(time.Second)
+
+	switch {
+	case timeout <= 0:
+		return 0, errors.New("invalid timer threshold")
+	case timer > maxCoalescingTimer:
+		return 0, errors.New("timer threshold too large")
+	case timer == 0:
+		timer = 1
+	}
+
+	return 1<<enetICEN | 1<<enetICCS | uint32(frames)<<enetICFT | uint32(timer)<<enetICTT, nil
+}
+
+// SetCoalescing configures the ENET interrupt coalescing (see Coalescing).
+//
+// Coalescing affects the assertion of ENET frame interrupts, it is therefore
+// only relevant to applications servicing them rather than polling the
+// device (e.g. enet.ENET.Start()).
+func (eth *NIC) SetCoalescing(c Coalescing) (err error) {
+	dev := eth.Device
+
+	if dev == nil {
+		return errors.New("missing physical interface")
+	}
+
+	if dev.Clock == nil {
+		return errors.New("missing clock retrieval function")
+	}
+
+	rate := dev.Clock()
+
+	rx, err := coalescingRegister(c.RxFrames, c.RxTimeout, rate)
+
+	if err != nil {
+		return
+	}
+
+	tx, err := coalescingRegister(c.TxFrames, c.TxTimeout, rate)
+
+	if err != nil {
+		return
+	}
+
+	dev.Lock()
+	defer dev.Unlock()
+
+	writeRegister(dev.Base+enetRXIC0, rx)
+	writeRegister(dev.Base+enetTXIC0, tx)
+
+	return
+}
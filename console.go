@@ -0,0 +1,257 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Network console defaults
+const (
+	// DefaultNetConsolePort is the default network console TCP port.
+	DefaultNetConsolePort = 23
+	// DefaultNetConsoleBacklog is the default amount of console output,
+	// in bytes, replayed to newly connected clients.
+	DefaultNetConsoleBacklog = 4096
+	// DefaultNetConsoleClients is the default maximum number of connected
+	// clients.
+	DefaultNetConsoleClients = 4
+
+	// per-client pending writes
+	netConsoleQueueLength = 64
+	// per-client write timeout, slower clients are disconnected
+	netConsoleWriteTimeout = 5 * time.Second
+)
+
+// NetConsoleOptions represents network console configuration options.
+type NetConsoleOptions struct {
+	// Port is the listening TCP port, 0 selects DefaultNetConsolePort.
+	Port uint16
+	// Backlog is the amount of console output, in bytes, replayed to
+	// newly connected clients, 0 selects DefaultNetConsoleBacklog while a
+	// negative value disables replay.
+	Backlog int
+	// MaxClients is the maximum number of connected clients, 0 selects
+	// DefaultNetConsoleClients.
+	MaxClients int
+
+	// Handler, when not nil, is invoked for each client connection to
+	// serve an interactive command channel, it must return once the
+	// connection is closed. Client input is otherwise discarded.
+	Handler func(conn net.Conn)
+}
+
+// NetConsole represents a network console, mirroring output written to it
+// to all connected TCP clients. It implements io.Writer and is meant to be
+// combined with the serial console, for instance:
+//
+//	log.SetOutput(io.MultiWriter(os.Stdout, console))
+//
+// Writes never block, output is dropped for clients unable to keep up.
+type NetConsole struct {
+	sync.Mutex
+
+	opts     NetConsoleOptions
+	listener net.Listener
+
+	backlog []byte
+	clients map[*netConsoleClient]bool
+
+	done chan struct{}
+	once sync.Once
+}
+
+type netConsoleClient struct {
+	conn net.Conn
+	out  chan []byte
+	once sync.Once
+}
+
+func (c *netConsoleClient) close() {
+	c.once.Do(func() {
+		c.conn.Close()
+		close(c.out)
+	})
+}
+
+// StartNetConsole starts a network console listening on the interface IPv4
+// address, or on any when none is configured yet.
+func (iface *Interface) StartNetConsole(opts NetConsoleOptions) (c *NetConsole, err error) {
+	if opts.Port == 0 {
+		opts.Port = DefaultNetConsolePort
+	}
+
+	if opts.Backlog == 0 {
+		opts.Backlog = DefaultNetConsoleBacklog
+	}
+
+	if opts.MaxClients == 0 {
+		opts.MaxClients = DefaultNetConsoleClients
+	}
+
+	if opts.MaxClients < 0 {
+		return nil, errors.New("invalid maximum number of clients")
+	}
+
+	l, err := iface.ListenerTCPWithOptions(ListenerOptions{
+		Port:     opts.Port,
+		Wildcard: len(iface.address.Address) == 0,
+	})
+
+	if err != nil {
+		return
+	}
+
+	c = &NetConsole{
+		opts:     opts,
+		listener: l,
+		clients:  make(map[*netConsoleClient]bool),
+		done:     make(chan struct{}),
+	}
+
+	go c.serve()
+
+	return
+}
+
+func (c *NetConsole) serve() {
+	for {
+		conn, err := c.listener.Accept()
+
+		if err != nil {
+			select {
+			case <-c.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		c.add(conn)
+	}
+}
+
+func (c *NetConsole) add(conn net.Conn) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.clients) >= c.opts.MaxClients {
+		conn.Close()
+		return
+	}
+
+	client := &netConsoleClient{
+		conn: conn,
+		out:  make(chan []byte, netConsoleQueueLength),
+	}
+
+	if len(c.backlog) > 0 {
+		client.out <- append([]byte{}, c.backlog...)
+	}
+
+	c.clients[client] = true
+
+	go c.output(client)
+	go c.input(client)
+}
+
+func (c *NetConsole) remove(client *netConsoleClient) {
+	c.Lock()
+	delete(c.clients, client)
+	c.Unlock()
+
+	client.close()
+}
+
+// output writes console output to a client.
+func (c *NetConsole) output(client *netConsoleClient) {
+	for buf := range client.out {
+		client.conn.SetWriteDeadline(time.Now().Add(netConsoleWriteTimeout))
+
+		if _, err := client.conn.Write(buf); err != nil {
+			c.remove(client)
+		}
+	}
+}
+
+// input serves, or discards, client input until disconnection.
+func (c *NetConsole) input(client *netConsoleClient) {
+	defer c.remove(client)
+
+	if c.opts.Handler != nil {
+		c.opts.Handler(client.conn)
+		return
+	}
+
+	io.Copy(io.Discard, client.conn)
+}
+
+// Write mirrors console output to all connected clients, it implements
+// io.Writer.
+func (c *NetConsole) Write(p []byte) (n int, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.opts.Backlog > 0 {
+		c.backlog = append(c.backlog, p...)
+
+		if over := len(c.backlog) - c.opts.Backlog; over > 0 {
+			c.backlog = append(c.backlog[:0], c.backlog[over:]...)
+		}
+	}
+
+	if len(c.clients) == 0 {
+		return len(p), nil
+	}
+
+	buf := append([]byte{}, p...)
+
+	for client := range c.clients {
+		select {
+		case client.out <- buf:
+		default:
+		}
+	}
+
+	return len(p), nil
+}
+
+// Clients returns the remote addresses of connected clients.
+func (c *NetConsole) Clients() (addrs []net.Addr) {
+	c.Lock()
+	defer c.Unlock()
+
+	for client := range c.clients {
+		addrs = append(addrs, client.conn.RemoteAddr())
+	}
+
+	return
+}
+
+// Close stops the network console and disconnects all clients.
+func (c *NetConsole) Close() (err error) {
+	c.once.Do(func() {
+		close(c.done)
+		err = c.listener.Close()
+
+		c.Lock()
+		defer c.Unlock()
+
+		for client := range c.clients {
+			delete(c.clients, client)
+			client.close()
+		}
+	})
+
+	return
+}
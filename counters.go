@@ -0,0 +1,245 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+)
+
+// ENET MIB control register
+const (
+	enetMIBC        = 0x0064
+	enetMIBCDisable = 31
+)
+
+// ENET MIB block counters (RMON and IEEE 802.3 statistics)
+const (
+	enetMIBStart = 0x0200
+	enetMIBEnd   = 0x02e4
+
+	enetRMON_T_PACKETS   = 0x0204
+	enetRMON_T_BC_PKT    = 0x0208
+	enetRMON_T_MC_PKT    = 0x020c
+	enetRMON_T_CRC_ALIGN = 0x0210
+	enetRMON_T_UNDERSIZE = 0x0214
+	enetRMON_T_OVERSIZE  = 0x0218
+	enetRMON_T_FRAG      = 0x021c
+	enetRMON_T_JAB       = 0x0220
+	enetRMON_T_COL       = 0x0224
+	enetRMON_T_OCTETS    = 0x0244
+	enetIEEE_T_FRAME_OK  = 0x024c
+	enetIEEE_T_1COL      = 0x0250
+	enetIEEE_T_MCOL      = 0x0254
+	enetIEEE_T_DEF       = 0x0258
+	enetIEEE_T_LCOL      = 0x025c
+	enetIEEE_T_EXCOL     = 0x0260
+	enetIEEE_T_MACERR    = 0x0264
+	enetIEEE_T_CSERR     = 0x0268
+	enetIEEE_T_FDXFC     = 0x0270
+	enetRMON_R_PACKETS   = 0x0284
+	enetRMON_R_BC_PKT    = 0x0288
+	enetRMON_R_MC_PKT    = 0x028c
+	enetRMON_R_CRC_ALIGN = 0x0290
+	enetRMON_R_UNDERSIZE = 0x0294
+	enetRMON_R_OVERSIZE  = 0x0298
+	enetRMON_R_FRAG      = 0x029c
+	enetRMON_R_JAB       = 0x02a0
+	enetRMON_R_OCTETS    = 0x02c4
+	enetIEEE_R_DROP      = 0x02cc
+	enetIEEE_R_FRAME_OK  = 0x02d0
+	enetIEEE_R_CRC       = 0x02d4
+	enetIEEE_R_ALIGN     = 0x02d8
+	enetIEEE_R_MACERR    = 0x02dc
+	enetIEEE_R_FDXFC     = 0x02e0
+)
+
+// Counters represents the ENET hardware statistics (MIB) counters, which
+// account for all frames seen by the MAC, including those discarded before
+// reaching the stack.
+type Counters struct {
+	// TxFrames is the number of transmitted frames.
+	TxFrames uint32
+	// TxFramesOK is the number of frames transmitted successfully.
+	TxFramesOK uint32
+	// TxBroadcast is the number of transmitted broadcast frames.
+	TxBroadcast uint32
+	// TxMulticast is the number of transmitted multicast frames.
+	TxMulticast uint32
+	// TxOctets is the number of transmitted octets.
+	TxOctets uint32
+	// TxCRCAlignErrors is the number of frames transmitted with CRC or
+	// alignment errors.
+	TxCRCAlignErrors uint32
+	// TxUndersize is the number of transmitted frames shorter than 64
+	// bytes with a valid CRC.
+	TxUndersize uint32
+	// TxOversize is the number of transmitted frames longer than the
+	// maximum frame length with a valid CRC.
+	TxOversize uint32
+	// TxFragments is the number of transmitted frames shorter than 64
+	// bytes with an invalid CRC.
+	TxFragments uint32
+	// TxJabbers is the number of transmitted frames longer than the
+	// maximum frame length with an invalid CRC.
+	TxJabbers uint32
+	// TxCollisions is the number of transmit collisions.
+	TxCollisions uint32
+	// TxSingleCollision is the number of frames transmitted after a
+	// single collision.
+	TxSingleCollision uint32
+	// TxMultipleCollisions is the number of frames transmitted after
+	// multiple collisions.
+	TxMultipleCollisions uint32
+	// TxDeferred is the number of frames transmitted after deferral.
+	TxDeferred uint32
+	// TxLateCollisions is the number of late collisions.
+	TxLateCollisions uint32
+	// TxExcessiveCollisions is the number of frames dropped for excessive
+	// collisions.
+	TxExcessiveCollisions uint32
+	// TxFIFOUnderruns is the number of frames dropped for transmit FIFO
+	// underrun.
+	TxFIFOUnderruns uint32
+	// TxCarrierSenseErrors is the number of carrier sense errors.
+	TxCarrierSenseErrors uint32
+	// TxPause is the number of transmitted pause frames.
+	TxPause uint32
+
+	// RxFrames is the number of received frames.
+	RxFrames uint32
+	// RxFramesOK is the number of frames received successfully.
+	RxFramesOK uint32
+	// RxBroadcast is the number of received broadcast frames.
+	RxBroadcast uint32
+	// RxMulticast is the number of received multicast frames.
+	RxMulticast uint32
+	// RxOctets is the number of received octets.
+	RxOctets uint32
+	// RxCRCAlignErrors is the number of frames received with CRC or
+	// alignment errors.
+	RxCRCAlignErrors uint32
+	// RxCRCErrors is the number of frames received with CRC errors.
+	RxCRCErrors uint32
+	// RxAlignErrors is the number of frames received with alignment
+	// errors.
+	RxAlignErrors uint32
+	// RxUndersize is the number of received frames shorter than 64 bytes
+	// with a valid CRC.
+	RxUndersize uint32
+	// RxOversize is the number of received frames longer than the
+	// maximum frame length with a valid CRC.
+	RxOversize uint32
+	// RxFragments is the number of received frames shorter than 64 bytes
+	// with an invalid CRC.
+	RxFragments uint32
+	// RxJabbers is the number of received frames longer than the maximum
+	// frame length with an invalid CRC.
+	RxJabbers uint32
+	// RxDropped is the number of received frames dropped for lack of
+	// receive buffers.
+	RxDropped uint32
+	// RxFIFOOverruns is the number of frames dropped for receive FIFO
+	// overrun.
+	RxFIFOOverruns uint32
+	// RxPause is the number of received pause frames.
+	RxPause uint32
+}
+
+// enableCounters enables the ENET MIB block, which the driver disables on
+// initialization.
+func enableCounters(dev *enet.ENET) {
+	dev.Lock()
+	defer dev.Unlock()
+
+	mibc := dev.Base + enetMIBC
+	writeRegister(mibc, readRegister(mibc)&^(1<<enetMIBCDisable))
+}
+
+// Counters returns the ENET hardware statistics counters.
+func (eth *NIC) Counters() (c Counters, err error) {
+	if eth.Device == nil {
+		return c, errors.New("missing physical interface")
+	}
+
+	r := func(off uint32) uint32 {
+		return readRegister(eth.Device.Base + off)
+	}
+
+	c = Counters{
+		TxFrames:              r(enetRMON_T_PACKETS),
+		TxFramesOK:            r(enetIEEE_T_FRAME_OK),
+		TxBroadcast:           r(enetRMON_T_BC_PKT),
+		TxMulticast:           r(enetRMON_T_MC_PKT),
+		TxOctets:              r(enetRMON_T_OCTETS),
+		TxCRCAlignErrors:      r(enetRMON_T_CRC_ALIGN),
+		TxUndersize:           r(enetRMON_T_UNDERSIZE),
+		TxOversize:            r(enetRMON_T_OVERSIZE),
+		TxFragments:           r(enetRMON_T_FRAG),
+		TxJabbers:             r(enetRMON_T_JAB),
+		TxCollisions:          r(enetRMON_T_COL),
+		TxSingleCollision:     r(enetIEEE_T_1COL),
+		TxMultipleCollisions:  r(enetIEEE_T_MCOL),
+		TxDeferred:            r(enetIEEE_T_DEF),
+		TxLateCollisions:      r(enetIEEE_T_LCOL),
+		TxExcessiveCollisions: r(enetIEEE_T_EXCOL),
+		TxFIFOUnderruns:       r(enetIEEE_T_MACERR),
+		TxCarrierSenseErrors:  r(enetIEEE_T_CSERR),
+		TxPause:               r(enetIEEE_T_FDXFC),
+
+		RxFrames:         r(enetRMON_R_PACKETS),
+		RxFramesOK:       r(enetIEEE_R_FRAME_OK),
+		RxBroadcast:      r(enetRMON_R_BC_PKT),
+		RxMulticast:      r(enetRMON_R_MC_PKT),
+		RxOctets:         r(enetRMON_R_OCTETS),
+		RxCRCAlignErrors: r(enetRMON_R_CRC_ALIGN),
+		RxCRCErrors:      r(enetIEEE_R_CRC),
+		RxAlignErrors:    r(enetIEEE_R_ALIGN),
+		RxUndersize:      r(enetRMON_R_UNDERSIZE),
+		RxOversize:       r(enetRMON_R_OVERSIZE),
+		RxFragments:      r(enetRMON_R_FRAG),
+		RxJabbers:        r(enetRMON_R_JAB),
+		RxDropped:        r(enetIEEE_R_DROP),
+		RxFIFOOverruns:   r(enetIEEE_R_MACERR),
+		RxPause:          r(enetIEEE_R_FDXFC),
+	}
+
+	return
+}
+
+// ClearCounters resets the ENET hardware statistics counters.
+func (eth *NIC) ClearCounters() (err error) {
+	dev := eth.Device
+
+	if dev == nil {
+		return errors.New("missing physical interface")
+	}
+
+	dev.Lock()
+	defer dev.Unlock()
+
+	// counters are writable only while the MIB block is disabled
+	mibc := dev.Base + enetMIBC
+	writeRegister(mibc, readRegister(mibc)|1<<enetMIBCDisable)
+
+	for off := uint32(enetMIBStart); off <= enetMIBEnd; off += 4 {
+		writeRegister(dev.Base+off, 0)
+	}
+
+	writeRegister(mibc, readRegister(mibc)&^(1<<enetMIBCDisable))
+
+	return
+}
+
+// Counters returns the ENET hardware statistics counters (see
+// NIC.Counters()).
+func (iface *Interface) Counters() (Counters, error) {
+	return iface.NIC.Counters()
+}
@@ -0,0 +1,650 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+// DHCP constants (RFC 2131, RFC 2132)
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	dhcpBootRequest = 1
+	dhcpBootReply   = 2
+
+	// fixed fields (RFC 2131 - 2) and magic cookie
+	dhcpHeaderLen = 240
+	dhcpCookie    = 0x63825363
+	dhcpBroadcast = 0x8000
+
+	dhcpOptionSubnetMask      = 1
+	dhcpOptionRouter          = 3
+	dhcpOptionRequestedIP     = 50
+	dhcpOptionLeaseTime       = 51
+	dhcpOptionMessageType     = 53
+	dhcpOptionServerID        = 54
+	dhcpOptionParameterList   = 55
+	dhcpOptionRenewalTime     = 58
+	dhcpOptionRebindingTime   = 59
+	dhcpOptionClientID        = 61
+	dhcpOptionMaxMessageSize  = 57
+	dhcpOptionTFTPServer      = 66
+	dhcpOptionBootFile        = 67
+	dhcpInfiniteLease         = 0xffffffff
+	dhcpDeclineWait           = 10 * time.Second
+	dhcpMinRetransmit         = 4 * time.Second
+	dhcpMaxRetransmit         = 64 * time.Second
+	dhcpMinRenewalRetransmit  = 60 * time.Second
+	dhcpAcquisitionRetryDelay = 10 * time.Second
+)
+
+// DHCP message types (RFC 2132 - 9.6)
+const (
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpDecline  = 4
+	dhcpAck      = 5
+	dhcpNak      = 6
+	dhcpRelease  = 7
+	dhcpInform   = 8
+)
+
+// DHCPLease represents an IPv4 configuration obtained through DHCP.
+type DHCPLease struct {
+	// Address is the leased address.
+	Address tcpip.AddressWithPrefix
+	// Gateway is the default route gateway, if any.
+	Gateway tcpip.Address
+	// Server is the DHCP server identifier.
+	Server tcpip.Address
+
+	// Obtained is the time of the last lease acknowledgment.
+	Obtained time.Time
+	// Duration is the lease duration, zero for infinite leases.
+	Duration time.Duration
+	// Renewal is the renewal (T1) time.
+	Renewal time.Duration
+	// Rebinding is the rebinding (T2) time.
+	Rebinding time.Duration
+
+	// LeaseOptions are the network service options.
+	LeaseOptions
+
+	// NextServer is the boot server address (siaddr), if any.
+	NextServer tcpip.Address
+	// TFTPServer is the boot server name (option 66), if any.
+	TFTPServer string
+	// BootFile is the boot file name (option 67, or file field), if any.
+	BootFile string
+
+	// link address of the server, or relay, for renewals
+	serverMAC tcpip.LinkAddress
+}
+
+type dhcpMessage struct {
+	op      uint8
+	xid     uint32
+	ciaddr  tcpip.Address
+	yiaddr  tcpip.Address
+	siaddr  tcpip.Address
+	chaddr  []byte
+	file    []byte
+	msgType uint8
+	options map[uint8][]byte
+	raw     []byte
+
+	// link address of the sender
+	src tcpip.LinkAddress
+}
+
+type dhcpClient struct {
+	iface *Interface
+	xid   uint32
+	rx    chan *dhcpMessage
+}
+
+func parseDHCP(buf []byte) (msg *dhcpMessage, err error) {
+	if len(buf) < dhcpHeaderLen {
+		return nil, errors.New("invalid message length")
+	}
+
+	if binary.BigEndian.Uint32(buf[236:240]) != dhcpCookie {
+		return nil, errors.New("invalid magic cookie")
+	}
+
+	msg = &dhcpMessage{
+		op:     buf[0],
+		xid:    binary.BigEndian.Uint32(buf[4:8]),
+		ciaddr: tcpip.Address(buf[12:16]),
+		yiaddr: tcpip.Address(buf[16:20]),
+		siaddr: tcpip.Address(buf[20:24]),
+		chaddr: buf[28:34],
+		file:   buf[108:236],
+		raw:    buf[dhcpHeaderLen:],
+	}
+
+	msg.options = dhcpOptions(msg.raw)
+
+	if t := msg.options[dhcpOptionMessageType]; len(t) == 1 {
+		msg.msgType = t[0]
+	}
+
+	return
+}
+
+// cString returns the string preceding the first NUL character, if any.
+func cString(buf []byte) string {
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+
+	return string(buf)
+}
+
+func appendOption(buf []byte, code uint8, data ...byte) []byte {
+	buf = append(buf, code, uint8(len(data)))
+	return append(buf, data...)
+}
+
+func optionAddress(opts map[uint8][]byte, code uint8) tcpip.Address {
+	if v := opts[code]; len(v) >= header.IPv4AddressSize {
+		return tcpip.Address(v[:header.IPv4AddressSize])
+	}
+
+	return ""
+}
+
+func optionDuration(opts map[uint8][]byte, code uint8) (d time.Duration, ok bool) {
+	if v := opts[code]; len(v) == 4 {
+		return time.Duration(binary.BigEndian.Uint32(v)) * time.Second, true
+	}
+
+	return
+}
+
+// message returns a DHCP client message (RFC 2131 - 4.4.1).
+func (c *dhcpClient) message(msgType uint8, ciaddr tcpip.Address, opts []byte) []byte {
+	buf := make([]byte, dhcpHeaderLen)
+
+	buf[0] = dhcpBootRequest
+	buf[1] = 1 // Ethernet
+	buf[2] = 6 // hardware address length
+	binary.BigEndian.PutUint32(buf[4:8], atomic.LoadUint32(&c.xid))
+
+	if len(ciaddr) == 0 {
+		binary.BigEndian.PutUint16(buf[10:12], dhcpBroadcast)
+	} else {
+		copy(buf[12:16], ciaddr)
+	}
+
+	copy(buf[28:34], c.iface.NIC.MAC)
+	binary.BigEndian.PutUint32(buf[236:240], dhcpCookie)
+
+	buf = appendOption(buf, dhcpOptionMessageType, msgType)
+	buf = appendOption(buf, dhcpOptionClientID, append([]byte{1}, c.iface.NIC.MAC...)...)
+
+	if msgType != dhcpDecline && msgType != dhcpRelease {
+		buf = appendOption(buf, dhcpOptionMaxMessageSize, byte(MaxMTU>>8), byte(MaxMTU&0xff))
+		buf = appendOption(buf, dhcpOptionParameterList,
+			dhcpOptionSubnetMask,
+			dhcpOptionRouter,
+			dhcpOptionDNS,
+			dhcpOptionNTP,
+			dhcpOptionLeaseTime,
+			dhcpOptionRenewalTime,
+			dhcpOptionRebindingTime,
+			dhcpOptionDomainSearch,
+			dhcpOptionTFTPServer,
+			dhcpOptionBootFile,
+		)
+	}
+
+	buf = append(buf, opts...)
+	buf = append(buf, dhcpOptionEnd)
+
+	return buf
+}
+
+// send transmits a DHCP message encapsulated in a UDP datagram, the frame is
+// directly written to the link as the interface might not yet have an
+// address.
+func (c *dhcpClient) send(msg []byte, src tcpip.Address, dst tcpip.Address, mac tcpip.LinkAddress) error {
+	if len(src) == 0 {
+		src = header.IPv4Any
+	}
+
+	length := header.UDPMinimumSize + len(msg)
+	size := header.IPv4MinimumSize + length
+	buf := make([]byte, size)
+
+	ip := header.IPv4(buf)
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: uint16(size),
+		TTL:         64,
+		Protocol:    uint8(udp.ProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+
+	u := header.UDP(buf[header.IPv4MinimumSize:])
+	u.Encode(&header.UDPFields{
+		SrcPort: dhcpClientPort,
+		DstPort: dhcpServerPort,
+		Length:  uint16(length),
+	})
+	copy(u.Payload(), msg)
+
+	xsum := header.PseudoHeaderChecksum(udp.ProtocolNumber, src, dst, uint16(length))
+	xsum = checksum.Checksum(msg, xsum)
+	u.SetChecksum(^u.CalculateChecksum(xsum))
+
+	payload := bufferv2.MakeWithData(buf)
+
+	if err := c.iface.Stack.WritePacketToRemote(c.iface.nicid, mac, ipv4.ProtocolNumber, payload); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	return nil
+}
+
+// handle processes incoming IPv4 frames, DHCP replies are consumed and passed
+// to the client.
+func (c *dhcpClient) handle(buf []byte) bool {
+	f, ok := parseFrame(buf)
+
+	if !ok || f.transport != udp.ProtocolNumber || f.srcPort != dhcpServerPort || f.dstPort != dhcpClientPort {
+		return false
+	}
+
+	ip := header.IPv4(buf[header.EthernetMinimumSize:])
+	payload := ip.Payload()
+
+	if len(payload) < header.UDPMinimumSize {
+		return true
+	}
+
+	msg, err := parseDHCP(payload[header.UDPMinimumSize:])
+
+	if err != nil || msg.op != dhcpBootReply || msg.xid != atomic.LoadUint32(&c.xid) || !bytes.Equal(msg.chaddr, c.iface.NIC.MAC) {
+		return true
+	}
+
+	msg.src = f.src
+
+	select {
+	case c.rx <- msg:
+	default:
+	}
+
+	return true
+}
+
+func (c *dhcpClient) newXID() {
+	atomic.StoreUint32(&c.xid, c.iface.Stack.Rand().Uint32())
+
+	for {
+		select {
+		case <-c.rx:
+		default:
+			return
+		}
+	}
+}
+
+// exchange transmits a DHCP message, retransmitting it with randomized
+// exponential backoff (RFC 2131 - 4.1), until a reply of the expected types
+// is received or the deadline is reached.
+func (c *dhcpClient) exchange(msg []byte, src, dst tcpip.Address, mac tcpip.LinkAddress, deadline time.Time, interval time.Duration, types ...uint8) (reply *dhcpMessage, err error) {
+	rng := c.iface.Stack.Rand()
+	delay := interval
+
+	for time.Now().Before(deadline) {
+		if err = c.send(msg, src, dst, mac); err != nil {
+			return
+		}
+
+		// randomized by -1 to +1 seconds
+		wait := delay - time.Second + time.Duration(rng.Int63n(int64(2*time.Second)))
+
+		if left := time.Until(deadline); wait > left {
+			wait = left
+		}
+
+		timeout := time.After(wait)
+
+	wait:
+		for {
+			select {
+			case reply = <-c.rx:
+				for _, t := range types {
+					if reply.msgType == t {
+						return
+					}
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+
+		if delay *= 2; delay > dhcpMaxRetransmit {
+			delay = dhcpMaxRetransmit
+		}
+	}
+
+	return nil, errors.New("timeout")
+}
+
+func (c *dhcpClient) parseLease(ack *dhcpMessage) (lease *DHCPLease, err error) {
+	addr := net.IP(ack.yiaddr)
+
+	if addr.To4() == nil || addr.IsUnspecified() {
+		return nil, errors.New("invalid address")
+	}
+
+	mask := addr.DefaultMask()
+
+	if v := ack.options[dhcpOptionSubnetMask]; len(v) == net.IPv4len {
+		mask = net.IPMask(v)
+	}
+
+	prefixLen, bits := mask.Size()
+
+	if bits != 8*net.IPv4len {
+		return nil, errors.New("invalid subnet mask")
+	}
+
+	lease = &DHCPLease{
+		Address: tcpip.AddressWithPrefix{
+			Address:   ack.yiaddr,
+			PrefixLen: prefixLen,
+		},
+		Gateway:      optionAddress(ack.options, dhcpOptionRouter),
+		Server:       optionAddress(ack.options, dhcpOptionServerID),
+		Obtained:     time.Now(),
+		LeaseOptions: parseLeaseOptions(ack.raw),
+		TFTPServer:   cString(ack.options[dhcpOptionTFTPServer]),
+		BootFile:     cString(ack.options[dhcpOptionBootFile]),
+		serverMAC:    ack.src,
+	}
+
+	if addr := net.IP(ack.siaddr); !addr.IsUnspecified() {
+		lease.NextServer = ack.siaddr
+	}
+
+	if len(lease.BootFile) == 0 {
+		lease.BootFile = cString(ack.file)
+	}
+
+	if v := ack.options[dhcpOptionLeaseTime]; len(v) == 4 && binary.BigEndian.Uint32(v) == dhcpInfiniteLease {
+		return
+	}
+
+	d, ok := optionDuration(ack.options, dhcpOptionLeaseTime)
+
+	if !ok || d == 0 {
+		return nil, errors.New("invalid lease time")
+	}
+
+	lease.Duration = d
+	lease.Renewal = d / 2
+	lease.Rebinding = d * 7 / 8
+
+	if t1, ok := optionDuration(ack.options, dhcpOptionRenewalTime); ok && t1 < d {
+		lease.Renewal = t1
+	}
+
+	if t2, ok := optionDuration(ack.options, dhcpOptionRebindingTime); ok && t2 < d && t2 >= lease.Renewal {
+		lease.Rebinding = t2
+	}
+
+	return
+}
+
+// acquire obtains a lease through the DHCP allocation process (RFC 2131 -
+// 3.1).
+func (c *dhcpClient) acquire() (lease *DHCPLease, err error) {
+	c.newXID()
+
+	deadline := time.Now().Add(2 * dhcpMaxRetransmit)
+	discover := c.message(dhcpDiscover, "", nil)
+
+	offer, err := c.exchange(discover, "", header.IPv4Broadcast, header.EthernetBroadcastAddress, deadline, dhcpMinRetransmit, dhcpOffer)
+
+	if err != nil {
+		return
+	}
+
+	server := optionAddress(offer.options, dhcpOptionServerID)
+
+	var opts []byte
+	opts = appendOption(opts, dhcpOptionRequestedIP, []byte(offer.yiaddr)...)
+	opts = appendOption(opts, dhcpOptionServerID, []byte(server)...)
+
+	request := c.message(dhcpRequest, "", opts)
+
+	ack, err := c.exchange(request, "", header.IPv4Broadcast, header.EthernetBroadcastAddress, deadline, dhcpMinRetransmit, dhcpAck, dhcpNak)
+
+	if err != nil {
+		return
+	}
+
+	if ack.msgType == dhcpNak {
+		return nil, errors.New("request not acknowledged")
+	}
+
+	if lease, err = c.parseLease(ack); err != nil {
+		return
+	}
+
+	if !c.iface.opts.ACD {
+		return
+	}
+
+	ctx, cancel := c.iface.context()
+	defer cancel()
+
+	// RFC 2131 - 3.1.5
+	mac, err := c.iface.detectConflict(ctx, lease.Address.Address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if mac != nil {
+		c.iface.addressConflict(lease.Address.Address, mac)
+
+		opts = appendOption(nil, dhcpOptionRequestedIP, []byte(lease.Address.Address)...)
+		opts = appendOption(opts, dhcpOptionServerID, []byte(server)...)
+
+		c.send(c.message(dhcpDecline, "", opts), "", header.IPv4Broadcast, header.EthernetBroadcastAddress)
+		time.Sleep(dhcpDeclineWait)
+
+		return nil, errors.New("address conflict")
+	}
+
+	return
+}
+
+// renew extends a lease, by unicast requests to its server until the
+// rebinding time and then by broadcast requests until its expiration (RFC
+// 2131 - 4.4.5).
+func (c *dhcpClient) renew(lease *DHCPLease) (renewed *DHCPLease, err error) {
+	c.newXID()
+
+	addr := lease.Address.Address
+	request := c.message(dhcpRequest, addr, nil)
+
+	t2 := lease.Obtained.Add(lease.Rebinding)
+	expiry := lease.Obtained.Add(lease.Duration)
+
+	ack, err := c.exchange(request, addr, lease.Server, lease.serverMAC, t2, dhcpMinRenewalRetransmit, dhcpAck, dhcpNak)
+
+	if err != nil {
+		ack, err = c.exchange(request, addr, header.IPv4Broadcast, header.EthernetBroadcastAddress, expiry, dhcpMinRenewalRetransmit, dhcpAck, dhcpNak)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if ack.msgType == dhcpNak {
+		return nil, errors.New("request not acknowledged")
+	}
+
+	return c.parseLease(ack)
+}
+
+// bindLease configures the interface with a lease.
+func (iface *Interface) bindLease(lease *DHCPLease) (err error) {
+	if err = iface.configureProtocol(ipv4.ProtocolNumber, lease.Address, lease.Gateway); err != nil {
+		return
+	}
+
+	iface.mu.Lock()
+	iface.address = lease.Address
+	iface.gateway = lease.Gateway
+	iface.dhcpLease = lease
+	iface.mu.Unlock()
+
+	if iface.opts.ACD {
+		iface.acd.watch(lease.Address.Address)
+	}
+
+	go iface.announce(lease.Address.Address, acdAnnounceNum)
+
+	iface.setLeaseOptions(lease.LeaseOptions)
+
+	return
+}
+
+// unbindLease removes a lease configuration from the interface.
+func (iface *Interface) unbindLease(lease *DHCPLease) {
+	iface.acd.unwatch(lease.Address.Address)
+	iface.Stack.RemoveAddress(iface.nicid, lease.Address.Address)
+	iface.Stack.RemoveRoutes(func(rt tcpip.Route) bool {
+		return rt.NIC == iface.nicid &&
+			(rt.Destination == lease.Address.Subnet() ||
+				len(lease.Gateway) > 0 && rt.Gateway == lease.Gateway && rt.Destination == header.IPv4EmptySubnet)
+	})
+
+	iface.mu.Lock()
+	iface.address = tcpip.AddressWithPrefix{}
+	iface.gateway = ""
+	iface.dhcpLease = nil
+	iface.mu.Unlock()
+
+	iface.setLeaseOptions(LeaseOptions{})
+}
+
+func (c *dhcpClient) run() {
+	iface := c.iface
+
+	for {
+		lease, err := c.acquire()
+
+		if err != nil {
+			if iface.linkLocalEnabled() {
+				iface.startLinkLocal()
+			}
+
+			if !iface.sleep(dhcpAcquisitionRetryDelay) {
+				return
+			}
+
+			continue
+		}
+
+		// RFC 3927 - 1.9
+		iface.stopLinkLocal()
+
+		if err = iface.bindLease(lease); err != nil {
+			if !iface.sleep(dhcpAcquisitionRetryDelay) {
+				return
+			}
+
+			continue
+		}
+
+		for lease.Duration > 0 {
+			if !iface.sleep(time.Until(lease.Obtained.Add(lease.Renewal))) {
+				return
+			}
+
+			renewed, err := c.renew(lease)
+
+			if err != nil {
+				iface.unbindLease(lease)
+				break
+			}
+
+			if renewed.Address != lease.Address || renewed.Gateway != lease.Gateway {
+				iface.unbindLease(lease)
+
+				if err = iface.bindLease(renewed); err != nil {
+					break
+				}
+			} else {
+				iface.mu.Lock()
+				iface.dhcpLease = renewed
+				iface.mu.Unlock()
+
+				iface.setLeaseOptions(renewed.LeaseOptions)
+			}
+
+			lease = renewed
+		}
+
+		if lease.Duration == 0 {
+			return
+		}
+	}
+}
+
+func newDHCPClient(iface *Interface) *dhcpClient {
+	return &dhcpClient{
+		iface: iface,
+		rx:    make(chan *dhcpMessage, 4),
+	}
+}
+
+// DHCPLease returns the current DHCP lease, nil is returned when DHCP is not
+// enabled or no lease is currently bound.
+func (iface *Interface) DHCPLease() *DHCPLease {
+	iface.mu.RLock()
+	defer iface.mu.RUnlock()
+
+	if iface.dhcpLease == nil {
+		return nil
+	}
+
+	lease := *iface.dhcpLease
+
+	return &lease
+}
+
+func dhcpEnabled(opts *Options) bool {
+	return opts.IPv4 != nil && opts.IPv4.DHCP
+}
@@ -0,0 +1,473 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// DefaultDHCPLeaseTime is the DHCP server lease time used when not
+	// specified in DHCPServerOptions.
+	DefaultDHCPLeaseTime = 1 * time.Hour
+
+	// time an offered address is reserved for the client
+	dhcpOfferTimeout = 60 * time.Second
+)
+
+// DHCPServerOptions represents DHCP server configuration options.
+type DHCPServerOptions struct {
+	// PoolStart is the first address of the pool.
+	PoolStart string
+	// PoolEnd is the last address of the pool.
+	PoolEnd string
+
+	// LeaseTime is the duration of leases, DefaultDHCPLeaseTime is used
+	// when zero.
+	LeaseTime time.Duration
+
+	// Router is the default gateway advertised to clients, none is
+	// advertised when empty.
+	Router string
+	// DNSServers are the DNS servers advertised to clients.
+	DNSServers []string
+	// DomainSearch is the domain search list advertised to clients.
+	DomainSearch []string
+	// NTPServers are the NTP servers advertised to clients.
+	NTPServers []string
+}
+
+// DHCPServerLease represents an address assigned by the DHCP server.
+type DHCPServerLease struct {
+	// MAC is the client hardware address.
+	MAC net.HardwareAddr
+	// Address is the assigned address.
+	Address tcpip.Address
+	// Expires is the lease expiration time.
+	Expires time.Time
+
+	// offered but not yet requested
+	offer bool
+}
+
+// DHCPServer represents a DHCP server (RFC 2131) instance.
+type DHCPServer struct {
+	sync.Mutex
+
+	iface *Interface
+	conn  *gonet.UDPConn
+
+	server    tcpip.Address
+	mask      net.IPMask
+	start     uint32
+	end       uint32
+	leaseTime time.Duration
+	options   []byte
+
+	// leases indexed by client hardware address
+	leases map[string]*DHCPServerLease
+	// declined addresses (RFC 2131 - 4.3.3)
+	declined map[tcpip.Address]time.Time
+
+	done chan struct{}
+	once sync.Once
+}
+
+func parseAddressOption(addrs []string) (buf []byte, err error) {
+	for _, s := range addrs {
+		ip := net.ParseIP(s).To4()
+
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+
+		buf = append(buf, ip...)
+	}
+
+	return
+}
+
+// encodeName encodes a domain name (RFC 1035 - 3.1) without compression.
+func encodeName(name string) (buf []byte, err error) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid domain %q", name)
+		}
+
+		buf = append(buf, uint8(len(label)))
+		buf = append(buf, label...)
+	}
+
+	return append(buf, 0), nil
+}
+
+// appendLongOption appends an option, split across multiple instances when
+// exceeding 255 bytes (RFC 3396).
+func appendLongOption(buf []byte, code uint8, data []byte) []byte {
+	for len(data) > 255 {
+		buf = appendOption(buf, code, data[:255]...)
+		data = data[255:]
+	}
+
+	if len(data) > 0 {
+		buf = appendOption(buf, code, data...)
+	}
+
+	return buf
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToAddress(v uint32) tcpip.Address {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	return tcpip.Address(buf)
+}
+
+// StartDHCPServer starts a DHCP server (RFC 2131) on the interface, handing
+// out addresses from the argument pool, which must lie within the subnet of
+// the interface IPv4 address.
+//
+// Replies are broadcast to clients which do not yet have an address, leases
+// are kept in memory only.
+func (iface *Interface) StartDHCPServer(opts *DHCPServerOptions) (s *DHCPServer, err error) {
+	local, err := iface.localAddress()
+
+	if err != nil {
+		return
+	}
+
+	start := net.ParseIP(opts.PoolStart).To4()
+	end := net.ParseIP(opts.PoolEnd).To4()
+
+	if start == nil || end == nil || ipToUint32(start) > ipToUint32(end) {
+		return nil, errors.New("invalid address pool")
+	}
+
+	subnet := iface.address.Subnet()
+
+	if !subnet.Contains(tcpip.Address(start)) || !subnet.Contains(tcpip.Address(end)) {
+		return nil, errors.New("address pool outside interface subnet")
+	}
+
+	s = &DHCPServer{
+		iface:     iface,
+		server:    local,
+		mask:      net.IPMask(subnet.Mask()),
+		start:     ipToUint32(start),
+		end:       ipToUint32(end),
+		leaseTime: opts.LeaseTime,
+		leases:    make(map[string]*DHCPServerLease),
+		declined:  make(map[tcpip.Address]time.Time),
+		done:      make(chan struct{}),
+	}
+
+	if s.leaseTime == 0 {
+		s.leaseTime = DefaultDHCPLeaseTime
+	}
+
+	if err = s.parseOptions(opts); err != nil {
+		return nil, err
+	}
+
+	var wq waiter.Queue
+
+	ep, tcpErr := iface.Stack.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (udp): %v", tcpErr)
+	}
+
+	ep.SocketOptions().SetBroadcast(true)
+
+	if tcpErr := ep.Bind(tcpip.FullAddress{NIC: iface.nicid, Port: dhcpServerPort}); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("bind error (udp): %v", tcpErr)
+	}
+
+	s.conn = gonet.NewUDPConn(iface.Stack, &wq, ep)
+
+	go s.serve()
+
+	return
+}
+
+func (s *DHCPServer) parseOptions(opts *DHCPServerOptions) (err error) {
+	var buf []byte
+
+	s.options = appendOption(s.options, dhcpOptionSubnetMask, s.mask...)
+
+	if len(opts.Router) > 0 {
+		if buf, err = parseAddressOption([]string{opts.Router}); err != nil {
+			return
+		}
+
+		s.options = appendOption(s.options, dhcpOptionRouter, buf...)
+	}
+
+	if buf, err = parseAddressOption(opts.DNSServers); err != nil {
+		return
+	}
+
+	s.options = appendLongOption(s.options, dhcpOptionDNS, buf)
+
+	if buf, err = parseAddressOption(opts.NTPServers); err != nil {
+		return
+	}
+
+	s.options = appendLongOption(s.options, dhcpOptionNTP, buf)
+	buf = nil
+
+	for _, domain := range opts.DomainSearch {
+		name, err := encodeName(domain)
+
+		if err != nil {
+			return err
+		}
+
+		buf = append(buf, name...)
+	}
+
+	s.options = appendLongOption(s.options, dhcpOptionDomainSearch, buf)
+
+	return
+}
+
+// available returns whether an address can be assigned to a client.
+func (s *DHCPServer) available(addr tcpip.Address, mac string, now time.Time) bool {
+	if len(addr) != header.IPv4AddressSize || addr == s.server {
+		return false
+	}
+
+	if v := ipToUint32(net.IP(addr)); v < s.start || v > s.end {
+		return false
+	}
+
+	if t, ok := s.declined[addr]; ok && now.Before(t) {
+		return false
+	}
+
+	for m, lease := range s.leases {
+		if m != mac && lease.Address == addr && now.Before(lease.Expires) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allocate selects an address for a client (RFC 2131 - 4.3.1).
+func (s *DHCPServer) allocate(mac string, requested tcpip.Address, now time.Time) (addr tcpip.Address, err error) {
+	if lease, ok := s.leases[mac]; ok && s.available(lease.Address, mac, now) {
+		return lease.Address, nil
+	}
+
+	if s.available(requested, mac, now) {
+		return requested, nil
+	}
+
+	for v := s.start; v <= s.end && v >= s.start; v++ {
+		if addr = uint32ToAddress(v); s.available(addr, mac, now) {
+			return
+		}
+	}
+
+	return "", errors.New("address pool exhausted")
+}
+
+func (s *DHCPServer) reply(req []byte, msgType uint8, yiaddr tcpip.Address, leaseTime time.Duration) []byte {
+	buf := make([]byte, dhcpHeaderLen)
+	copy(buf, req[:dhcpHeaderLen])
+
+	buf[0] = dhcpBootReply
+	buf[3] = 0 // hops
+	binary.BigEndian.PutUint16(buf[8:10], 0)
+	copy(buf[16:20], yiaddr)
+	copy(buf[20:24], header.IPv4Any)
+	// clear sname and file fields
+	copy(buf[44:236], make([]byte, 192))
+
+	if msgType == dhcpNak {
+		copy(buf[12:16], header.IPv4Any)
+	}
+
+	buf = appendOption(buf, dhcpOptionMessageType, msgType)
+	buf = appendOption(buf, dhcpOptionServerID, []byte(s.server)...)
+
+	if msgType != dhcpNak {
+		if leaseTime > 0 {
+			t := uint32(leaseTime / time.Second)
+
+			buf = appendOption(buf, dhcpOptionLeaseTime, dhcpUint32(t)...)
+			buf = appendOption(buf, dhcpOptionRenewalTime, dhcpUint32(t/2)...)
+			buf = appendOption(buf, dhcpOptionRebindingTime, dhcpUint32(t/8*7)...)
+		}
+
+		buf = append(buf, s.options...)
+	}
+
+	return append(buf, dhcpOptionEnd)
+}
+
+func dhcpUint32(v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	return buf
+}
+
+// send transmits a reply, unicast to clients with a configured address and
+// broadcast otherwise (RFC 2131 - 4.1).
+func (s *DHCPServer) send(buf []byte, ciaddr tcpip.Address) (err error) {
+	dst := &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpClientPort}
+
+	if !ciaddr.Unspecified() && len(ciaddr) > 0 {
+		dst.IP = net.IP(ciaddr)
+	}
+
+	_, err = s.conn.WriteTo(buf, dst)
+
+	return
+}
+
+// handle processes a client message (RFC 2131 - 4.3).
+func (s *DHCPServer) handle(req []byte) {
+	msg, err := parseDHCP(req)
+
+	if err != nil || msg.op != dhcpBootRequest || req[1] != 1 || req[2] != 6 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	mac := net.HardwareAddr(append([]byte{}, msg.chaddr...))
+	id := mac.String()
+	server := optionAddress(msg.options, dhcpOptionServerID)
+	requested := optionAddress(msg.options, dhcpOptionRequestedIP)
+
+	switch msg.msgType {
+	case dhcpDiscover:
+		addr, err := s.allocate(id, requested, now)
+
+		if err != nil {
+			return
+		}
+
+		s.leases[id] = &DHCPServerLease{
+			MAC:     mac,
+			Address: addr,
+			Expires: now.Add(dhcpOfferTimeout),
+			offer:   true,
+		}
+
+		s.send(s.reply(req, dhcpOffer, addr, s.leaseTime), msg.ciaddr)
+	case dhcpRequest:
+		if len(server) > 0 && server != s.server {
+			// the client selected another server
+			if lease, ok := s.leases[id]; ok && lease.offer {
+				delete(s.leases, id)
+			}
+
+			return
+		}
+
+		addr := requested
+
+		if len(addr) == 0 {
+			addr = msg.ciaddr
+		}
+
+		if !s.available(addr, id, now) {
+			s.send(s.reply(req, dhcpNak, "", 0), "")
+			return
+		}
+
+		s.leases[id] = &DHCPServerLease{
+			MAC:     mac,
+			Address: addr,
+			Expires: now.Add(s.leaseTime),
+		}
+
+		s.send(s.reply(req, dhcpAck, addr, s.leaseTime), msg.ciaddr)
+	case dhcpDecline:
+		if server != s.server {
+			return
+		}
+
+		s.declined[requested] = now.Add(s.leaseTime)
+		delete(s.leases, id)
+	case dhcpRelease:
+		if lease, ok := s.leases[id]; ok && lease.Address == msg.ciaddr {
+			delete(s.leases, id)
+		}
+	case dhcpInform:
+		s.send(s.reply(req, dhcpAck, "", 0), msg.ciaddr)
+	}
+}
+
+func (s *DHCPServer) serve() {
+	buf := make([]byte, MaxMTU)
+
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		s.handle(buf[:n])
+	}
+}
+
+// Leases returns the addresses currently assigned by the DHCP server.
+func (s *DHCPServer) Leases() (leases []DHCPServerLease) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	for _, lease := range s.leases {
+		if !lease.offer && now.Before(lease.Expires) {
+			leases = append(leases, *lease)
+		}
+	}
+
+	return
+}
+
+// Close stops the DHCP server.
+func (s *DHCPServer) Close() (err error) {
+	s.once.Do(func() {
+		close(s.done)
+		err = s.conn.Close()
+	})
+
+	return
+}
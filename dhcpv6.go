@@ -0,0 +1,650 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// DHCPv6 constants (RFC 8415)
+const (
+	dhcpv6ClientPort = 546
+	dhcpv6ServerPort = 547
+
+	// All_DHCP_Relay_Agents_and_Servers (RFC 8415 - 7.1)
+	dhcpv6ServersAddress = "ff02::1:2"
+
+	dhcpv6Solicit            = 1
+	dhcpv6Advertise          = 2
+	dhcpv6Request            = 3
+	dhcpv6Renew              = 5
+	dhcpv6Rebind             = 6
+	dhcpv6Reply              = 7
+	dhcpv6InformationRequest = 11
+
+	dhcpv6OptionClientID    = 1
+	dhcpv6OptionServerID    = 2
+	dhcpv6OptionIANA        = 3
+	dhcpv6OptionIAAddr      = 5
+	dhcpv6OptionORO         = 6
+	dhcpv6OptionElapsedTime = 8
+	dhcpv6OptionStatusCode  = 13
+	dhcpv6OptionDNSServers  = 23
+	dhcpv6OptionDomainList  = 24
+	dhcpv6OptionRefreshTime = 32
+
+	dhcpv6StatusSuccess = 0
+
+	// DUID-LL (RFC 8415 - 11.4)
+	dhcpv6DUIDLL = 3
+	// identity association identifier
+	dhcpv6IAID = 1
+
+	// transmission and retransmission parameters (RFC 8415 - 7.6)
+	dhcpv6SolTimeout = 1 * time.Second
+	dhcpv6SolMaxRT   = 3600 * time.Second
+	dhcpv6ReqTimeout = 1 * time.Second
+	dhcpv6ReqMaxRT   = 30 * time.Second
+	dhcpv6ReqMaxRC   = 10
+	dhcpv6RenTimeout = 10 * time.Second
+	dhcpv6RenMaxRT   = 600 * time.Second
+	dhcpv6InfTimeout = 1 * time.Second
+	dhcpv6InfMaxRT   = 3600 * time.Second
+
+	// RFC 8415 - 21.23
+	dhcpv6DefaultRefreshTime = 86400 * time.Second
+	dhcpv6MinRefreshTime     = 600 * time.Second
+)
+
+// DHCPv6Lease represents an IPv6 configuration obtained through DHCPv6.
+type DHCPv6Lease struct {
+	// Address is the leased address, it is empty for stateless
+	// configurations obtained through Information-request messages.
+	Address tcpip.AddressWithPrefix
+	// ServerID is the DHCPv6 server DUID.
+	ServerID []byte
+
+	// Obtained is the time of the last server reply.
+	Obtained time.Time
+	// Renewal is the renewal (T1) time, or the information refresh time
+	// for stateless configurations.
+	Renewal time.Duration
+	// Rebinding is the rebinding (T2) time.
+	Rebinding time.Duration
+	// Valid is the valid lifetime of the address.
+	Valid time.Duration
+
+	// LeaseOptions are the network service options.
+	LeaseOptions
+}
+
+type dhcpv6Message struct {
+	msgType uint8
+	xid     uint32
+	options map[uint16][][]byte
+}
+
+type dhcpv6Client struct {
+	iface *Interface
+	conn  *gonet.UDPConn
+	duid  []byte
+	xid   uint32
+
+	// DHCPv6 mode requested by Router Advertisements
+	mode chan ipv6.DHCPv6ConfigurationFromNDPRA
+}
+
+func appendOption6(buf []byte, code uint16, data []byte) []byte {
+	hdr := make([]byte, 4)
+	binary.BigEndian.PutUint16(hdr[0:2], code)
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(len(data)))
+
+	buf = append(buf, hdr...)
+
+	return append(buf, data...)
+}
+
+// dhcpv6Options returns the options found in a DHCPv6 options field.
+func dhcpv6Options(buf []byte) (opts map[uint16][][]byte) {
+	opts = make(map[uint16][][]byte)
+
+	for len(buf) >= 4 {
+		code := binary.BigEndian.Uint16(buf[0:2])
+		size := int(binary.BigEndian.Uint16(buf[2:4]))
+
+		if len(buf) < 4+size {
+			return
+		}
+
+		opts[code] = append(opts[code], buf[4:4+size])
+		buf = buf[4+size:]
+	}
+
+	return
+}
+
+func parseDHCPv6(buf []byte) (msg *dhcpv6Message, err error) {
+	if len(buf) < 4 {
+		return nil, errors.New("invalid message length")
+	}
+
+	msg = &dhcpv6Message{
+		msgType: buf[0],
+		xid:     uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3]),
+		options: dhcpv6Options(buf[4:]),
+	}
+
+	return
+}
+
+// option returns the first instance of a message option.
+func (msg *dhcpv6Message) option(code uint16) []byte {
+	if v := msg.options[code]; len(v) > 0 {
+		return v[0]
+	}
+
+	return nil
+}
+
+// status returns the status code of an options field (RFC 8415 - 21.13),
+// an absent status indicates success.
+func dhcpv6Status(opts map[uint16][][]byte) uint16 {
+	if v := opts[dhcpv6OptionStatusCode]; len(v) > 0 && len(v[0]) >= 2 {
+		return binary.BigEndian.Uint16(v[0])
+	}
+
+	return dhcpv6StatusSuccess
+}
+
+func parseLeaseOptions6(msg *dhcpv6Message) (lease LeaseOptions) {
+	for buf := msg.option(dhcpv6OptionDNSServers); len(buf) >= net.IPv6len; buf = buf[net.IPv6len:] {
+		lease.DNSServers = append(lease.DNSServers, net.IP(buf[:net.IPv6len]).String())
+	}
+
+	lease.DomainSearch, _ = parseDomainSearch(msg.option(dhcpv6OptionDomainList))
+
+	return
+}
+
+// message returns a DHCPv6 client message (RFC 8415 - 18.2).
+func (c *dhcpv6Client) message(msgType uint8, start time.Time, opts []byte) []byte {
+	buf := make([]byte, 4)
+	buf[0] = msgType
+	buf[1] = uint8(c.xid >> 16)
+	buf[2] = uint8(c.xid >> 8)
+	buf[3] = uint8(c.xid)
+
+	// hundredths of a second (RFC 8415 - 21.9)
+	elapsed := time.Since(start) / (10 * time.Millisecond)
+
+	if elapsed > 0xffff {
+		elapsed = 0xffff
+	}
+
+	buf = appendOption6(buf, dhcpv6OptionClientID, c.duid)
+	buf = appendOption6(buf, dhcpv6OptionElapsedTime, []byte{uint8(elapsed >> 8), uint8(elapsed)})
+	buf = appendOption6(buf, dhcpv6OptionORO, []byte{
+		0, dhcpv6OptionDNSServers,
+		0, dhcpv6OptionDomainList,
+		0, dhcpv6OptionRefreshTime,
+	})
+
+	return append(buf, opts...)
+}
+
+// iana returns an IA_NA option (RFC 8415 - 21.4), with the argument address
+// when not empty.
+func iana(addr tcpip.Address) []byte {
+	buf := make([]byte, 12)
+	binary.BigEndian.PutUint32(buf[0:4], dhcpv6IAID)
+
+	if len(addr) > 0 {
+		iaaddr := make([]byte, 24)
+		copy(iaaddr, addr)
+		buf = appendOption6(buf, dhcpv6OptionIAAddr, iaaddr)
+	}
+
+	return appendOption6(nil, dhcpv6OptionIANA, buf)
+}
+
+// exchange transmits a DHCPv6 message, retransmitting it as specified in RFC
+// 8415 - 15, until a valid reply of the expected type is received, or either
+// the maximum retransmission count (when non-zero) or deadline (when not
+// zero) is reached. The message is rebuilt on each transmission to update
+// its elapsed time.
+func (c *dhcpv6Client) exchange(msg func() []byte, irt time.Duration, mrt time.Duration, mrc int, deadline time.Time, msgType uint8) (reply *dhcpv6Message, err error) {
+	rng := c.iface.Stack.Rand()
+	dst := &net.UDPAddr{IP: net.ParseIP(dhcpv6ServersAddress), Port: dhcpv6ServerPort}
+	buf := make([]byte, MaxMTU)
+
+	// RT = IRT + RAND*IRT, with RAND in [-0.1, 0.1]
+	jitter := func(rt time.Duration) time.Duration {
+		return rt + time.Duration(rng.Int63n(int64(rt/5)+1)) - rt/10
+	}
+
+	rt := jitter(irt)
+
+	for n := 0; mrc == 0 || n < mrc; n++ {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			break
+		}
+
+		if _, err = c.conn.WriteTo(msg(), dst); err != nil {
+			return
+		}
+
+		timeout := time.Now().Add(rt)
+
+		if !deadline.IsZero() && deadline.Before(timeout) {
+			timeout = deadline
+		}
+
+		c.conn.SetReadDeadline(timeout)
+
+		for {
+			size, _, err := c.conn.ReadFrom(buf)
+
+			if err != nil {
+				break
+			}
+
+			reply, err = parseDHCPv6(buf[:size])
+
+			if err != nil || reply.msgType != msgType || reply.xid != c.xid {
+				continue
+			}
+
+			if !bytes.Equal(reply.option(dhcpv6OptionClientID), c.duid) || len(reply.option(dhcpv6OptionServerID)) == 0 {
+				continue
+			}
+
+			return reply, nil
+		}
+
+		// RT = 2*RTprev + RAND*RTprev
+		if rt = jitter(2 * rt); mrt > 0 && rt > mrt {
+			rt = jitter(mrt)
+		}
+	}
+
+	return nil, errors.New("timeout")
+}
+
+func (c *dhcpv6Client) newXID() {
+	c.xid = c.iface.Stack.Rand().Uint32() & 0xffffff
+}
+
+// parseLease returns the lease found in a Reply message.
+func (c *dhcpv6Client) parseLease(reply *dhcpv6Message, stateful bool) (lease *DHCPv6Lease, err error) {
+	if status := dhcpv6Status(reply.options); status != dhcpv6StatusSuccess {
+		return nil, fmt.Errorf("server status %d", status)
+	}
+
+	lease = &DHCPv6Lease{
+		ServerID:     append([]byte{}, reply.option(dhcpv6OptionServerID)...),
+		Obtained:     time.Now(),
+		LeaseOptions: parseLeaseOptions6(reply),
+	}
+
+	if !stateful {
+		lease.Renewal = dhcpv6DefaultRefreshTime
+
+		if v := reply.option(dhcpv6OptionRefreshTime); len(v) == 4 {
+			lease.Renewal = time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+		}
+
+		if lease.Renewal < dhcpv6MinRefreshTime {
+			lease.Renewal = dhcpv6MinRefreshTime
+		}
+
+		return
+	}
+
+	ia := reply.option(dhcpv6OptionIANA)
+
+	if len(ia) < 12 || binary.BigEndian.Uint32(ia[0:4]) != dhcpv6IAID {
+		return nil, errors.New("missing IA_NA")
+	}
+
+	opts := dhcpv6Options(ia[12:])
+
+	if status := dhcpv6Status(opts); status != dhcpv6StatusSuccess {
+		return nil, fmt.Errorf("IA_NA status %d", status)
+	}
+
+	for _, iaaddr := range opts[dhcpv6OptionIAAddr] {
+		if len(iaaddr) < 24 {
+			continue
+		}
+
+		valid := time.Duration(binary.BigEndian.Uint32(iaaddr[20:24])) * time.Second
+
+		if valid == 0 {
+			continue
+		}
+
+		lease.Address = tcpip.AddressWithPrefix{
+			Address:   tcpip.Address(iaaddr[0:16]),
+			PrefixLen: 8 * net.IPv6len,
+		}
+
+		lease.Valid = valid
+		break
+	}
+
+	if len(lease.Address.Address) == 0 {
+		return nil, errors.New("missing IA address")
+	}
+
+	t1 := time.Duration(binary.BigEndian.Uint32(ia[4:8])) * time.Second
+	t2 := time.Duration(binary.BigEndian.Uint32(ia[8:12])) * time.Second
+
+	// RFC 8415 - 21.4, values left to the client discretion
+	if t1 == 0 || t1 > lease.Valid {
+		t1 = lease.Valid / 2
+	}
+
+	if t2 == 0 || t2 < t1 || t2 > lease.Valid {
+		t2 = lease.Valid * 4 / 5
+	}
+
+	lease.Renewal = t1
+	lease.Rebinding = t2
+
+	return
+}
+
+// acquire obtains a lease through Solicit and Request messages (RFC 8415 -
+// 18.2.1, 18.2.2).
+func (c *dhcpv6Client) acquire() (lease *DHCPv6Lease, err error) {
+	c.newXID()
+	start := time.Now()
+
+	solicit := func() []byte {
+		return c.message(dhcpv6Solicit, start, iana(""))
+	}
+
+	advertise, err := c.exchange(solicit, dhcpv6SolTimeout, dhcpv6SolMaxRT, 0, time.Time{}, dhcpv6Advertise)
+
+	if err != nil {
+		return
+	}
+
+	if lease, err = c.parseLease(advertise, true); err != nil {
+		return
+	}
+
+	c.newXID()
+	start = time.Now()
+
+	var opts []byte
+	opts = appendOption6(opts, dhcpv6OptionServerID, lease.ServerID)
+	opts = append(opts, iana(lease.Address.Address)...)
+
+	request := func() []byte {
+		return c.message(dhcpv6Request, start, opts)
+	}
+
+	reply, err := c.exchange(request, dhcpv6ReqTimeout, dhcpv6ReqMaxRT, dhcpv6ReqMaxRC, time.Time{}, dhcpv6Reply)
+
+	if err != nil {
+		return
+	}
+
+	return c.parseLease(reply, true)
+}
+
+// renew extends a lease, through Renew messages until the rebinding time and
+// Rebind messages until the address valid lifetime (RFC 8415 - 18.2.4,
+// 18.2.5).
+func (c *dhcpv6Client) renew(lease *DHCPv6Lease) (renewed *DHCPv6Lease, err error) {
+	c.newXID()
+	start := time.Now()
+
+	opts := appendOption6(nil, dhcpv6OptionServerID, lease.ServerID)
+	opts = append(opts, iana(lease.Address.Address)...)
+
+	renew := func() []byte {
+		return c.message(dhcpv6Renew, start, opts)
+	}
+
+	reply, err := c.exchange(renew, dhcpv6RenTimeout, dhcpv6RenMaxRT, 0, lease.Obtained.Add(lease.Rebinding), dhcpv6Reply)
+
+	if err == nil {
+		if renewed, err = c.parseLease(reply, true); err == nil {
+			return
+		}
+	}
+
+	c.newXID()
+	start = time.Now()
+
+	rebind := func() []byte {
+		return c.message(dhcpv6Rebind, start, iana(lease.Address.Address))
+	}
+
+	if reply, err = c.exchange(rebind, dhcpv6RenTimeout, dhcpv6RenMaxRT, 0, lease.Obtained.Add(lease.Valid), dhcpv6Reply); err != nil {
+		return
+	}
+
+	return c.parseLease(reply, true)
+}
+
+// inform obtains a stateless configuration through Information-request
+// messages (RFC 8415 - 18.2.6).
+func (c *dhcpv6Client) inform() (lease *DHCPv6Lease, err error) {
+	c.newXID()
+	start := time.Now()
+
+	inform := func() []byte {
+		return c.message(dhcpv6InformationRequest, start, nil)
+	}
+
+	reply, err := c.exchange(inform, dhcpv6InfTimeout, dhcpv6InfMaxRT, 0, time.Time{}, dhcpv6Reply)
+
+	if err != nil {
+		return
+	}
+
+	return c.parseLease(reply, false)
+}
+
+// bindLease6 configures the interface with a DHCPv6 lease.
+func (iface *Interface) bindLease6(lease *DHCPv6Lease) (err error) {
+	if len(lease.Address.Address) > 0 {
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol:          ipv6.ProtocolNumber,
+			AddressWithPrefix: lease.Address,
+		}
+
+		if err := iface.Stack.AddProtocolAddress(iface.nicid, protocolAddr, stack.AddressProperties{}); err != nil {
+			return fmt.Errorf("%v", err)
+		}
+	}
+
+	iface.mu.Lock()
+
+	if len(iface.address6.Address) == 0 {
+		iface.address6 = lease.Address
+	}
+
+	iface.dhcpv6Lease = lease
+	iface.mu.Unlock()
+
+	iface.setLeaseOptions6(lease.LeaseOptions)
+
+	return
+}
+
+// unbindLease6 removes a DHCPv6 lease configuration from the interface.
+func (iface *Interface) unbindLease6(lease *DHCPv6Lease) {
+	if len(lease.Address.Address) > 0 {
+		iface.Stack.RemoveAddress(iface.nicid, lease.Address.Address)
+	}
+
+	iface.mu.Lock()
+
+	if iface.address6 == lease.Address {
+		iface.address6 = tcpip.AddressWithPrefix{}
+	}
+
+	iface.dhcpv6Lease = nil
+	iface.mu.Unlock()
+
+	iface.setLeaseOptions6(LeaseOptions{})
+}
+
+// runStateful maintains a lease obtained through DHCPv6 stateful
+// configuration.
+func (c *dhcpv6Client) runStateful() {
+	iface := c.iface
+
+	for {
+		lease, err := c.acquire()
+
+		if err != nil {
+			if !iface.sleep(dhcpv6SolTimeout) {
+				return
+			}
+
+			continue
+		}
+
+		if err = iface.bindLease6(lease); err != nil {
+			if !iface.sleep(dhcpv6SolMaxRT / 60) {
+				return
+			}
+
+			continue
+		}
+
+		for {
+			if !iface.sleep(time.Until(lease.Obtained.Add(lease.Renewal))) {
+				return
+			}
+
+			renewed, err := c.renew(lease)
+
+			if err != nil || renewed.Address != lease.Address {
+				iface.unbindLease6(lease)
+				break
+			}
+
+			iface.mu.Lock()
+			iface.dhcpv6Lease = renewed
+			iface.mu.Unlock()
+
+			iface.setLeaseOptions6(renewed.LeaseOptions)
+			lease = renewed
+		}
+	}
+}
+
+// runStateless maintains a configuration obtained through DHCPv6 stateless
+// configuration.
+func (c *dhcpv6Client) runStateless() {
+	for {
+		lease, err := c.inform()
+
+		if err != nil {
+			if !c.iface.sleep(dhcpv6InfTimeout) {
+				return
+			}
+
+			continue
+		}
+
+		c.iface.bindLease6(lease)
+
+		if !c.iface.sleep(lease.Renewal) {
+			return
+		}
+	}
+}
+
+// run performs stateful configuration or, when SLAAC is enabled, the
+// configuration mode first advertised by routers (RFC 4861 - 4.2).
+func (c *dhcpv6Client) run() {
+	if !c.iface.opts.IPv6.SLAAC {
+		c.runStateful()
+		return
+	}
+
+	for {
+		select {
+		case <-c.iface.done:
+			return
+		case mode := <-c.mode:
+			switch mode {
+			case ipv6.DHCPv6ManagedAddress:
+				c.runStateful()
+			case ipv6.DHCPv6OtherConfigurations:
+				c.runStateless()
+			}
+		}
+	}
+}
+
+// startDHCPv6 starts the DHCPv6 client (RFC 8415) in the background.
+func (iface *Interface) startDHCPv6() (err error) {
+	var wq waiter.Queue
+
+	ep, tcpErr := iface.Stack.NewEndpoint(udp.ProtocolNumber, ipv6.ProtocolNumber, &wq)
+
+	if tcpErr != nil {
+		return fmt.Errorf("endpoint error (udp): %v", tcpErr)
+	}
+
+	if tcpErr := ep.Bind(tcpip.FullAddress{NIC: iface.nicid, Port: dhcpv6ClientPort}); tcpErr != nil {
+		ep.Close()
+		return fmt.Errorf("bind error (udp): %v", tcpErr)
+	}
+
+	duid := make([]byte, 4)
+	binary.BigEndian.PutUint16(duid[0:2], dhcpv6DUIDLL)
+	binary.BigEndian.PutUint16(duid[2:4], 1) // Ethernet
+
+	iface.dhcpv6 = &dhcpv6Client{
+		iface: iface,
+		conn:  gonet.NewUDPConn(iface.Stack, &wq, ep),
+		duid:  append(duid, iface.NIC.MAC...),
+		mode:  make(chan ipv6.DHCPv6ConfigurationFromNDPRA, 1),
+	}
+
+	go iface.dhcpv6.run()
+
+	return
+}
+
+// DHCPv6Lease returns the current DHCPv6 lease, nil is returned when DHCPv6
+// is not enabled or no lease is currently bound.
+func (iface *Interface) DHCPv6Lease() *DHCPv6Lease {
+	iface.mu.RLock()
+	defer iface.mu.RUnlock()
+
+	if iface.dhcpv6Lease == nil {
+		return nil
+	}
+
+	lease := *iface.dhcpv6Lease
+
+	return &lease
+}
@@ -0,0 +1,228 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// ConnectionAttemptDelay is the delay between successive connection attempts
+// of dual-stack dials (RFC 8305 - 5).
+var ConnectionAttemptDelay = 250 * time.Millisecond
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialAddresses returns the addresses to dial for the argument host, ordered
+// according to RFC 8305 - 4, omitting families not configured on the
+// interface.
+func (iface *Interface) dialAddresses(ctx context.Context, network string, host string) (addrs []net.IP, err error) {
+	var ips []net.IP
+	var v4, v6 []net.IP
+
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		res, err := iface.LookupHost(ctx, host)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range res {
+			if ip := net.ParseIP(addr); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	hasIPv4 := len(iface.address.Address) > 0 && network != "tcp6" && network != "udp6"
+	hasIPv6 := iface.opts.IPv6 != nil && network != "tcp4" && network != "udp4"
+
+	for _, ip := range ips {
+		switch {
+		case ip.To4() != nil && hasIPv4:
+			v4 = append(v4, ip.To4())
+		case ip.To4() == nil && hasIPv6:
+			v6 = append(v6, ip)
+		}
+	}
+
+	first, second := v6, v4
+
+	if iface.opts.PreferIPv4 {
+		first, second = v4, v6
+	}
+
+	for len(first) > 0 || len(second) > 0 {
+		if len(first) > 0 {
+			addrs = append(addrs, first[0])
+			first = first[1:]
+		}
+
+		if len(second) > 0 {
+			addrs = append(addrs, second[0])
+			second = second[1:]
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no suitable address for %s", host)
+	}
+
+	return
+}
+
+// dialAddress connects to the argument address, from the interface address of
+// its family when configured, so that every attempt originates from the
+// address the interface is known by.
+func (iface *Interface) dialAddress(ctx context.Context, ip net.IP, port uint16) (net.Conn, error) {
+	var local tcpip.FullAddress
+
+	proto := ipv4.ProtocolNumber
+	localAddress := iface.localAddress
+
+	if ip.To4() == nil {
+		proto = ipv6.ProtocolNumber
+		localAddress = iface.localAddress6
+	}
+
+	if addr, err := localAddress(); err == nil {
+		local.Addr = addr
+	}
+
+	addr := tcpip.FullAddress{Addr: tcpip.Address(ip), Port: port}
+	conn, err := gonet.DialTCPWithBind(ctx, iface.Stack, local, addr, proto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return (net.Conn)(conn), nil
+}
+
+// DialContext connects to a TCP address over the Ethernet interface, the host
+// can be either an IP address or a name resolved through LookupHost().
+//
+// Names resolving to both IPv4 and IPv6 addresses are dialed as mandated by
+// RFC 8305 (Happy Eyeballs), by starting connection attempts in parallel,
+// staggered by ConnectionAttemptDelay, and returning the first established
+// one. IPv6 addresses are attempted first unless Options.PreferIPv4 is set,
+// families not configured on the interface are skipped.
+func (iface *Interface) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("unsupported network")
+	}
+
+	host, p, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(p, 10, 16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.dialAddresses(ctx, network, host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(addrs))
+	next := 0
+	pending := 0
+
+	attempt := func() {
+		go func(ip net.IP) {
+			conn, err := iface.dialAddress(ctx, ip, uint16(port))
+			results <- dialResult{conn, err}
+		}(addrs[next])
+
+		next++
+		pending++
+	}
+
+	var errs []string
+
+	for next < len(addrs) || pending > 0 {
+		var delay <-chan time.Time
+
+		if next < len(addrs) {
+			// a failed attempt starts the next one immediately
+			if pending == 0 {
+				attempt()
+				continue
+			}
+
+			delay = time.After(ConnectionAttemptDelay)
+		}
+
+		select {
+		case res := <-results:
+			pending--
+
+			if res.err == nil {
+				go drainDials(results, pending)
+				return res.conn, nil
+			}
+
+			errs = append(errs, res.err.Error())
+		case <-delay:
+			attempt()
+		case <-ctx.Done():
+			go drainDials(results, pending)
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, fmt.Errorf("dial %s: %s", address, strings.Join(errs, "; "))
+}
+
+// drainDials closes connections established by attempts which lost the race.
+func drainDials(results chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if res := <-results; res.err == nil {
+			res.conn.Close()
+		}
+	}
+}
+
+// Dial connects to an address over the Ethernet interface, on the argument
+// network ("tcp", "tcp4" or "tcp6"), see DialContext().
+func (iface *Interface) Dial(network string, address string) (net.Conn, error) {
+	return iface.DialContext(context.Background(), network, address)
+}
+
+// DialTCP connects to a TCP address over the Ethernet interface, see
+// DialContext().
+func (iface *Interface) DialTCP(address string) (net.Conn, error) {
+	return iface.DialContext(context.Background(), "tcp", address)
+}
@@ -0,0 +1,153 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testDNSServer answers A and AAAA queries, for any name, with the argument
+// addresses.
+func testDNSServer(t *testing.T, iface *Interface, address string, addrs ...string) {
+	conn, err := iface.ListenUDP("udp4", address)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, dnsMaxUDPSize)
+
+		for {
+			n, src, err := conn.ReadFrom(buf)
+
+			if err != nil {
+				return
+			}
+
+			query := buf[:n]
+
+			_, size, err := readName(query, dnsHeaderLen)
+
+			if err != nil || dnsHeaderLen+size+4 > n {
+				continue
+			}
+
+			off := dnsHeaderLen + size
+			qtype := binary.BigEndian.Uint16(query[off : off+2])
+
+			res := append([]byte{}, query[:off+4]...)
+			binary.BigEndian.PutUint16(res[2:4], dnsFlagResponse|dnsFlagRecursion)
+
+			var ancount uint16
+
+			for _, addr := range addrs {
+				ip := net.ParseIP(addr)
+
+				switch {
+				case qtype == dnsTypeA && ip.To4() != nil:
+					ip = ip.To4()
+				case qtype == dnsTypeAAAA && ip.To4() == nil:
+				default:
+					continue
+				}
+
+				// name pointer to the question, class IN, TTL 60
+				res = append(res, 0xc0, dnsHeaderLen, byte(qtype>>8), byte(qtype), 0, dnsClassIN, 0, 0, 0, 60, 0, byte(len(ip)))
+				res = append(res, ip...)
+				ancount++
+			}
+
+			binary.BigEndian.PutUint16(res[6:8], ancount)
+			conn.WriteTo(res, src)
+		}
+	}()
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	a, b := testPair(t, func(n int, opts *Options) {
+		opts.IPv6 = &IPConfig{Address: fmt.Sprintf("fd00::%d/64", n)}
+		opts.DisableDAD = true
+
+		if n == 1 {
+			opts.DNSServers = []string{"10.0.0.2"}
+		}
+	})
+	testDNSServer(t, b, "10.0.0.2:53", "10.0.0.2", "10.0.0.3", "fd00::2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, test := range []struct {
+		preferIPv4 bool
+		network    string
+		addrs      []string
+	}{
+		{false, "tcp", []string{"fd00::2", "10.0.0.2", "10.0.0.3"}},
+		{true, "tcp", []string{"10.0.0.2", "fd00::2", "10.0.0.3"}},
+		{false, "tcp4", []string{"10.0.0.2", "10.0.0.3"}},
+		{false, "tcp6", []string{"fd00::2"}},
+	} {
+		a.opts.PreferIPv4 = test.preferIPv4
+
+		ips, err := a.dialAddresses(ctx, test.network, "dual.example.")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var addrs []string
+
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+
+		if !reflect.DeepEqual(addrs, test.addrs) {
+			t.Errorf("unexpected %s order (PreferIPv4: %v), %v", test.network, test.preferIPv4, addrs)
+		}
+	}
+
+	a.opts.PreferIPv4 = false
+
+	l, err := b.ListenerTCP4(80)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	defer func(delay time.Duration) {
+		ConnectionAttemptDelay = delay
+	}(ConnectionAttemptDelay)
+
+	// a refused IPv6 attempt must start the IPv4 one without waiting for
+	// the attempt delay
+	ConnectionAttemptDelay = time.Minute
+
+	conn, err := a.DialContext(ctx, "tcp", "dual.example.:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if addr := conn.RemoteAddr().String(); addr != "10.0.0.2:80" {
+		t.Errorf("unexpected remote address %s", addr)
+	}
+}
@@ -0,0 +1,486 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// DLEP constants (RFC 8175)
+const (
+	// DLEPPort is the IANA assigned DLEP UDP and TCP port.
+	DLEPPort = 854
+	// DLEPMulticastAddress is the IPv4 link-local multicast address for
+	// DLEP Peer Discovery signals.
+	DLEPMulticastAddress = "224.0.0.117"
+
+	dlepSignalPrefix      = "DLEP"
+	dlepHeaderLen         = 4
+	dlepHeartbeatInterval = 60 * time.Second
+	dlepHeartbeatMissed   = 2
+	dlepDiscoveryInterval = 1 * time.Second
+	dlepPeerType          = "TamaGo"
+)
+
+// DLEP signal and message types (RFC 8175 - 15.3, 15.4)
+const (
+	dlepPeerDiscovery = 1
+	dlepPeerOffer     = 2
+
+	dlepSessionInit            = 1
+	dlepSessionInitResponse    = 2
+	dlepSessionUpdate          = 3
+	dlepSessionUpdateResponse  = 4
+	dlepSessionTermination     = 5
+	dlepSessionTerminationResp = 6
+	dlepDestinationUp          = 7
+	dlepDestinationUpResponse  = 8
+	dlepDestinationDown        = 11
+	dlepDestinationDownResp    = 12
+	dlepDestinationUpdate      = 13
+	dlepHeartbeat              = 16
+)
+
+// DLEP data item types (RFC 8175 - 15.8)
+const (
+	dlepStatus              = 1
+	dlepIPv4ConnectionPoint = 2
+	dlepPeerTypeItem        = 4
+	dlepHeartbeatItem       = 5
+	dlepMACAddress          = 7
+	dlepCDRR                = 14
+	dlepCDRT                = 15
+	dlepLatency             = 16
+	dlepRLQR                = 18
+	dlepRLQT                = 19
+)
+
+// DLEPMetrics represents the link metrics reported by a DLEP modem.
+type DLEPMetrics struct {
+	// RLQRX is the Relative Link Quality (Receive), from 0 to 100.
+	RLQRX uint8
+	// RLQTX is the Relative Link Quality (Transmit), from 0 to 100.
+	RLQTX uint8
+	// RxDataRate is the Current Data Rate (Receive) in bits per second.
+	RxDataRate uint64
+	// TxDataRate is the Current Data Rate (Transmit) in bits per second.
+	TxDataRate uint64
+	// Latency is the transmission delay in microseconds.
+	Latency uint32
+}
+
+// DLEPSession represents a DLEP (RFC 8175) session with a modem, where the
+// interface acts as router.
+type DLEPSession struct {
+	sync.Mutex
+
+	conn      net.Conn
+	metrics   DLEPMetrics
+	heartbeat time.Duration
+	done      chan struct{}
+	once      sync.Once
+}
+
+type dlepDataItem struct {
+	Type  uint16
+	Value []byte
+}
+
+func marshalDLEP(t uint16, items []dlepDataItem) []byte {
+	buf := new(bytes.Buffer)
+
+	for _, item := range items {
+		binary.Write(buf, binary.BigEndian, item.Type)
+		binary.Write(buf, binary.BigEndian, uint16(len(item.Value)))
+		buf.Write(item.Value)
+	}
+
+	hdr := make([]byte, dlepHeaderLen)
+	binary.BigEndian.PutUint16(hdr[0:2], t)
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(buf.Len()))
+
+	return append(hdr, buf.Bytes()...)
+}
+
+func unmarshalDLEPItems(buf []byte) (items []dlepDataItem, err error) {
+	for len(buf) > 0 {
+		if len(buf) < dlepHeaderLen {
+			return nil, errors.New("invalid data item header")
+		}
+
+		t := binary.BigEndian.Uint16(buf[0:2])
+		n := int(binary.BigEndian.Uint16(buf[2:4]))
+
+		if len(buf) < dlepHeaderLen+n {
+			return nil, errors.New("invalid data item length")
+		}
+
+		items = append(items, dlepDataItem{
+			Type:  t,
+			Value: buf[dlepHeaderLen : dlepHeaderLen+n],
+		})
+
+		buf = buf[dlepHeaderLen+n:]
+	}
+
+	return
+}
+
+func dlepUint32(v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	return buf
+}
+
+// discoverDLEP sends Peer Discovery signals until a Peer Offer is received, the
+// advertised TCP connection point is returned (RFC 8175 - 7.1).
+func (iface *Interface) discoverDLEP(ctx context.Context, peer net.IP) (addr tcpip.FullAddress, err error) {
+	local, err := iface.localAddress()
+
+	if err != nil {
+		return
+	}
+
+	laddr := &tcpip.FullAddress{Addr: local, NIC: iface.nicid}
+	conn, err := gonet.DialUDP(iface.Stack, laddr, nil, ipv4.ProtocolNumber)
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	dst := &net.UDPAddr{IP: net.ParseIP(DLEPMulticastAddress), Port: DLEPPort}
+	signal := append([]byte(dlepSignalPrefix), marshalDLEP(dlepPeerDiscovery, nil)...)
+	buf := make([]byte, 1500)
+
+	for {
+		if _, err = conn.WriteTo(signal, dst); err != nil {
+			return
+		}
+
+		deadline := time.Now().Add(dlepDiscoveryInterval)
+
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+
+		conn.SetReadDeadline(deadline)
+
+		for {
+			n, src, err := conn.ReadFrom(buf)
+
+			if err != nil {
+				break
+			}
+
+			if addr, err = parseDLEPOffer(buf[:n], src.(*net.UDPAddr), peer); err == nil {
+				return addr, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return addr, ctx.Err()
+		default:
+		}
+	}
+}
+
+func parseDLEPOffer(buf []byte, src *net.UDPAddr, peer net.IP) (addr tcpip.FullAddress, err error) {
+	if peer != nil && !src.IP.Equal(peer) {
+		return addr, errors.New("unexpected peer")
+	}
+
+	if len(buf) < len(dlepSignalPrefix)+dlepHeaderLen || string(buf[0:4]) != dlepSignalPrefix {
+		return addr, errors.New("invalid signal")
+	}
+
+	buf = buf[len(dlepSignalPrefix):]
+
+	if t := binary.BigEndian.Uint16(buf[0:2]); t != dlepPeerOffer {
+		return addr, errors.New("unexpected signal")
+	}
+
+	items, err := unmarshalDLEPItems(buf[dlepHeaderLen:])
+
+	if err != nil {
+		return
+	}
+
+	addr = tcpip.FullAddress{Addr: tcpip.Address(src.IP.To4()), Port: DLEPPort}
+
+	for _, item := range items {
+		// Flags, IPv4 Address and optional TCP Port (RFC 8175 - 13.2)
+		if item.Type == dlepIPv4ConnectionPoint && len(item.Value) >= 5 {
+			addr.Addr = tcpip.Address(item.Value[1:5])
+
+			if len(item.Value) >= 7 {
+				addr.Port = binary.BigEndian.Uint16(item.Value[5:7])
+			}
+
+			break
+		}
+	}
+
+	return
+}
+
+// DialDLEP performs DLEP (RFC 8175) Peer Discovery, Session Initialization and
+// metrics reporting, acting as router, towards the argument modem address
+// (discovery offers from other peers are ignored). An empty address accepts
+// the first discovered peer.
+func (iface *Interface) DialDLEP(ctx context.Context, routerAddr string) (s *DLEPSession, err error) {
+	var peer net.IP
+
+	if len(routerAddr) > 0 {
+		if peer = net.ParseIP(routerAddr).To4(); peer == nil {
+			return nil, fmt.Errorf("invalid address %q", routerAddr)
+		}
+	}
+
+	addr, err := iface.discoverDLEP(ctx, peer)
+
+	if err != nil {
+		return
+	}
+
+	conn, err := gonet.DialContextTCP(ctx, iface.Stack, addr, ipv4.ProtocolNumber)
+
+	if err != nil {
+		return
+	}
+
+	s = &DLEPSession{
+		conn:      conn,
+		heartbeat: dlepHeartbeatInterval,
+		done:      make(chan struct{}),
+	}
+
+	if err = s.init(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go s.handle()
+	go s.keepalive()
+
+	return
+}
+
+func (s *DLEPSession) send(t uint16, items []dlepDataItem) (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	_, err = s.conn.Write(marshalDLEP(t, items))
+
+	return
+}
+
+func (s *DLEPSession) recv() (t uint16, items []dlepDataItem, err error) {
+	hdr := make([]byte, dlepHeaderLen)
+
+	if _, err = io.ReadFull(s.conn, hdr); err != nil {
+		return
+	}
+
+	t = binary.BigEndian.Uint16(hdr[0:2])
+	buf := make([]byte, binary.BigEndian.Uint16(hdr[2:4]))
+
+	if _, err = io.ReadFull(s.conn, buf); err != nil {
+		return
+	}
+
+	items, err = unmarshalDLEPItems(buf)
+
+	return
+}
+
+// init performs the session initialization handshake (RFC 8175 - 7.2).
+func (s *DLEPSession) init(ctx context.Context) (err error) {
+	if d, ok := ctx.Deadline(); ok {
+		s.conn.SetDeadline(d)
+		defer s.conn.SetDeadline(time.Time{})
+	}
+
+	items := []dlepDataItem{
+		{Type: dlepHeartbeatItem, Value: dlepUint32(uint32(s.heartbeat.Milliseconds()))},
+		{Type: dlepPeerTypeItem, Value: append([]byte{0}, dlepPeerType...)},
+	}
+
+	if err = s.send(dlepSessionInit, items); err != nil {
+		return
+	}
+
+	t, items, err := s.recv()
+
+	if err != nil {
+		return
+	}
+
+	if t != dlepSessionInitResponse {
+		return fmt.Errorf("unexpected message type %d", t)
+	}
+
+	if err = dlepStatusError(items); err != nil {
+		return
+	}
+
+	for _, item := range items {
+		if item.Type == dlepHeartbeatItem && len(item.Value) == 4 {
+			if ms := binary.BigEndian.Uint32(item.Value); ms > 0 {
+				s.heartbeat = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	s.update(items)
+
+	return
+}
+
+func dlepStatusError(items []dlepDataItem) error {
+	for _, item := range items {
+		if item.Type == dlepStatus && len(item.Value) > 0 && item.Value[0] != 0 {
+			return fmt.Errorf("DLEP status code %d (%s)", item.Value[0], item.Value[1:])
+		}
+	}
+
+	return nil
+}
+
+// update applies metric data items (RFC 8175 - 13.7 to 13.17).
+func (s *DLEPSession) update(items []dlepDataItem) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, item := range items {
+		switch {
+		case item.Type == dlepCDRR && len(item.Value) == 8:
+			s.metrics.RxDataRate = binary.BigEndian.Uint64(item.Value)
+		case item.Type == dlepCDRT && len(item.Value) == 8:
+			s.metrics.TxDataRate = binary.BigEndian.Uint64(item.Value)
+		case item.Type == dlepLatency && len(item.Value) == 8:
+			latency := binary.BigEndian.Uint64(item.Value)
+
+			if latency > math.MaxUint32 {
+				latency = math.MaxUint32
+			}
+
+			s.metrics.Latency = uint32(latency)
+		case item.Type == dlepRLQR && len(item.Value) == 1:
+			s.metrics.RLQRX = item.Value[0]
+		case item.Type == dlepRLQT && len(item.Value) == 1:
+			s.metrics.RLQTX = item.Value[0]
+		}
+	}
+}
+
+// handle processes modem messages, the session is terminated when none is
+// received within two modem heartbeat intervals (RFC 8175 - 5.1).
+func (s *DLEPSession) handle() {
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(dlepHeartbeatMissed * s.heartbeat))
+
+		t, items, err := s.recv()
+
+		if err != nil {
+			s.Close()
+			return
+		}
+
+		switch t {
+		case dlepSessionUpdate:
+			s.update(items)
+			s.send(dlepSessionUpdateResponse, []dlepDataItem{{Type: dlepStatus, Value: []byte{0}}})
+		case dlepDestinationUp:
+			s.update(items)
+			s.send(dlepDestinationUpResponse, append(dlepMAC(items), dlepDataItem{Type: dlepStatus, Value: []byte{0}}))
+		case dlepDestinationUpdate:
+			s.update(items)
+		case dlepDestinationDown:
+			s.send(dlepDestinationDownResp, append(dlepMAC(items), dlepDataItem{Type: dlepStatus, Value: []byte{0}}))
+		case dlepSessionTermination:
+			s.send(dlepSessionTerminationResp, nil)
+			s.close(false)
+			return
+		}
+	}
+}
+
+func dlepMAC(items []dlepDataItem) []dlepDataItem {
+	for _, item := range items {
+		if item.Type == dlepMACAddress {
+			return []dlepDataItem{item}
+		}
+	}
+
+	return nil
+}
+
+func (s *DLEPSession) keepalive() {
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.send(dlepHeartbeat, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Metrics returns the last link metrics reported by the modem.
+func (s *DLEPSession) Metrics() DLEPMetrics {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.metrics
+}
+
+// Done returns a channel which is closed when the session terminates.
+func (s *DLEPSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// close releases the session, signaling its termination to the modem when
+// requested.
+func (s *DLEPSession) close(terminate bool) (err error) {
+	s.once.Do(func() {
+		if terminate {
+			s.send(dlepSessionTermination, []dlepDataItem{{Type: dlepStatus, Value: []byte{0}}})
+		}
+
+		close(s.done)
+		err = s.conn.Close()
+	})
+
+	return
+}
+
+// Close terminates the DLEP session.
+func (s *DLEPSession) Close() (err error) {
+	return s.close(true)
+}
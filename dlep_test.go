@@ -0,0 +1,96 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testDLEPSession returns a session, with the argument heartbeat interval,
+// along with the modem end of its connection.
+func testDLEPSession(t *testing.T, heartbeat time.Duration) (s *DLEPSession, modem net.Conn) {
+	conn, modem := net.Pipe()
+
+	s = &DLEPSession{
+		conn:      conn,
+		heartbeat: heartbeat,
+		done:      make(chan struct{}),
+	}
+
+	t.Cleanup(func() {
+		modem.Close()
+		s.Close()
+	})
+
+	go s.handle()
+
+	return
+}
+
+// testDLEPMessage reads the next message type from the modem end of a
+// session connection, skipping heartbeats.
+func testDLEPMessage(modem net.Conn) (t uint16, err error) {
+	hdr := make([]byte, dlepHeaderLen)
+
+	for {
+		modem.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		if _, err = io.ReadFull(modem, hdr); err != nil {
+			return
+		}
+
+		if _, err = io.ReadFull(modem, make([]byte, binary.BigEndian.Uint16(hdr[2:4]))); err != nil {
+			return
+		}
+
+		if t = binary.BigEndian.Uint16(hdr[0:2]); t != dlepHeartbeat {
+			return
+		}
+	}
+}
+
+func TestDLEPTermination(t *testing.T) {
+	s, modem := testDLEPSession(t, time.Minute)
+
+	go modem.Write(marshalDLEP(dlepSessionTermination, []dlepDataItem{{Type: dlepStatus, Value: []byte{0}}}))
+
+	if typ, err := testDLEPMessage(modem); err != nil || typ != dlepSessionTerminationResp {
+		t.Fatalf("unexpected reply %d, %v", typ, err)
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed")
+	}
+
+	// the terminated session must not in turn request termination
+	if typ, err := testDLEPMessage(modem); err == nil {
+		t.Fatalf("unexpected message %d", typ)
+	}
+}
+
+func TestDLEPHeartbeatTimeout(t *testing.T) {
+	s, modem := testDLEPSession(t, 100*time.Millisecond)
+
+	// the silent modem is notified of the session termination
+	if typ, err := testDLEPMessage(modem); err != nil || typ != dlepSessionTermination {
+		t.Fatalf("unexpected message %d, %v", typ, err)
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed on missed heartbeats")
+	}
+}
@@ -0,0 +1,364 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS constants (RFC 1035)
+const (
+	// DNSPort is the DNS server UDP and TCP port.
+	DNSPort = 53
+
+	dnsHeaderLen  = 12
+	dnsMaxUDPSize = 512
+
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeAAAA  = 28
+	dnsClassIN   = 1
+
+	dnsFlagResponse  = 0x8000
+	dnsFlagTruncated = 0x0200
+	dnsFlagRecursion = 0x0100
+
+	dnsRcodeNameError = 3
+)
+
+// DNSTimeout is the timeout of each DNS query attempt.
+var DNSTimeout = 2 * time.Second
+
+// errDNSNotFound is returned for names with no records of the queried type.
+var errDNSNotFound = errors.New("no such host")
+
+func dnsQuery(id uint16, name string, qtype uint16) (buf []byte, err error) {
+	qname, err := encodeName(name)
+
+	if err != nil {
+		return
+	}
+
+	buf = make([]byte, dnsHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], id)
+	binary.BigEndian.PutUint16(buf[2:4], dnsFlagRecursion)
+	binary.BigEndian.PutUint16(buf[4:6], 1)
+
+	buf = append(buf, qname...)
+	buf = append(buf, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+
+	return
+}
+
+// parseDNSResponse returns the addresses of the queried type found in a DNS
+// response.
+func parseDNSResponse(buf []byte, id uint16, qtype uint16) (addrs []string, truncated bool, err error) {
+	if len(buf) < dnsHeaderLen || binary.BigEndian.Uint16(buf[0:2]) != id {
+		return nil, false, errors.New("invalid response")
+	}
+
+	flags := binary.BigEndian.Uint16(buf[2:4])
+
+	if flags&dnsFlagResponse == 0 {
+		return nil, false, errors.New("invalid response")
+	}
+
+	if flags&dnsFlagTruncated != 0 {
+		return nil, true, nil
+	}
+
+	switch rcode := flags & 0xf; rcode {
+	case 0:
+	case dnsRcodeNameError:
+		return nil, false, errDNSNotFound
+	default:
+		return nil, false, errors.New("server failure")
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(buf[4:6]))
+	ancount := int(binary.BigEndian.Uint16(buf[6:8]))
+	off := dnsHeaderLen
+
+	for i := 0; i < qdcount; i++ {
+		_, n, err := readName(buf, off)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		off += n + 4
+	}
+
+	for i := 0; i < ancount; i++ {
+		_, n, err := readName(buf, off)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		off += n
+
+		if off+10 > len(buf) {
+			return nil, false, errors.New("invalid record")
+		}
+
+		rtype := binary.BigEndian.Uint16(buf[off : off+2])
+		class := binary.BigEndian.Uint16(buf[off+2 : off+4])
+		size := int(binary.BigEndian.Uint16(buf[off+8 : off+10]))
+		off += 10
+
+		if off+size > len(buf) {
+			return nil, false, errors.New("invalid record length")
+		}
+
+		data := buf[off : off+size]
+		off += size
+
+		switch {
+		// the mDNS cache-flush bit is ignored (RFC 6762 - 10.2)
+		case class&0x7fff != dnsClassIN || rtype != qtype:
+			continue
+		case rtype == dnsTypeA && size == net.IPv4len:
+			addrs = append(addrs, net.IP(data).String())
+		case rtype == dnsTypeAAAA && size == net.IPv6len:
+			addrs = append(addrs, net.IP(data).String())
+		}
+	}
+
+	if len(addrs) == 0 {
+		err = errDNSNotFound
+	}
+
+	return
+}
+
+func (iface *Interface) exchangeUDP(ctx context.Context, server string, query []byte) (res []byte, err error) {
+	conn, err := iface.dialUDP("", server, addressProtocol(server), nil)
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(DNSTimeout)
+
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn.SetDeadline(deadline)
+
+	if _, err = conn.Write(query); err != nil {
+		return
+	}
+
+	buf := make([]byte, dnsMaxUDPSize)
+
+	for {
+		n, err := conn.Read(buf)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// discard responses to other queries
+		if n >= 2 && binary.BigEndian.Uint16(buf) == binary.BigEndian.Uint16(query) {
+			return buf[:n], nil
+		}
+	}
+}
+
+func (iface *Interface) exchangeTCP(ctx context.Context, server string, query []byte) (res []byte, err error) {
+	ctx, cancel := context.WithTimeout(ctx, DNSTimeout)
+	defer cancel()
+
+	conn, err := iface.DialContextTCP(ctx, "", server)
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+
+	// RFC 1035 - 4.2.2
+	msg := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+
+	if _, err = conn.Write(append(msg, query...)); err != nil {
+		return
+	}
+
+	if _, err = io.ReadFull(conn, msg); err != nil {
+		return
+	}
+
+	res = make([]byte, binary.BigEndian.Uint16(msg))
+	_, err = io.ReadFull(conn, res)
+
+	return
+}
+
+// lookup queries the configured DNS servers for the argument name and
+// record type, falling back to TCP for truncated responses.
+func (iface *Interface) lookup(ctx context.Context, servers []string, name string, qtype uint16) (addrs []string, err error) {
+	id := uint16(iface.Stack.Rand().Uint32())
+	query, err := dnsQuery(id, name, qtype)
+
+	if err != nil {
+		return
+	}
+
+	err = errors.New("no DNS servers configured")
+
+	for _, s := range servers {
+		var res []byte
+		var truncated bool
+
+		server := net.JoinHostPort(s, strconv.Itoa(DNSPort))
+
+		if res, err = iface.exchangeUDP(ctx, server, query); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			continue
+		}
+
+		if addrs, truncated, err = parseDNSResponse(res, id, qtype); truncated {
+			if res, err = iface.exchangeTCP(ctx, server, query); err != nil {
+				continue
+			}
+
+			addrs, _, err = parseDNSResponse(res, id, qtype)
+		}
+
+		if err == nil || err == errDNSNotFound {
+			return
+		}
+	}
+
+	return
+}
+
+// resolve queries all argument record types for a name through the argument
+// lookup function.
+func resolve(name string, qtypes []uint16, lookup func(name string, qtype uint16) ([]string, error)) (addrs []string, err error) {
+	for _, qtype := range qtypes {
+		res, e := lookup(name, qtype)
+
+		if e != nil && e != errDNSNotFound {
+			err = e
+		}
+
+		addrs = append(addrs, res...)
+	}
+
+	return
+}
+
+// LookupHost resolves a hostname to its IPv4 and IPv6 addresses (the latter
+// only when IPv6 is enabled on the interface), through the DNS servers
+// returned by DNSServers(). Queries are sent over UDP, with TCP fallback for
+// truncated responses, and relative names are qualified with the domains
+// returned by DomainSearch().
+//
+// Names within the ".local" domain are resolved through mDNS (RFC 6762)
+// while single-label names, not resolved through DNS, are resolved through
+// LLMNR (RFC 4795).
+//
+// Resolution errors are returned as *net.DNSError.
+func (iface *Interface) LookupHost(ctx context.Context, name string) (addrs []string, err error) {
+	if ip := net.ParseIP(name); ip != nil {
+		return []string{name}, nil
+	}
+
+	servers := iface.DNSServers()
+	qtypes := []uint16{dnsTypeA}
+
+	if iface.opts.IPv6 != nil {
+		qtypes = append(qtypes, dnsTypeAAAA)
+	}
+
+	dns := func(name string, qtype uint16) ([]string, error) {
+		return iface.lookup(ctx, servers, name, qtype)
+	}
+
+	mdns := func(name string, qtype uint16) ([]string, error) {
+		return iface.multicastLookup(ctx, mdnsQueryAddress, name, qtype)
+	}
+
+	llmnr := func(name string, qtype uint16) ([]string, error) {
+		return iface.multicastLookup(ctx, llmnrQueryAddress, name, qtype)
+	}
+
+	fqdn := strings.TrimSuffix(name, ".")
+
+	switch {
+	case strings.HasSuffix(strings.ToLower(fqdn), ".local"):
+		addrs, err = resolve(fqdn, qtypes, mdns)
+	case strings.HasSuffix(name, "."):
+		addrs, err = resolve(name, qtypes, dns)
+	default:
+		var names []string
+
+		if strings.Contains(name, ".") {
+			names = append(names, name)
+		}
+
+		for _, domain := range iface.DomainSearch() {
+			names = append(names, name+"."+strings.TrimSuffix(domain, "."))
+		}
+
+		if !strings.Contains(name, ".") {
+			names = append(names, name)
+		}
+
+		for _, n := range names {
+			if addrs, err = resolve(n, qtypes, dns); len(addrs) > 0 || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if len(addrs) == 0 && !strings.Contains(name, ".") && ctx.Err() == nil {
+			addrs, err = resolve(name, qtypes, llmnr)
+		}
+	}
+
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+
+	dnsErr := &net.DNSError{
+		Name: name,
+		Err:  errDNSNotFound.Error(),
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		dnsErr.Err = ctx.Err().Error()
+		dnsErr.IsTimeout = ctx.Err() == context.DeadlineExceeded
+	case err != nil:
+		dnsErr.Err = err.Error()
+		dnsErr.IsTemporary = true
+	default:
+		dnsErr.IsNotFound = true
+	}
+
+	return nil, dnsErr
+}
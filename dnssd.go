@@ -0,0 +1,242 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DNS-SD constants (RFC 6763)
+const (
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+
+	// RFC 6763 - 9
+	dnssdServicesName = "_services._dns-sd._udp.local"
+)
+
+// MDNSService represents a DNS-based Service Discovery (RFC 6763) service
+// instance advertised through mDNS.
+type MDNSService struct {
+	// Instance is the user-friendly service instance name (e.g.
+	// "USB armory"), it must not contain dots.
+	Instance string
+	// Service is the service type and transport protocol (e.g.
+	// "_https._tcp").
+	Service string
+	// Port is the service port on the interface.
+	Port uint16
+	// TXT are the service TXT record strings, usually in key=value form
+	// (RFC 6763 - 6.3).
+	TXT []string
+}
+
+// serviceName returns the service type domain name.
+func (s *MDNSService) serviceName() string {
+	return strings.ToLower(strings.TrimSuffix(s.Service, ".")) + ".local"
+}
+
+// instanceName returns the service instance domain name.
+func (s *MDNSService) instanceName() string {
+	return s.Instance + "." + s.serviceName()
+}
+
+func (s *MDNSService) validate() (err error) {
+	if len(s.Instance) == 0 || strings.Contains(s.Instance, ".") {
+		return fmt.Errorf("invalid instance name %q", s.Instance)
+	}
+
+	labels := strings.Split(strings.TrimSuffix(s.Service, "."), ".")
+
+	if len(labels) != 2 || !strings.HasPrefix(labels[0], "_") || (labels[1] != "_tcp" && labels[1] != "_udp") {
+		return fmt.Errorf("invalid service type %q", s.Service)
+	}
+
+	for _, txt := range s.TXT {
+		if len(txt) == 0 || len(txt) > 255 {
+			return fmt.Errorf("invalid TXT string %q", txt)
+		}
+	}
+
+	_, err = encodeName(s.instanceName())
+
+	return
+}
+
+// records returns the service PTR, SRV and TXT records.
+func (s *MDNSService) records(hostname string) (records []*mdnsRecord) {
+	instance, _ := encodeName(s.instanceName())
+	target, _ := encodeName(hostname)
+	service, _ := encodeName(s.serviceName())
+
+	// RFC 2782
+	srv := make([]byte, 6)
+	binary.BigEndian.PutUint16(srv[4:6], s.Port)
+
+	// RFC 6763 - 6.1
+	txt := []byte{0}
+
+	if len(s.TXT) > 0 {
+		txt = nil
+	}
+
+	for _, str := range s.TXT {
+		txt = append(txt, uint8(len(str)))
+		txt = append(txt, str...)
+	}
+
+	return []*mdnsRecord{
+		{
+			name:  dnssdServicesName,
+			rtype: dnsTypePTR,
+			ttl:   mdnsServiceTTL,
+			data:  service,
+		},
+		{
+			name:  s.serviceName(),
+			rtype: dnsTypePTR,
+			ttl:   mdnsServiceTTL,
+			data:  instance,
+		},
+		{
+			name:  s.instanceName(),
+			rtype: dnsTypeSRV,
+			ttl:   mdnsHostTTL,
+			flush: true,
+			data:  append(srv, target...),
+		},
+		{
+			name:  s.instanceName(),
+			rtype: dnsTypeTXT,
+			ttl:   mdnsServiceTTL,
+			flush: true,
+			data:  txt,
+		},
+	}
+}
+
+// serviceRecords returns the records of all registered services.
+func (r *MDNSResponder) serviceRecords() (records []*mdnsRecord) {
+	for _, s := range r.services {
+		records = append(records, s.records(r.hostname)...)
+	}
+
+	return uniqueRecords(records, nil)
+}
+
+// additionalRecords returns the additional records recommended for an
+// answer (RFC 6763 - 12).
+func (r *MDNSResponder) additionalRecords(rec *mdnsRecord) (additional []*mdnsRecord) {
+	var names []string
+
+	switch rec.rtype {
+	case dnsTypePTR:
+		if rec.name == dnssdServicesName {
+			return
+		}
+
+		for _, s := range r.services {
+			if strings.EqualFold(rec.name, s.serviceName()) {
+				names = append(names, s.instanceName())
+			}
+		}
+	case dnsTypeSRV:
+	default:
+		return
+	}
+
+	for _, name := range names {
+		for _, rtype := range []uint16{dnsTypeSRV, dnsTypeTXT} {
+			additional = append(additional, matchRecords(mdnsQuestion{name: name, qtype: rtype}, r.serviceRecords())...)
+		}
+	}
+
+	return append(additional, r.hostRecords()...)
+}
+
+// Register advertises a service instance through DNS-SD (RFC 6763), the
+// service target is the responder hostname.
+func (r *MDNSResponder) Register(s MDNSService) (err error) {
+	if err = s.validate(); err != nil {
+		return
+	}
+
+	r.Lock()
+
+	for _, service := range r.services {
+		if strings.EqualFold(service.instanceName(), s.instanceName()) {
+			r.Unlock()
+			return errors.New("service instance already registered")
+		}
+	}
+
+	r.services = append(r.services, &s)
+	r.Unlock()
+
+	go r.announce(s.records(r.hostname), false, mdnsAnnounceNum)
+
+	return
+}
+
+// Deregister withdraws a service instance, sending goodbye responses for its
+// records (RFC 6762 - 10.1).
+func (r *MDNSResponder) Deregister(instance string, service string) (err error) {
+	var found *MDNSService
+	var shared bool
+
+	r.Lock()
+
+	for i, s := range r.services {
+		if strings.EqualFold(s.Instance, instance) && strings.EqualFold(strings.TrimSuffix(s.Service, "."), strings.TrimSuffix(service, ".")) {
+			found = s
+			r.services = append(r.services[:i], r.services[i+1:]...)
+			break
+		}
+	}
+
+	for _, s := range r.services {
+		if found != nil && s.serviceName() == found.serviceName() {
+			shared = true
+		}
+	}
+
+	r.Unlock()
+
+	if found == nil {
+		return errors.New("service instance not found")
+	}
+
+	records := found.records(r.hostname)
+
+	// the service type enumeration record is retained as long as other
+	// instances of the same type are registered
+	if shared {
+		records = records[1:]
+	}
+
+	r.announce(records, true, 1)
+
+	return
+}
+
+// Services returns the registered service instances.
+func (r *MDNSResponder) Services() (services []MDNSService) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, s := range r.services {
+		services = append(services, *s)
+	}
+
+	return
+}
@@ -0,0 +1,126 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// EtherTypeHandler represents a handler for Ethernet frames of a specific
+// EtherType, see HandleEtherType().
+//
+// The handler receives complete Ethernet frames along with a function to
+// transmit complete Ethernet frames (header included) on the interface.
+type EtherTypeHandler func(frame []byte, tx func(frame []byte) error)
+
+type etherTypes struct {
+	sync.RWMutex
+
+	handlers map[tcpip.NetworkProtocolNumber]func(buf []byte)
+}
+
+// handle passes a frame to its EtherType handler, if any, and returns
+// whether the frame has been consumed.
+func (e *etherTypes) handle(proto tcpip.NetworkProtocolNumber, buf []byte) bool {
+	e.RLock()
+	fn, ok := e.handlers[proto]
+	e.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	fn(buf)
+
+	return true
+}
+
+// reservedEtherType returns whether an EtherType is reserved to the stack
+// or the driver.
+func reservedEtherType(proto tcpip.NetworkProtocolNumber) bool {
+	switch proto {
+	case header.IPv4ProtocolNumber, header.IPv6ProtocolNumber, header.ARPProtocolNumber, VLANProtocolNumber, LLDPProtocolNumber:
+		return true
+	}
+
+	return false
+}
+
+// HandleEtherType registers a handler for all received frames of the
+// argument EtherType, such frames bypass the gVisor stack entirely.
+//
+// Handlers are invoked synchronously on the receive path and must therefore
+// return quickly, the frame payload view must not be modified or retained
+// (it must be copied instead). Frames transmitted through the handler Tx
+// function are queued to the interface like any other stack frame.
+//
+// EtherTypes handled by the stack or the driver (IPv4, IPv6, ARP, VLAN and
+// LLDP) cannot be registered.
+func (iface *Interface) HandleEtherType(proto tcpip.NetworkProtocolNumber, handler EtherTypeHandler) (err error) {
+	if handler == nil {
+		return errors.New("invalid handler")
+	}
+
+	// values below 0x0600 are IEEE 802.3 length fields
+	if proto < 0x0600 || reservedEtherType(proto) {
+		return fmt.Errorf("invalid EtherType %#04x", uint16(proto))
+	}
+
+	e := &iface.NIC.etherTypes
+
+	e.Lock()
+	defer e.Unlock()
+
+	if _, ok := e.handlers[proto]; ok {
+		return fmt.Errorf("EtherType %#04x already registered", uint16(proto))
+	}
+
+	if e.handlers == nil {
+		e.handlers = make(map[tcpip.NetworkProtocolNumber]func(buf []byte))
+	}
+
+	e.handlers[proto] = func(buf []byte) {
+		handler(buf, iface.transmitFrame)
+	}
+
+	return
+}
+
+// RemoveEtherTypeHandler removes the handler registered for the argument
+// EtherType, received frames of such type are passed again to the stack.
+func (iface *Interface) RemoveEtherTypeHandler(proto tcpip.NetworkProtocolNumber) {
+	e := &iface.NIC.etherTypes
+
+	e.Lock()
+	defer e.Unlock()
+
+	delete(e.handlers, proto)
+}
+
+// transmitFrame queues a complete Ethernet frame for transmission.
+func (iface *Interface) transmitFrame(frame []byte) (err error) {
+	if len(frame) < header.EthernetMinimumSize {
+		return errors.New("invalid frame")
+	}
+
+	proto := header.Ethernet(frame).Type()
+	payload := bufferv2.MakeWithData(frame)
+
+	if tcpErr := iface.Stack.WriteRawPacket(iface.nicid, proto, payload); tcpErr != nil {
+		return fmt.Errorf("%v", tcpErr)
+	}
+
+	return
+}
@@ -0,0 +1,79 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+)
+
+// ExpvarStats represents the interface statistics published through expvar.
+type ExpvarStats struct {
+	// Stats holds the interface and stack counters.
+	Stats Stats
+	// Hardware holds the ENET hardware counters, on physical interfaces.
+	Hardware *Counters `json:",omitempty"`
+	// Link holds the Ethernet PHY link status, on physical interfaces.
+	Link *LinkState `json:",omitempty"`
+	// Operational holds the interface traffic rates and uptime.
+	Operational struct {
+		UptimeSeconds  float64
+		RxPPS          float64
+		TxPPS          float64
+		RxBandwidthBps float64
+		TxBandwidthBps float64
+	}
+}
+
+func (iface *Interface) expvarStats() interface{} {
+	stats := ExpvarStats{
+		Stats: iface.Stats(),
+	}
+
+	if c, err := iface.NIC.Counters(); err == nil {
+		stats.Hardware = &c
+	}
+
+	if iface.NIC.Device != nil {
+		if state, err := iface.LinkState(); err == nil {
+			stats.Link = &state
+		}
+	}
+
+	oper := iface.OperStats()
+
+	stats.Operational.UptimeSeconds = oper.UptimeSeconds
+	stats.Operational.RxPPS = oper.RxPPS
+	stats.Operational.TxPPS = oper.TxPPS
+	stats.Operational.RxBandwidthBps = oper.RxBandwidthBps
+	stats.Operational.TxBandwidthBps = oper.TxBandwidthBps
+
+	return stats
+}
+
+// PublishExpvar publishes the interface statistics (see ExpvarStats) as an
+// expvar variable with the argument name, evaluated on each access (e.g.
+// through the expvar /debug/vars HTTP handler).
+//
+// As expvar variables cannot be removed the name must be unique across the
+// application lifetime, including closed interfaces.
+func (iface *Interface) PublishExpvar(name string) error {
+	if len(name) == 0 {
+		return errors.New("invalid expvar name")
+	}
+
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %s already published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(iface.expvarStats))
+
+	return nil
+}
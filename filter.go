@@ -0,0 +1,121 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FilterAction represents the action taken on frames matching a receive
+// filter.
+type FilterAction int
+
+// Filter actions
+const (
+	// FilterPass passes the frame to the next filter and, eventually, to
+	// the stack.
+	FilterPass FilterAction = iota
+	// FilterDrop discards the frame.
+	FilterDrop
+	// FilterRedirect passes the frame to the filter Redirect function,
+	// in place of the stack.
+	FilterRedirect
+)
+
+// RxFilter represents a receive filter, evaluated on every Ethernet frame
+// received by the interface before any processing.
+type RxFilter struct {
+	// ID is the filter identifier.
+	ID int
+
+	// Match returns the action taken on a received frame, it must not
+	// retain or modify the frame.
+	Match func(buf []byte) FilterAction
+	// Redirect receives frames for which Match returns FilterRedirect,
+	// it can retain the frame.
+	Redirect func(buf []byte)
+}
+
+type rxFilters struct {
+	sync.RWMutex
+	filters []RxFilter
+}
+
+// apply evaluates filters, in insertion order, against a received Ethernet
+// frame, true is returned when the frame must be passed to the stack.
+func (r *rxFilters) apply(buf []byte) bool {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, f := range r.filters {
+		switch f.Match(buf) {
+		case FilterDrop:
+			return false
+		case FilterRedirect:
+			f.Redirect(buf)
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddRxFilter appends a filter to those evaluated on all received frames.
+func (iface *Interface) AddRxFilter(filter RxFilter) error {
+	r := &iface.NIC.filters
+
+	if filter.Match == nil {
+		return errors.New("missing match function")
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for _, f := range r.filters {
+		if f.ID == filter.ID {
+			return fmt.Errorf("duplicate filter ID %d", filter.ID)
+		}
+	}
+
+	if filter.Redirect == nil {
+		match := filter.Match
+
+		// redirection without a destination drops the frame
+		filter.Match = func(buf []byte) FilterAction {
+			if action := match(buf); action != FilterRedirect {
+				return action
+			}
+
+			return FilterDrop
+		}
+	}
+
+	r.filters = append(r.filters, filter)
+
+	return nil
+}
+
+// RemoveRxFilter removes a receive filter.
+func (iface *Interface) RemoveRxFilter(id int) error {
+	r := &iface.NIC.filters
+
+	r.Lock()
+	defer r.Unlock()
+
+	for i, f := range r.filters {
+		if f.ID == id {
+			r.filters = append(r.filters[:i], r.filters[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("filter ID %d not found", id)
+}
@@ -0,0 +1,161 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// MaxForwardedTCPInFlight is the maximum number of forwarded TCP connections
+// being established at any given time, further connection requests are
+// dropped.
+var MaxForwardedTCPInFlight = 1024
+
+// forwarders holds the transport protocol forwarders, which receive packets
+// not matching any endpoint.
+type forwarders struct {
+	sync.RWMutex
+
+	tcp *tcp.Forwarder
+	udp *udp.Forwarder
+}
+
+// installForwarders sets the stack default transport protocol handlers,
+// which dispatch to forwarders set at runtime as the stack does not allow
+// changing handlers once operating.
+func (iface *Interface) installForwarders() {
+	iface.Stack.SetTransportProtocolHandler(tcp.ProtocolNumber, iface.forwardTCP)
+	iface.Stack.SetTransportProtocolHandler(udp.ProtocolNumber, iface.forwardUDP)
+}
+
+func (iface *Interface) forwardTCP(id stack.TransportEndpointID, pkt *stack.PacketBuffer) bool {
+	iface.forward.RLock()
+	f := iface.forward.tcp
+	iface.forward.RUnlock()
+
+	if f == nil {
+		return false
+	}
+
+	return f.HandlePacket(id, pkt)
+}
+
+// ForwardTCP dispatches inbound TCP connections not matching any listener,
+// to any port and local address, to the argument handler. This allows a
+// single handler to serve arbitrary ports (e.g. transparent proxies,
+// honeypots or captive portals), the original destination is available
+// through the connection LocalAddr().
+//
+// The handler is invoked on its own goroutine for each established
+// connection, which it is responsible for closing. A nil handler disables
+// forwarding, connections not matching any listener are then reset.
+func (iface *Interface) ForwardTCP(handler func(conn net.Conn)) {
+	var f *tcp.Forwarder
+
+	if handler != nil {
+		f = tcp.NewForwarder(iface.Stack, 0, MaxForwardedTCPInFlight, func(r *tcp.ForwarderRequest) {
+			var wq waiter.Queue
+
+			ep, tcpErr := r.CreateEndpoint(&wq)
+
+			if tcpErr != nil {
+				r.Complete(true)
+				return
+			}
+
+			r.Complete(false)
+
+			handler(gonet.NewTCPConn(&wq, ep))
+		})
+	}
+
+	iface.forward.Lock()
+	iface.forward.tcp = f
+	iface.forward.Unlock()
+}
+
+func (iface *Interface) forwardUDP(id stack.TransportEndpointID, pkt *stack.PacketBuffer) bool {
+	iface.forward.RLock()
+	f := iface.forward.udp
+	iface.forward.RUnlock()
+
+	if f == nil {
+		return false
+	}
+
+	return f.HandlePacket(id, pkt)
+}
+
+// ForwardUDP dispatches inbound UDP datagrams not matching any endpoint, to
+// any port and local address, to the argument handler. This allows a single
+// handler to serve arbitrary ports (e.g. DNS interception or protocol
+// gateways), the original destination is available through the connection
+// LocalAddr().
+//
+// The handler is invoked on its own goroutine for each new session, with a
+// connection bound to the original destination and connected to the
+// datagram source, which receives the first datagram and all subsequent ones
+// sharing the same addresses and ports. The handler is responsible for
+// closing the connection, which ends the session. A nil handler disables
+// forwarding, datagrams not matching any endpoint are then rejected.
+func (iface *Interface) ForwardUDP(handler func(conn *UDPConn)) {
+	var f *udp.Forwarder
+
+	if handler != nil {
+		f = udp.NewForwarder(iface.Stack, func(r *udp.ForwarderRequest) {
+			var wq waiter.Queue
+
+			// the request is only valid within this function
+			ep, tcpErr := r.CreateEndpoint(&wq)
+
+			if tcpErr != nil {
+				return
+			}
+
+			go handler(&UDPConn{
+				UDPConn: gonet.NewUDPConn(iface.Stack, &wq, ep),
+				ep:      ep,
+			})
+		})
+	}
+
+	iface.forward.Lock()
+	iface.forward.udp = f
+	iface.forward.Unlock()
+}
+
+// SetTransparentProxy controls acceptance of traffic for non-local
+// destination addresses, by enabling promiscuous and spoofing modes on the
+// stack NIC. Connections and datagrams addressed to any destination are then
+// delivered to the TCP and UDP forwarders (see ForwardTCP() and
+// ForwardUDP()), which reply on behalf of the original destination, allowing
+// inline proxies (e.g. TLS terminating or filtering ones) when the device is
+// on the traffic path (e.g. as gateway).
+//
+// Only frames accepted by the ENET MAC address filter are received, the
+// hardware promiscuous mode is not enabled.
+func (iface *Interface) SetTransparentProxy(enabled bool) (err error) {
+	if tcpErr := iface.Stack.SetPromiscuousMode(iface.nicid, enabled); tcpErr != nil {
+		return fmt.Errorf("promiscuous mode error: %v", tcpErr)
+	}
+
+	if tcpErr := iface.Stack.SetSpoofing(iface.nicid, enabled); tcpErr != nil {
+		return fmt.Errorf("spoofing mode error: %v", tcpErr)
+	}
+
+	return
+}
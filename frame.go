@@ -0,0 +1,159 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// frame represents the decoded headers of an Ethernet frame.
+type frame struct {
+	dst   tcpip.LinkAddress
+	src   tcpip.LinkAddress
+	proto tcpip.NetworkProtocolNumber
+
+	// IP headers, only set for IPv4 and IPv6 frames
+	srcAddr   tcpip.Address
+	dstAddr   tcpip.Address
+	transport tcpip.TransportProtocolNumber
+
+	// transport headers, only set for TCP and UDP first fragments
+	srcPort uint16
+	dstPort uint16
+
+	// set for TCP and UDP packets whose ports are not available, such as
+	// non-initial or tiny first fragments (RFC 1858)
+	noPorts bool
+}
+
+// IPv6 Authentication Header (RFC 4302), which unlike other extension headers
+// expresses its length in 4-octet units
+const ipv6AuthenticationHeader = 51
+
+// ipv6Transport walks the IPv6 extension headers chain (RFC 8200 - 4),
+// returning the transport protocol and, unless the packet is a non-initial
+// fragment or the chain is truncated, its payload.
+func ipv6Transport(next uint8, buf []byte) (transport tcpip.TransportProtocolNumber, payload []byte, ok bool) {
+	for {
+		switch header.IPv6ExtensionHeaderIdentifier(next) {
+		case header.IPv6HopByHopOptionsExtHdrIdentifier,
+			header.IPv6RoutingExtHdrIdentifier,
+			header.IPv6DestinationOptionsExtHdrIdentifier,
+			ipv6AuthenticationHeader:
+			if len(buf) < 8 {
+				return tcpip.TransportProtocolNumber(next), nil, false
+			}
+
+			length := (int(buf[1]) + 1) * 8
+
+			if next == ipv6AuthenticationHeader {
+				length = (int(buf[1]) + 2) * 4
+			}
+
+			if len(buf) < length {
+				return tcpip.TransportProtocolNumber(next), nil, false
+			}
+
+			next = buf[0]
+			buf = buf[length:]
+		case header.IPv6FragmentExtHdrIdentifier:
+			if len(buf) < header.IPv6FragmentExtHdrLength {
+				return tcpip.TransportProtocolNumber(next), nil, false
+			}
+
+			offset := binary.BigEndian.Uint16(buf[2:4]) >> 3
+			next = buf[0]
+			buf = buf[header.IPv6FragmentExtHdrLength:]
+
+			// the remaining headers are only carried by the first
+			// fragment
+			if offset != 0 {
+				return tcpip.TransportProtocolNumber(next), nil, false
+			}
+		default:
+			return tcpip.TransportProtocolNumber(next), buf, true
+		}
+	}
+}
+
+func (f *frame) isIP() bool {
+	return len(f.srcAddr) > 0
+}
+
+// parseFrame decodes the headers of an Ethernet frame, false is returned if
+// the frame is too short to hold an Ethernet header.
+func parseFrame(buf []byte) (f frame, ok bool) {
+	if len(buf) < header.EthernetMinimumSize {
+		return
+	}
+
+	f.dst = tcpip.LinkAddress(buf[0:6])
+	f.src = tcpip.LinkAddress(buf[6:12])
+	f.proto = tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(buf[12:14]))
+
+	var payload []byte
+	var complete bool
+
+	pkt := buf[header.EthernetMinimumSize:]
+
+	switch f.proto {
+	case header.IPv4ProtocolNumber:
+		ip := header.IPv4(pkt)
+
+		if !ip.IsValid(len(pkt)) {
+			return f, true
+		}
+
+		f.srcAddr = ip.SourceAddress()
+		f.dstAddr = ip.DestinationAddress()
+		f.transport = ip.TransportProtocol()
+
+		if complete = ip.FragmentOffset() == 0; complete {
+			payload = pkt[ip.HeaderLength():ip.TotalLength()]
+		}
+	case header.IPv6ProtocolNumber:
+		ip := header.IPv6(pkt)
+
+		if !ip.IsValid(len(pkt)) {
+			return f, true
+		}
+
+		f.srcAddr = ip.SourceAddress()
+		f.dstAddr = ip.DestinationAddress()
+
+		end := header.IPv6MinimumSize + int(ip.PayloadLength())
+		f.transport, payload, complete = ipv6Transport(ip.NextHeader(), pkt[header.IPv6MinimumSize:end])
+	default:
+		return f, true
+	}
+
+	switch f.transport {
+	case header.TCPProtocolNumber:
+		if complete && len(payload) >= header.TCPMinimumSize {
+			tcp := header.TCP(payload)
+			f.srcPort = tcp.SourcePort()
+			f.dstPort = tcp.DestinationPort()
+		} else {
+			f.noPorts = true
+		}
+	case header.UDPProtocolNumber:
+		if complete && len(payload) >= header.UDPMinimumSize {
+			udp := header.UDP(payload)
+			f.srcPort = udp.SourcePort()
+			f.dstPort = udp.DestinationPort()
+		} else {
+			f.noPorts = true
+		}
+	}
+
+	return f, true
+}
@@ -0,0 +1,441 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// GENEVE constants (RFC 8926)
+const (
+	// GENEVEPort is the IANA assigned GENEVE UDP destination port.
+	GENEVEPort = 6081
+
+	genevePacketSize = 65535
+	geneveHeaderLen  = 8
+	geneveOptionLen  = 4
+	geneveVersion    = 0
+	geneveMaxVNI     = 1<<24 - 1
+
+	// critical options present (header) and critical option (type) flags
+	geneveCritical       = 0x40
+	geneveOptionCritical = 0x80
+
+	// Transparent Ethernet Bridging
+	geneveProtocolEthernet = 0x6558
+
+	// outer IPv4, UDP and GENEVE headers plus inner Ethernet header
+	geneveOverhead = header.IPv4MinimumSize + header.UDPMinimumSize + geneveHeaderLen + header.EthernetMinimumSize
+)
+
+// GENEVEOption represents a GENEVE option TLV (RFC 8926 - 3.5).
+type GENEVEOption struct {
+	// Class is the option namespace.
+	Class uint16
+	// Type is the option type within its class, the most significant bit
+	// flags critical options.
+	Type uint8
+	// Data is the variable length option data, it must be a multiple of 4
+	// bytes and no longer than 124 bytes.
+	Data []byte
+}
+
+// GENEVE represents a GENEVE tunnel endpoint, see GENEVETunnel().
+type GENEVE struct {
+	// VNI is the Virtual Network Identifier.
+	VNI uint32
+	// Local is the outer source address.
+	Local tcpip.Address
+	// Remote is the outer destination address.
+	Remote tcpip.Address
+
+	// Options are appended to the header of all outgoing frames.
+	Options []GENEVEOption
+
+	// incoming header options handler, see SetOptionHandler()
+	mu            sync.Mutex
+	optionHandler func(opts []GENEVEOption)
+
+	sock   *geneveSocket
+	nic    *NIC
+	parent *Interface
+}
+
+// SetOptionHandler sets the function invoked with the options found in each
+// incoming frame header, a nil function removes it. Frames carrying critical
+// options are dropped before reaching it.
+func (tun *GENEVE) SetOptionHandler(fn func(opts []GENEVEOption)) {
+	tun.mu.Lock()
+	defer tun.mu.Unlock()
+
+	tun.optionHandler = fn
+}
+
+// geneveSockets holds the GENEVE UDP sockets of an interface, indexed by
+// local address, as only one endpoint can be bound to each address and port.
+type geneveSockets struct {
+	sync.Mutex
+
+	sockets map[tcpip.Address]*geneveSocket
+}
+
+// geneveSocket represents a GENEVE UDP socket, shared by all tunnels with
+// the same local address.
+type geneveSocket struct {
+	sync.RWMutex
+
+	conn  *gonet.UDPConn
+	local tcpip.Address
+
+	// tunnels, indexed by VNI
+	tunnels map[uint32]*GENEVE
+}
+
+func (sock *geneveSocket) get(vni uint32) *GENEVE {
+	sock.RLock()
+	defer sock.RUnlock()
+
+	return sock.tunnels[vni]
+}
+
+// open returns the socket bound to the argument local address, creating it
+// if necessary, and attaches the tunnel to it.
+func (s *geneveSockets) open(iface *Interface, tun *GENEVE) (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	sock := s.sockets[tun.Local]
+
+	if sock == nil {
+		laddr := &tcpip.FullAddress{Addr: tun.Local, Port: GENEVEPort, NIC: iface.nicid}
+		conn, err := gonet.DialUDP(iface.Stack, laddr, nil, ipv4.ProtocolNumber)
+
+		if err != nil {
+			return err
+		}
+
+		sock = &geneveSocket{
+			conn:    conn,
+			local:   tun.Local,
+			tunnels: make(map[uint32]*GENEVE),
+		}
+
+		if s.sockets == nil {
+			s.sockets = make(map[tcpip.Address]*geneveSocket)
+		}
+
+		s.sockets[tun.Local] = sock
+
+		go sock.start()
+	}
+
+	sock.Lock()
+	defer sock.Unlock()
+
+	if sock.tunnels[tun.VNI] != nil {
+		return errors.New("VNI already in use")
+	}
+
+	sock.tunnels[tun.VNI] = tun
+	tun.sock = sock
+
+	return
+}
+
+// close detaches the tunnel from its socket, which is closed once no other
+// tunnel is using it.
+func (s *geneveSockets) close(tun *GENEVE) {
+	s.Lock()
+	defer s.Unlock()
+
+	sock := tun.sock
+
+	if sock == nil {
+		return
+	}
+
+	sock.Lock()
+	delete(sock.tunnels, tun.VNI)
+	n := len(sock.tunnels)
+	sock.Unlock()
+
+	if n == 0 {
+		sock.conn.Close()
+		delete(s.sockets, sock.local)
+	}
+}
+
+type geneveNotification struct {
+	tun *GENEVE
+}
+
+func (n *geneveNotification) WriteNotify() {
+	n.tun.Tx(n.tun.nic.Tx())
+}
+
+func parseGENEVEOptions(buf []byte) (opts []GENEVEOption, err error) {
+	for len(buf) > 0 {
+		if len(buf) < geneveOptionLen {
+			return nil, errors.New("invalid option header")
+		}
+
+		size := geneveOptionLen + int(buf[3]&0x1f)*4
+
+		if len(buf) < size {
+			return nil, errors.New("invalid option length")
+		}
+
+		opts = append(opts, GENEVEOption{
+			Class: binary.BigEndian.Uint16(buf[0:2]),
+			Type:  buf[2],
+			Data:  buf[geneveOptionLen:size],
+		})
+
+		buf = buf[size:]
+	}
+
+	return
+}
+
+func (tun *GENEVE) header() (hdr []byte, err error) {
+	var opts []byte
+
+	for _, opt := range tun.Options {
+		if len(opt.Data)%4 != 0 || len(opt.Data) > 0x1f*4 {
+			return nil, fmt.Errorf("invalid option length (class:%#x type:%#x)", opt.Class, opt.Type)
+		}
+
+		tlv := make([]byte, geneveOptionLen)
+		binary.BigEndian.PutUint16(tlv[0:2], opt.Class)
+		tlv[2] = opt.Type
+		tlv[3] = byte(len(opt.Data) / 4)
+
+		opts = append(opts, tlv...)
+		opts = append(opts, opt.Data...)
+	}
+
+	if len(opts) > 0x3f*4 {
+		return nil, errors.New("invalid options length")
+	}
+
+	hdr = make([]byte, geneveHeaderLen)
+	hdr[0] = geneveVersion<<6 | byte(len(opts)/4)
+	binary.BigEndian.PutUint16(hdr[2:4], geneveProtocolEthernet)
+	binary.BigEndian.PutUint32(hdr[4:8], tun.VNI<<8)
+
+	return append(hdr, opts...), nil
+}
+
+// Tx encapsulates a single Ethernet frame and transmits it to the remote
+// tunnel endpoint.
+func (tun *GENEVE) Tx(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+
+	hdr, err := tun.header()
+
+	if err != nil {
+		return
+	}
+
+	addr := &net.UDPAddr{IP: net.IP(tun.Remote), Port: GENEVEPort}
+	tun.sock.conn.WriteTo(append(hdr, buf...), addr)
+}
+
+// Rx receives a single GENEVE datagram, it strips its header and passes the
+// inner Ethernet frame to the tunnel NIC.
+//
+// Datagrams carrying critical options are rejected, as options are not
+// processed by the tunnel endpoint (RFC 8926 - 3.5).
+func (tun *GENEVE) Rx(buf []byte) (err error) {
+	if len(buf) < geneveHeaderLen {
+		return errors.New("invalid header length")
+	}
+
+	if ver := buf[0] >> 6; ver != geneveVersion {
+		return fmt.Errorf("unsupported version %d", ver)
+	}
+
+	size := geneveHeaderLen + int(buf[0]&0x3f)*4
+
+	if len(buf) < size+header.EthernetMinimumSize {
+		return errors.New("invalid options length")
+	}
+
+	if proto := binary.BigEndian.Uint16(buf[2:4]); proto != geneveProtocolEthernet {
+		return fmt.Errorf("unsupported protocol type %#x", proto)
+	}
+
+	if vni := binary.BigEndian.Uint32(buf[4:8]) >> 8; vni != tun.VNI {
+		return fmt.Errorf("VNI mismatch (%d)", vni)
+	}
+
+	if buf[1]&geneveCritical != 0 {
+		return errors.New("unsupported critical options")
+	}
+
+	opts, err := parseGENEVEOptions(buf[geneveHeaderLen:size])
+
+	if err != nil {
+		return
+	}
+
+	// the header flag might not be set by non-compliant senders
+	for _, opt := range opts {
+		if opt.Type&geneveOptionCritical != 0 {
+			return fmt.Errorf("unsupported critical option (class:%#x type:%#x)", opt.Class, opt.Type)
+		}
+	}
+
+	tun.mu.Lock()
+	handler := tun.optionHandler
+	tun.mu.Unlock()
+
+	if handler != nil && len(opts) > 0 {
+		handler(opts)
+	}
+
+	tun.nic.Rx(buf[size:])
+
+	return
+}
+
+// start receives GENEVE datagrams and dispatches them to the tunnel matching
+// their VNI and source address.
+func (sock *geneveSocket) start() {
+	buf := make([]byte, genevePacketSize)
+
+	for {
+		n, addr, err := sock.conn.ReadFrom(buf)
+
+		if err != nil {
+			return
+		}
+
+		if n < geneveHeaderLen {
+			continue
+		}
+
+		tun := sock.get(binary.BigEndian.Uint32(buf[4:8]) >> 8)
+
+		if tun == nil {
+			continue
+		}
+
+		if udpAddr, ok := addr.(*net.UDPAddr); !ok || !udpAddr.IP.Equal(net.IP(tun.Remote)) {
+			continue
+		}
+
+		tun.Rx(buf[:n])
+	}
+}
+
+func (iface *Interface) nextNICID() (id tcpip.NICID) {
+	for nicid := range iface.Stack.NICInfo() {
+		if nicid > id {
+			id = nicid
+		}
+	}
+
+	return id + 1
+}
+
+// GENEVETunnel creates a virtual Ethernet interface, on the same stack, backed
+// by a GENEVE (RFC 8926) encapsulation endpoint. Outgoing frames are
+// encapsulated and sent over UDP to the remote tunnel endpoint, incoming
+// GENEVE datagrams are decapsulated and injected in the returned interface.
+//
+// Tunnels sharing the same local address share a single UDP socket, incoming
+// datagrams are dispatched by VNI, which must therefore be unique for each
+// local address.
+//
+// The returned interface has no IP address configured, its GENEVE field can
+// be used to set options and an option handler.
+func (iface *Interface) GENEVETunnel(vnid uint32, localIP, remoteIP tcpip.Address) (tun *Interface, err error) {
+	if vnid > geneveMaxVNI {
+		return nil, errors.New("invalid VNI")
+	}
+
+	if len(localIP) != header.IPv4AddressSize || len(remoteIP) != header.IPv4AddressSize {
+		return nil, errors.New("invalid tunnel address")
+	}
+
+	mac := make([]byte, 6)
+
+	if _, err = rand.Read(mac); err != nil {
+		return
+	}
+
+	// locally administered unicast address
+	mac[0] = (mac[0] | 0x02) &^ 0x01
+
+	tun = &Interface{
+		nicid:   iface.nextNICID(),
+		Stack:   iface.Stack,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+
+	mtu := uint32(iface.MTU() - geneveOverhead)
+
+	tun.Link = channel.New(256, mtu, tcpip.LinkAddress(mac))
+	tun.Link.LinkEPCapabilities |= stack.CapabilityResolutionRequired
+	tun.endpoint = newLinkEndpoint(tun.Link, mtu)
+
+	if err := tun.Stack.CreateNIC(tun.nicid, tun.endpoint); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+
+	tun.NIC = &NIC{
+		MAC:     mac,
+		Link:    tun.Link,
+		Gateway: header.EthernetBroadcastAddress,
+	}
+
+	if err = tun.NIC.Init(); err != nil {
+		return
+	}
+
+	tun.GENEVE = &GENEVE{
+		VNI:    vnid,
+		Local:  localIP,
+		Remote: remoteIP,
+		nic:    tun.NIC,
+		parent: iface,
+	}
+
+	if err = iface.geneve.open(iface, tun.GENEVE); err != nil {
+		tun.Stack.RemoveNIC(tun.nicid)
+		tun.Link.Close()
+		return nil, err
+	}
+
+	tun.Link.AddNotify(&geneveNotification{
+		tun: tun.GENEVE,
+	})
+
+	tun.SetName(fmt.Sprintf("geneve%d", vnid))
+	register(tun)
+
+	return
+}
@@ -0,0 +1,90 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestGENEVEOptions(t *testing.T) {
+	a, b := testPair(t, nil)
+
+	tunA, err := a.GENEVETunnel(1, testAddress("10.0.0.1"), testAddress("10.0.0.2"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunA.Close()
+
+	tunB, err := b.GENEVETunnel(1, testAddress("10.0.0.2"), testAddress("10.0.0.1"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunB.Close()
+
+	if err = tunA.AddAddress("192.168.0.1/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tunB.AddAddress("192.168.0.2/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := GENEVEOption{Class: 0x0100, Type: 0x01, Data: []byte{1, 2, 3, 4}}
+	tunA.GENEVE.Options = []GENEVEOption{opt}
+
+	received := make(chan GENEVEOption, 16)
+
+	server, err := tunB.ListenUDP("udp4", "192.168.0.2:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tunA.DialUDP4("", "192.168.0.2:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the handler is set while frames are being received
+	go tunB.GENEVE.SetOptionHandler(func(opts []GENEVEOption) {
+		for _, o := range opts {
+			select {
+			case received <- o:
+			default:
+			}
+		}
+	})
+
+	deadline := time.After(5 * time.Second)
+
+	for {
+		if _, err = client.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case o := <-received:
+			if o.Class != opt.Class || o.Type != opt.Type || !bytes.Equal(o.Data, opt.Data) {
+				t.Fatalf("unexpected option %+v", o)
+			}
+
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("option not received")
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// testWire delivers frames transmitted by an interface to a receive
+// function.
+type testWire struct {
+	sync.WaitGroup
+
+	src    *Interface
+	rx     func(buf []byte)
+	frames chan []byte
+	done   chan struct{}
+}
+
+func (w *testWire) WriteNotify() {
+	if buf := w.src.NIC.Tx(); len(buf) > 0 {
+		select {
+		case w.frames <- buf:
+		default:
+		}
+	}
+}
+
+func (w *testWire) run() {
+	defer w.Done()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case buf := <-w.frames:
+			w.rx(buf)
+		}
+	}
+}
+
+func testMAC(n int) string {
+	return fmt.Sprintf("02:00:00:00:00:%02x", n)
+}
+
+func testAddress(s string) tcpip.Address {
+	ip := net.ParseIP(s)
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return tcpip.Address(ip4)
+	}
+
+	return tcpip.Address(ip)
+}
+
+// testOptions returns the options of the n-th test host, addressed
+// 10.0.0.n/24.
+func testOptions(n int) *Options {
+	return &Options{
+		MAC:  testMAC(n),
+		IPv4: &IPConfig{Address: fmt.Sprintf("10.0.0.%d/24", n)},
+	}
+}
+
+// testInterface returns an interface without physical device, its frames
+// are exchanged through its channel endpoint (see connect()).
+func testInterface(t *testing.T, opts *Options) *Interface {
+	t.Helper()
+
+	iface, err := InitWithOptions(nil, 1, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		iface.Close()
+	})
+
+	return iface
+}
+
+// testPair returns two connected interfaces, with options returned by
+// testOptions(1) and testOptions(2), the argument function, when not nil, is
+// invoked on each to amend them.
+func testPair(t *testing.T, amend func(n int, opts *Options)) (a *Interface, b *Interface) {
+	t.Helper()
+
+	var hosts [2]*Interface
+
+	for i := range hosts {
+		opts := testOptions(i + 1)
+
+		if amend != nil {
+			amend(i+1, opts)
+		}
+
+		hosts[i] = testInterface(t, opts)
+	}
+
+	connect(t, hosts[0], hosts[1])
+
+	return hosts[0], hosts[1]
+}
+
+// wire passes frames transmitted by an interface to the argument receive
+// function, frames queued before the call are passed as well.
+func wire(t *testing.T, src *Interface, rx func(buf []byte)) {
+	w := &testWire{
+		src:    src,
+		rx:     rx,
+		frames: make(chan []byte, 256),
+		done:   make(chan struct{}),
+	}
+
+	src.Link.AddNotify(w)
+
+	for src.Link.NumQueued() > 0 {
+		w.WriteNotify()
+	}
+
+	w.Add(1)
+	go w.run()
+
+	// stop delivery before interfaces are closed
+	t.Cleanup(func() {
+		close(w.done)
+		w.Wait()
+	})
+}
+
+// connect links two interfaces.
+func connect(t *testing.T, a *Interface, b *Interface) {
+	wire(t, a, b.NIC.Rx)
+	wire(t, b, a.NIC.Rx)
+}
+
+// testEcho sends a datagram from the client to the server and back.
+func testEcho(t *testing.T, client net.Conn, server net.PacketConn) {
+	t.Helper()
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	n, addr, err := server.ReadFrom(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = server.WriteTo(buf[:n], addr); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err = client.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testAccept returns a channel receiving the next connection accepted by the
+// argument listener.
+func testAccept(l net.Listener) chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	return accepted
+}
@@ -0,0 +1,49 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"net/http"
+	"time"
+)
+
+// HTTP client defaults
+const (
+	// DefaultHTTPTimeout is the default HTTP client request timeout.
+	DefaultHTTPTimeout = 30 * time.Second
+
+	httpTLSHandshakeTimeout = 10 * time.Second
+	httpIdleConnTimeout     = 90 * time.Second
+	httpMaxIdleConns        = 16
+)
+
+// HTTPTransport returns an HTTP transport establishing connections over the
+// interface, host names are resolved through LookupHost() (see
+// DialContext()).
+//
+// Environment proxy settings are ignored, as meaningless on bare metal.
+func (iface *Interface) HTTPTransport() *http.Transport {
+	return &http.Transport{
+		DialContext:           iface.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          httpMaxIdleConns,
+		IdleConnTimeout:       httpIdleConnTimeout,
+		TLSHandshakeTimeout:   httpTLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// HTTPClient returns an HTTP client, with DefaultHTTPTimeout, using the
+// interface transport (see HTTPTransport()).
+func (iface *Interface) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: iface.HTTPTransport(),
+		Timeout:   DefaultHTTPTimeout,
+	}
+}
@@ -0,0 +1,148 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// registry of all interfaces created by the package
+var interfaces struct {
+	sync.Mutex
+	list []*Interface
+
+	// last assigned interface index
+	index int
+}
+
+func register(iface *Interface) {
+	interfaces.Lock()
+	defer interfaces.Unlock()
+
+	if len(iface.name) == 0 {
+		iface.name = freeName()
+	}
+
+	// indices are never reused, as stack NIC identifiers are only unique
+	// within each stack
+	interfaces.index++
+	iface.index = interfaces.index
+
+	interfaces.list = append(interfaces.list, iface)
+}
+
+// freeName returns the first default interface name not in use by registered
+// interfaces, it must be invoked with the registry locked.
+func freeName() string {
+	used := make(map[string]bool)
+
+	for _, v := range interfaces.list {
+		used[v.Name()] = true
+	}
+
+	for i := 0; ; i++ {
+		if name := fmt.Sprintf("eth%d", i); !used[name] {
+			return name
+		}
+	}
+}
+
+func unregister(iface *Interface) {
+	interfaces.Lock()
+	defer interfaces.Unlock()
+
+	for i, v := range interfaces.list {
+		if v == iface {
+			interfaces.list = append(interfaces.list[:i], interfaces.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// Interfaces returns all Ethernet interfaces created by the package.
+func Interfaces() []*Interface {
+	interfaces.Lock()
+	defer interfaces.Unlock()
+
+	return append([]*Interface{}, interfaces.list...)
+}
+
+// InterfaceByName returns the Ethernet interface with the argument name, nil
+// is returned if not found.
+func InterfaceByName(name string) *Interface {
+	for _, iface := range Interfaces() {
+		if iface.Name() == name {
+			return iface
+		}
+	}
+
+	return nil
+}
+
+// Name returns the interface name.
+func (iface *Interface) Name() string {
+	iface.mu.RLock()
+	defer iface.mu.RUnlock()
+
+	return iface.name
+}
+
+// SetName sets the interface name.
+func (iface *Interface) SetName(name string) {
+	iface.mu.Lock()
+	defer iface.mu.Unlock()
+
+	iface.name = name
+}
+
+// HardwareAddr returns the interface hardware address.
+func (iface *Interface) HardwareAddr() net.HardwareAddr {
+	return net.HardwareAddr(iface.Link.LinkAddress())
+}
+
+// MTU returns the interface Maximum Transmission Unit.
+func (iface *Interface) MTU() int {
+	return int(iface.endpoint.MTU())
+}
+
+// Addrs returns all addresses currently configured on the interface, for all
+// network protocols, as *net.IPNet values.
+func (iface *Interface) Addrs() (addrs []net.Addr) {
+	for _, addr := range iface.Stack.AllAddresses()[iface.nicid] {
+		// the IPv4 broadcast endpoint is not an interface address
+		if addr.AddressWithPrefix.Address == header.IPv4Broadcast {
+			continue
+		}
+
+		ip := net.IP(addr.AddressWithPrefix.Address)
+		bits := len(ip) * 8
+
+		addrs = append(addrs, &net.IPNet{
+			IP:   ip,
+			Mask: net.CIDRMask(addr.AddressWithPrefix.PrefixLen, bits),
+		})
+	}
+
+	return
+}
+
+// NetInterface returns the interface description in net.Interface format.
+func (iface *Interface) NetInterface() net.Interface {
+	return net.Interface{
+		Index:        iface.index,
+		MTU:          iface.MTU(),
+		Name:         iface.Name(),
+		HardwareAddr: iface.HardwareAddr(),
+		Flags:        net.FlagUp | net.FlagBroadcast | net.FlagMulticast,
+	}
+}
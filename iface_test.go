@@ -0,0 +1,32 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"testing"
+)
+
+func TestNetInterface(t *testing.T) {
+	// both interfaces have their own stack, with the same NIC identifier
+	a, b := testPair(t, nil)
+
+	if a.NetInterface().Index == b.NetInterface().Index {
+		t.Errorf("duplicate interface index %d", a.NetInterface().Index)
+	}
+
+	var addrs []string
+
+	for _, addr := range a.Addrs() {
+		addrs = append(addrs, addr.String())
+	}
+
+	if len(addrs) != 1 || addrs[0] != "10.0.0.1/24" {
+		t.Errorf("unexpected addresses %v", addrs)
+	}
+}
@@ -0,0 +1,234 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// DHCP options (RFC 2132, RFC 3397)
+const (
+	dhcpOptionPad          = 0
+	dhcpOptionDNS          = 6
+	dhcpOptionNTP          = 42
+	dhcpOptionDomainSearch = 119
+	dhcpOptionEnd          = 255
+
+	// maximum number of compression pointers followed in a domain name
+	maxNamePointers = 16
+)
+
+// LeaseOptions represents the network service options provided by a DHCP or
+// DHCPv6 lease.
+type LeaseOptions struct {
+	// DNSServers are the lease DNS servers (option 6).
+	DNSServers []string
+	// DomainSearch is the lease domain search list (option 119).
+	DomainSearch []string
+	// NTPServers are the lease NTP servers (option 42).
+	NTPServers []string
+}
+
+// dhcpOptions returns the options found in a DHCP options field, repeated
+// options are concatenated (RFC 3396).
+func dhcpOptions(buf []byte) (opts map[uint8][]byte) {
+	opts = make(map[uint8][]byte)
+
+	for len(buf) > 0 {
+		code := buf[0]
+
+		switch code {
+		case dhcpOptionPad:
+			buf = buf[1:]
+			continue
+		case dhcpOptionEnd:
+			return
+		}
+
+		if len(buf) < 2 || len(buf) < 2+int(buf[1]) {
+			return
+		}
+
+		size := int(buf[1])
+		opts[code] = append(opts[code], buf[2:2+size]...)
+		buf = buf[2+size:]
+	}
+
+	return
+}
+
+func parseAddressList(buf []byte) (addrs []string) {
+	for ; len(buf) >= net.IPv4len; buf = buf[net.IPv4len:] {
+		addrs = append(addrs, net.IP(buf[:net.IPv4len]).String())
+	}
+
+	return
+}
+
+// readName decodes a domain name (RFC 1035 - 4.1.4) at the argument offset,
+// it returns the name and the number of bytes it occupies at such offset.
+func readName(buf []byte, off int) (name string, n int, err error) {
+	var labels []string
+	var pointers int
+
+	for {
+		if off >= len(buf) {
+			return "", 0, errors.New("invalid name length")
+		}
+
+		size := int(buf[off])
+
+		switch {
+		case size == 0:
+			if pointers == 0 {
+				n += 1
+			}
+
+			return strings.Join(labels, "."), n, nil
+		case size&0xc0 == 0xc0:
+			if off+1 >= len(buf) {
+				return "", 0, errors.New("invalid name pointer")
+			}
+
+			if pointers == 0 {
+				n += 2
+			}
+
+			if pointers++; pointers > maxNamePointers {
+				return "", 0, errors.New("too many name pointers")
+			}
+
+			off = (size&0x3f)<<8 | int(buf[off+1])
+		case size&0xc0 != 0:
+			return "", 0, errors.New("invalid label type")
+		default:
+			if off+1+size > len(buf) {
+				return "", 0, errors.New("invalid label length")
+			}
+
+			labels = append(labels, string(buf[off+1:off+1+size]))
+
+			if pointers == 0 {
+				n += 1 + size
+			}
+
+			off += 1 + size
+		}
+	}
+}
+
+// parseDomainSearch decodes a domain search list option (RFC 3397).
+func parseDomainSearch(buf []byte) (domains []string, err error) {
+	for off := 0; off < len(buf); {
+		name, n, err := readName(buf, off)
+
+		if err != nil {
+			return nil, err
+		}
+
+		domains = append(domains, name)
+		off += n
+	}
+
+	return
+}
+
+// parseLeaseOptions returns the network service options found in a DHCP
+// options field.
+func parseLeaseOptions(buf []byte) (lease LeaseOptions) {
+	opts := dhcpOptions(buf)
+
+	lease.DNSServers = parseAddressList(opts[dhcpOptionDNS])
+	lease.NTPServers = parseAddressList(opts[dhcpOptionNTP])
+	lease.DomainSearch, _ = parseDomainSearch(opts[dhcpOptionDomainSearch])
+
+	return
+}
+
+// setLeaseOptions updates the interface DHCP lease options, invoking the
+// OnLeaseOptions callback on changes.
+func (iface *Interface) setLeaseOptions(lease LeaseOptions) {
+	iface.updateLeaseOptions(&iface.lease, lease)
+}
+
+// setLeaseOptions6 updates the interface DHCPv6 lease options, invoking the
+// OnLeaseOptions callback on changes.
+func (iface *Interface) setLeaseOptions6(lease LeaseOptions) {
+	iface.updateLeaseOptions(&iface.lease6, lease)
+}
+
+func (iface *Interface) updateLeaseOptions(dst *LeaseOptions, lease LeaseOptions) {
+	iface.mu.Lock()
+
+	if reflect.DeepEqual(*dst, lease) {
+		iface.mu.Unlock()
+		return
+	}
+
+	*dst = lease
+	merged := iface.leaseOptions()
+	iface.mu.Unlock()
+
+	if fn := iface.opts.OnLeaseOptions; fn != nil {
+		fn(merged)
+	}
+}
+
+// leaseOptions returns the DHCP lease options followed by the DHCPv6 ones.
+func (iface *Interface) leaseOptions() (lease LeaseOptions) {
+	for _, l := range []LeaseOptions{iface.lease, iface.lease6} {
+		lease.DNSServers = append(lease.DNSServers, l.DNSServers...)
+		lease.DomainSearch = append(lease.DomainSearch, l.DomainSearch...)
+		lease.NTPServers = append(lease.NTPServers, l.NTPServers...)
+	}
+
+	return
+}
+
+// LeaseOptions returns the network service options provided by the current
+// DHCP and DHCPv6 leases.
+func (iface *Interface) LeaseOptions() LeaseOptions {
+	iface.mu.RLock()
+	defer iface.mu.RUnlock()
+
+	return iface.leaseOptions()
+}
+
+// DNSServers returns the DNS servers configured through Options, or
+// otherwise provided by the current DHCP lease.
+func (iface *Interface) DNSServers() []string {
+	if len(iface.opts.DNSServers) > 0 {
+		return iface.opts.DNSServers
+	}
+
+	return iface.LeaseOptions().DNSServers
+}
+
+// DomainSearch returns the domain search list configured through Options,
+// or otherwise provided by the current DHCP lease.
+func (iface *Interface) DomainSearch() []string {
+	if len(iface.opts.DomainSearch) > 0 {
+		return iface.opts.DomainSearch
+	}
+
+	return iface.LeaseOptions().DomainSearch
+}
+
+// NTPServers returns the NTP servers configured through Options, or
+// otherwise provided by the current DHCP lease.
+func (iface *Interface) NTPServers() []string {
+	if len(iface.opts.NTPServers) > 0 {
+		return iface.opts.NTPServers
+	}
+
+	return iface.LeaseOptions().NTPServers
+}
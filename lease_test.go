@@ -0,0 +1,98 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLeaseOptions(t *testing.T) {
+	buf := []byte{
+		dhcpOptionPad,
+		// DNS servers
+		dhcpOptionDNS, 8, 10, 0, 0, 53, 10, 0, 1, 53,
+		// NTP servers, split across repeated options (RFC 3396)
+		dhcpOptionNTP, 2, 10, 0,
+		dhcpOptionNTP, 2, 0, 123,
+		// example.com, lan.example.com (compressed)
+		dhcpOptionDomainSearch, 19,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		3, 'l', 'a', 'n', 0xc0, 0x00,
+		dhcpOptionEnd,
+		// ignored after the end option
+		dhcpOptionDNS, 4, 10, 0, 0, 54,
+	}
+
+	lease := parseLeaseOptions(buf)
+
+	if s := []string{"10.0.0.53", "10.0.1.53"}; !reflect.DeepEqual(lease.DNSServers, s) {
+		t.Errorf("unexpected DNS servers %v", lease.DNSServers)
+	}
+
+	if s := []string{"10.0.0.123"}; !reflect.DeepEqual(lease.NTPServers, s) {
+		t.Errorf("unexpected NTP servers %v", lease.NTPServers)
+	}
+
+	if s := []string{"example.com", "lan.example.com"}; !reflect.DeepEqual(lease.DomainSearch, s) {
+		t.Errorf("unexpected domain search list %v", lease.DomainSearch)
+	}
+
+	// truncated options are ignored
+	lease = parseLeaseOptions([]byte{dhcpOptionDNS, 8, 10, 0, 0, 53})
+
+	if len(lease.DNSServers) != 0 {
+		t.Errorf("unexpected DNS servers %v", lease.DNSServers)
+	}
+}
+
+func TestLeaseOptions(t *testing.T) {
+	var updates []LeaseOptions
+
+	iface := testInterface(t, &Options{
+		MAC:  testMAC(1),
+		IPv4: &IPConfig{Address: "10.0.0.1/24"},
+		OnLeaseOptions: func(lease LeaseOptions) {
+			updates = append(updates, lease)
+		},
+	})
+
+	lease := LeaseOptions{
+		DNSServers: []string{"10.0.0.53"},
+		NTPServers: []string{"10.0.0.123"},
+	}
+
+	iface.setLeaseOptions(lease)
+	// unchanged options do not trigger the callback
+	iface.setLeaseOptions(lease)
+
+	if len(updates) != 1 {
+		t.Fatalf("unexpected number of updates %d", len(updates))
+	}
+
+	if s := iface.DNSServers(); !reflect.DeepEqual(s, lease.DNSServers) {
+		t.Errorf("unexpected DNS servers %v", s)
+	}
+
+	if s := iface.NTPServers(); !reflect.DeepEqual(s, lease.NTPServers) {
+		t.Errorf("unexpected NTP servers %v", s)
+	}
+
+	// manual configuration takes precedence
+	iface.opts.DNSServers = []string{"10.0.0.54"}
+	iface.opts.NTPServers = []string{"10.0.0.124"}
+
+	if s := iface.DNSServers(); !reflect.DeepEqual(s, iface.opts.DNSServers) {
+		t.Errorf("unexpected DNS servers %v", s)
+	}
+
+	if s := iface.NTPServers(); !reflect.DeepEqual(s, iface.opts.NTPServers) {
+		t.Errorf("unexpected NTP servers %v", s)
+	}
+}
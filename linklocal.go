@@ -0,0 +1,175 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// RFC 3927 - 9. Constants
+const (
+	linkLocalMaxConflicts      = 10
+	linkLocalRateLimitInterval = 60 * time.Second
+	linkLocalPrefixLen         = 16
+)
+
+type linkLocalState struct {
+	sync.Mutex
+
+	// configured address
+	address tcpip.Address
+	cancel  context.CancelFunc
+}
+
+// linkLocalEnabled returns whether IPv4 link-local address autoconfiguration
+// is enabled.
+func (iface *Interface) linkLocalEnabled() bool {
+	return iface.opts.IPv4 != nil && iface.opts.IPv4.LinkLocal
+}
+
+// linkLocalCandidate returns a pseudo-random address within 169.254.1.0 to
+// 169.254.254.255 (RFC 3927 - 2.1).
+func linkLocalCandidate(rng *rand.Rand) tcpip.Address {
+	n := 0x100 + rng.Intn(0xfe00)
+	return tcpip.Address([]byte{169, 254, byte(n >> 8), byte(n)})
+}
+
+// LinkLocalAddress4 returns the self-assigned IPv4 link-local address, an
+// empty address is returned when none is configured.
+func (iface *Interface) LinkLocalAddress4() tcpip.Address {
+	iface.linkLocal.Lock()
+	defer iface.linkLocal.Unlock()
+
+	return iface.linkLocal.address
+}
+
+// startLinkLocal starts IPv4 link-local address autoconfiguration in the
+// background, if not already running.
+func (iface *Interface) startLinkLocal() {
+	iface.linkLocal.Lock()
+	defer iface.linkLocal.Unlock()
+
+	if iface.linkLocal.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	iface.linkLocal.cancel = cancel
+
+	go iface.runLinkLocal(ctx)
+}
+
+// stopLinkLocal stops IPv4 link-local address autoconfiguration, removing
+// any self-assigned address.
+func (iface *Interface) stopLinkLocal() {
+	iface.linkLocal.Lock()
+	defer iface.linkLocal.Unlock()
+
+	if iface.linkLocal.cancel == nil {
+		return
+	}
+
+	iface.linkLocal.cancel()
+	iface.linkLocal.cancel = nil
+
+	addr := iface.linkLocal.address
+	iface.linkLocal.address = ""
+
+	if len(addr) == 0 {
+		return
+	}
+
+	iface.acd.unwatch(addr)
+
+	prefix := tcpip.AddressWithPrefix{Address: addr, PrefixLen: linkLocalPrefixLen}
+
+	iface.Stack.RemoveAddress(iface.nicid, addr)
+	iface.Stack.RemoveRoutes(func(rt tcpip.Route) bool {
+		return rt.NIC == iface.nicid && rt.Destination == prefix.Subnet()
+	})
+
+	iface.mu.Lock()
+
+	if iface.address.Address == addr {
+		iface.address = tcpip.AddressWithPrefix{}
+	}
+
+	iface.mu.Unlock()
+}
+
+// runLinkLocal selects, probes and configures an IPv4 link-local address
+// (RFC 3927 - 2).
+func (iface *Interface) runLinkLocal(ctx context.Context) {
+	var addr tcpip.Address
+
+	// RFC 3927 - 2.1, the generator is seeded with the hardware address
+	// so that the same address is selected across restarts
+	seed := binary.BigEndian.Uint32(iface.NIC.MAC[2:])
+	rng := rand.New(rand.NewSource(int64(seed)))
+
+	for conflicts := 0; ; conflicts++ {
+		if conflicts >= linkLocalMaxConflicts {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(linkLocalRateLimitInterval):
+			}
+		}
+
+		addr = linkLocalCandidate(rng)
+		mac, err := iface.detectConflict(ctx, addr)
+
+		if err != nil {
+			return
+		}
+
+		if mac == nil {
+			break
+		}
+
+		iface.addressConflict(addr, mac)
+	}
+
+	prefix := tcpip.AddressWithPrefix{Address: addr, PrefixLen: linkLocalPrefixLen}
+
+	iface.linkLocal.Lock()
+
+	if ctx.Err() != nil {
+		iface.linkLocal.Unlock()
+		return
+	}
+
+	if err := iface.configureProtocol(ipv4.ProtocolNumber, prefix, ""); err != nil {
+		iface.linkLocal.Unlock()
+		return
+	}
+
+	iface.linkLocal.address = addr
+	iface.linkLocal.Unlock()
+
+	iface.mu.Lock()
+
+	if len(iface.address.Address) == 0 {
+		iface.address = prefix
+	}
+
+	iface.mu.Unlock()
+
+	// RFC 3927 - 2.5
+	iface.acd.watch(addr)
+
+	iface.announce(addr, acdAnnounceNum)
+}
@@ -0,0 +1,180 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// ListenConfig contains options for listening on the Ethernet interface, it
+// mirrors net.ListenConfig semantics.
+type ListenConfig struct {
+	// Control, when not nil, is invoked after creating the network
+	// endpoint and before binding it, allowing socket options to be set
+	// through ep.SocketOptions() or ep.SetSockOpt*(). The listener creation
+	// is aborted if it returns an error.
+	Control func(network, address string, ep tcpip.Endpoint) error
+
+	// Backlog is the maximum number of pending TCP connections, 0 selects
+	// DefaultListenBacklog.
+	Backlog int
+
+	iface *Interface
+}
+
+// ListenConfig returns a listen configuration for the Ethernet interface.
+func (iface *Interface) ListenConfig() *ListenConfig {
+	return &ListenConfig{iface: iface}
+}
+
+// listenProtocol returns the network protocol for the argument network and
+// local address.
+func (lc *ListenConfig) listenProtocol(network string, address string) (proto tcpip.NetworkProtocolNumber, err error) {
+	switch network {
+	case "tcp", "udp":
+		proto = addressProtocol(address)
+	case "tcp4", "udp4":
+		proto = ipv4.ProtocolNumber
+	case "tcp6", "udp6":
+		proto = ipv6.ProtocolNumber
+	default:
+		return 0, errors.New("unsupported network")
+	}
+
+	if proto == ipv6.ProtocolNumber && lc.iface.opts.IPv6 == nil {
+		return 0, errors.New("IPv6 not enabled")
+	}
+
+	return
+}
+
+func (lc *ListenConfig) control(network string, address string) func(ep tcpip.Endpoint) error {
+	if lc.Control == nil {
+		return nil
+	}
+
+	return func(ep tcpip.Endpoint) error {
+		return lc.Control(network, address, ep)
+	}
+}
+
+// Listen announces on the argument local TCP address, in host:port form, on
+// the Ethernet interface. An empty or unspecified host binds all interface
+// addresses of the network family.
+//
+// The context is checked before creating the listener, once created its
+// expiration has no effect.
+func (lc *ListenConfig) Listen(ctx context.Context, network string, address string) (net.Listener, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("unsupported network")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	proto, err := lc.listenProtocol(network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := listenerOptions(address, proto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Backlog = lc.Backlog
+	opts.control = lc.control(network, address)
+
+	listener, err := lc.iface.ListenerTCPWithOptions(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return (net.Listener)(listener), nil
+}
+
+// ListenPacket announces on the argument local UDP address, in host:port
+// form, on the Ethernet interface. An empty or unspecified host binds all
+// interface addresses of the network family.
+//
+// The context is checked before creating the connection, once created its
+// expiration has no effect.
+func (lc *ListenConfig) ListenPacket(ctx context.Context, network string, address string) (net.PacketConn, error) {
+	conn, err := lc.ListenUDP(ctx, network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return (net.PacketConn)(conn), nil
+}
+
+// ListenUDP is like ListenPacket but returns the concrete connection type,
+// which implements net.PacketConn as well as the buffer size setters probed
+// by QUIC and DTLS libraries.
+func (lc *ListenConfig) ListenUDP(ctx context.Context, network string, address string) (*UDPConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, errors.New("unsupported network")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	proto, err := lc.listenProtocol(network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	host, port, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// unspecified addresses bind to all local ones
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = ""
+	}
+
+	return lc.iface.dialUDP(net.JoinHostPort(host, port), "", proto, lc.control(network, address))
+}
+
+// ListenContext announces on the argument local TCP address on the Ethernet
+// interface, see ListenConfig.Listen().
+func (iface *Interface) ListenContext(ctx context.Context, network string, address string) (net.Listener, error) {
+	return iface.ListenConfig().Listen(ctx, network, address)
+}
+
+// ListenPacketContext announces on the argument local UDP address on the
+// Ethernet interface, see ListenConfig.ListenPacket().
+func (iface *Interface) ListenPacketContext(ctx context.Context, network string, address string) (net.PacketConn, error) {
+	return iface.ListenConfig().ListenPacket(ctx, network, address)
+}
+
+// ListenUDP announces on the argument local UDP address on the Ethernet
+// interface, see ListenConfig.ListenUDP().
+func (iface *Interface) ListenUDP(network string, address string) (*UDPConn, error) {
+	return iface.ListenConfig().ListenUDP(context.Background(), network, address)
+}
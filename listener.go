@@ -0,0 +1,282 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// DefaultListenBacklog is the default TCP listen backlog, it matches the one
+// used by gVisor gonet listeners.
+const DefaultListenBacklog = 4096
+
+// ListenerOptions represents TCP listener options.
+type ListenerOptions struct {
+	// Port is the listening port.
+	Port uint16
+	// Backlog is the maximum number of pending connections, 0 selects
+	// DefaultListenBacklog.
+	Backlog int
+
+	// Wildcard binds the listener to the unspecified address, rather than
+	// the interface one, allowing its creation before any address is
+	// configured.
+	Wildcard bool
+	// Address, when not empty, binds the listener to the argument local IP
+	// address (e.g. a secondary one), rather than the interface one.
+	Address string
+
+	// IPv6 selects an IPv6 listener, rather than an IPv4 one.
+	IPv6 bool
+
+	// AcceptFilter, when not nil, is invoked with the remote address of
+	// each established connection, before it is returned by Accept.
+	// Rejected connections are reset and never returned by Accept.
+	AcceptFilter func(remote net.Addr) bool
+
+	// control, when not nil, is invoked on the endpoint before binding it.
+	control func(ep tcpip.Endpoint) error
+}
+
+// ListenerStats represents TCP listener statistics.
+type ListenerStats struct {
+	// Backlog is the configured listen backlog.
+	Backlog int
+
+	// SynDrops is the number of SYN segments dropped as the accept queue
+	// was full.
+	SynDrops uint64
+	// AckDrops is the number of handshakes dropped, on their final ACK, as
+	// the accept queue was full.
+	AckDrops uint64
+
+	// Rejected is the number of connections reset as rejected by the
+	// AcceptFilter.
+	Rejected uint64
+
+	// SynCookiesSent is the number of SYN cookies sent, on the whole stack,
+	// as the SYN backlog was full.
+	SynCookiesSent uint64
+	// SynCookiesReceived is the number of valid SYN cookies received on the
+	// whole stack.
+	SynCookiesReceived uint64
+}
+
+// TCPListener represents a TCP listener with a configurable backlog.
+type TCPListener struct {
+	net.Listener
+
+	iface   *Interface
+	ep      tcpip.Endpoint
+	backlog int
+}
+
+// filterEndpoint wraps a listening endpoint to reset connections rejected by
+// an accept filter.
+type filterEndpoint struct {
+	tcpip.Endpoint
+
+	filter   func(remote net.Addr) bool
+	rejected uint64
+}
+
+func (ep *filterEndpoint) Accept(peerAddr *tcpip.FullAddress) (tcpip.Endpoint, *waiter.Queue, tcpip.Error) {
+	for {
+		var addr tcpip.FullAddress
+
+		n, wq, err := ep.Endpoint.Accept(&addr)
+
+		if err != nil || ep.filter(&net.TCPAddr{IP: net.IP(addr.Addr), Port: int(addr.Port)}) {
+			if peerAddr != nil {
+				*peerAddr = addr
+			}
+
+			return n, wq, err
+		}
+
+		n.Abort()
+		atomic.AddUint64(&ep.rejected, 1)
+	}
+}
+
+// Stats returns the listener statistics.
+func (l *TCPListener) Stats() (stats ListenerStats) {
+	stats.Backlog = l.backlog
+
+	if s, ok := l.ep.Stats().(*tcp.Stats); ok {
+		stats.SynDrops = s.ReceiveErrors.ListenOverflowSynDrop.Value()
+		stats.AckDrops = s.ReceiveErrors.ListenOverflowAckDrop.Value()
+	}
+
+	if ep, ok := l.ep.(*filterEndpoint); ok {
+		stats.Rejected = atomic.LoadUint64(&ep.rejected)
+	}
+
+	tcpStats := l.iface.Stack.Stats().TCP
+	stats.SynCookiesSent = tcpStats.ListenOverflowSynCookieSent.Value()
+	stats.SynCookiesReceived = tcpStats.ListenOverflowSynCookieRcvd.Value()
+
+	return
+}
+
+// ListenerTCPWithOptions returns a TCP listener capable of accepting IPv4,
+// or IPv6, TCP connections on the Ethernet interface, according to the
+// argument options.
+//
+// Once the SYN backlog is full the stack replies with SYN cookies, while
+// SYN segments are dropped when the accept queue is full, such drops are
+// reported by the listener Stats().
+func (iface *Interface) ListenerTCPWithOptions(opts ListenerOptions) (l *TCPListener, err error) {
+	backlog := opts.Backlog
+
+	switch {
+	case backlog < 0:
+		return nil, errors.New("invalid backlog")
+	case backlog == 0:
+		backlog = DefaultListenBacklog
+	}
+
+	var addr tcpip.Address
+
+	proto := ipv4.ProtocolNumber
+	localAddress := iface.localAddress
+
+	if opts.IPv6 {
+		if iface.opts.IPv6 == nil {
+			return nil, errors.New("IPv6 not enabled")
+		}
+
+		proto = ipv6.ProtocolNumber
+		localAddress = iface.localAddress6
+	}
+
+	switch {
+	case len(opts.Address) > 0:
+		var local tcpip.FullAddress
+
+		if local, err = fullAddr(net.JoinHostPort(opts.Address, "0"), proto); err != nil {
+			return
+		}
+
+		if addr = local.Addr; !iface.hasAddress(proto, addr) {
+			return nil, ErrAddressNotAvailable
+		}
+	case !opts.Wildcard:
+		if addr, err = localAddress(); err != nil {
+			return
+		}
+	}
+
+	var wq waiter.Queue
+
+	ep, tcpErr := iface.Stack.NewEndpoint(tcp.ProtocolNumber, proto, &wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (tcp): %v", tcpErr)
+	}
+
+	if opts.control != nil {
+		if err = opts.control(ep); err != nil {
+			ep.Close()
+			return nil, err
+		}
+	}
+
+	bindAddr := tcpip.FullAddress{Addr: addr, Port: opts.Port, NIC: iface.nicid}
+
+	if tcpErr := ep.Bind(bindAddr); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("bind error (tcp): %v", tcpErr)
+	}
+
+	if tcpErr := ep.Listen(backlog); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("listen error (tcp): %v", tcpErr)
+	}
+
+	if opts.AcceptFilter != nil {
+		ep = &filterEndpoint{
+			Endpoint: ep,
+			filter:   opts.AcceptFilter,
+		}
+	}
+
+	l = &TCPListener{
+		Listener: gonet.NewTCPListener(iface.Stack, &wq, ep),
+		iface:    iface,
+		ep:       ep,
+		backlog:  backlog,
+	}
+
+	if h := iface.connectionDuration(); h != nil {
+		l.Listener = &histogramListener{Listener: l.Listener, h: h}
+	}
+
+	return
+}
+
+// listenerOptions returns the listener options for the argument local
+// address, in host:port form, an empty or unspecified host selects a wildcard
+// listener.
+func listenerOptions(address string, proto tcpip.NetworkProtocolNumber) (opts ListenerOptions, err error) {
+	host, port, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+
+	if err != nil {
+		return
+	}
+
+	opts.Port = uint16(p)
+	opts.IPv6 = proto == ipv6.ProtocolNumber
+
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		opts.Wildcard = true
+	} else {
+		opts.Address = host
+	}
+
+	return
+}
+
+// ListenerTCPAddress returns a net.Listener capable of accepting TCP
+// connections for the argument local address, in host:port form, on the
+// Ethernet interface. The host can be any IPv4 or IPv6 address configured on
+// the interface, while an empty or unspecified one (e.g. "0.0.0.0", "::")
+// binds the listener to all addresses of its family.
+func (iface *Interface) ListenerTCPAddress(address string) (net.Listener, error) {
+	opts, err := listenerOptions(address, addressProtocol(address))
+
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := iface.ListenerTCPWithOptions(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return (net.Listener)(listener), nil
+}
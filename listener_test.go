@@ -0,0 +1,387 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+func TestListenerBacklog(t *testing.T) {
+	a, b := testPair(t, nil)
+
+	if _, err := b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Backlog: -1}); err == nil {
+		t.Fatal("invalid backlog accepted")
+	}
+
+	l, err := b.ListenerTCPWithOptions(ListenerOptions{Port: 80})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := l.Stats().Backlog; n != DefaultListenBacklog {
+		t.Errorf("unexpected default backlog %d", n)
+	}
+
+	l.Close()
+
+	if l, err = b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Backlog: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if n := l.Stats().Backlog; n != 1 {
+		t.Errorf("unexpected backlog %d", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// fills the accept queue, as connections are not accepted
+	conn, err := a.DialContextTCP4(ctx, "10.0.0.2:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	overflowCtx, overflowCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer overflowCancel()
+
+	if conn, err := a.DialContextTCP4(overflowCtx, "10.0.0.2:80"); err == nil {
+		conn.Close()
+		t.Fatal("connection established with full accept queue")
+	}
+
+	if stats := l.Stats(); stats.SynDrops == 0 {
+		t.Errorf("SYN drops not reported, %+v", stats)
+	}
+
+	// the queued connection is still available
+	peer, err := l.Accept()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer.Close()
+}
+
+func TestListenerBacklogBurst(t *testing.T) {
+	const burst = 8
+
+	a, b := testPair(t, nil)
+
+	// dial dials a burst of connections, without accepting them, and
+	// returns how many were established.
+	dial := func(l *TCPListener) (n int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		conns := make(chan net.Conn, burst)
+
+		for i := 0; i < burst; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if conn, err := a.DialContextTCP4(ctx, "10.0.0.2:80"); err == nil {
+					conns <- conn
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(conns)
+
+		for conn := range conns {
+			conn.Close()
+			n++
+		}
+
+		return
+	}
+
+	l, err := b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Backlog: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := dial(l); n == burst {
+		t.Errorf("small backlog accepted the whole burst")
+	}
+
+	if stats := l.Stats(); stats.SynDrops == 0 {
+		t.Errorf("SYN drops not reported, %+v", stats)
+	}
+
+	l.Close()
+
+	if l, err = b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Backlog: burst}); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if n := dial(l); n != burst {
+		t.Errorf("larger backlog accepted %d connections out of %d", n, burst)
+	}
+
+	if stats := l.Stats(); stats.SynDrops != 0 {
+		t.Errorf("unexpected SYN drops, %+v", stats)
+	}
+}
+
+func TestHalfClose(t *testing.T) {
+	a, b := testPair(t, nil)
+
+	// accepted connections are wrapped by both the duration histogram and
+	// the accept filter
+	if err := b.EnableConnectionDurationHistogram([]time.Duration{time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := b.ListenerTCPWithOptions(ListenerOptions{
+		Port: 80,
+		AcceptFilter: func(net.Addr) bool {
+			return true
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := testAccept(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := a.DialContextTCP4(ctx, "10.0.0.2:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var peer net.Conn
+
+	select {
+	case peer = <-accepted:
+	case <-ctx.Done():
+		t.Fatal("connection not accepted")
+	}
+
+	server, ok := peer.(TCPConn)
+
+	if !ok {
+		peer.Close()
+		t.Fatalf("accepted connection (%T) does not support half-close", peer)
+	}
+
+	if err = server.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if buf, err := io.ReadAll(conn); err != nil || len(buf) != 0 {
+		t.Fatalf("unexpected read after peer CloseWrite, %q, %v", buf, err)
+	}
+
+	// the reverse direction still works
+	if _, err = conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	client, ok := conn.(TCPConn)
+
+	if !ok {
+		t.Fatalf("dialed connection (%T) does not support half-close", conn)
+	}
+
+	if err = client.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if buf, err := io.ReadAll(server); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected read, %q, %v", buf, err)
+	}
+
+	server.Close()
+
+	var n uint64
+
+	for _, count := range b.ConnectionDurationHistogram().Buckets() {
+		n += count
+	}
+
+	if n == 0 {
+		t.Error("connection duration not recorded")
+	}
+}
+
+func TestListenerAcceptFilter(t *testing.T) {
+	a, b := testPair(t, func(n int, opts *Options) {
+		if n == 1 {
+			opts.IPv4.Addresses = []string{"10.0.0.3/24"}
+		}
+	})
+
+	l, err := b.ListenerTCPWithOptions(ListenerOptions{
+		Port: 80,
+		AcceptFilter: func(remote net.Addr) bool {
+			return remote.(*net.TCPAddr).IP.Equal(net.ParseIP("10.0.0.3"))
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := testAccept(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// rejected connections are reset, possibly before the dial returns
+	if rejected, err := a.DialContextTCP(ctx, "10.0.0.1:0", "10.0.0.2:80"); err == nil {
+		defer rejected.Close()
+
+		rejected.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var nerr net.Error
+
+		if _, err = rejected.Read(make([]byte, 1)); err == nil || errors.As(err, &nerr) && nerr.Timeout() {
+			t.Fatalf("rejected connection not reset, %v", err)
+		}
+	} else if !strings.HasSuffix(err.Error(), (&tcpip.ErrConnectionReset{}).String()) {
+		t.Fatalf("unexpected dial error, %v", err)
+	}
+
+	conn, err := a.DialContextTCP(ctx, "10.0.0.3:0", "10.0.0.2:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case peer := <-accepted:
+		defer peer.Close()
+
+		if ip := peer.RemoteAddr().(*net.TCPAddr).IP; !ip.Equal(net.ParseIP("10.0.0.3")) {
+			t.Errorf("unexpected remote address %s", ip)
+		}
+	case <-ctx.Done():
+		t.Fatal("connection not accepted")
+	}
+
+	if n := l.Stats().Rejected; n != 1 {
+		t.Errorf("unexpected number of rejected connections %d", n)
+	}
+}
+
+func TestWildcardListener(t *testing.T) {
+	// the address is expected to be configured through DHCP, which is never
+	// answered
+	a, b := testPair(t, func(n int, opts *Options) {
+		if n == 2 {
+			opts.IPv4 = &IPConfig{DHCP: true}
+		}
+	})
+
+	if _, err := b.ListenerTCP4(80); !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("unexpected error without address, %v", err)
+	}
+
+	l, err := b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Wildcard: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := testAccept(l)
+
+	// the listener accepts connections once an address is installed
+	if err = b.AddAddress("10.0.0.2/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := a.DialContextTCP4(ctx, "10.0.0.2:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case peer := <-accepted:
+		peer.Close()
+	case <-ctx.Done():
+		t.Fatal("connection not accepted")
+	}
+}
+
+func TestListenerAddress(t *testing.T) {
+	a, b := testPair(t, func(n int, opts *Options) {
+		if n == 2 {
+			opts.IPv4.Addresses = []string{"10.0.0.3/24"}
+		}
+	})
+
+	if _, err := b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Address: "10.0.0.4"}); !errors.Is(err, ErrAddressNotAvailable) {
+		t.Fatalf("unexpected error for address not configured, %v", err)
+	}
+
+	l, err := b.ListenerTCPWithOptions(ListenerOptions{Port: 80, Address: "10.0.0.3"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := testAccept(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := a.DialContextTCP4(ctx, "10.0.0.3:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case peer := <-accepted:
+		peer.Close()
+	case <-ctx.Done():
+		t.Fatal("connection not accepted")
+	}
+}
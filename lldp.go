@@ -0,0 +1,409 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// LLDP constants (IEEE 802.1AB-2016)
+const (
+	// LLDPProtocolNumber is the LLDP EtherType.
+	LLDPProtocolNumber tcpip.NetworkProtocolNumber = 0x88cc
+
+	// DefaultLLDPInterval is the default transmit interval
+	// (msgTxInterval).
+	DefaultLLDPInterval = 30 * time.Second
+	// lldpTxHold is the TTL multiplier (msgTxHold).
+	lldpTxHold = 4
+)
+
+// LLDPMulticastAddress is the nearest bridge group address (IEEE 802.1AB-2016
+// - 7.1).
+var LLDPMulticastAddress = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+
+// IEEE 802.1AB-2016 - 8.4.1 TLV types
+const (
+	lldpEnd               = 0
+	lldpChassisID         = 1
+	lldpPortID            = 2
+	lldpTTL               = 3
+	lldpPortDescription   = 4
+	lldpSystemName        = 5
+	lldpSystemDescription = 6
+	lldpCapabilities      = 7
+	lldpManagementAddress = 8
+)
+
+// IEEE 802.1AB-2016 - 8.5.2.2, 8.5.3.2 ID subtypes
+const (
+	lldpChassisMAC     = 4
+	lldpChassisNetwork = 5
+	lldpPortMAC        = 3
+	lldpPortNetwork    = 4
+	lldpPortName       = 5
+)
+
+// IEEE 802.1AB-2016 - 8.5.8.1 system capabilities
+const (
+	// LLDPCapabilityRouter indicates a router.
+	LLDPCapabilityRouter = 1 << 4
+	// LLDPCapabilityStation indicates an end station.
+	LLDPCapabilityStation = 1 << 7
+)
+
+// LLDPOptions represents LLDP agent configuration options.
+type LLDPOptions struct {
+	// SystemName is the advertised system name, it is omitted when empty.
+	SystemName string
+	// SystemDescription is the advertised system description, it is
+	// omitted when empty.
+	SystemDescription string
+	// PortDescription is the advertised port description, it is omitted
+	// when empty.
+	PortDescription string
+
+	// Interval is the transmit interval, 0 selects DefaultLLDPInterval.
+	// Advertisements are valid for 4 intervals.
+	Interval time.Duration
+}
+
+// LLDPNeighbor represents a neighbor discovered through LLDP.
+type LLDPNeighbor struct {
+	// MAC is the source hardware address of the neighbor LLDPDU.
+	MAC net.HardwareAddr
+
+	// ChassisID is the neighbor chassis identifier, MAC and network
+	// addresses are returned in their textual form.
+	ChassisID string
+	// PortID is the neighbor port identifier, MAC and network addresses
+	// are returned in their textual form.
+	PortID string
+
+	PortDescription   string
+	SystemName        string
+	SystemDescription string
+
+	// Capabilities are the neighbor enabled system capabilities.
+	Capabilities uint16
+	// ManagementAddresses are the neighbor IPv4 and IPv6 management
+	// addresses.
+	ManagementAddresses []net.IP
+
+	// Expires is the neighbor information expiration time.
+	Expires time.Time
+}
+
+// LLDPAgent represents an LLDP agent instance, transmitting the interface
+// information and collecting the one received from neighbors.
+type LLDPAgent struct {
+	sync.Mutex
+
+	iface *Interface
+	opts  LLDPOptions
+
+	// neighbors indexed by MSAP identifier (chassis and port IDs)
+	neighbors map[string]*LLDPNeighbor
+
+	done chan struct{}
+	once sync.Once
+}
+
+func appendTLV(buf []byte, t int, val []byte) []byte {
+	buf = append(buf, byte(t<<1|len(val)>>8), byte(len(val)))
+	return append(buf, val...)
+}
+
+// lldpID returns the textual form of a chassis or port identifier.
+func lldpID(subtype byte, val []byte, mac byte, network byte) string {
+	switch {
+	case subtype == mac && len(val) == 6:
+		return net.HardwareAddr(val).String()
+	case subtype == network && lldpAddress(val) != nil:
+		return lldpAddress(val).String()
+	default:
+		return string(val)
+	}
+}
+
+// lldpAddress decodes an IANA address family prefixed address.
+func lldpAddress(val []byte) net.IP {
+	switch {
+	case len(val) == 1+net.IPv4len && val[0] == 1:
+	case len(val) == 1+net.IPv6len && val[0] == 2:
+	default:
+		return nil
+	}
+
+	return append(net.IP{}, val[1:]...)
+}
+
+// managementAddress returns the Management Address TLV value for the argument
+// address (IEEE 802.1AB-2016 - 8.5.9).
+func (a *LLDPAgent) managementAddress(addr tcpip.Address) []byte {
+	family := byte(1)
+
+	if len(addr) == net.IPv6len {
+		family = 2
+	}
+
+	val := []byte{byte(1 + len(addr)), family}
+	val = append(val, addr...)
+
+	// ifIndex interface numbering, no OID
+	val = append(val, 2, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(val[len(val)-5:], uint32(a.iface.nicid))
+
+	return val
+}
+
+// lldpdu returns an LLDPDU advertising the interface with the argument TTL
+// (IEEE 802.1AB-2016 - 8.2).
+func (a *LLDPAgent) lldpdu(ttl uint16) (buf []byte) {
+	mac := []byte(a.iface.NIC.MAC)
+
+	buf = appendTLV(buf, lldpChassisID, append([]byte{lldpChassisMAC}, mac...))
+	buf = appendTLV(buf, lldpPortID, append([]byte{lldpPortName}, a.iface.Name()...))
+	buf = appendTLV(buf, lldpTTL, []byte{byte(ttl >> 8), byte(ttl)})
+
+	if ttl == 0 {
+		return appendTLV(buf, lldpEnd, nil)
+	}
+
+	if s := a.opts.PortDescription; len(s) > 0 {
+		buf = appendTLV(buf, lldpPortDescription, []byte(s))
+	}
+
+	if s := a.opts.SystemName; len(s) > 0 {
+		buf = appendTLV(buf, lldpSystemName, []byte(s))
+	}
+
+	if s := a.opts.SystemDescription; len(s) > 0 {
+		buf = appendTLV(buf, lldpSystemDescription, []byte(s))
+	}
+
+	caps := make([]byte, 4)
+	binary.BigEndian.PutUint16(caps[0:2], LLDPCapabilityStation)
+	binary.BigEndian.PutUint16(caps[2:4], LLDPCapabilityStation)
+	buf = appendTLV(buf, lldpCapabilities, caps)
+
+	if addr, err := a.iface.localAddress(); err == nil {
+		buf = appendTLV(buf, lldpManagementAddress, a.managementAddress(addr))
+	}
+
+	if addr, err := a.iface.localAddress6(); err == nil {
+		buf = appendTLV(buf, lldpManagementAddress, a.managementAddress(addr))
+	}
+
+	return appendTLV(buf, lldpEnd, nil)
+}
+
+func (a *LLDPAgent) send(ttl uint16) error {
+	payload := bufferv2.MakeWithData(a.lldpdu(ttl))
+	dst := tcpip.LinkAddress(LLDPMulticastAddress)
+
+	if err := a.iface.Stack.WritePacketToRemote(a.iface.nicid, dst, LLDPProtocolNumber, payload); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	return nil
+}
+
+// parseLLDP decodes an LLDPDU, the returned TTL is 0 for shutdown LLDPDUs
+// (IEEE 802.1AB-2016 - 9.2.7.7.1).
+func parseLLDP(buf []byte) (n *LLDPNeighbor, ttl uint16, err error) {
+	n = &LLDPNeighbor{}
+
+	for i := 0; len(buf) > 0; i++ {
+		if len(buf) < 2 {
+			return nil, 0, errors.New("invalid TLV")
+		}
+
+		t := int(buf[0] >> 1)
+		size := int(buf[0]&1)<<8 | int(buf[1])
+
+		if len(buf) < 2+size {
+			return nil, 0, errors.New("invalid TLV length")
+		}
+
+		val := buf[2 : 2+size]
+		buf = buf[2+size:]
+
+		// the first three TLVs are mandatory and ordered
+		if (i == 0 && t != lldpChassisID) || (i == 1 && t != lldpPortID) || (i == 2 && t != lldpTTL) {
+			return nil, 0, errors.New("missing mandatory TLV")
+		}
+
+		switch t {
+		case lldpEnd:
+			return
+		case lldpChassisID, lldpPortID:
+			if len(val) < 2 {
+				return nil, 0, errors.New("invalid ID")
+			}
+
+			if t == lldpChassisID {
+				n.ChassisID = lldpID(val[0], val[1:], lldpChassisMAC, lldpChassisNetwork)
+			} else {
+				n.PortID = lldpID(val[0], val[1:], lldpPortMAC, lldpPortNetwork)
+			}
+		case lldpTTL:
+			if len(val) < 2 {
+				return nil, 0, errors.New("invalid TTL")
+			}
+
+			ttl = binary.BigEndian.Uint16(val)
+		case lldpPortDescription:
+			n.PortDescription = string(val)
+		case lldpSystemName:
+			n.SystemName = string(val)
+		case lldpSystemDescription:
+			n.SystemDescription = string(val)
+		case lldpCapabilities:
+			if len(val) == 4 {
+				n.Capabilities = binary.BigEndian.Uint16(val[2:4])
+			}
+		case lldpManagementAddress:
+			if len(val) < 2 || int(val[0]) < 2 || len(val) < 1+int(val[0]) {
+				continue
+			}
+
+			if ip := lldpAddress(val[1 : 1+int(val[0])]); ip != nil {
+				n.ManagementAddresses = append(n.ManagementAddresses, ip)
+			}
+		}
+	}
+
+	return
+}
+
+// handle updates the neighbor table with a received LLDPDU.
+func (a *LLDPAgent) handle(src net.HardwareAddr, buf []byte) {
+	n, ttl, err := parseLLDP(buf)
+
+	if err != nil {
+		return
+	}
+
+	n.MAC = append(net.HardwareAddr{}, src...)
+	n.Expires = time.Now().Add(time.Duration(ttl) * time.Second)
+	id := n.ChassisID + "/" + n.PortID
+
+	a.Lock()
+	defer a.Unlock()
+
+	if ttl == 0 {
+		delete(a.neighbors, id)
+		return
+	}
+
+	a.neighbors[id] = n
+}
+
+func (a *LLDPAgent) run() {
+	ttl := uint16(a.opts.Interval.Seconds() * lldpTxHold)
+
+	for {
+		a.send(ttl)
+
+		select {
+		case <-a.done:
+			return
+		case <-time.After(a.opts.Interval):
+		}
+	}
+}
+
+// StartLLDP starts a Link Layer Discovery Protocol (IEEE 802.1AB) agent which
+// periodically advertises the interface to directly connected bridges and
+// collects neighbor information from received advertisements (see
+// Neighbors()).
+//
+// The chassis is identified by the interface MAC address and the port by the
+// interface name, the configured IPv4 and IPv6 addresses are advertised as
+// management addresses.
+func (iface *Interface) StartLLDP(opts LLDPOptions) (a *LLDPAgent, err error) {
+	if opts.Interval == 0 {
+		opts.Interval = DefaultLLDPInterval
+	}
+
+	if opts.Interval < time.Second || opts.Interval*lldpTxHold > 65535*time.Second {
+		return nil, errors.New("invalid interval")
+	}
+
+	if iface.NIC.lldpHandler != nil {
+		return nil, errors.New("LLDP agent already started")
+	}
+
+	a = &LLDPAgent{
+		iface:     iface,
+		opts:      opts,
+		neighbors: make(map[string]*LLDPNeighbor),
+		done:      make(chan struct{}),
+	}
+
+	iface.NIC.lldpHandler = a.handle
+	iface.NIC.AddMulticast(LLDPMulticastAddress)
+
+	go a.run()
+
+	return
+}
+
+// Neighbors returns the neighbors currently known to the LLDP agent, sorted
+// by chassis and port ID, expired entries are discarded.
+func (a *LLDPAgent) Neighbors() (neighbors []LLDPNeighbor) {
+	a.Lock()
+	defer a.Unlock()
+
+	now := time.Now()
+
+	for id, n := range a.neighbors {
+		if now.After(n.Expires) {
+			delete(a.neighbors, id)
+			continue
+		}
+
+		neighbors = append(neighbors, *n)
+	}
+
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].ChassisID != neighbors[j].ChassisID {
+			return neighbors[i].ChassisID < neighbors[j].ChassisID
+		}
+
+		return neighbors[i].PortID < neighbors[j].PortID
+	})
+
+	return
+}
+
+// Close sends a shutdown LLDPDU, invalidating the interface information on
+// neighbors, and stops the agent.
+func (a *LLDPAgent) Close() (err error) {
+	a.once.Do(func() {
+		close(a.done)
+
+		a.iface.NIC.lldpHandler = nil
+		a.iface.NIC.RemoveMulticast(LLDPMulticastAddress)
+
+		err = a.send(0)
+	})
+
+	return
+}
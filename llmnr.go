@@ -0,0 +1,83 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// LLMNR constants (RFC 4795)
+const (
+	// LLMNRPort is the LLMNR UDP port.
+	LLMNRPort = 5355
+	// LLMNRIPv4Address is the LLMNR IPv4 link-scope multicast address.
+	LLMNRIPv4Address = "224.0.0.252"
+
+	// RFC 4795 - 7
+	llmnrTimeout = 1 * time.Second
+)
+
+var (
+	mdnsQueryAddress  = &net.UDPAddr{IP: net.ParseIP(MDNSIPv4Address).To4(), Port: MDNSPort}
+	llmnrQueryAddress = &net.UDPAddr{IP: net.ParseIP(LLMNRIPv4Address).To4(), Port: LLMNRPort}
+)
+
+// multicastLookup sends a one-shot query (RFC 6762 - 5.1, RFC 4795 - 2.4) to
+// the argument IPv4 multicast group, returning the addresses found in the
+// first answer received within the lookup timeout.
+func (iface *Interface) multicastLookup(ctx context.Context, group *net.UDPAddr, name string, qtype uint16) (addrs []string, err error) {
+	id := uint16(iface.Stack.Rand().Uint32())
+	query, err := dnsQuery(id, name, qtype)
+
+	if err != nil {
+		return
+	}
+
+	// multicast queries do not request recursion
+	query[2], query[3] = 0, 0
+
+	conn, err := iface.DialUDP4(":0", "")
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(llmnrTimeout)
+
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn.SetDeadline(deadline)
+
+	if _, err = conn.WriteTo(query, group); err != nil {
+		return
+	}
+
+	buf := make([]byte, MaxMTU)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, errDNSNotFound
+		}
+
+		if addrs, _, err = parseDNSResponse(buf[:n], id, qtype); err == nil {
+			return addrs, nil
+		}
+	}
+}
@@ -0,0 +1,602 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// 6LoWPAN constants (RFC 4944, RFC 6282)
+const (
+	// LoWPANEtherType is the LoWPAN encapsulation EtherType (RFC 7973).
+	LoWPANEtherType = 0xa0ed
+
+	// maximum IEEE 802.15.4 frame payload (RFC 4944 - 1)
+	lowpanFrameSize = 81
+	// maximum datagram size which can be fragmented (RFC 4944 - 5.3)
+	lowpanMaxDatagram = 0x7ff
+
+	lowpanReassemblyTimeout = 60 * time.Second
+	lowpanMaxReassemblies   = 16
+
+	lowpanDispatchIPv6  = 0x41
+	lowpanDispatchIPHC  = 0x60
+	lowpanDispatchFrag1 = 0xc0
+	lowpanDispatchFragN = 0xe0
+
+	lowpanFrag1Len = 4
+	lowpanFragNLen = 5
+)
+
+type lowpanKey struct {
+	src  tcpip.LinkAddress
+	size int
+	tag  uint16
+}
+
+type lowpanReassembly struct {
+	buf      []byte
+	received int
+	deadline time.Time
+}
+
+// lowpan represents a 6LoWPAN adaptation layer between the stack (IPv6) and
+// an IEEE 802.15.4 network bridged over Ethernet.
+type lowpan struct {
+	sync.Mutex
+
+	enabled bool
+	panID   uint16
+	tag     uint16
+
+	// pending fragments
+	queue [][]byte
+	// incomplete datagrams
+	fragments map[lowpanKey]*lowpanReassembly
+}
+
+type iphcReader struct {
+	buf []byte
+	err error
+}
+
+func (r *iphcReader) next(size int) (v []byte) {
+	if len(r.buf) < size {
+		r.err = errors.New("invalid header length")
+		return make([]byte, size)
+	}
+
+	v, r.buf = r.buf[:size], r.buf[size:]
+
+	return
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compressUnicast returns the RFC 6282 SAM/DAM mode, and inline bytes, for
+// an IPv6 unicast address.
+func compressUnicast(addr []byte, mac tcpip.LinkAddress) (mode byte, inline []byte) {
+	if addr[0] != 0xfe || addr[1] != 0x80 || !isZero(addr[2:8]) {
+		return 0, addr
+	}
+
+	eui := header.EthernetAddressToModifiedEUI64(mac)
+
+	switch {
+	case len(mac) == header.EthernetAddressSize && bytes.Equal(addr[8:], eui[:]):
+		return 3, nil
+	case bytes.Equal(addr[8:14], []byte{0x00, 0x00, 0x00, 0xff, 0xfe, 0x00}):
+		return 2, addr[14:]
+	default:
+		return 1, addr[8:]
+	}
+}
+
+// compressMulticast returns the RFC 6282 DAM mode, and inline bytes, for an
+// IPv6 multicast address.
+func compressMulticast(addr []byte) (mode byte, inline []byte) {
+	switch {
+	case addr[1] == 0x02 && isZero(addr[2:15]):
+		return 3, addr[15:]
+	case isZero(addr[2:13]):
+		return 2, append([]byte{addr[1]}, addr[13:]...)
+	case isZero(addr[2:11]):
+		return 1, append([]byte{addr[1]}, addr[11:]...)
+	default:
+		return 0, addr
+	}
+}
+
+func decompressUnicast(r *iphcReader, mode byte, mac tcpip.LinkAddress) tcpip.Address {
+	addr := make([]byte, header.IPv6AddressSize)
+
+	if mode == 0 {
+		copy(addr, r.next(header.IPv6AddressSize))
+		return tcpip.Address(addr)
+	}
+
+	addr[0] = 0xfe
+	addr[1] = 0x80
+
+	switch mode {
+	case 1:
+		copy(addr[8:], r.next(8))
+	case 2:
+		addr[11] = 0xff
+		addr[12] = 0xfe
+		copy(addr[14:], r.next(2))
+	case 3:
+		if len(mac) != header.EthernetAddressSize {
+			r.err = errors.New("invalid link address")
+			break
+		}
+
+		header.EthernetAdddressToModifiedEUI64IntoBuf(mac, addr[8:])
+	}
+
+	return tcpip.Address(addr)
+}
+
+func decompressMulticast(r *iphcReader, mode byte) tcpip.Address {
+	addr := make([]byte, header.IPv6AddressSize)
+	addr[0] = 0xff
+
+	switch mode {
+	case 0:
+		copy(addr, r.next(header.IPv6AddressSize))
+	case 1:
+		v := r.next(6)
+		addr[1] = v[0]
+		copy(addr[11:], v[1:])
+	case 2:
+		v := r.next(4)
+		addr[1] = v[0]
+		copy(addr[13:], v[1:])
+	case 3:
+		addr[1] = 0x02
+		addr[15] = r.next(1)[0]
+	}
+
+	return tcpip.Address(addr)
+}
+
+// compressIPHC returns the RFC 6282 IPHC encoding of an IPv6 header, next
+// headers are always carried inline and no context is used.
+func compressIPHC(ip header.IPv6, src tcpip.LinkAddress, dst tcpip.LinkAddress) []byte {
+	hdr := []byte{lowpanDispatchIPHC, 0x00}
+
+	tc, fl := ip.TOS()
+
+	if tc == 0 && fl == 0 {
+		hdr[0] |= 0x3 << 3
+	} else {
+		// ECN, DSCP and Flow Label
+		hdr = append(hdr, tc<<6|tc>>2, byte(fl>>16)&0x0f, byte(fl>>8), byte(fl))
+	}
+
+	hdr = append(hdr, ip.NextHeader())
+
+	switch hl := ip.HopLimit(); hl {
+	case 1:
+		hdr[0] |= 0x1
+	case 64:
+		hdr[0] |= 0x2
+	case 255:
+		hdr[0] |= 0x3
+	default:
+		hdr = append(hdr, hl)
+	}
+
+	srcAddr := []byte(ip.SourceAddress())
+	dstAddr := []byte(ip.DestinationAddress())
+
+	if isZero(srcAddr) {
+		// SAC=1, SAM=00: unspecified address
+		hdr[1] |= 0x40
+	} else {
+		mode, inline := compressUnicast(srcAddr, src)
+		hdr[1] |= mode << 4
+		hdr = append(hdr, inline...)
+	}
+
+	if dstAddr[0] == 0xff {
+		mode, inline := compressMulticast(dstAddr)
+		hdr[1] |= 0x08 | mode
+		hdr = append(hdr, inline...)
+	} else {
+		mode, inline := compressUnicast(dstAddr, dst)
+		hdr[1] |= mode
+		hdr = append(hdr, inline...)
+	}
+
+	return hdr
+}
+
+// decompressIPHC decodes an RFC 6282 IPHC header, it returns the IPv6 header
+// (with no payload length set) and the number of bytes consumed.
+func decompressIPHC(buf []byte, src tcpip.LinkAddress, dst tcpip.LinkAddress) (ip header.IPv6, n int, err error) {
+	if len(buf) < 2 {
+		return nil, 0, errors.New("invalid header length")
+	}
+
+	b0 := buf[0]
+	b1 := buf[1]
+	r := &iphcReader{buf: buf[2:]}
+
+	switch {
+	case b0&0x04 != 0:
+		return nil, 0, errors.New("unsupported next header compression")
+	case b1&0x80 != 0, b1&0x40 != 0 && b1&0x30 != 0, b1&0x04 != 0:
+		return nil, 0, errors.New("unsupported context based compression")
+	}
+
+	var tc uint8
+	var fl uint32
+
+	switch (b0 >> 3) & 0x3 {
+	case 0:
+		v := r.next(4)
+		tc = v[0]<<2 | v[0]>>6
+		fl = uint32(v[1]&0x0f)<<16 | uint32(v[2])<<8 | uint32(v[3])
+	case 1:
+		v := r.next(3)
+		tc = v[0] >> 6
+		fl = uint32(v[0]&0x0f)<<16 | uint32(v[1])<<8 | uint32(v[2])
+	case 2:
+		v := r.next(1)
+		tc = v[0]<<2 | v[0]>>6
+	}
+
+	nh := r.next(1)[0]
+
+	var hl uint8
+
+	switch b0 & 0x3 {
+	case 0:
+		hl = r.next(1)[0]
+	case 1:
+		hl = 1
+	case 2:
+		hl = 64
+	case 3:
+		hl = 255
+	}
+
+	srcAddr := header.IPv6Any
+
+	if b1&0x40 == 0 {
+		srcAddr = decompressUnicast(r, (b1>>4)&0x3, src)
+	}
+
+	var dstAddr tcpip.Address
+
+	if b1&0x08 != 0 {
+		dstAddr = decompressMulticast(r, b1&0x3)
+	} else {
+		dstAddr = decompressUnicast(r, b1&0x3, dst)
+	}
+
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+
+	ip = make(header.IPv6, header.IPv6MinimumSize)
+	ip.Encode(&header.IPv6Fields{
+		TrafficClass:      tc,
+		FlowLabel:         fl,
+		TransportProtocol: tcpip.TransportProtocolNumber(nh),
+		HopLimit:          hl,
+		SrcAddr:           srcAddr,
+		DstAddr:           dstAddr,
+	})
+
+	return ip, len(buf) - len(r.buf), nil
+}
+
+// encode compresses an IPv6 packet, it returns one or more (when fragmented)
+// 6LoWPAN payloads.
+func (l *lowpan) encode(pkt []byte, src tcpip.LinkAddress, dst tcpip.LinkAddress) (payloads [][]byte, err error) {
+	ip := header.IPv6(pkt)
+
+	if !ip.IsValid(len(pkt)) {
+		return nil, errors.New("invalid IPv6 packet")
+	}
+
+	size := header.IPv6MinimumSize + int(ip.PayloadLength())
+	hdr := compressIPHC(ip, src, dst)
+	payload := pkt[header.IPv6MinimumSize:size]
+
+	if len(hdr)+len(payload) <= lowpanFrameSize {
+		return [][]byte{append(hdr, payload...)}, nil
+	}
+
+	if size > lowpanMaxDatagram {
+		return nil, fmt.Errorf("datagram too large (%d)", size)
+	}
+
+	l.tag++
+	tag := l.tag
+
+	// RFC 4944 - 5.3, fragment payloads (but the last one) must be a
+	// multiple of 8 bytes of the uncompressed datagram.
+	n := (lowpanFrameSize - lowpanFrag1Len - len(hdr)) &^ 7
+
+	frag := make([]byte, lowpanFrag1Len)
+	binary.BigEndian.PutUint16(frag[0:2], lowpanDispatchFrag1<<8|uint16(size))
+	binary.BigEndian.PutUint16(frag[2:4], tag)
+	frag = append(frag, hdr...)
+	frag = append(frag, payload[:n]...)
+
+	payloads = append(payloads, frag)
+
+	for off := header.IPv6MinimumSize + n; off < size; off += n {
+		n = (lowpanFrameSize - lowpanFragNLen) &^ 7
+
+		if off+n > size {
+			n = size - off
+		}
+
+		frag = make([]byte, lowpanFragNLen)
+		binary.BigEndian.PutUint16(frag[0:2], lowpanDispatchFragN<<8|uint16(size))
+		binary.BigEndian.PutUint16(frag[2:4], tag)
+		frag[4] = byte(off / 8)
+		frag = append(frag, pkt[off:off+n]...)
+
+		payloads = append(payloads, frag)
+	}
+
+	return
+}
+
+// reassemble processes an RFC 4944 fragment, it returns the IPv6 datagram
+// once all its fragments have been received.
+func (l *lowpan) reassemble(buf []byte, src tcpip.LinkAddress, dst tcpip.LinkAddress) (pkt []byte, err error) {
+	first := buf[0]&0xf8 == lowpanDispatchFrag1
+	hdrLen := lowpanFragNLen
+
+	if first {
+		hdrLen = lowpanFrag1Len
+	}
+
+	if len(buf) < hdrLen {
+		return nil, errors.New("invalid fragment header")
+	}
+
+	size := int(binary.BigEndian.Uint16(buf[0:2]) & lowpanMaxDatagram)
+	tag := binary.BigEndian.Uint16(buf[2:4])
+	off := 0
+
+	if size < header.IPv6MinimumSize {
+		return nil, errors.New("invalid datagram size")
+	}
+
+	var data []byte
+
+	if first {
+		ip, n, err := decompressIPHC(buf[hdrLen:], src, dst)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ip.SetPayloadLength(uint16(size - header.IPv6MinimumSize))
+		data = append(ip, buf[hdrLen+n:]...)
+	} else {
+		off = int(buf[4]) * 8
+		data = buf[hdrLen:]
+	}
+
+	if off+len(data) > size {
+		return nil, errors.New("invalid fragment offset")
+	}
+
+	now := time.Now()
+
+	for key, r := range l.fragments {
+		if now.After(r.deadline) {
+			delete(l.fragments, key)
+		}
+	}
+
+	key := lowpanKey{src: src, size: size, tag: tag}
+	r, ok := l.fragments[key]
+
+	if !ok {
+		if len(l.fragments) >= lowpanMaxReassemblies {
+			return nil, errors.New("too many incomplete datagrams")
+		}
+
+		r = &lowpanReassembly{
+			buf:      make([]byte, size),
+			deadline: now.Add(lowpanReassemblyTimeout),
+		}
+
+		l.fragments[key] = r
+	}
+
+	copy(r.buf[off:], data)
+	r.received += len(data)
+
+	if r.received < size {
+		return
+	}
+
+	delete(l.fragments, key)
+
+	if r.received > size {
+		return nil, errors.New("overlapping fragments")
+	}
+
+	return r.buf, nil
+}
+
+// decode returns the IPv6 datagram carried in a 6LoWPAN payload, a nil
+// datagram is returned for incomplete fragmented datagrams.
+func (l *lowpan) decode(buf []byte, src tcpip.LinkAddress, dst tcpip.LinkAddress) (pkt []byte, err error) {
+	if len(buf) == 0 {
+		return nil, errors.New("invalid payload")
+	}
+
+	switch {
+	case buf[0] == lowpanDispatchIPv6:
+		return buf[1:], nil
+	case buf[0]&0xe0 == lowpanDispatchIPHC:
+		ip, n, err := decompressIPHC(buf, src, dst)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ip.SetPayloadLength(uint16(len(buf) - n))
+
+		return append(ip, buf[n:]...), nil
+	case buf[0]&0xf8 == lowpanDispatchFrag1, buf[0]&0xf8 == lowpanDispatchFragN:
+		return l.reassemble(buf, src, dst)
+	default:
+		return nil, fmt.Errorf("unsupported dispatch %#x", buf[0])
+	}
+}
+
+// rx converts incoming LoWPAN encapsulated frames to IPv6 ones, other frames
+// are returned unmodified while nil is returned for dropped frames and
+// incomplete fragmented datagrams.
+func (l *lowpan) rx(buf []byte) []byte {
+	if len(buf) <= header.EthernetMinimumSize || binary.BigEndian.Uint16(buf[12:14]) != LoWPANEtherType {
+		return buf
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.enabled {
+		return buf
+	}
+
+	dst := tcpip.LinkAddress(buf[0:6])
+	src := tcpip.LinkAddress(buf[6:12])
+
+	pkt, err := l.decode(buf[header.EthernetMinimumSize:], src, dst)
+
+	if err != nil || pkt == nil {
+		return nil
+	}
+
+	frame := make([]byte, header.EthernetMinimumSize, header.EthernetMinimumSize+len(pkt))
+	copy(frame, buf[0:12])
+	binary.BigEndian.PutUint16(frame[12:14], uint16(header.IPv6ProtocolNumber))
+
+	return append(frame, pkt...)
+}
+
+// tx converts outgoing IPv6 frames to LoWPAN encapsulated ones, other frames
+// are returned unmodified. Fragmented datagrams are returned one frame at a
+// time, see next().
+func (l *lowpan) tx(buf []byte) []byte {
+	if len(buf) <= header.EthernetMinimumSize || binary.BigEndian.Uint16(buf[12:14]) != uint16(header.IPv6ProtocolNumber) {
+		return buf
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.enabled {
+		return buf
+	}
+
+	dst := tcpip.LinkAddress(buf[0:6])
+	src := tcpip.LinkAddress(buf[6:12])
+
+	payloads, err := l.encode(buf[header.EthernetMinimumSize:], src, dst)
+
+	if err != nil {
+		return nil
+	}
+
+	for _, payload := range payloads {
+		frame := make([]byte, header.EthernetMinimumSize, header.EthernetMinimumSize+len(payload))
+		copy(frame, buf[0:12])
+		binary.BigEndian.PutUint16(frame[12:14], LoWPANEtherType)
+
+		l.queue = append(l.queue, append(frame, payload...))
+	}
+
+	return l.pop()
+}
+
+func (l *lowpan) pop() (buf []byte) {
+	if len(l.queue) == 0 {
+		return
+	}
+
+	buf, l.queue = l.queue[0], l.queue[1:]
+
+	return
+}
+
+// next returns the next pending fragment, if any.
+func (l *lowpan) next() []byte {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.pop()
+}
+
+// Enable6LoWPAN enables a 6LoWPAN adaptation layer for IPv6 packets
+// exchanged with an IEEE 802.15.4 network through a bridge using LoWPAN
+// encapsulation (RFC 7973).
+//
+// Incoming LoWPAN frames are reassembled (RFC 4944) and decompressed (RFC
+// 6282) before being passed to the stack, outgoing IPv6 packets are
+// compressed and, when exceeding the IEEE 802.15.4 frame payload,
+// fragmented. Link-local addresses are compressed against the Ethernet
+// addresses of each frame, while stateful (context based) and next header
+// compression are not supported.
+//
+// The argument panID identifies the bridged PAN, the broadcast PAN identifier
+// (0xffff) is not valid.
+func (iface *Interface) Enable6LoWPAN(panID uint16) error {
+	if iface.opts.IPv6 == nil {
+		return errors.New("IPv6 is not enabled")
+	}
+
+	if panID == 0xffff {
+		return errors.New("invalid PAN identifier")
+	}
+
+	if iface.opts.ChecksumOffload {
+		return errors.New("incompatible with checksum offload")
+	}
+
+	l := &iface.NIC.lowpan
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.enabled = true
+	l.panID = panID
+	l.fragments = make(map[lowpanKey]*lowpanReassembly)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+)
+
+// IEEE 802.3 Annex 22D - MMD access through Clause 22 registers
+const (
+	MII_MMD_CTRL      = 0x0d
+	MMD_CTRL_FUNCTION = 14
+	MMD_FUNCTION_ADDR = 0b00
+	MMD_FUNCTION_DATA = 0b01
+	MII_MMD_ADDR_DATA = 0x0e
+
+	// maximum Clause 22 register and MMD device addresses
+	miiMaxRegister = 31
+	mmdMaxDevice   = 31
+)
+
+// checkMII validates a Clause 22 register address for the PHY associated to
+// the physical interface.
+func (eth *NIC) checkMII(ra int) error {
+	if eth.Device == nil {
+		return errors.New("missing physical interface")
+	}
+
+	if ra < 0 || ra > miiMaxRegister {
+		return errors.New("invalid register address")
+	}
+
+	if eth.PHYAddress < 0 || eth.PHYAddress > miiMaxRegister {
+		return errors.New("invalid PHY address")
+	}
+
+	return nil
+}
+
+// selectMMD selects, with the MII lock held, a Clause 45 MMD register for
+// subsequent data access through MII_MMD_ADDR_DATA.
+func (eth *NIC) selectMMD(devad int, ra uint16) {
+	pa := eth.PHYAddress
+
+	eth.Device.WriteMII(pa, MII_MMD_CTRL, MMD_FUNCTION_ADDR<<MMD_CTRL_FUNCTION|uint16(devad))
+	eth.Device.WriteMII(pa, MII_MMD_ADDR_DATA, ra)
+	eth.Device.WriteMII(pa, MII_MMD_CTRL, MMD_FUNCTION_DATA<<MMD_CTRL_FUNCTION|uint16(devad))
+}
+
+// ReadMMD reads a Clause 45 register, of the argument MMD device, of the
+// Ethernet PHY associated to the physical interface.
+//
+// As the ENET MDIO interface is used with Clause 22 frames, the register is
+// accessed indirectly through the MMD access control and address/data
+// registers (IEEE 802.3 Annex 22D), which the PHY must therefore implement.
+func (eth *NIC) ReadMMD(devad int, ra uint16) (data uint16, err error) {
+	if err = eth.checkMII(MII_MMD_CTRL); err != nil {
+		return
+	}
+
+	if devad < 0 || devad > mmdMaxDevice {
+		return 0, errors.New("invalid MMD device address")
+	}
+
+	eth.mii.Lock()
+	defer eth.mii.Unlock()
+
+	eth.selectMMD(devad, ra)
+
+	return eth.Device.ReadMII(eth.PHYAddress, MII_MMD_ADDR_DATA), nil
+}
+
+// WriteMMD writes a Clause 45 register, of the argument MMD device, of the
+// Ethernet PHY associated to the physical interface (see ReadMMD()).
+func (eth *NIC) WriteMMD(devad int, ra uint16, data uint16) (err error) {
+	if err = eth.checkMII(MII_MMD_CTRL); err != nil {
+		return
+	}
+
+	if devad < 0 || devad > mmdMaxDevice {
+		return errors.New("invalid MMD device address")
+	}
+
+	eth.mii.Lock()
+	defer eth.mii.Unlock()
+
+	eth.selectMMD(devad, ra)
+	eth.Device.WriteMII(eth.PHYAddress, MII_MMD_ADDR_DATA, data)
+
+	return
+}
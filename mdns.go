@@ -0,0 +1,493 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// mDNS constants (RFC 6762)
+const (
+	// MDNSPort is the mDNS UDP port.
+	MDNSPort = 5353
+	// MDNSIPv4Address is the mDNS IPv4 link-local multicast address.
+	MDNSIPv4Address = "224.0.0.251"
+	// MDNSIPv6Address is the mDNS IPv6 link-local multicast address.
+	MDNSIPv6Address = "ff02::fb"
+
+	// RFC 6762 - 10
+	mdnsHostTTL = 120
+	// RFC 6762 - 6.7
+	mdnsLegacyTTL = 10
+	// RFC 6762 - 8.3
+	mdnsAnnounceNum      = 2
+	mdnsAnnounceInterval = 1 * time.Second
+
+	// RFC 6762 - 10
+	mdnsServiceTTL = 4500
+
+	mdnsCacheFlush     = 0x8000
+	mdnsUnicastQuery   = 0x8000
+	mdnsFlagsAuthority = 0x8400
+
+	dnsTypeANY = 255
+)
+
+type mdnsRecord struct {
+	name  string
+	rtype uint16
+	ttl   uint32
+	flush bool
+	data  []byte
+}
+
+type mdnsQuestion struct {
+	name    string
+	qtype   uint16
+	unicast bool
+}
+
+type mdnsConn struct {
+	*gonet.UDPConn
+
+	group *net.UDPAddr
+}
+
+// MDNSResponder represents a Multicast DNS (RFC 6762) responder instance.
+type MDNSResponder struct {
+	sync.Mutex
+
+	iface    *Interface
+	hostname string
+	conns    []*mdnsConn
+
+	// DNS-SD services, see Register()
+	services []*MDNSService
+
+	done chan struct{}
+	once sync.Once
+}
+
+func appendRecord(buf []byte, rec *mdnsRecord, legacy bool) []byte {
+	name, err := encodeName(rec.name)
+
+	if err != nil {
+		return buf
+	}
+
+	class := uint16(dnsClassIN)
+	ttl := rec.ttl
+
+	switch {
+	case legacy && ttl > mdnsLegacyTTL:
+		ttl = mdnsLegacyTTL
+	case !legacy && rec.flush:
+		class |= mdnsCacheFlush
+	}
+
+	hdr := make([]byte, 10)
+	binary.BigEndian.PutUint16(hdr[0:2], rec.rtype)
+	binary.BigEndian.PutUint16(hdr[2:4], class)
+	binary.BigEndian.PutUint32(hdr[4:8], ttl)
+	binary.BigEndian.PutUint16(hdr[8:10], uint16(len(rec.data)))
+
+	buf = append(buf, name...)
+	buf = append(buf, hdr...)
+
+	return append(buf, rec.data...)
+}
+
+func parseMDNSQuery(buf []byte) (id uint16, questions []mdnsQuestion, err error) {
+	if len(buf) < dnsHeaderLen {
+		return 0, nil, errors.New("invalid message length")
+	}
+
+	// responses are ignored
+	if binary.BigEndian.Uint16(buf[2:4])&dnsFlagResponse != 0 {
+		return 0, nil, nil
+	}
+
+	id = binary.BigEndian.Uint16(buf[0:2])
+	qdcount := int(binary.BigEndian.Uint16(buf[4:6]))
+	off := dnsHeaderLen
+
+	for i := 0; i < qdcount; i++ {
+		name, n, err := readName(buf, off)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if off += n; off+4 > len(buf) {
+			return 0, nil, errors.New("invalid question")
+		}
+
+		class := binary.BigEndian.Uint16(buf[off+2 : off+4])
+
+		questions = append(questions, mdnsQuestion{
+			name:    name,
+			qtype:   binary.BigEndian.Uint16(buf[off : off+2]),
+			unicast: class&mdnsUnicastQuery != 0,
+		})
+
+		off += 4
+	}
+
+	return
+}
+
+func normalizeHostname(hostname string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(hostname, "."))
+
+	if !strings.HasSuffix(name, ".local") {
+		name += ".local"
+	}
+
+	if _, err := encodeName(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// hostRecords returns the address records of the responder hostname.
+func (r *MDNSResponder) hostRecords() (records []*mdnsRecord) {
+	iface := r.iface
+
+	if addr, err := iface.localAddress(); err == nil {
+		records = append(records, &mdnsRecord{
+			name:  r.hostname,
+			rtype: dnsTypeA,
+			ttl:   mdnsHostTTL,
+			flush: true,
+			data:  []byte(addr),
+		})
+	}
+
+	if addr := iface.address6.Address; len(addr) > 0 && iface.Stack.CheckLocalAddress(iface.nicid, ipv6.ProtocolNumber, addr) != 0 {
+		records = append(records, &mdnsRecord{
+			name:  r.hostname,
+			rtype: dnsTypeAAAA,
+			ttl:   mdnsHostTTL,
+			flush: true,
+			data:  []byte(addr),
+		})
+	}
+
+	return
+}
+
+// matchRecords returns the records matching a question name and type.
+func matchRecords(q mdnsQuestion, records []*mdnsRecord) (matches []*mdnsRecord) {
+	name := strings.TrimSuffix(q.name, ".")
+
+	for _, rec := range records {
+		if strings.EqualFold(name, rec.name) && (q.qtype == rec.rtype || q.qtype == dnsTypeANY) {
+			matches = append(matches, rec)
+		}
+	}
+
+	return
+}
+
+// answer returns the records answering a question, along with additional
+// records useful to the querier (RFC 6763 - 12).
+func (r *MDNSResponder) answer(q mdnsQuestion) (answers []*mdnsRecord, additional []*mdnsRecord) {
+	answers = matchRecords(q, r.records())
+
+	for _, rec := range answers {
+		additional = append(additional, r.additionalRecords(rec)...)
+	}
+
+	return
+}
+
+// records returns all records owned by the responder.
+func (r *MDNSResponder) records() []*mdnsRecord {
+	return append(r.hostRecords(), r.serviceRecords()...)
+}
+
+func (r *MDNSResponder) response(id uint16, questions []mdnsQuestion, records []*mdnsRecord, additional []*mdnsRecord, legacy bool) []byte {
+	buf := make([]byte, dnsHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], id)
+	binary.BigEndian.PutUint16(buf[2:4], mdnsFlagsAuthority)
+	binary.BigEndian.PutUint16(buf[6:8], uint16(len(records)))
+	binary.BigEndian.PutUint16(buf[10:12], uint16(len(additional)))
+
+	// legacy unicast responses repeat the question (RFC 6762 - 6.7)
+	if legacy {
+		binary.BigEndian.PutUint16(buf[4:6], uint16(len(questions)))
+
+		for _, q := range questions {
+			name, _ := encodeName(q.name)
+			buf = append(buf, name...)
+			buf = append(buf, byte(q.qtype>>8), byte(q.qtype), 0, dnsClassIN)
+		}
+	}
+
+	for _, rec := range records {
+		buf = appendRecord(buf, rec, legacy)
+	}
+
+	for _, rec := range additional {
+		buf = appendRecord(buf, rec, legacy)
+	}
+
+	return buf
+}
+
+// handle processes an mDNS query (RFC 6762 - 6).
+func (r *MDNSResponder) handle(conn *mdnsConn, buf []byte, src *net.UDPAddr) {
+	id, questions, err := parseMDNSQuery(buf)
+
+	if err != nil || len(questions) == 0 {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	legacy := src.Port != MDNSPort
+	unicast := legacy
+
+	var records []*mdnsRecord
+	var additional []*mdnsRecord
+
+	for _, q := range questions {
+		if answers, extra := r.answer(q); len(answers) > 0 {
+			records = append(records, answers...)
+			additional = append(additional, extra...)
+			unicast = unicast || q.unicast
+		}
+	}
+
+	if len(records) == 0 {
+		return
+	}
+
+	if !legacy {
+		id = 0
+		questions = nil
+	}
+
+	dst := conn.group
+
+	if unicast {
+		dst = src
+	}
+
+	additional = uniqueRecords(additional, records)
+
+	conn.WriteTo(r.response(id, questions, records, additional, legacy), dst)
+}
+
+func (r *MDNSResponder) serve(conn *mdnsConn) {
+	buf := make([]byte, MaxMTU)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		if src, ok := addr.(*net.UDPAddr); ok {
+			r.handle(conn, buf[:n], src)
+		}
+	}
+}
+
+// uniqueRecords returns the argument records omitting duplicates and those
+// already present in the exclude list.
+func uniqueRecords(records []*mdnsRecord, exclude []*mdnsRecord) (unique []*mdnsRecord) {
+	seen := make(map[string]bool)
+
+	for _, rec := range exclude {
+		seen[rec.key()] = true
+	}
+
+	for _, rec := range records {
+		if k := rec.key(); !seen[k] {
+			seen[k] = true
+			unique = append(unique, rec)
+		}
+	}
+
+	return
+}
+
+func (rec *mdnsRecord) key() string {
+	return fmt.Sprintf("%s/%d/%x", strings.ToLower(rec.name), rec.rtype, rec.data)
+}
+
+// announce sends unsolicited responses with the argument records (RFC 6762 -
+// 8.3), goodbye responses (RFC 6762 - 10.1) have their TTL set to zero.
+func (r *MDNSResponder) announce(records []*mdnsRecord, goodbye bool, num int) {
+	if goodbye {
+		for _, rec := range records {
+			rec.ttl = 0
+		}
+	}
+
+	msg := r.response(0, nil, records, nil, false)
+
+	for i := 0; i < num; i++ {
+		if i > 0 {
+			select {
+			case <-r.done:
+				return
+			case <-time.After(mdnsAnnounceInterval):
+			}
+		}
+
+		for _, conn := range r.conns {
+			conn.WriteTo(msg, conn.group)
+		}
+	}
+}
+
+func (iface *Interface) listenMDNS(proto tcpip.NetworkProtocolNumber, group string) (conn *mdnsConn, err error) {
+	var wq waiter.Queue
+
+	ip := net.ParseIP(group)
+
+	if proto == ipv4.ProtocolNumber {
+		ip = ip.To4()
+	}
+
+	ep, tcpErr := iface.Stack.NewEndpoint(udp.ProtocolNumber, proto, &wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (udp): %v", tcpErr)
+	}
+
+	ep.SocketOptions().SetReuseAddress(true)
+	ep.SocketOptions().SetMulticastLoop(false)
+
+	// RFC 6762 - 11
+	ep.SetSockOptInt(tcpip.MulticastTTLOption, 255)
+
+	if proto == ipv4.ProtocolNumber {
+		ep.SetSockOptInt(tcpip.IPv4TTLOption, 255)
+	} else {
+		ep.SetSockOptInt(tcpip.IPv6HopLimitOption, 255)
+	}
+
+	if tcpErr := ep.Bind(tcpip.FullAddress{NIC: iface.nicid, Port: MDNSPort}); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("bind error (udp): %v", tcpErr)
+	}
+
+	membership := &tcpip.AddMembershipOption{
+		NIC:           iface.nicid,
+		MulticastAddr: tcpip.Address(ip),
+	}
+
+	if tcpErr := ep.SetSockOpt(membership); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("membership error (udp): %v", tcpErr)
+	}
+
+	return &mdnsConn{
+		UDPConn: gonet.NewUDPConn(iface.Stack, &wq, ep),
+		group:   &net.UDPAddr{IP: ip, Port: MDNSPort},
+	}, nil
+}
+
+// StartMDNS starts a Multicast DNS (RFC 6762) responder which answers
+// queries for the argument hostname, qualified with the ".local" domain when
+// not already, with the interface IPv4 and IPv6 addresses.
+//
+// The responder operates over IPv4 and, when enabled on the interface, over
+// IPv6. Hostname records are announced at startup, no probing is performed
+// to ensure their uniqueness. DNS-SD services can be advertised with
+// Register().
+func (iface *Interface) StartMDNS(hostname string) (r *MDNSResponder, err error) {
+	name, err := normalizeHostname(hostname)
+
+	if err != nil {
+		return
+	}
+
+	r = &MDNSResponder{
+		iface:    iface,
+		hostname: name,
+		done:     make(chan struct{}),
+	}
+
+	groups := map[tcpip.NetworkProtocolNumber]string{
+		ipv4.ProtocolNumber: MDNSIPv4Address,
+	}
+
+	if iface.opts.IPv6 != nil {
+		groups[ipv6.ProtocolNumber] = MDNSIPv6Address
+	}
+
+	for proto, group := range groups {
+		conn, err := iface.listenMDNS(proto, group)
+
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+
+		r.conns = append(r.conns, conn)
+	}
+
+	for _, conn := range r.conns {
+		go r.serve(conn)
+	}
+
+	go r.announce(r.hostRecords(), false, mdnsAnnounceNum)
+
+	return
+}
+
+// Hostname returns the fully qualified hostname advertised by the responder.
+func (r *MDNSResponder) Hostname() string {
+	return r.hostname
+}
+
+// Close sends goodbye responses (RFC 6762 - 10.1) and stops the responder.
+func (r *MDNSResponder) Close() (err error) {
+	r.once.Do(func() {
+		r.Lock()
+		records := r.records()
+		r.Unlock()
+
+		r.announce(records, true, 1)
+		close(r.done)
+
+		for _, conn := range r.conns {
+			if e := conn.Close(); e != nil {
+				err = e
+			}
+		}
+	})
+
+	return
+}
@@ -0,0 +1,332 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Histogram represents a cumulative duration histogram.
+type Histogram interface {
+	// Observe records a single duration.
+	Observe(d time.Duration)
+	// Buckets returns, for each bucket upper bound, the cumulative count of
+	// observations less than or equal to it, followed by the total count.
+	Buckets() []uint64
+}
+
+type durationHistogram struct {
+	sync.Mutex
+
+	bounds []time.Duration
+	counts []uint64
+	sum    time.Duration
+}
+
+func newDurationHistogram(buckets []time.Duration) (h *durationHistogram, err error) {
+	if len(buckets) == 0 {
+		return nil, errors.New("missing buckets")
+	}
+
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, errors.New("buckets must be in increasing order")
+		}
+	}
+
+	h = &durationHistogram{
+		bounds: append([]time.Duration{}, buckets...),
+		counts: make([]uint64, len(buckets)+1),
+	}
+
+	return
+}
+
+func (h *durationHistogram) Observe(d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	i := 0
+
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i] += 1
+	h.sum += d
+}
+
+func (h *durationHistogram) snapshot() (buckets []uint64, sum time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	var n uint64
+
+	for _, c := range h.counts {
+		n += c
+		buckets = append(buckets, n)
+	}
+
+	return buckets, h.sum
+}
+
+func (h *durationHistogram) Buckets() (buckets []uint64) {
+	buckets, _ = h.snapshot()
+	return
+}
+
+func (h *durationHistogram) writePrometheus(w io.Writer, name string, help string, labels string) {
+	buckets, sum := h.snapshot()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	for i, n := range buckets {
+		le := "+Inf"
+
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i].Seconds(), 'g', -1, 64)
+		}
+
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, le, n)
+	}
+
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, trimLabels(labels), sum.Seconds())
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, trimLabels(labels), buckets[len(buckets)-1])
+}
+
+func trimLabels(labels string) string {
+	if n := len(labels); n > 0 && labels[n-1] == ',' {
+		return labels[:n-1]
+	}
+
+	return labels
+}
+
+type histogramListener struct {
+	net.Listener
+	h *durationHistogram
+}
+
+func (l *histogramListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &histogramConn{Conn: conn, h: l.h, start: time.Now()}, nil
+}
+
+type histogramConn struct {
+	net.Conn
+	h     *durationHistogram
+	start time.Time
+	once  sync.Once
+}
+
+func (c *histogramConn) Close() error {
+	c.once.Do(func() {
+		c.h.Observe(time.Since(c.start))
+	})
+
+	return c.Conn.Close()
+}
+
+func (c *histogramConn) CloseRead() error {
+	if conn, ok := c.Conn.(TCPConn); ok {
+		return conn.CloseRead()
+	}
+
+	return errors.New("half-close not supported")
+}
+
+func (c *histogramConn) CloseWrite() error {
+	if conn, ok := c.Conn.(TCPConn); ok {
+		return conn.CloseWrite()
+	}
+
+	return errors.New("half-close not supported")
+}
+
+// EnableConnectionDurationHistogram enables recording, in a histogram with
+// the argument bucket upper bounds, of the time elapsed between Accept and
+// Close of TCP connections received on listeners created with ListenerTCP4.
+//
+// Only listeners created after enabling the histogram are tracked.
+func (iface *Interface) EnableConnectionDurationHistogram(buckets []time.Duration) (err error) {
+	h, err := newDurationHistogram(buckets)
+
+	if err != nil {
+		return
+	}
+
+	iface.mu.Lock()
+	iface.connDuration = h
+	iface.mu.Unlock()
+
+	return
+}
+
+// connectionDuration returns the TCP connection duration histogram, if
+// enabled.
+func (iface *Interface) connectionDuration() *durationHistogram {
+	iface.mu.RLock()
+	defer iface.mu.RUnlock()
+
+	return iface.connDuration
+}
+
+// ConnectionDurationHistogram returns the TCP connection duration histogram,
+// nil is returned if EnableConnectionDurationHistogram() has not been called.
+func (iface *Interface) ConnectionDurationHistogram() Histogram {
+	h := iface.connectionDuration()
+
+	if h == nil {
+		return nil
+	}
+
+	return h
+}
+
+// PrometheusHandler returns an HTTP handler which serves the interface
+// metrics in Prometheus text exposition format.
+func (iface *Interface) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		iface.WritePrometheus(w)
+	})
+}
+
+type metric struct {
+	name  string
+	help  string
+	gauge bool
+	value float64
+}
+
+func writeMetrics(w io.Writer, labels string, metrics []metric) {
+	for _, m := range metrics {
+		typ := "counter"
+
+		if m.gauge {
+			typ = "gauge"
+		}
+
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, typ)
+		fmt.Fprintf(w, "%s{%s} %g\n", m.name, trimLabels(labels), m.value)
+	}
+}
+
+func bool2float(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// stackMetrics returns the interface and stack metrics (see Stats()).
+func (iface *Interface) stackMetrics() []metric {
+	s := iface.Stats()
+
+	return []metric{
+		{"enet_uptime_seconds", "Time elapsed since interface initialization.", true, time.Since(iface.started).Seconds()},
+		{"enet_rx_packets_total", "Packets received by the interface.", false, float64(s.RxPackets)},
+		{"enet_rx_bytes_total", "Bytes received by the interface.", false, float64(s.RxBytes)},
+		{"enet_tx_packets_total", "Packets transmitted by the interface.", false, float64(s.TxPackets)},
+		{"enet_tx_bytes_total", "Bytes transmitted by the interface.", false, float64(s.TxBytes)},
+		{"enet_tx_dropped_total", "Packets dropped on full transmit queue.", false, float64(s.TxDropped)},
+		{"enet_stack_dropped_packets_total", "Packets dropped by the stack.", false, float64(s.DroppedPackets)},
+		{"enet_ip_packets_received_total", "IP packets received.", false, float64(s.IP.PacketsReceived)},
+		{"enet_ip_packets_sent_total", "IP packets sent.", false, float64(s.IP.PacketsSent)},
+		{"enet_ip_malformed_packets_total", "Malformed IP packets received.", false, float64(s.IP.MalformedPacketsReceived)},
+		{"enet_ip_outgoing_errors_total", "IP packets which could not be sent.", false, float64(s.IP.OutgoingPacketErrors)},
+		{"enet_arp_requests_sent_total", "ARP requests sent.", false, float64(s.ARP.RequestsSent)},
+		{"enet_arp_replies_received_total", "ARP replies received.", false, float64(s.ARP.RepliesReceived)},
+		{"enet_arp_request_errors_total", "ARP requests dropped or not sent.", false, float64(s.ARP.RequestErrors)},
+		{"enet_icmp_dst_unreachable_received_total", "ICMP destination unreachable messages received.", false, float64(s.ICMP.DstUnreachableReceived)},
+		{"enet_icmp_time_exceeded_received_total", "ICMP time exceeded messages received.", false, float64(s.ICMP.TimeExceededReceived)},
+		{"enet_icmp_invalid_received_total", "Invalid ICMP messages received.", false, float64(s.ICMP.InvalidPacketsReceived)},
+		{"enet_tcp_current_established", "TCP connections in established or close wait state.", true, float64(s.TCP.CurrentEstablished)},
+		{"enet_tcp_active_openings_total", "TCP connections actively opened.", false, float64(s.TCP.ActiveConnectionOpenings)},
+		{"enet_tcp_passive_openings_total", "TCP connections passively opened.", false, float64(s.TCP.PassiveConnectionOpenings)},
+		{"enet_tcp_failed_attempts_total", "TCP connection attempts failed.", false, float64(s.TCP.FailedConnectionAttempts)},
+		{"enet_tcp_established_resets_total", "TCP established connections reset.", false, float64(s.TCP.EstablishedResets)},
+		{"enet_tcp_retransmits_total", "TCP segments retransmitted.", false, float64(s.TCP.Retransmits)},
+		{"enet_tcp_timeouts_total", "TCP retransmission timeouts.", false, float64(s.TCP.Timeouts)},
+		{"enet_tcp_checksum_errors_total", "TCP segments received with invalid checksum.", false, float64(s.TCP.ChecksumErrors)},
+		{"enet_udp_packets_received_total", "UDP datagrams received.", false, float64(s.UDP.PacketsReceived)},
+		{"enet_udp_packets_sent_total", "UDP datagrams sent.", false, float64(s.UDP.PacketsSent)},
+		{"enet_udp_unknown_port_errors_total", "UDP datagrams received on unbound ports.", false, float64(s.UDP.UnknownPortErrors)},
+		{"enet_udp_receive_buffer_errors_total", "UDP datagrams dropped on full receive buffer.", false, float64(s.UDP.ReceiveBufferErrors)},
+	}
+}
+
+// hardwareMetrics returns the ENET and PHY metrics (see Counters() and
+// LinkState()).
+func (iface *Interface) hardwareMetrics() (metrics []metric) {
+	if state, err := iface.LinkState(); err == nil {
+		metrics = append(metrics,
+			metric{"enet_link_up", "Whether the Ethernet link is established.", true, bool2float(state.Up)},
+			metric{"enet_link_speed_mbps", "Ethernet link speed.", true, float64(state.Speed)},
+		)
+	}
+
+	c, err := iface.Counters()
+
+	if err != nil {
+		return
+	}
+
+	return append(metrics,
+		metric{"enet_hw_rx_frames_total", "Frames received by the MAC.", false, float64(c.RxFrames)},
+		metric{"enet_hw_rx_crc_errors_total", "Frames received with CRC errors.", false, float64(c.RxCRCErrors)},
+		metric{"enet_hw_rx_align_errors_total", "Frames received with alignment errors.", false, float64(c.RxAlignErrors)},
+		metric{"enet_hw_rx_dropped_total", "Frames dropped for lack of receive buffers.", false, float64(c.RxDropped)},
+		metric{"enet_hw_rx_fifo_overruns_total", "Frames dropped on receive FIFO overrun.", false, float64(c.RxFIFOOverruns)},
+		metric{"enet_hw_tx_frames_total", "Frames transmitted by the MAC.", false, float64(c.TxFrames)},
+		metric{"enet_hw_tx_collisions_total", "Transmit collisions.", false, float64(c.TxCollisions)},
+		metric{"enet_hw_tx_fifo_underruns_total", "Frames dropped on transmit FIFO underrun.", false, float64(c.TxFIFOUnderruns)},
+	)
+}
+
+// WritePrometheus writes the interface metrics in Prometheus text exposition
+// format.
+func (iface *Interface) WritePrometheus(w io.Writer) {
+	labels := fmt.Sprintf("nic=\"%d\",", iface.nicid)
+
+	writeMetrics(w, labels, iface.stackMetrics())
+
+	if iface.NIC != nil && iface.NIC.Device != nil {
+		writeMetrics(w, labels, iface.hardwareMetrics())
+	}
+
+	if h := iface.connectionDuration(); h != nil {
+		h.writePrometheus(w, "enet_tcp_connection_duration_seconds", "TCP connection duration from Accept to Close.", labels)
+	}
+}
+
+// ServePrometheus serves the interface metrics, in Prometheus text exposition
+// format, on the /metrics path of the argument listener (e.g. obtained with
+// ListenerTCPAddress()). It blocks until the listener is closed.
+func (iface *Interface) ServePrometheus(l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", iface.PrometheusHandler())
+
+	return http.Serve(l, mux)
+}
@@ -0,0 +1,56 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionDurationHistogram(t *testing.T) {
+	iface := testInterface(t, testOptions(1))
+
+	if h := iface.ConnectionDurationHistogram(); h != nil {
+		t.Fatal("unexpected histogram before enabling")
+	}
+
+	var wg sync.WaitGroup
+
+	// the histogram can be enabled while metrics are being served
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			iface.WritePrometheus(io.Discard)
+		}
+	}()
+
+	if err := iface.EnableConnectionDurationHistogram([]time.Duration{time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Wait()
+
+	if h := iface.ConnectionDurationHistogram(); h == nil {
+		t.Fatal("histogram not enabled")
+	}
+
+	buf := new(bytes.Buffer)
+	iface.WritePrometheus(buf)
+
+	if !strings.Contains(buf.String(), "enet_tcp_connection_duration_seconds") {
+		t.Error("histogram not exported")
+	}
+}
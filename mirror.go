@@ -0,0 +1,206 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Mirror encapsulation formats
+const (
+	// MirrorTZSP encapsulates frames in TaZmen Sniffer Protocol (TZSP)
+	// datagrams, decoded by Wireshark on UDP port 37008.
+	MirrorTZSP = iota
+	// MirrorUDP sends each frame, unmodified, as UDP datagram payload.
+	MirrorUDP
+)
+
+// TZSP constants
+const (
+	// TZSPPort is the default TZSP collector port.
+	TZSPPort = 37008
+
+	tzspVersion      = 1
+	tzspTypeReceived = 0
+	tzspEncapEther   = 1
+	tzspTagEnd       = 1
+)
+
+// mirrorQueueLength is the number of frames queued for transmission to the
+// collector, further frames are dropped.
+const mirrorQueueLength = 64
+
+// MirrorOptions represents a remote packet mirroring configuration.
+type MirrorOptions struct {
+	// Collector is the collector address, in host:port format.
+	Collector string
+	// Format is the encapsulation format (MirrorTZSP or MirrorUDP).
+	Format int
+
+	// Rx enables mirroring of received frames.
+	Rx bool
+	// Tx enables mirroring of transmitted frames.
+	Tx bool
+
+	// Filter, when not nil, selects the frames to mirror.
+	Filter func(FrameInfo) bool
+}
+
+// Mirror represents a remote packet mirroring session.
+type Mirror struct {
+	sync.Mutex
+
+	opts      MirrorOptions
+	conn      *UDPConn
+	collector *net.UDPAddr
+	local     int
+
+	queue  chan []byte
+	closed bool
+	// dropped frames
+	dropped uint64
+}
+
+// own returns whether a frame carries mirrored traffic.
+func (m *Mirror) own(info FrameInfo) bool {
+	return info.Protocol == header.UDPProtocolNumber &&
+		int(info.SrcPort) == m.local &&
+		int(info.DstPort) == m.collector.Port &&
+		info.DstIP.Equal(m.collector.IP)
+}
+
+func (m *Mirror) tap(info FrameInfo, buf []byte) {
+	if m.own(info) || m.opts.Filter != nil && !m.opts.Filter(info) {
+		return
+	}
+
+	var pkt []byte
+
+	if m.opts.Format == MirrorTZSP {
+		pkt = make([]byte, 0, 5+len(buf))
+		pkt = append(pkt, tzspVersion, tzspTypeReceived, 0, tzspEncapEther, tzspTagEnd)
+	}
+
+	pkt = append(pkt, buf...)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	select {
+	case m.queue <- pkt:
+	default:
+		m.dropped++
+	}
+}
+
+func (m *Mirror) run() {
+	for pkt := range m.queue {
+		m.conn.Write(pkt)
+	}
+
+	m.conn.Close()
+}
+
+// Dropped returns the number of frames not mirrored as the transmission
+// queue was full.
+func (m *Mirror) Dropped() uint64 {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.dropped
+}
+
+// Close stops mirroring, frames already queued are sent before the
+// collector connection is closed.
+func (m *Mirror) Close() {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+}
+
+// StartMirror starts mirroring frames received and/or transmitted by the
+// interface to a remote collector over UDP (see MirrorOptions).
+//
+// Frames are queued and sent in the background, excluding the mirroring
+// traffic itself, frames exceeding the queue capacity are dropped.
+func (iface *Interface) StartMirror(opts MirrorOptions) (m *Mirror, err error) {
+	if !opts.Rx && !opts.Tx {
+		return nil, errors.New("no direction selected")
+	}
+
+	if opts.Format != MirrorTZSP && opts.Format != MirrorUDP {
+		return nil, errors.New("invalid format")
+	}
+
+	host, port, err := net.SplitHostPort(opts.Collector)
+
+	if err != nil {
+		return
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return nil, errors.New("invalid collector address")
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+
+	if err != nil {
+		return nil, errors.New("invalid collector port")
+	}
+
+	var conn *UDPConn
+
+	if ip.To4() != nil {
+		conn, err = iface.DialUDP4("", opts.Collector)
+	} else {
+		conn, err = iface.DialUDP6("", opts.Collector)
+	}
+
+	if err != nil {
+		return
+	}
+
+	m = &Mirror{
+		opts:      opts,
+		conn:      conn,
+		collector: &net.UDPAddr{IP: ip, Port: int(p)},
+		queue:     make(chan []byte, mirrorQueueLength),
+	}
+
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		m.local = addr.Port
+	}
+
+	go m.run()
+
+	if opts.Rx {
+		iface.OnRxFrame(m.tap)
+	}
+
+	if opts.Tx {
+		iface.OnTxFrame(m.tap)
+	}
+
+	return
+}
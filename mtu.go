@@ -0,0 +1,124 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+)
+
+const (
+	// MinMTU is the minimum MTU accepted by SetMTU() and Options.MTU, it
+	// matches the minimum IPv4 datagram size every host must accept (RFC
+	// 791).
+	MinMTU = 576
+	// MaxMTU is the maximum MTU (1500) accepted by SetMTU(), Options.MTU
+	// and the package MTU default on physical interfaces, it matches the
+	// ENET driver maximum frame length minus Ethernet header and IEEE
+	// 802.1Q tag.
+	MaxMTU = enet.MTU - header.EthernetMinimumSize - 4
+)
+
+// ENET receive control register maximum frame length
+const (
+	enetRCRMaxFL     = 16
+	enetRCRMaxFLMask = 0x3fff
+)
+
+// linkEndpoint wraps a channel endpoint to allow runtime MTU changes.
+type linkEndpoint struct {
+	*channel.Endpoint
+
+	mtu uint32
+	max uint32
+}
+
+func newLinkEndpoint(ep *channel.Endpoint, max uint32) *linkEndpoint {
+	return &linkEndpoint{
+		Endpoint: ep,
+		mtu:      ep.MTU(),
+		max:      max,
+	}
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (ep *linkEndpoint) MTU() uint32 {
+	return atomic.LoadUint32(&ep.mtu)
+}
+
+// setMaxFrameLength sets the maximum length, FCS included, of frames
+// received by a physical device.
+func setMaxFrameLength(dev *enet.ENET, mtu uint32) {
+	dev.Lock()
+	defer dev.Unlock()
+
+	rcr := dev.Base + enetRCR
+	val := readRegister(rcr) &^ (enetRCRMaxFLMask << enetRCRMaxFL)
+	val |= (mtu + header.EthernetMinimumSize + 4) << enetRCRMaxFL
+
+	writeRegister(rcr, val)
+}
+
+// SetMTU changes the interface Maximum Transmission Unit, the value is used
+// by the stack for all packets transmitted afterwards and for the MSS of new
+// TCP connections, established ones retain their MSS.
+//
+// On physical interfaces the ENET maximum receive frame length is updated
+// accordingly. VLAN and GENEVE sub-interfaces follow the MTU of their
+// parent, reduced by their encapsulation overhead.
+func (iface *Interface) SetMTU(mtu uint32) error {
+	max := atomic.LoadUint32(&iface.endpoint.max)
+
+	if mtu < MinMTU || mtu > max {
+		return fmt.Errorf("invalid MTU, must be between %d and %d", MinMTU, max)
+	}
+
+	iface.setMTU(mtu)
+
+	return nil
+}
+
+func (iface *Interface) setMTU(mtu uint32) {
+	atomic.StoreUint32(&iface.endpoint.mtu, mtu)
+
+	if iface.NIC.Device != nil {
+		setMaxFrameLength(iface.NIC.Device, mtu)
+	}
+
+	vlans := make(map[*NIC]bool)
+
+	iface.NIC.vlans.RLock()
+
+	for _, nic := range iface.NIC.vlans.nics {
+		vlans[nic] = true
+	}
+
+	iface.NIC.vlans.RUnlock()
+
+	for _, child := range Interfaces() {
+		var overhead uint32
+
+		switch {
+		case vlans[child.NIC]:
+			overhead = vlanTagLen
+		case child.GENEVE != nil && child.GENEVE.parent == iface:
+			overhead = geneveOverhead
+		default:
+			continue
+		}
+
+		atomic.StoreUint32(&child.endpoint.max, mtu-overhead)
+		child.setMTU(mtu - overhead)
+	}
+}
@@ -0,0 +1,176 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestMTUBounds(t *testing.T) {
+	for _, mtu := range []uint32{MinMTU - 1, MaxMTU + 1} {
+		if _, err := InitWithOptions(nil, 1, &Options{MAC: testMAC(1), MTU: mtu}); err == nil {
+			t.Errorf("MTU %d accepted", mtu)
+		}
+	}
+
+	defer func(mtu uint32) {
+		MTU = mtu
+	}(MTU)
+
+	// the package default is validated as well
+	MTU = MaxMTU + 1
+
+	if _, err := InitWithOptions(nil, 1, &Options{MAC: testMAC(1)}); err == nil {
+		t.Errorf("package MTU %d accepted", MTU)
+	}
+
+	MTU = MaxMTU
+
+	iface := testInterface(t, &Options{MAC: testMAC(1), MTU: MinMTU})
+
+	if n := iface.MTU(); n != MinMTU {
+		t.Errorf("unexpected MTU %d", n)
+	}
+
+	for _, mtu := range []uint32{MinMTU - 1, MaxMTU + 1} {
+		if err := iface.SetMTU(mtu); err == nil {
+			t.Errorf("MTU %d accepted", mtu)
+		}
+	}
+
+	if err := iface.SetMTU(MaxMTU); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := iface.MTU(); n != MaxMTU {
+		t.Errorf("unexpected MTU %d", n)
+	}
+}
+
+func TestMTUPropagation(t *testing.T) {
+	const mtu = 1000
+
+	a, b := testPair(t, nil)
+
+	var mu sync.Mutex
+	var largest int
+	var mss uint16
+
+	a.OnTxFrame(func(info FrameInfo, buf []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if info.Length > largest {
+			largest = info.Length
+		}
+
+		if len(buf) < header.EthernetMinimumSize+header.IPv4MinimumSize {
+			return
+		}
+
+		ip := header.IPv4(buf[header.EthernetMinimumSize:])
+
+		if !ip.IsValid(len(ip)) || ip.TransportProtocol() != header.TCPProtocolNumber {
+			return
+		}
+
+		if tcp := header.TCP(ip.Payload()); tcp.Flags().Contains(header.TCPFlagSyn) {
+			mss = header.ParseSynOptions(tcp.Options(), false).MSS
+		}
+	})
+
+	tun, err := a.GENEVETunnel(1, testAddress("10.0.0.1"), testAddress("10.0.0.2"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.Close()
+
+	if err := a.SetMTU(mtu); err != nil {
+		t.Fatal(err)
+	}
+
+	// sub-interfaces follow the parent MTU
+	if n := tun.MTU(); n != mtu-geneveOverhead {
+		t.Errorf("unexpected GENEVE MTU %d", n)
+	}
+
+	if err := tun.SetMTU(mtu - geneveOverhead + 1); err == nil {
+		t.Error("GENEVE MTU exceeding the parent one accepted")
+	}
+
+	server, err := b.ListenUDP("udp4", "10.0.0.2:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := a.DialUDP4("", "10.0.0.2:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// fragmented according to the runtime MTU
+	payload := bytes.Repeat([]byte{0xaa}, 1400)
+
+	if _, err = client.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	n, _, err := server.ReadFrom(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf[:n], payload) {
+		t.Error("payload mismatch")
+	}
+
+	// new TCP connections advertise the MSS of the runtime MTU
+	l, err := b.ListenerTCP4(80)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := a.DialContextTCP4(ctx, "10.0.0.2:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if largest > header.EthernetMinimumSize+mtu {
+		t.Errorf("frame length %d exceeds MTU %d", largest, mtu)
+	}
+
+	if mss != mtu-header.IPv4MinimumSize-header.TCPMinimumSize {
+		t.Errorf("unexpected SYN MSS %d", mss)
+	}
+}
@@ -0,0 +1,229 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// ENET group address hash table registers
+const (
+	enetGAUR = 0x0120
+	enetGALR = 0x0124
+)
+
+type multicastFilter struct {
+	sync.Mutex
+
+	// references for each hash table entry
+	refs [64]int
+}
+
+// groupHash returns the ENET group address hash table index for a multicast
+// hardware address, the 6 most significant bits of its CRC-32.
+func groupHash(mac net.HardwareAddr) int {
+	return int(^crc32.ChecksumIEEE(mac)>>26) & 0x3f
+}
+
+// updateMulticast programs the ENET group address hash filter.
+func (eth *NIC) updateMulticast() {
+	var hi, lo uint32
+
+	if eth.Device == nil {
+		return
+	}
+
+	for i, n := range eth.multicast.refs {
+		switch {
+		case n == 0:
+		case i >= 32:
+			hi |= 1 << (i - 32)
+		default:
+			lo |= 1 << i
+		}
+	}
+
+	writeRegister(eth.Device.Base+enetGAUR, hi)
+	writeRegister(eth.Device.Base+enetGALR, lo)
+}
+
+// AddMulticast enables reception of frames addressed to the argument
+// multicast hardware address through the ENET group address hash filter.
+// The filter is imperfect, frames for other addresses sharing the same hash
+// are also received and left to the stack to discard.
+func (eth *NIC) AddMulticast(mac net.HardwareAddr) {
+	eth.multicast.Lock()
+	defer eth.multicast.Unlock()
+
+	eth.multicast.refs[groupHash(mac)]++
+	eth.updateMulticast()
+}
+
+// RemoveMulticast disables reception of frames addressed to a multicast
+// hardware address previously added with AddMulticast().
+func (eth *NIC) RemoveMulticast(mac net.HardwareAddr) {
+	eth.multicast.Lock()
+	defer eth.multicast.Unlock()
+
+	if h := groupHash(mac); eth.multicast.refs[h] > 0 {
+		eth.multicast.refs[h]--
+	}
+
+	eth.updateMulticast()
+}
+
+// multicastProtocol returns the network protocol of a multicast group
+// address.
+func (iface *Interface) multicastProtocol(group tcpip.Address) (proto tcpip.NetworkProtocolNumber, err error) {
+	switch {
+	case header.IsV4MulticastAddress(group):
+		return ipv4.ProtocolNumber, nil
+	case header.IsV6MulticastAddress(group) && iface.opts.IPv6 != nil:
+		return ipv6.ProtocolNumber, nil
+	default:
+		return 0, errors.New("invalid multicast group address")
+	}
+}
+
+// multicastHardwareAddr returns the hardware address of a multicast group
+// (RFC 1112 - 6.4, RFC 2464 - 7).
+func multicastHardwareAddr(proto tcpip.NetworkProtocolNumber, group tcpip.Address) net.HardwareAddr {
+	if proto == ipv4.ProtocolNumber {
+		return net.HardwareAddr(header.EthernetAddressFromMulticastIPv4Address(group))
+	}
+
+	return net.HardwareAddr(header.EthernetAddressFromMulticastIPv6Address(group))
+}
+
+// JoinMulticastGroup joins a multicast group on the interface, allowing
+// reception of datagrams addressed to it. Membership is reported through
+// IGMP (RFC 2236) for IPv4 groups and MLD (RFC 2710) for IPv6 ones, so that
+// snooping switches forward the group traffic.
+//
+// MLDv1 reports are understood by MLDv2 routers and snooping switches (RFC
+// 3810 - 8).
+//
+// Memberships are reference counted, each join must be matched by a
+// LeaveMulticastGroup() call.
+func (iface *Interface) JoinMulticastGroup(group tcpip.Address) error {
+	proto, err := iface.multicastProtocol(group)
+
+	if err != nil {
+		return err
+	}
+
+	if err := iface.Stack.JoinGroup(proto, iface.nicid, group); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	iface.NIC.AddMulticast(multicastHardwareAddr(proto, group))
+
+	return nil
+}
+
+// LeaveMulticastGroup leaves a multicast group previously joined with
+// JoinMulticastGroup().
+func (iface *Interface) LeaveMulticastGroup(group tcpip.Address) error {
+	proto, err := iface.multicastProtocol(group)
+
+	if err != nil {
+		return err
+	}
+
+	if err := iface.Stack.LeaveGroup(proto, iface.nicid, group); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	iface.NIC.RemoveMulticast(multicastHardwareAddr(proto, group))
+
+	return nil
+}
+
+// multicastConn represents a UDP connection receiving a multicast group.
+type multicastConn struct {
+	*UDPConn
+
+	nic  *NIC
+	mac  net.HardwareAddr
+	once sync.Once
+}
+
+// Close closes the connection, leaving the multicast group.
+func (c *multicastConn) Close() error {
+	c.once.Do(func() {
+		c.nic.RemoveMulticast(c.mac)
+	})
+
+	return c.UDPConn.Close()
+}
+
+// ListenMulticastUDP returns a net.PacketConn receiving UDP datagrams sent to
+// the argument multicast group and port on the Ethernet interface.
+//
+// The group is joined, reporting its membership (see JoinMulticastGroup()),
+// and enabled on the hardware filter until the connection is closed. The
+// port can be shared by multiple connections, datagrams sent on the
+// connection use the interface as multicast interface.
+func (iface *Interface) ListenMulticastUDP(group tcpip.Address, port uint16) (net.PacketConn, error) {
+	var wq waiter.Queue
+
+	proto, err := iface.multicastProtocol(group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ep, tcpErr := iface.Stack.NewEndpoint(udp.ProtocolNumber, proto, &wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (udp): %v", tcpErr)
+	}
+
+	ep.SocketOptions().SetReuseAddress(true)
+	ep.SocketOptions().SetMulticastLoop(!iface.opts.DisableMulticastLoopback)
+
+	if tcpErr := ep.Bind(tcpip.FullAddress{NIC: iface.nicid, Port: port}); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("bind error (udp): %v", tcpErr)
+	}
+
+	membership := &tcpip.AddMembershipOption{
+		NIC:           iface.nicid,
+		MulticastAddr: group,
+	}
+
+	if tcpErr := ep.SetSockOpt(membership); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("membership error (udp): %v", tcpErr)
+	}
+
+	mac := multicastHardwareAddr(proto, group)
+	iface.NIC.AddMulticast(mac)
+
+	return &multicastConn{
+		UDPConn: &UDPConn{
+			UDPConn: gonet.NewUDPConn(iface.Stack, &wq, ep),
+			ep:      ep,
+		},
+		nic: iface.NIC,
+		mac: mac,
+	}, nil
+}
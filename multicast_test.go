@@ -0,0 +1,69 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMulticastLoopback(t *testing.T) {
+	const group = "239.1.2.3"
+
+	for _, disabled := range []bool{false, true} {
+		iface := testInterface(t, &Options{
+			MAC: testMAC(1),
+			// the default route allows multicast transmission
+			IPv4: &IPConfig{
+				Address: "10.0.0.1/24",
+				Gateway: "10.0.0.254",
+			},
+			DisableMulticastLoopback: disabled,
+		})
+
+		l, err := iface.ListenMulticastUDP(testAddress(group), 5000)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		conn, err := iface.DialUDP4("", group+":5000")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if enabled := conn.MulticastLoopback(); enabled == disabled {
+			t.Fatalf("unexpected default loopback %v (disabled: %v)", enabled, disabled)
+		}
+
+		// the connection option overrides the interface default
+		for _, loop := range []bool{true, false} {
+			conn.SetMulticastLoopback(loop)
+
+			if _, err = conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, 64)
+			l.SetReadDeadline(time.Now().Add(1 * time.Second))
+
+			_, _, err := l.ReadFrom(buf)
+
+			switch {
+			case loop && err != nil:
+				t.Errorf("datagram not looped back (disabled: %v), %v", disabled, err)
+			case !loop && err == nil:
+				t.Errorf("datagram looped back (disabled: %v)", disabled)
+			}
+		}
+	}
+}
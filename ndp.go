@@ -0,0 +1,266 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// dadRetransmitTimer is the interval between IPv6 Duplicate Address Detection
+// Neighbor Solicitations (RFC 4861 - 10. RETRANS_TIMER).
+const dadRetransmitTimer = 1 * time.Second
+
+// DefaultDADTransmits is the default number of Neighbor Solicitations sent to
+// perform IPv6 Duplicate Address Detection (RFC 4862 - 5.1).
+const DefaultDADTransmits = 1
+
+// ErrDuplicateAddress is returned when Duplicate Address Detection finds an
+// address in use by another host.
+var ErrDuplicateAddress = errors.New("duplicate address detected")
+
+type dadState struct {
+	sync.Mutex
+
+	// DAD results, nil for successful ones
+	results map[tcpip.Address]error
+	// closed on each result
+	update chan struct{}
+}
+
+func dadTransmits(opts *Options) uint8 {
+	switch {
+	case opts.DisableDAD:
+		return 0
+	case opts.DADTransmits == 0:
+		return DefaultDADTransmits
+	default:
+		return opts.DADTransmits
+	}
+}
+
+func (iface *Interface) OnDuplicateAddressDetectionResult(nicid tcpip.NICID, addr tcpip.Address, res stack.DADResult) {
+	if nicid != iface.nicid {
+		return
+	}
+
+	var err error
+
+	switch r := res.(type) {
+	case *stack.DADSucceeded:
+	case *stack.DADDupAddrDetected:
+		err = fmt.Errorf("%s: %w", addr, ErrDuplicateAddress)
+	case *stack.DADError:
+		err = fmt.Errorf("%s: %v", addr, r.Err)
+	default:
+		err = fmt.Errorf("%s: DAD aborted", addr)
+	}
+
+	iface.dad.Lock()
+
+	if iface.dad.results == nil {
+		iface.dad.results = make(map[tcpip.Address]error)
+	}
+
+	iface.dad.results[addr] = err
+
+	if iface.dad.update != nil {
+		close(iface.dad.update)
+		iface.dad.update = nil
+	}
+
+	iface.dad.Unlock()
+
+	dup, ok := res.(*stack.DADDupAddrDetected)
+
+	if !ok {
+		return
+	}
+
+	// the stack cannot be invoked within NDP dispatcher callbacks
+	go func() {
+		iface.addressConflict(addr, net.HardwareAddr(dup.HolderLinkAddress))
+
+		if iface.opts.WithdrawOnConflict {
+			iface.Stack.RemoveAddress(nicid, addr)
+		}
+	}()
+}
+
+// LinkLocalAddress returns the IPv6 link-local address, derived from the
+// interface MAC address (RFC 4862 - 5.3), automatically assigned when IPv6
+// is enabled.
+func (iface *Interface) LinkLocalAddress() tcpip.Address {
+	return header.LinkLocalAddr(iface.Link.LinkAddress())
+}
+
+// WaitDAD waits for IPv6 Duplicate Address Detection to complete on the
+// link-local and configured IPv6 addresses, an error wrapping
+// ErrDuplicateAddress is returned when any of them is in use by another host
+// (the conflict is also reported through Options.OnAddressConflict).
+func (iface *Interface) WaitDAD(ctx context.Context) error {
+	if iface.opts.IPv6 == nil || iface.opts.DisableDAD {
+		return nil
+	}
+
+	iface.mu.RLock()
+	addrs := []tcpip.Address{iface.LinkLocalAddress()}
+
+	if addr := iface.address6.Address; len(addr) > 0 {
+		addrs = append(addrs, addr)
+	}
+	iface.mu.RUnlock()
+
+	for {
+		pending := false
+
+		iface.dad.Lock()
+
+		for _, addr := range addrs {
+			err, ok := iface.dad.results[addr]
+
+			if err != nil {
+				iface.dad.Unlock()
+				return err
+			}
+
+			pending = pending || !ok
+		}
+
+		if !pending {
+			iface.dad.Unlock()
+			return nil
+		}
+
+		if iface.dad.update == nil {
+			iface.dad.update = make(chan struct{})
+		}
+
+		update := iface.dad.update
+		iface.dad.Unlock()
+
+		select {
+		case <-update:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// slaacConfigurations returns the NDP configuration for router discovery and
+// SLAAC.
+func slaacConfigurations() ipv6.NDPConfigurations {
+	ndp := ipv6.DefaultNDPConfigurations()
+
+	ndp.HandleRAs = ipv6.HandlingRAsEnabledWhenForwardingDisabled
+	ndp.DiscoverDefaultRouters = true
+	ndp.DiscoverOnLinkPrefixes = true
+	ndp.AutoGenGlobalAddresses = true
+	ndp.AutoGenTempGlobalAddresses = false
+
+	return ndp
+}
+
+// updateRoute replaces, in the background, routes to the argument
+// destination learned through Router Advertisements.
+func (iface *Interface) updateRoute(nicid tcpip.NICID, dest tcpip.Subnet, router tcpip.Address, add bool) {
+	if nicid != iface.nicid {
+		return
+	}
+
+	// the stack cannot be invoked within NDP dispatcher callbacks
+	go func() {
+		iface.Stack.RemoveRoutes(func(rt tcpip.Route) bool {
+			return rt.NIC == nicid && rt.Destination == dest && rt.Gateway == router
+		})
+
+		if add {
+			iface.addRoute(tcpip.Route{
+				Destination: dest,
+				Gateway:     router,
+				NIC:         nicid,
+			})
+		}
+	}()
+}
+
+func (iface *Interface) OnOffLinkRouteUpdated(nicid tcpip.NICID, dest tcpip.Subnet, router tcpip.Address, _ header.NDPRoutePreference) {
+	iface.updateRoute(nicid, dest, router, true)
+}
+
+func (iface *Interface) OnOffLinkRouteInvalidated(nicid tcpip.NICID, dest tcpip.Subnet, router tcpip.Address) {
+	iface.updateRoute(nicid, dest, router, false)
+}
+
+func (iface *Interface) OnOnLinkPrefixDiscovered(nicid tcpip.NICID, prefix tcpip.Subnet) {
+	iface.updateRoute(nicid, prefix, "", true)
+}
+
+func (iface *Interface) OnOnLinkPrefixInvalidated(nicid tcpip.NICID, prefix tcpip.Subnet) {
+	iface.updateRoute(nicid, prefix, "", false)
+}
+
+// OnAutoGenAddress records addresses configured through SLAAC as the
+// interface IPv6 address, unless one is statically configured.
+func (iface *Interface) OnAutoGenAddress(nicid tcpip.NICID, addr tcpip.AddressWithPrefix) stack.AddressDispatcher {
+	if nicid != iface.nicid {
+		return nil
+	}
+
+	iface.mu.Lock()
+	defer iface.mu.Unlock()
+
+	if len(iface.address6.Address) == 0 {
+		iface.address6 = addr
+	}
+
+	return nil
+}
+
+func (iface *Interface) OnAutoGenAddressDeprecated(tcpip.NICID, tcpip.AddressWithPrefix) {
+}
+
+func (iface *Interface) OnAutoGenAddressInvalidated(nicid tcpip.NICID, addr tcpip.AddressWithPrefix) {
+	if nicid != iface.nicid {
+		return
+	}
+
+	iface.mu.Lock()
+	defer iface.mu.Unlock()
+
+	if iface.address6 == addr {
+		iface.address6 = tcpip.AddressWithPrefix{}
+	}
+}
+
+func (iface *Interface) OnRecursiveDNSServerOption(tcpip.NICID, []tcpip.Address, time.Duration) {
+}
+
+func (iface *Interface) OnDNSSearchListOption(tcpip.NICID, []string, time.Duration) {
+}
+
+func (iface *Interface) OnDHCPv6Configuration(nicid tcpip.NICID, mode ipv6.DHCPv6ConfigurationFromNDPRA) {
+	if nicid != iface.nicid || iface.dhcpv6 == nil {
+		return
+	}
+
+	select {
+	case iface.dhcpv6.mode <- mode:
+	default:
+	}
+}
@@ -0,0 +1,108 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// neighborProtocols returns the network protocols with a neighbor cache, ARP
+// for IPv4 and NDP for IPv6.
+func (iface *Interface) neighborProtocols() (protos []tcpip.NetworkProtocolNumber) {
+	protos = append(protos, ipv4.ProtocolNumber)
+
+	if iface.opts.IPv6 != nil {
+		protos = append(protos, ipv6.ProtocolNumber)
+	}
+
+	return
+}
+
+// neighborProtocol returns the network protocol of a neighbor address.
+func (iface *Interface) neighborProtocol(addr tcpip.Address) (proto tcpip.NetworkProtocolNumber, err error) {
+	switch {
+	case len(addr) == net.IPv4len:
+		return ipv4.ProtocolNumber, nil
+	case len(addr) == net.IPv6len && iface.opts.IPv6 != nil:
+		return ipv6.ProtocolNumber, nil
+	default:
+		return 0, errors.New("invalid address")
+	}
+}
+
+// Neighbors returns the interface ARP (IPv4) and, when IPv6 is enabled, NDP
+// (IPv6) neighbor cache entries.
+func (iface *Interface) Neighbors() (entries []stack.NeighborEntry, err error) {
+	for _, proto := range iface.neighborProtocols() {
+		res, tcpErr := iface.Stack.Neighbors(iface.nicid, proto)
+
+		if tcpErr != nil {
+			return nil, fmt.Errorf("%v", tcpErr)
+		}
+
+		entries = append(entries, res...)
+	}
+
+	return
+}
+
+// FlushNeighbors removes all neighbor cache entries, static ones included.
+func (iface *Interface) FlushNeighbors() error {
+	for _, proto := range iface.neighborProtocols() {
+		if err := iface.Stack.ClearNeighbors(iface.nicid, proto); err != nil {
+			return fmt.Errorf("%v", err)
+		}
+	}
+
+	return nil
+}
+
+// AddStaticNeighbor adds a static neighbor cache entry, it can be used to
+// reach hosts which do not answer ARP or NDP requests. Static entries are
+// never expired and are only removed with RemoveNeighbor() or
+// FlushNeighbors().
+func (iface *Interface) AddStaticNeighbor(addr tcpip.Address, mac net.HardwareAddr) error {
+	proto, err := iface.neighborProtocol(addr)
+
+	if err != nil {
+		return err
+	}
+
+	if len(mac) != 6 {
+		return errors.New("invalid MAC address")
+	}
+
+	if err := iface.Stack.AddStaticNeighbor(iface.nicid, proto, addr, tcpip.LinkAddress(mac)); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	return nil
+}
+
+// RemoveNeighbor removes a neighbor cache entry.
+func (iface *Interface) RemoveNeighbor(addr tcpip.Address) error {
+	proto, err := iface.neighborProtocol(addr)
+
+	if err != nil {
+		return err
+	}
+
+	if err := iface.Stack.RemoveNeighbor(iface.nicid, proto, addr); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	return nil
+}
@@ -17,9 +17,14 @@
 package enet
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/usbarmory/tamago/soc/nxp/enet"
 
@@ -29,88 +34,419 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
-// MTU represents the Ethernet Maximum Transmission Unit.
-var MTU uint32 = enet.MTU
+// MTU represents the default Ethernet Maximum Transmission Unit, used when
+// Options.MTU is not set, it must be between MinMTU and MaxMTU (1500).
+var MTU uint32 = MaxMTU
+
+// IPConfig represents an IP protocol configuration.
+type IPConfig struct {
+	// Address is the interface address, optionally in CIDR notation (an
+	// address without prefix length is configured as a single host one).
+	Address string
+	// Addresses are additional addresses, optionally in CIDR notation,
+	// configured on the interface alongside Address (see AddAddress()).
+	// They are not probed by ACD, but are defended once configured.
+	Addresses []string
+	// Gateway is the default route gateway, an empty value disables the
+	// default route.
+	Gateway string
+
+	// DHCP enables dynamic configuration, through DHCP (RFC 2131) for
+	// IPv4 and DHCPv6 (RFC 8415) for IPv6, performed in the background.
+	//
+	// For IPv4 the address, netmask and gateway are obtained from the
+	// server and Address and Gateway are ignored.
+	//
+	// For IPv6 an address is obtained through stateful configuration, in
+	// addition to the optional Address and Gateway. When SLAAC is also
+	// enabled the stateful or stateless (Information-request) mode is
+	// selected according to Router Advertisements.
+	DHCP bool
+
+	// SLAAC enables IPv6 router discovery (RFC 4861 - 6.3.7) and Stateless
+	// Address Autoconfiguration (RFC 4862), supported only for IPv6. Global
+	// addresses, on-link prefixes and default routes are configured from
+	// Router Advertisements, in addition to the optional Address and
+	// Gateway.
+	SLAAC bool
+
+	// LinkLocal enables IPv4 link-local address autoconfiguration (RFC
+	// 3927), supported only for IPv4. An address within 169.254/16 is
+	// self-assigned, in the background, when Address is empty or, with
+	// DHCP, as long as no lease is bound.
+	LinkLocal bool
+}
+
+// Options represents Ethernet interface configuration options.
+type Options struct {
+	// MAC is the interface hardware address.
+	MAC string
+
+	// IPv4 is the IPv4 configuration.
+	IPv4 *IPConfig
+	// IPv6 is the IPv6 configuration, IPv6 support is enabled only when
+	// set.
+	IPv6 *IPConfig
+
+	// ACD enables IPv4 Address Conflict Detection (RFC 5227), the IPv4
+	// address is probed in the background and configured only afterwards.
+	ACD bool
+	// DADTransmits is the number of Neighbor Solicitations sent to perform
+	// IPv6 Duplicate Address Detection (RFC 4862 - 5.4), 0 selects
+	// DefaultDADTransmits. IPv6 addresses are not used until DAD
+	// completes, see WaitDAD().
+	DADTransmits uint8
+	// DisableDAD disables IPv6 Duplicate Address Detection.
+	DisableDAD bool
+
+	// OnAddressConflict, when not nil, is invoked when ACD or DAD detect an
+	// address conflict, either before or after the address is configured,
+	// with the hardware address of the conflicting host.
+	OnAddressConflict func(addr tcpip.Address, mac net.HardwareAddr)
+	// WithdrawOnConflict prevents configuration, or triggers removal, of
+	// conflicting addresses. When false IPv4 addresses in use are defended
+	// (RFC 5227 - 2.4(c)).
+	WithdrawOnConflict bool
+
+	// MTU is the interface Maximum Transmission Unit, 0 selects the
+	// package MTU default. It must be between MinMTU and MaxMTU (1500).
+	MTU uint32
+
+	// PHYAddress is the MDIO address of the Ethernet PHY.
+	PHYAddress int
+
+	// PHYDriver, when not nil, selects the Ethernet PHY driver, which is
+	// initialized after the ENET device (see PHYDriver).
+	PHYDriver PHYDriver
+
+	// PHY, when not nil, configures the Ethernet PHY link speed, duplex
+	// mode and auto-negotiation at initialization (see
+	// NIC.ConfigurePHY()).
+	PHY *PHYConfig
+
+	// WrapLink, when not nil, is applied to the link endpoint before its
+	// registration on the stack, allowing to interpose custom endpoints
+	// (e.g. traffic shaping, fault injection) between the stack and the
+	// NIC. The NIC keeps operating on the inner channel endpoint (Link).
+	//
+	// The returned endpoint must forward, or correctly account for, the
+	// inner endpoint MTU, capabilities, link address and dispatcher
+	// attachment (e.g. by embedding it).
+	WrapLink func(stack.LinkEndpoint) stack.LinkEndpoint
+
+	// DisableMulticastLoopback disables, for UDP connections created with
+	// DialUDP4 or DialUDP6, loopback of sent multicast datagrams to local
+	// subscribers.
+	DisableMulticastLoopback bool
+
+	// Routes are additional static routes, for either IPv4 or IPv6,
+	// installed at initialization (see AddRoute()).
+	Routes []Route
+
+	// ChecksumOffload enables the ENET checksum accelerator, relieving the
+	// stack from computing and verifying TCP and UDP checksums. Received
+	// frames with invalid checksums are discarded by the ENET, checksums
+	// of fragmented datagrams are not verified. It cannot be used with
+	// 6LoWPAN (see Enable6LoWPAN()).
+	//
+	// Checksum insertion requires the ENET driver to use enhanced buffer
+	// descriptors, initialization fails otherwise.
+	ChecksumOffload bool
+
+	// Coalescing, when not nil, configures the ENET interrupt coalescing
+	// at initialization (see NIC.SetCoalescing()).
+	Coalescing *Coalescing
+
+	// Expvar, when set, publishes the interface statistics as an expvar
+	// variable with this name (see PublishExpvar()).
+	Expvar string
+
+	// Capture, when not nil, starts capturing frames at initialization
+	// (see StartCapture()).
+	Capture *Capture
+
+	// PreferIPv4 prioritizes IPv4 over IPv6 addresses when dialing
+	// dual-stack hosts (see DialContext()).
+	PreferIPv4 bool
+
+	// DNSServers, when set, overrides the DNS servers provided by DHCP
+	// for name resolution (see LookupHost()).
+	DNSServers []string
+	// DomainSearch, when set, overrides the domain search list provided
+	// by DHCP.
+	DomainSearch []string
+	// NTPServers, when set, overrides the NTP servers provided by DHCP.
+	NTPServers []string
+
+	// OnLeaseOptions, when not nil, is invoked when the network service
+	// options provided by the DHCP lease change.
+	OnLeaseOptions func(lease LeaseOptions)
+
+	// TransparentProxy enables, at initialization, acceptance of traffic
+	// for non-local destination addresses (see SetTransparentProxy()).
+	TransparentProxy bool
+}
 
 // Interface represents an Ethernet interface instance.
 type Interface struct {
-	address tcpip.Address
+	mu    sync.RWMutex
+	name  string
+	index int
+
+	address tcpip.AddressWithPrefix
 	gateway tcpip.Address
 
+	address6 tcpip.AddressWithPrefix
+	gateway6 tcpip.Address
+
+	opts Options
+	acd  acdState
+	dad  dadState
+
+	linkLocal linkLocalState
+
+	// PHY link monitor, see OnLinkChange()
+	link linkMonitor
+
 	nicid tcpip.NICID
 	NIC   *NIC
 
 	Stack *stack.Stack
 	Link  *channel.Endpoint
+
+	endpoint *linkEndpoint
+
+	// GENEVE is the tunnel endpoint backing GENEVE interfaces (see
+	// GENEVETunnel()), it is nil for all other interfaces.
+	GENEVE *GENEVE
+	// GENEVE sockets bound to this interface, see GENEVETunnel()
+	geneve geneveSockets
+
+	// bridge ports, see Bridge()
+	bridge *bridge
+
+	// transport forwarders, see ForwardTCP() and ForwardUDP()
+	forward forwarders
+
+	connDuration *durationHistogram
+
+	started     time.Time
+	operSamples operSamples
+
+	// DHCP and DHCPv6 lease options
+	lease  LeaseOptions
+	lease6 LeaseOptions
+	// DHCP lease, see DHCPLease()
+	dhcpLease *DHCPLease
+
+	// DHCPv6 client and lease, see DHCPv6Lease()
+	dhcpv6      *dhcpv6Client
+	dhcpv6Lease *DHCPv6Lease
+
+	// closed on interface teardown, see Close()
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func (iface *Interface) OnNeighborAdded(nicid tcpip.NICID, entry stack.NeighborEntry) {
-	if entry.Addr == iface.gateway && len(entry.LinkAddr) > 0 {
+	if nicid == iface.nicid && entry.Addr == iface.gateway && len(entry.LinkAddr) > 0 {
 		iface.NIC.Gateway = entry.LinkAddr
 	}
 }
 
 func (iface *Interface) OnNeighborChanged(nicid tcpip.NICID, entry stack.NeighborEntry) {
-	if entry.Addr == iface.gateway && len(entry.LinkAddr) > 0 {
+	if nicid == iface.nicid && entry.Addr == iface.gateway && len(entry.LinkAddr) > 0 {
 		iface.NIC.Gateway = entry.LinkAddr
 	}
 }
 
 func (iface *Interface) OnNeighborRemoved(nicid tcpip.NICID, entry stack.NeighborEntry) {
-	if entry.Addr == iface.gateway {
+	if nicid == iface.nicid && entry.Addr == iface.gateway {
 		iface.NIC.Gateway = header.EthernetBroadcastAddress
 	}
 }
 
-func (iface *Interface) configure(mac string) (err error) {
+func (iface *Interface) configureProtocol(proto tcpip.NetworkProtocolNumber, addr tcpip.AddressWithPrefix, gateway tcpip.Address) (err error) {
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          proto,
+		AddressWithPrefix: addr,
+	}
+
+	if err := iface.Stack.AddProtocolAddress(iface.nicid, protocolAddr, stack.AddressProperties{}); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	if len(gateway) > 0 && len(gateway) != len(addr.Address) {
+		return fmt.Errorf("invalid gateway %s", gateway)
+	}
+
+	if addr.PrefixLen < len(addr.Address)*8 {
+		iface.addRoute(tcpip.Route{
+			Destination: addr.Subnet(),
+			NIC:         iface.nicid,
+		})
+	}
+
+	if !gateway.Unspecified() {
+		subnet := header.IPv4EmptySubnet
+
+		if proto == ipv6.ProtocolNumber {
+			subnet = header.IPv6EmptySubnet
+		}
+
+		iface.addRoute(tcpip.Route{
+			Destination: subnet,
+			Gateway:     gateway,
+			NIC:         iface.nicid,
+		})
+	}
+
+	return
+}
+
+func (iface *Interface) configure(opts *Options) (err error) {
+	mtu := MTU
+
+	if opts.MTU != 0 {
+		mtu = opts.MTU
+	}
+
+	if mtu < MinMTU || mtu > MaxMTU {
+		return fmt.Errorf("invalid MTU, must be between %d and %d", MinMTU, MaxMTU)
+	}
+
+	networkProtocols := []stack.NetworkProtocolFactory{
+		ipv4.NewProtocolWithOptions(ipv4.Options{
+			IGMP: ipv4.IGMPOptions{Enabled: true},
+		}),
+		arp.NewProtocol,
+	}
+
+	if opts.IPv6 != nil {
+		var ndp ipv6.NDPConfigurations
+
+		if opts.IPv6.SLAAC {
+			ndp = slaacConfigurations()
+		}
+
+		networkProtocols = append(networkProtocols, ipv6.NewProtocolWithOptions(ipv6.Options{
+			NDPConfigs:       ndp,
+			AutoGenLinkLocal: true,
+			DADConfigs: stack.DADConfigurations{
+				DupAddrDetectTransmits: dadTransmits(opts),
+				RetransmitTimer:        dadRetransmitTimer,
+			},
+			MLD:     ipv6.MLDOptions{Enabled: true},
+			NDPDisp: iface,
+		}))
+	}
+
+	transportProtocols := []stack.TransportProtocolFactory{
+		tcp.NewProtocol,
+		udp.NewProtocol,
+		icmp.NewProtocol4,
+	}
+
+	if opts.IPv6 != nil {
+		transportProtocols = append(transportProtocols, icmp.NewProtocol6)
+	}
+
 	iface.Stack = stack.New(stack.Options{
-		NetworkProtocols: []stack.NetworkProtocolFactory{
-			ipv4.NewProtocol,
-			arp.NewProtocol},
-		TransportProtocols: []stack.TransportProtocolFactory{
-			tcp.NewProtocol,
-			icmp.NewProtocol4},
-		NUDDisp: iface,
+		NetworkProtocols:   networkProtocols,
+		TransportProtocols: transportProtocols,
+		RawFactory:         raw.EndpointFactory{},
+		NUDDisp:            iface,
+		// see ListenPacketRaw() and ListenPacketCooked()
+		AllowPacketEndpointWrite: true,
 	})
 
-	linkAddr, err := tcpip.ParseMACAddress(mac)
+	iface.installForwarders()
+
+	linkAddr, err := tcpip.ParseMACAddress(opts.MAC)
 
 	if err != nil {
 		return
 	}
 
-	iface.Link = channel.New(256, MTU, linkAddr)
-	linkEP := stack.LinkEndpoint(iface.Link)
+	iface.Link = channel.New(256, mtu, linkAddr)
 	iface.Link.LinkEPCapabilities |= stack.CapabilityResolutionRequired
 
+	if opts.ChecksumOffload {
+		iface.Link.LinkEPCapabilities |= checksumOffloadCapabilities
+	}
+
+	iface.endpoint = newLinkEndpoint(iface.Link, MaxMTU)
+	linkEP := stack.LinkEndpoint(iface.endpoint)
+
+	if opts.WrapLink != nil {
+		linkEP = opts.WrapLink(linkEP)
+	}
+
 	if err := iface.Stack.CreateNIC(iface.nicid, linkEP); err != nil {
 		return fmt.Errorf("%v", err)
 	}
 
-	protocolAddr := tcpip.ProtocolAddress{
-		Protocol:          ipv4.ProtocolNumber,
-		AddressWithPrefix: iface.address.WithPrefix(),
+	if opts.TransparentProxy {
+		if err = iface.SetTransparentProxy(true); err != nil {
+			return
+		}
 	}
 
-	if err := iface.Stack.AddProtocolAddress(iface.nicid, protocolAddr, stack.AddressProperties{}); err != nil {
-		return fmt.Errorf("%v", err)
+	// with ACD the IPv4 address is configured only after probing, with
+	// DHCP only once a lease is obtained
+	if opts.IPv4 != nil && len(iface.address.Address) > 0 && !opts.ACD && !dhcpEnabled(opts) {
+		if err = iface.configureProtocol(ipv4.ProtocolNumber, iface.address, iface.gateway); err != nil {
+			return
+		}
 	}
 
-	rt := iface.Stack.GetRouteTable()
+	// with SLAAC or DHCPv6 the IPv6 address is optional
+	switch {
+	case opts.IPv6 == nil:
+	case len(iface.address6.Address) > 0:
+		if err = iface.configureProtocol(ipv6.ProtocolNumber, iface.address6, iface.gateway6); err != nil {
+			return
+		}
+	case len(iface.gateway6) > 0:
+		iface.addRoute(tcpip.Route{
+			Destination: header.IPv6EmptySubnet,
+			Gateway:     iface.gateway6,
+			NIC:         iface.nicid,
+		})
+	}
 
-	rt = append(rt, tcpip.Route{
-		Destination: header.IPv4EmptySubnet,
-		Gateway:     iface.gateway,
-		NIC:         iface.nicid,
-	})
+	for _, cfg := range []*IPConfig{opts.IPv4, opts.IPv6} {
+		if cfg == nil {
+			continue
+		}
 
-	iface.Stack.SetRouteTable(rt)
+		for _, address := range cfg.Addresses {
+			proto, addr, err := iface.parseInterfaceAddress(address)
+
+			if err != nil {
+				return err
+			}
+
+			if err = iface.addAddress(proto, addr); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, r := range opts.Routes {
+		if err = iface.AddRoute(r); err != nil {
+			return fmt.Errorf("route %s: %v", r.Destination, err)
+		}
+	}
 
 	return
 }
@@ -118,29 +454,59 @@ func (iface *Interface) configure(mac string) (err error) {
 // EnableICMP adds an ICMP endpoint to the interface, it is useful to enable
 // ping requests.
 func (iface *Interface) EnableICMP() error {
+	return iface.enableICMP(icmp.ProtocolNumber4, ipv4.ProtocolNumber)
+}
+
+// EnableICMPv6 adds an ICMPv6 endpoint to the interface, it is useful to
+// enable IPv6 ping requests.
+func (iface *Interface) EnableICMPv6() error {
+	if iface.opts.IPv6 == nil {
+		return errors.New("IPv6 not enabled")
+	}
+
+	return iface.enableICMP(icmp.ProtocolNumber6, ipv6.ProtocolNumber)
+}
+
+func (iface *Interface) enableICMP(transport tcpip.TransportProtocolNumber, proto tcpip.NetworkProtocolNumber) error {
 	var wq waiter.Queue
 
-	ep, err := iface.Stack.NewEndpoint(icmp.ProtocolNumber4, ipv4.ProtocolNumber, &wq)
+	ep, err := iface.Stack.NewEndpoint(transport, proto, &wq)
 
 	if err != nil {
 		return fmt.Errorf("endpoint error (icmp): %v", err)
 	}
 
-	fullAddr := tcpip.FullAddress{Addr: iface.address, Port: 0, NIC: iface.nicid}
+	// bind to the unspecified address to serve any address assigned to
+	// the interface, either now or later on
+	fullAddr := tcpip.FullAddress{NIC: iface.nicid}
 
 	if err := ep.Bind(fullAddr); err != nil {
-		return fmt.Errorf("bind error (icmp endpoint): ", err)
+		return fmt.Errorf("bind error (icmp endpoint): %v", err)
 	}
 
 	return nil
 }
 
 // ListenerTCP4 returns a net.Listener capable of accepting IPv4 TCP
-// connections for the argument port on the Ethernet interface.
+// connections for the argument port on the Ethernet interface, ErrNoAddress
+// is returned when no IPv4 address is configured (see
+// ListenerOptions.Wildcard).
 func (iface *Interface) ListenerTCP4(port uint16) (net.Listener, error) {
-	fullAddr := tcpip.FullAddress{Addr: iface.address, Port: port, NIC: iface.nicid}
+	listener, err := iface.ListenerTCPWithOptions(ListenerOptions{Port: port})
 
-	listener, err := gonet.ListenTCP(iface.Stack, fullAddr, ipv4.ProtocolNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return (net.Listener)(listener), nil
+}
+
+// ListenerTCP6 returns a net.Listener capable of accepting IPv6 TCP
+// connections for the argument port on the Ethernet interface, ErrNoAddress
+// is returned when no IPv6 address is configured (see
+// ListenerOptions.Wildcard).
+func (iface *Interface) ListenerTCP6(port uint16) (net.Listener, error) {
+	listener, err := iface.ListenerTCPWithOptions(ListenerOptions{Port: port, IPv6: true})
 
 	if err != nil {
 		return nil, err
@@ -149,24 +515,161 @@ func (iface *Interface) ListenerTCP4(port uint16) (net.Listener, error) {
 	return (net.Listener)(listener), nil
 }
 
-// Dial connects to an IPv4 TCP address, over the Ethernet interface.
-func (iface *Interface) DialTCP4(address string) (net.Conn, error) {
+// TCPConn represents a TCP connection supporting half-close, connections
+// returned by the TCP dial and listener functions can be type asserted to it.
+type TCPConn interface {
+	net.Conn
+
+	// CloseRead shuts down the reading side of the connection.
+	CloseRead() error
+	// CloseWrite shuts down the writing side of the connection, sending a
+	// FIN while reads remain possible until the peer closes.
+	CloseWrite() error
+}
+
+// ErrNoAddress is returned by operations requiring an address not yet
+// configured on the interface, they can be retried once it is.
+var ErrNoAddress = errors.New("no address configured")
+
+// localAddress returns the interface IPv4 address, if configured.
+func (iface *Interface) localAddress() (addr tcpip.Address, err error) {
+	iface.mu.RLock()
+	addr = iface.address.Address
+	iface.mu.RUnlock()
+
+	if len(addr) == 0 || !iface.hasAddress(ipv4.ProtocolNumber, addr) {
+		return "", ErrNoAddress
+	}
+
+	return
+}
+
+// localAddress6 returns the interface IPv6 address, if configured.
+func (iface *Interface) localAddress6() (addr tcpip.Address, err error) {
+	iface.mu.RLock()
+	addr = iface.address6.Address
+	iface.mu.RUnlock()
+
+	if len(addr) == 0 || !iface.hasAddress(ipv6.ProtocolNumber, addr) {
+		return "", ErrNoAddress
+	}
+
+	return
+}
+
+// ErrAddressNotAvailable is returned when dialing from a local address which
+// is not configured on the stack.
+var ErrAddressNotAvailable = errors.New("address not available")
+
+// addressProtocol returns the network protocol of an address literal in
+// host:port form, IPv4 is returned for empty or invalid hosts.
+func addressProtocol(address string) tcpip.NetworkProtocolNumber {
+	if host, _, err := net.SplitHostPort(address); err == nil && strings.Contains(host, ":") {
+		return ipv6.ProtocolNumber
+	}
+
+	return ipv4.ProtocolNumber
+}
+
+// fullAddr parses an address literal in host:port form, the host must belong
+// to the argument network protocol address family or be empty. IPv6 zones
+// are ignored.
+func fullAddr(address string, proto tcpip.NetworkProtocolNumber) (addr tcpip.FullAddress, err error) {
 	host, port, err := net.SplitHostPort(address)
 
 	if err != nil {
-		return nil, err
+		return
 	}
 
-	p, err := strconv.Atoi(port)
+	p, err := strconv.ParseUint(port, 10, 16)
 
 	if err != nil {
-		return nil, err
+		return
 	}
 
-	addr := net.ParseIP(host)
-	fullAddr := tcpip.FullAddress{Addr: tcpip.Address(addr.To4()), Port: uint16(p)}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+
+	if len(host) > 0 {
+		ip := net.ParseIP(host)
+
+		switch {
+		case ip == nil:
+			return addr, fmt.Errorf("invalid address %q", host)
+		case proto == ipv4.ProtocolNumber && ip.To4() != nil:
+			addr.Addr = tcpip.Address(ip.To4())
+		case proto == ipv6.ProtocolNumber && ip.To4() == nil:
+			addr.Addr = tcpip.Address(ip.To16())
+		default:
+			return addr, fmt.Errorf("invalid address %q for address family", host)
+		}
+	}
+
+	addr.Port = uint16(p)
+
+	return
+}
+
+// DialTCP4 connects to an IPv4 TCP address, over the Ethernet interface.
+func (iface *Interface) DialTCP4(address string) (net.Conn, error) {
+	return iface.DialContextTCP4(context.Background(), address)
+}
+
+// DialContextTCP4 connects to an IPv4 TCP address, over the Ethernet
+// interface, using the argument context.
+func (iface *Interface) DialContextTCP4(ctx context.Context, address string) (net.Conn, error) {
+	return iface.dialTCP(ctx, "", address, ipv4.ProtocolNumber)
+}
+
+// DialTCP6 connects to an IPv6 TCP address, over the Ethernet interface.
+func (iface *Interface) DialTCP6(address string) (net.Conn, error) {
+	return iface.DialContextTCP6(context.Background(), address)
+}
+
+// DialContextTCP6 connects to an IPv6 TCP address, over the Ethernet
+// interface, using the argument context.
+func (iface *Interface) DialContextTCP6(ctx context.Context, address string) (net.Conn, error) {
+	return iface.dialTCP(ctx, "", address, ipv6.ProtocolNumber)
+}
+
+// DialContextTCP connects, from the argument local address, to a remote TCP
+// address over the Ethernet interface. The address family is selected by the
+// remote address, which must be an IPv4 or IPv6 literal. An empty local
+// address, or host, selects the source address through routing while port 0
+// selects an ephemeral port.
+func (iface *Interface) DialContextTCP(ctx context.Context, laddr string, raddr string) (net.Conn, error) {
+	return iface.dialTCP(ctx, laddr, raddr, addressProtocol(raddr))
+}
+
+func (iface *Interface) dialTCP(ctx context.Context, laddr string, raddr string, proto tcpip.NetworkProtocolNumber) (net.Conn, error) {
+	var local tcpip.FullAddress
+
+	if proto == ipv6.ProtocolNumber && iface.opts.IPv6 == nil {
+		return nil, errors.New("IPv6 not enabled")
+	}
+
+	if len(laddr) > 0 {
+		addr, err := fullAddr(laddr, proto)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(addr.Addr) > 0 && !iface.hasAddress(proto, addr.Addr) {
+			return nil, ErrAddressNotAvailable
+		}
+
+		local = addr
+	}
 
-	conn, err := gonet.DialTCP(iface.Stack, fullAddr, ipv4.ProtocolNumber)
+	remote, err := fullAddr(raddr, proto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := gonet.DialTCPWithBind(ctx, iface.Stack, local, remote, proto)
 
 	if err != nil {
 		return nil, err
@@ -175,34 +678,238 @@ func (iface *Interface) DialTCP4(address string) (net.Conn, error) {
 	return (net.Conn)(conn), nil
 }
 
-// Init initializes an Ethernet interface.
+// Init initializes an Ethernet interface with a static IPv4 configuration,
+// an empty gateway disables the default route.
 func Init(nic *enet.ENET, ip string, mac string, gateway string, id int) (iface *Interface, err error) {
-	address, err := net.ParseMAC(mac)
+	opts := &Options{
+		MAC: mac,
+		IPv4: &IPConfig{
+			Address: ip,
+			Gateway: gateway,
+		},
+	}
+
+	return InitWithOptions(nic, id, opts)
+}
+
+// InitWithOptions initializes an Ethernet interface with the argument
+// options. On error no interface is returned and any partially initialized
+// state (e.g. stack, device reception) is released, background protocol
+// clients (e.g. DHCP, link-local, ACD) are only started on success.
+func InitWithOptions(nic *enet.ENET, id int, opts *Options) (iface *Interface, err error) {
+	address, err := net.ParseMAC(opts.MAC)
 
 	if err != nil {
 		return
 	}
 
 	iface = &Interface{
-		nicid:   tcpip.NICID(1),
-		address: tcpip.Address(net.ParseIP(ip)).To4(),
-		gateway: tcpip.Address(net.ParseIP(gateway)).To4(),
+		nicid:   tcpip.NICID(id),
+		opts:    *opts,
+		started: time.Now(),
+		done:    make(chan struct{}),
 	}
 
-	if err = iface.configure(mac); err != nil {
-		return
+	if cfg := opts.IPv4; cfg != nil && cfg.SLAAC {
+		return nil, errors.New("SLAAC is not supported for IPv4")
 	}
 
-	iface.nicid = tcpip.NICID(id)
+	if cfg := opts.IPv6; cfg != nil && cfg.LinkLocal {
+		return nil, errors.New("LinkLocal is not supported for IPv6")
+	}
+
+	if opts.ChecksumOffload && nic == nil {
+		return nil, errors.New("checksum offload requires a physical interface")
+	}
+
+	if cfg := opts.IPv4; cfg != nil && !cfg.DHCP && (len(cfg.Address) > 0 || !cfg.LinkLocal) {
+		if iface.address, err = parseAddress(cfg.Address, ipv4.ProtocolNumber); err != nil {
+			return nil, err
+		}
+
+		if iface.gateway, err = parseGateway(cfg.Gateway, ipv4.ProtocolNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg := opts.IPv6; cfg != nil {
+		if len(cfg.Address) > 0 || !(cfg.SLAAC || cfg.DHCP) {
+			if iface.address6, err = parseAddress(cfg.Address, ipv6.ProtocolNumber); err != nil {
+				return nil, err
+			}
+		}
+
+		if iface.gateway6, err = parseGateway(cfg.Gateway, ipv6.ProtocolNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = iface.configure(opts); err != nil {
+		if iface.Stack != nil {
+			iface.Stack.Close()
+			iface.Stack.Wait()
+		}
+
+		return nil, err
+	}
 
 	iface.NIC = &NIC{
-		MAC:     address,
-		Link:    iface.Link,
-		Device:  nic,
-		Gateway: header.EthernetBroadcastAddress,
+		MAC:        address,
+		Link:       iface.Link,
+		Device:     nic,
+		Gateway:    header.EthernetBroadcastAddress,
+		PHYAddress: opts.PHYAddress,
+		PHY:        opts.PHYDriver,
+	}
+
+	iface.NIC.arpHandler = iface.handleARP
+
+	var dhcp *dhcpClient
+
+	if dhcpEnabled(opts) {
+		dhcp = newDHCPClient(iface)
+		iface.NIC.dhcpHandler = dhcp.handle
+	}
+
+	// protocol clients are started only once all fallible steps succeed,
+	// the interface is otherwise torn down
+	if err = iface.init(nic, opts); err != nil {
+		iface.StopCapture()
+		iface.Close()
+
+		return nil, err
+	}
+
+	switch {
+	case dhcp != nil:
+		go dhcp.run()
+	case opts.IPv4 != nil && len(iface.address.Address) == 0:
+		iface.startLinkLocal()
+	case opts.IPv4 != nil && opts.ACD:
+		go iface.startACD()
+	case opts.IPv4 != nil:
+		go iface.announce(iface.address.Address, acdAnnounceNum)
+	}
+
+	register(iface)
+
+	return
+}
+
+// init initializes the interface NIC, its physical device and PHY, and
+// starts the optional capture, expvar publication and DHCPv6 client.
+func (iface *Interface) init(nic *enet.ENET, opts *Options) (err error) {
+	if err = iface.NIC.Init(); err != nil {
+		return
+	}
+
+	if nic != nil {
+		setMaxFrameLength(nic, iface.endpoint.MTU())
+	}
+
+	if opts.ChecksumOffload {
+		if !enhancedDescriptors(nic) {
+			return errors.New("checksum offload requires enhanced buffer descriptors")
+		}
+
+		iface.NIC.checksumOffload = true
+		enableChecksumOffload(nic)
+	}
+
+	if opts.Coalescing != nil {
+		if err = iface.NIC.SetCoalescing(*opts.Coalescing); err != nil {
+			return fmt.Errorf("coalescing configuration error: %v", err)
+		}
+	}
+
+	if opts.PHYDriver != nil {
+		if err = opts.PHYDriver.Init(iface.NIC); err != nil {
+			return fmt.Errorf("PHY initialization error: %v", err)
+		}
+	}
+
+	if opts.PHY != nil {
+		if err = iface.NIC.ConfigurePHY(*opts.PHY); err != nil {
+			return fmt.Errorf("PHY configuration error: %v", err)
+		}
 	}
 
-	err = iface.NIC.Init()
+	if opts.Capture != nil {
+		if err = iface.StartCapture(*opts.Capture); err != nil {
+			return fmt.Errorf("capture error: %v", err)
+		}
+	}
+
+	if len(opts.Expvar) > 0 {
+		if err = iface.PublishExpvar(opts.Expvar); err != nil {
+			return
+		}
+	}
+
+	// started last, as no further step can fail
+	if cfg := opts.IPv6; cfg != nil && cfg.DHCP {
+		err = iface.startDHCPv6()
+	}
+
+	return
+}
+
+// parseGateway parses a gateway address, an empty string returns an empty
+// address (no default route).
+func parseGateway(s string, proto tcpip.NetworkProtocolNumber) (gateway tcpip.Address, err error) {
+	if len(s) == 0 {
+		return
+	}
+
+	ip := net.ParseIP(s)
+
+	switch {
+	case ip == nil:
+		return "", fmt.Errorf("invalid gateway %q", s)
+	case proto == ipv4.ProtocolNumber && ip.To4() == nil:
+		return "", fmt.Errorf("gateway %q is not an IPv4 address", s)
+	case proto == ipv6.ProtocolNumber && ip.To4() != nil:
+		return "", fmt.Errorf("gateway %q is not an IPv6 address", s)
+	case proto == ipv4.ProtocolNumber:
+		return tcpip.Address(ip.To4()), nil
+	default:
+		return tcpip.Address(ip.To16()), nil
+	}
+}
+
+func parseAddress(s string, proto tcpip.NetworkProtocolNumber) (addr tcpip.AddressWithPrefix, err error) {
+	var ip net.IP
+	var prefixLen int
+
+	if strings.Contains(s, "/") {
+		var subnet *net.IPNet
+
+		if ip, subnet, err = net.ParseCIDR(s); err != nil {
+			return
+		}
+
+		prefixLen, _ = subnet.Mask.Size()
+	} else {
+		ip = net.ParseIP(s)
+	}
+
+	switch {
+	case proto == ipv4.ProtocolNumber && ip.To4() != nil:
+		ip = ip.To4()
+	case proto == ipv6.ProtocolNumber && ip != nil && ip.To4() == nil:
+		ip = ip.To16()
+	default:
+		return addr, fmt.Errorf("invalid address %q", s)
+	}
+
+	if prefixLen == 0 {
+		prefixLen = len(ip) * 8
+	}
+
+	addr = tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(ip),
+		PrefixLen: prefixLen,
+	}
 
 	return
 }
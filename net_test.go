@@ -0,0 +1,223 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// testEndpoint counts packets through a wrapped link endpoint.
+type testEndpoint struct {
+	stack.LinkEndpoint
+
+	dispatcher stack.NetworkDispatcher
+
+	tx uint32
+	rx uint32
+}
+
+func (ep *testEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	atomic.AddUint32(&ep.tx, uint32(pkts.Len()))
+	return ep.LinkEndpoint.WritePackets(pkts)
+}
+
+func (ep *testEndpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	ep.dispatcher = dispatcher
+
+	if dispatcher == nil {
+		ep.LinkEndpoint.Attach(nil)
+		return
+	}
+
+	ep.LinkEndpoint.Attach(ep)
+}
+
+func (ep *testEndpoint) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	atomic.AddUint32(&ep.rx, 1)
+	ep.dispatcher.DeliverNetworkPacket(protocol, pkt)
+}
+
+func (ep *testEndpoint) DeliverLinkPacket(protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer, incoming bool) {
+	ep.dispatcher.DeliverLinkPacket(protocol, pkt, incoming)
+}
+
+func TestWrapLink(t *testing.T) {
+	wrapper := &testEndpoint{}
+
+	a, b := testPair(t, func(n int, opts *Options) {
+		if n != 1 {
+			return
+		}
+
+		opts.WrapLink = func(ep stack.LinkEndpoint) stack.LinkEndpoint {
+			wrapper.LinkEndpoint = ep
+			return wrapper
+		}
+	})
+
+	server, err := b.ListenUDP("udp4", "10.0.0.2:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := a.DialUDP4("", "10.0.0.2:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testEcho(t, client, server)
+
+	if atomic.LoadUint32(&wrapper.tx) == 0 {
+		t.Error("outgoing packets did not traverse the wrapper")
+	}
+
+	if atomic.LoadUint32(&wrapper.rx) == 0 {
+		t.Error("incoming packets did not traverse the wrapper")
+	}
+}
+
+func TestDialLocalAddress(t *testing.T) {
+	a, b := testPair(t, func(n int, opts *Options) {
+		if n == 1 {
+			opts.IPv4.Addresses = []string{"10.0.0.3/24"}
+		}
+	})
+
+	l, err := b.ListenerTCP4(80)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := testAccept(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err = a.DialContextTCP(ctx, "10.0.0.9:0", "10.0.0.2:80"); !errors.Is(err, ErrAddressNotAvailable) {
+		t.Fatalf("unexpected error for non-local address, %v", err)
+	}
+
+	conn, err := a.DialContextTCP(ctx, "10.0.0.3:4000", "10.0.0.2:80")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if addr := conn.LocalAddr().String(); addr != "10.0.0.3:4000" {
+		t.Errorf("unexpected local address %s", addr)
+	}
+
+	select {
+	case peer := <-accepted:
+		defer peer.Close()
+
+		if addr := peer.RemoteAddr().String(); addr != "10.0.0.3:4000" {
+			t.Errorf("unexpected remote address %s", addr)
+		}
+	case <-ctx.Done():
+		t.Fatal("connection not accepted")
+	}
+
+	// swaps primary and secondary addresses, leaving the stack endpoints
+	// untouched, DialContext() attempts must originate from the new primary
+	// address rather than the one selected by routing
+	if err = a.SetIPv4(&IPConfig{Address: "10.0.0.3/24", Addresses: []string{"10.0.0.1/24"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	accepted = testAccept(l)
+
+	if conn, err = a.DialContext(ctx, "tcp", "10.0.0.2:80"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case peer := <-accepted:
+		defer peer.Close()
+
+		if addr := peer.RemoteAddr().String(); !strings.HasPrefix(addr, "10.0.0.3:") {
+			t.Errorf("unexpected remote address %s", addr)
+		}
+	case <-ctx.Done():
+		t.Fatal("connection not accepted")
+	}
+}
+
+func TestParseGateway(t *testing.T) {
+	for _, test := range []struct {
+		gateway string
+		proto   tcpip.NetworkProtocolNumber
+		addr    tcpip.Address
+		valid   bool
+	}{
+		{"", ipv4.ProtocolNumber, "", true},
+		{"", ipv6.ProtocolNumber, "", true},
+		{"10.0.0.254", ipv4.ProtocolNumber, testAddress("10.0.0.254"), true},
+		{"fd00::fe", ipv6.ProtocolNumber, testAddress("fd00::fe"), true},
+		{"fd00::fe", ipv4.ProtocolNumber, "", false},
+		{"10.0.0.254", ipv6.ProtocolNumber, "", false},
+		{"gateway", ipv4.ProtocolNumber, "", false},
+	} {
+		addr, err := parseGateway(test.gateway, test.proto)
+
+		if (err == nil) != test.valid {
+			t.Errorf("gateway %q (%d), unexpected error %v", test.gateway, test.proto, err)
+		}
+
+		if addr != test.addr {
+			t.Errorf("gateway %q (%d), unexpected address %s", test.gateway, test.proto, addr)
+		}
+	}
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	iface := testInterface(t, &Options{
+		MAC:  testMAC(1),
+		IPv4: &IPConfig{Address: "10.0.0.1/24"},
+		IPv6: &IPConfig{
+			Address: "fd00::1/64",
+			Gateway: "fd00::fe",
+		},
+		DisableDAD: true,
+	})
+
+	var gateway6 bool
+
+	for _, route := range iface.Stack.GetRouteTable() {
+		switch route.Destination {
+		case header.IPv4EmptySubnet:
+			t.Errorf("unexpected IPv4 default route %s", route)
+		case header.IPv6EmptySubnet:
+			gateway6 = route.Gateway == testAddress("fd00::fe")
+		}
+	}
+
+	if !gateway6 {
+		t.Error("missing IPv6 default route")
+	}
+}
@@ -0,0 +1,82 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// WaitDHCPLease blocks until a DHCP lease is obtained or the context is
+// done, it returns the obtained lease.
+func (iface *Interface) WaitDHCPLease(ctx context.Context) (lease *DHCPLease, err error) {
+	if !dhcpEnabled(&iface.opts) {
+		return nil, errors.New("DHCP not enabled")
+	}
+
+	ticker := time.NewTicker(linkPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if lease = iface.DHCPLease(); lease != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Netboot waits for a DHCP lease and fetches, over TFTP, the boot file it
+// references, writing its content to the argument writer.
+//
+// The boot server is taken from the TFTP server name option (66) or, in its
+// absence, from the next server address (siaddr). The boot file is taken
+// from the boot file name option (67) or, in its absence, from the file
+// field.
+func (iface *Interface) Netboot(ctx context.Context, w io.Writer, opts *TFTPOptions) (lease *DHCPLease, size int64, err error) {
+	if lease, err = iface.WaitDHCPLease(ctx); err != nil {
+		return
+	}
+
+	server := lease.TFTPServer
+
+	if len(server) == 0 && len(lease.NextServer) > 0 {
+		server = lease.NextServer.String()
+	}
+
+	if len(server) == 0 {
+		return lease, 0, errors.New("missing boot server")
+	}
+
+	if len(lease.BootFile) == 0 {
+		return lease, 0, errors.New("missing boot file")
+	}
+
+	size, err = iface.TFTPGet(ctx, server, lease.BootFile, w, opts)
+
+	return
+}
+
+// NetbootImage is like Netboot but returns the boot file content.
+func (iface *Interface) NetbootImage(ctx context.Context, opts *TFTPOptions) (lease *DHCPLease, image []byte, err error) {
+	buf := new(bytes.Buffer)
+
+	if lease, _, err = iface.Netboot(ctx, buf, opts); err != nil {
+		return
+	}
+
+	return lease, buf.Bytes(), nil
+}
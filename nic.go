@@ -12,11 +12,14 @@ import (
 	"encoding/binary"
 	"errors"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/usbarmory/tamago/soc/nxp/enet"
 
 	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
@@ -32,8 +35,62 @@ type NIC struct {
 	// Device is the physical interface associated to the virtual one.
 	Device *enet.ENET
 
+	// PHYAddress is the MDIO address of the Ethernet PHY connected to the
+	// physical interface.
+	PHYAddress int
+
+	// PHY is the Ethernet PHY driver, when nil GenericPHY is used.
+	PHY PHYDriver
+
 	// Gateway is router physical address
 	Gateway tcpip.LinkAddress
+
+	// serializes MDIO transactions
+	mii sync.Mutex
+	// serializes frame transmission
+	tx sync.Mutex
+
+	// ARP packet observer
+	arpHandler func(header.ARP)
+	// DHCP client frame handler, returns true for consumed frames
+	dhcpHandler func(buf []byte) bool
+	// LLDP agent frame handler
+	lldpHandler func(src net.HardwareAddr, buf []byte)
+	// EtherType handlers
+	etherTypes etherTypes
+
+	// clear protocol checksums for ENET insertion
+	checksumOffload bool
+
+	// IEEE 1588 timer
+	ptp *PTPClock
+	// frame timestamping
+	rxTimestamps bool
+	txTimestamps bool
+
+	// packet capture
+	capture capture
+
+	// frame tap handlers
+	taps taps
+
+	// receive filters
+	filters rxFilters
+
+	// Access Control List
+	acl acl
+
+	// group address hash filter
+	multicast multicastFilter
+
+	// 6LoWPAN adaptation layer
+	lowpan lowpan
+
+	// IEEE 802.1Q VLAN sub-interfaces
+	vlans vlanTable
+
+	// priority marking
+	qos qos
 }
 
 type notification struct {
@@ -41,7 +98,12 @@ type notification struct {
 }
 
 func (n *notification) WriteNotify() {
-	n.eth.Device.Tx(n.eth.Tx())
+	n.eth.tx.Lock()
+	defer n.eth.tx.Unlock()
+
+	for buf := n.eth.Tx(); len(buf) > 0; buf = n.eth.next() {
+		n.eth.Device.Tx(buf)
+	}
 }
 
 // Init initializes a virtual Ethernet instance bound to a physical Ethernet
@@ -62,6 +124,7 @@ func (eth *NIC) Init() (err error) {
 	eth.Device.MAC = eth.MAC
 	eth.Device.RxHandler = eth.Rx
 	eth.Device.Init()
+	enableCounters(eth.Device)
 
 	eth.Link.AddNotify(&notification{
 		eth: eth,
@@ -72,10 +135,60 @@ func (eth *NIC) Init() (err error) {
 
 // Rx receives a single Ethernet frame from the virtual Ethernet instance.
 func (eth *NIC) Rx(buf []byte) {
+	ts := eth.timestamp(false)
+
+	eth.capture.write(buf, false)
+	eth.taps.invoke(buf, false, ts)
+
+	if !eth.filters.apply(buf) {
+		return
+	}
+
+	if buf = eth.lowpan.rx(buf); buf == nil {
+		return
+	}
+
+	eth.receive(buf)
+}
+
+// receive dispatches a received Ethernet frame, once captured and filtered,
+// to protocol handlers and the stack.
+func (eth *NIC) receive(buf []byte) {
 	hdr := buf[0:14]
 	proto := tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(buf[12:14]))
 	payload := buf[14:]
 
+	if !eth.acl.allow(buf) {
+		return
+	}
+
+	if proto == header.ARPProtocolNumber && eth.arpHandler != nil {
+		if arp := header.ARP(payload); arp.IsValid() {
+			eth.arpHandler(arp)
+		}
+	}
+
+	if proto == VLANProtocolNumber {
+		eth.vlanRx(buf)
+		return
+	}
+
+	if proto == LLDPProtocolNumber {
+		if eth.lldpHandler != nil {
+			eth.lldpHandler(net.HardwareAddr(buf[6:12]), payload)
+		}
+
+		return
+	}
+
+	if eth.etherTypes.handle(proto, buf) {
+		return
+	}
+
+	if proto == header.IPv4ProtocolNumber && eth.dhcpHandler != nil && eth.dhcpHandler(buf) {
+		return
+	}
+
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: len(hdr),
 		Payload:            bufferv2.MakeWithData(payload),
@@ -84,8 +197,6 @@ func (eth *NIC) Rx(buf []byte) {
 	copy(pkt.LinkHeader().Push(len(hdr)), hdr)
 
 	eth.Link.InjectInbound(proto, pkt)
-
-	return
 }
 
 // Tx transmits a single Ethernet frame to the virtual Ethernet instance.
@@ -96,17 +207,91 @@ func (eth *NIC) Tx() (buf []byte) {
 		return
 	}
 
-	proto := make([]byte, 2)
-	binary.BigEndian.PutUint16(proto, uint16(pkt.NetworkProtocolNumber))
+	dst := pkt.EgressRoute.RemoteLinkAddress
+
+	// raw packet endpoint frames (see ListenPacketRaw) carry their own
+	// Ethernet header
+	raw := len(dst) == 0 && len(pkt.NetworkHeader().Slice()) == 0
+
+	if len(dst) == 0 {
+		dst = eth.Gateway
+	}
 
-	// Ethernet frame header
-	buf = append(buf, []byte(eth.Gateway)...)
-	buf = append(buf, eth.MAC...)
-	buf = append(buf, proto...)
+	if !raw {
+		proto := make([]byte, 2)
+		binary.BigEndian.PutUint16(proto, uint16(pkt.NetworkProtocolNumber))
+
+		// Ethernet frame header
+		buf = append(buf, []byte(dst)...)
+		buf = append(buf, eth.MAC...)
+		buf = append(buf, proto...)
+	}
 
 	for _, v := range pkt.AsSlices() {
 		buf = append(buf, v...)
 	}
 
+	if !eth.acl.allow(buf) {
+		return nil
+	}
+
+	if eth.checksumOffload {
+		offloadChecksum(buf)
+	}
+
+	buf = eth.lowpan.tx(eth.qos.mark(buf))
+	eth.capture.write(buf, true)
+	eth.taps.invoke(buf, true, eth.timestamp(true))
+
+	return
+}
+
+// Transmit transmits a fully-formed Ethernet frame, excluding the FCS,
+// bypassing the stack. The frame is serialized against stack transmission
+// and, like stack frames, is subject to the Access Control List, capture and
+// taps.
+func (eth *NIC) Transmit(frame []byte) (err error) {
+	_, err = eth.transmit(frame, false)
+	return
+}
+
+// transmit implements Transmit() and TransmitTimestamp(), the frame
+// timer-sampled timestamp is taken when requested or when Tx timestamping is
+// enabled.
+func (eth *NIC) transmit(frame []byte, timestamp bool) (ts time.Time, err error) {
+	if eth.Device == nil {
+		return ts, errors.New("missing physical interface")
+	}
+
+	if len(frame) < header.EthernetMinimumSize || len(frame) > enet.MTU {
+		return ts, errors.New("invalid frame length")
+	}
+
+	if !eth.acl.allow(frame) {
+		return ts, errors.New("frame denied by ACL")
+	}
+
+	eth.tx.Lock()
+	defer eth.tx.Unlock()
+
+	if timestamp && eth.ptp != nil {
+		ts = eth.ptp.Time()
+	} else {
+		ts = eth.timestamp(true)
+	}
+
+	eth.capture.write(frame, true)
+	eth.taps.invoke(frame, true, ts)
+	eth.Device.Tx(frame)
+
+	return
+}
+
+// next returns the next pending 6LoWPAN fragment, if any.
+func (eth *NIC) next() (buf []byte) {
+	buf = eth.lowpan.next()
+	eth.capture.write(buf, true)
+	eth.taps.invoke(buf, true, eth.timestamp(true))
+
 	return
 }
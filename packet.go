@@ -0,0 +1,262 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// ProtocolAll selects all EtherTypes on packet endpoints (ETH_P_ALL).
+const ProtocolAll tcpip.NetworkProtocolNumber = 0x0003
+
+// PacketAddr represents the link layer address of a packet endpoint peer.
+type PacketAddr struct {
+	// MAC is the peer hardware address.
+	MAC net.HardwareAddr
+	// Protocol is the frame EtherType.
+	Protocol tcpip.NetworkProtocolNumber
+}
+
+// Network returns the address network name ("packet").
+func (a *PacketAddr) Network() string {
+	return "packet"
+}
+
+// String returns the string form of the address.
+func (a *PacketAddr) String() string {
+	return fmt.Sprintf("%s/%#04x", a.MAC, uint16(a.Protocol))
+}
+
+// PacketConn represents a packet endpoint (AF_PACKET socket) over the
+// Ethernet interface, it implements net.PacketConn.
+//
+// Raw endpoints (SOCK_RAW) receive and transmit complete Ethernet frames,
+// while cooked endpoints (SOCK_DGRAM) receive and transmit the frame payload
+// only, the Ethernet header being stripped on reception and generated on
+// transmission.
+//
+// Frames handled outside the stack (VLAN, LLDP and DHCP client traffic) are
+// not delivered to packet endpoints.
+type PacketConn struct {
+	sync.Mutex
+
+	iface  *Interface
+	ep     tcpip.Endpoint
+	wq     waiter.Queue
+	proto  tcpip.NetworkProtocolNumber
+	cooked bool
+
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// ListenPacketRaw returns a raw packet endpoint, receiving and transmitting
+// complete Ethernet frames for the argument EtherType, ProtocolAll selects
+// all of them.
+//
+// Frames written on the endpoint must include the Ethernet header, the
+// destination address passed to WriteTo is ignored.
+func (iface *Interface) ListenPacketRaw(proto tcpip.NetworkProtocolNumber) (*PacketConn, error) {
+	return iface.listenPacket(proto, false)
+}
+
+// ListenPacketCooked returns a cooked packet endpoint, receiving and
+// transmitting Ethernet payloads for the argument EtherType, ProtocolAll
+// selects all of them for reception.
+//
+// Frames written on the endpoint are sent to the *PacketAddr destination
+// passed to WriteTo, its Protocol, when not zero, overrides the endpoint
+// EtherType.
+func (iface *Interface) ListenPacketCooked(proto tcpip.NetworkProtocolNumber) (*PacketConn, error) {
+	return iface.listenPacket(proto, true)
+}
+
+func (iface *Interface) listenPacket(proto tcpip.NetworkProtocolNumber, cooked bool) (c *PacketConn, err error) {
+	c = &PacketConn{
+		iface:  iface,
+		proto:  proto,
+		cooked: cooked,
+		closed: make(chan struct{}),
+	}
+
+	ep, tcpErr := iface.Stack.NewPacketEndpoint(cooked, proto, &c.wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (packet): %v", tcpErr)
+	}
+
+	if tcpErr := ep.Bind(tcpip.FullAddress{NIC: iface.nicid, Port: uint16(proto)}); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("bind error (packet): %v", tcpErr)
+	}
+
+	c.ep = ep
+
+	return
+}
+
+// ReadFrom reads a frame from the endpoint, copying it into b, and returns
+// the number of bytes copied and the frame source address (as *PacketAddr).
+// Frames larger than b are truncated.
+func (c *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	entry, notify := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.wq.EventRegister(&entry)
+	defer c.wq.EventUnregister(&entry)
+
+	opts := tcpip.ReadOptions{
+		NeedRemoteAddr:     true,
+		NeedLinkPacketInfo: true,
+	}
+
+	for {
+		w := tcpip.SliceWriter(b)
+		res, tcpErr := c.ep.Read(&w, opts)
+
+		switch tcpErr.(type) {
+		case nil:
+			addr = &PacketAddr{
+				MAC:      net.HardwareAddr(res.RemoteAddr.Addr),
+				Protocol: res.LinkPacketInfo.Protocol,
+			}
+
+			return res.Count, addr, nil
+		case *tcpip.ErrWouldBlock:
+		case *tcpip.ErrClosedForReceive:
+			return 0, nil, net.ErrClosed
+		default:
+			return 0, nil, fmt.Errorf("read error (packet): %v", tcpErr)
+		}
+
+		var t *time.Timer
+		var timeout <-chan time.Time
+
+		c.Lock()
+		deadline := c.deadline
+		c.Unlock()
+
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+
+			t = time.NewTimer(d)
+			timeout = t.C
+		}
+
+		select {
+		case <-notify:
+		case <-timeout:
+		case <-c.closed:
+			err = net.ErrClosed
+		}
+
+		if t != nil {
+			t.Stop()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// WriteTo transmits a frame on the endpoint, see ListenPacketRaw and
+// ListenPacketCooked for the frame format and destination address semantics.
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	to := &tcpip.FullAddress{
+		NIC:  c.iface.nicid,
+		Port: uint16(c.proto),
+	}
+
+	if c.cooked {
+		dst, ok := addr.(*PacketAddr)
+
+		if !ok || len(dst.MAC) != header.EthernetAddressSize {
+			return 0, errors.New("invalid destination address")
+		}
+
+		to.Addr = tcpip.Address(dst.MAC)
+
+		if dst.Protocol != 0 {
+			to.Port = uint16(dst.Protocol)
+		}
+	} else {
+		if len(b) < header.EthernetMinimumSize {
+			return 0, errors.New("invalid frame")
+		}
+
+		to.Port = uint16(header.Ethernet(b).Type())
+	}
+
+	if to.Port == uint16(ProtocolAll) {
+		return 0, errors.New("invalid protocol")
+	}
+
+	written, tcpErr := c.ep.Write(bytes.NewReader(b), tcpip.WriteOptions{To: to})
+
+	if tcpErr != nil {
+		return 0, fmt.Errorf("write error (packet): %v", tcpErr)
+	}
+
+	return int(written), nil
+}
+
+// Close closes the endpoint, pending reads are unblocked.
+func (c *PacketConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.ep.Close()
+	})
+
+	return nil
+}
+
+// LocalAddr returns the interface hardware address and endpoint EtherType.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return &PacketAddr{
+		MAC:      net.HardwareAddr(c.iface.Link.LinkAddress()),
+		Protocol: c.proto,
+	}
+}
+
+// SetDeadline sets the read deadline, writes never block.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future and pending ReadFrom calls,
+// a zero value disables it.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	c.deadline = t
+	c.Unlock()
+
+	// wake up pending readers to re-evaluate the deadline
+	c.wq.Notify(waiter.ReadableEvents)
+
+	return nil
+}
+
+// SetWriteDeadline is a no-op as writes never block.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,455 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// IEEE 802.3 Clause 22 PHY registers
+const (
+	MII_BMCR           = 0x00
+	BMCR_RESET         = 15
+	BMCR_LOOPBACK      = 14
+	BMCR_SPEED_SELECT  = 13
+	BMCR_ANENABLE      = 12
+	BMCR_POWER_DOWN    = 11
+	BMCR_ANRESTART     = 9
+	BMCR_DUPLEX_MODE   = 8
+	BMCR_SPEED_SELECT1 = 6
+
+	MII_BMSR          = 0x01
+	BMSR_ESTATEN      = 8
+	BMSR_ANEGCOMPLETE = 5
+	BMSR_LSTATUS      = 2
+
+	MII_ANAR     = 0x04
+	MII_ANLPAR   = 0x05
+	ANAR_100FULL = 8
+	ANAR_100HALF = 7
+	ANAR_10FULL  = 6
+	ANAR_10HALF  = 5
+
+	MII_CTRL1000      = 0x09
+	CTRL1000_1000FULL = 9
+	CTRL1000_1000HALF = 8
+
+	MII_STAT1000      = 0x0a
+	STAT1000_1000FULL = 11
+	STAT1000_1000HALF = 10
+
+	MII_ESTATUS        = 0x0f
+	ESTATUS_1000T_FULL = 13
+	ESTATUS_1000T_HALF = 12
+)
+
+// LinkModes represents a set of Ethernet link speed and duplex modes.
+type LinkModes uint
+
+// Link modes
+const (
+	Link10Half LinkModes = 1 << iota
+	Link10Full
+	Link100Half
+	Link100Full
+	Link1000Half
+	Link1000Full
+)
+
+// PHYConfig represents the Ethernet PHY link configuration.
+type PHYConfig struct {
+	// Speed forces the link speed in Mbps (10 or 100), 0 selects
+	// auto-negotiation. As 1000BASE-T requires auto-negotiation, 1000 is
+	// only negotiated with link partners supporting it.
+	Speed int
+	// FullDuplex selects full-duplex mode when Speed is set.
+	FullDuplex bool
+
+	// Advertise restricts the modes advertised during auto-negotiation,
+	// 0 advertises all modes supported by the PHY.
+	Advertise LinkModes
+}
+
+// linkPollInterval is the PHY status polling interval used by WaitLinkUp().
+const linkPollInterval = 100 * time.Millisecond
+
+// LinkMonitorInterval is the PHY status polling interval of the link monitor
+// (see OnLinkChange()).
+var LinkMonitorInterval = 1 * time.Second
+
+// LinkState represents the Ethernet PHY link status.
+type LinkState struct {
+	// Up is true when the link is established.
+	Up bool
+	// Speed is the link speed in Mbps.
+	Speed int
+	// FullDuplex is true when the link operates in full-duplex mode.
+	FullDuplex bool
+}
+
+type linkMonitor struct {
+	sync.Mutex
+
+	handlers []func(LinkState)
+	state    *LinkState
+}
+
+// ReadPHY reads a register of the Ethernet PHY associated to the physical
+// interface.
+func (eth *NIC) ReadPHY(ra int) (data uint16, err error) {
+	if err = eth.checkMII(ra); err != nil {
+		return
+	}
+
+	eth.mii.Lock()
+	defer eth.mii.Unlock()
+
+	return eth.Device.ReadMII(eth.PHYAddress, ra), nil
+}
+
+// WritePHY writes a register of the Ethernet PHY associated to the physical
+// interface.
+func (eth *NIC) WritePHY(ra int, data uint16) (err error) {
+	if err = eth.checkMII(ra); err != nil {
+		return
+	}
+
+	eth.mii.Lock()
+	defer eth.mii.Unlock()
+
+	eth.Device.WriteMII(eth.PHYAddress, ra, data)
+
+	return
+}
+
+// supportedModes returns the link modes supported by the Ethernet PHY.
+func (eth *NIC) supportedModes() (modes LinkModes, err error) {
+	modes = Link10Half | Link10Full | Link100Half | Link100Full
+
+	bmsr, err := eth.ReadPHY(MII_BMSR)
+
+	if err != nil || bmsr&(1<<BMSR_ESTATEN) == 0 {
+		return
+	}
+
+	estatus, err := eth.ReadPHY(MII_ESTATUS)
+
+	if err != nil {
+		return
+	}
+
+	if estatus&(1<<ESTATUS_1000T_HALF) != 0 {
+		modes |= Link1000Half
+	}
+
+	if estatus&(1<<ESTATUS_1000T_FULL) != 0 {
+		modes |= Link1000Full
+	}
+
+	return
+}
+
+// advertise configures the link modes advertised during auto-negotiation and
+// restarts it.
+func (eth *NIC) advertise(modes LinkModes, supported LinkModes) (err error) {
+	anar, err := eth.ReadPHY(MII_ANAR)
+
+	if err != nil {
+		return
+	}
+
+	anar &^= 1<<ANAR_10HALF | 1<<ANAR_10FULL | 1<<ANAR_100HALF | 1<<ANAR_100FULL
+
+	for mode, bit := range map[LinkModes]int{
+		Link10Half:  ANAR_10HALF,
+		Link10Full:  ANAR_10FULL,
+		Link100Half: ANAR_100HALF,
+		Link100Full: ANAR_100FULL,
+	} {
+		if modes&mode != 0 {
+			anar |= 1 << bit
+		}
+	}
+
+	if err = eth.WritePHY(MII_ANAR, anar); err != nil {
+		return
+	}
+
+	if supported&(Link1000Half|Link1000Full) != 0 {
+		ctrl, err := eth.ReadPHY(MII_CTRL1000)
+
+		if err != nil {
+			return err
+		}
+
+		ctrl &^= 1<<CTRL1000_1000HALF | 1<<CTRL1000_1000FULL
+
+		if modes&Link1000Half != 0 {
+			ctrl |= 1 << CTRL1000_1000HALF
+		}
+
+		if modes&Link1000Full != 0 {
+			ctrl |= 1 << CTRL1000_1000FULL
+		}
+
+		if err = eth.WritePHY(MII_CTRL1000, ctrl); err != nil {
+			return err
+		}
+	}
+
+	bmcr, err := eth.ReadPHY(MII_BMCR)
+
+	if err != nil {
+		return
+	}
+
+	bmcr |= 1<<BMCR_ANENABLE | 1<<BMCR_ANRESTART
+
+	return eth.WritePHY(MII_BMCR, bmcr)
+}
+
+// ConfigurePHY configures the Ethernet PHY link speed, duplex mode and
+// auto-negotiation, overriding the defaults set on device initialization.
+func (eth *NIC) ConfigurePHY(cfg PHYConfig) (err error) {
+	supported, err := eth.supportedModes()
+
+	if err != nil {
+		return
+	}
+
+	modes := supported
+
+	if cfg.Advertise != 0 {
+		modes &= cfg.Advertise
+	}
+
+	switch cfg.Speed {
+	case 0:
+	case 10, 100:
+		bmcr, err := eth.ReadPHY(MII_BMCR)
+
+		if err != nil {
+			return err
+		}
+
+		bmcr &^= 1<<BMCR_ANENABLE | 1<<BMCR_SPEED_SELECT | 1<<BMCR_SPEED_SELECT1 | 1<<BMCR_DUPLEX_MODE
+
+		if cfg.Speed == 100 {
+			bmcr |= 1 << BMCR_SPEED_SELECT
+		}
+
+		if cfg.FullDuplex {
+			bmcr |= 1 << BMCR_DUPLEX_MODE
+		}
+
+		return eth.WritePHY(MII_BMCR, bmcr)
+	case 1000:
+		if cfg.FullDuplex {
+			modes &= Link1000Full
+		} else {
+			modes &= Link1000Half
+		}
+	default:
+		return errors.New("invalid speed")
+	}
+
+	if modes == 0 {
+		return errors.New("unsupported link modes")
+	}
+
+	return eth.advertise(modes, supported)
+}
+
+// LinkState returns the Ethernet PHY link status, the speed and duplex mode
+// are only reported when the link is up.
+func (eth *NIC) LinkState() (state LinkState, err error) {
+	if eth.PHY != nil {
+		return eth.PHY.LinkState(eth)
+	}
+
+	return GenericPHY{}.LinkState(eth)
+}
+
+// LinkState returns the Ethernet PHY link status from IEEE 802.3 Clause 22
+// registers, the speed and duplex mode are only reported when the link is up.
+func (GenericPHY) LinkState(eth *NIC) (state LinkState, err error) {
+	// link status is latched low, read twice for its current value
+	if _, err = eth.ReadPHY(MII_BMSR); err != nil {
+		return
+	}
+
+	bmsr, err := eth.ReadPHY(MII_BMSR)
+
+	if err != nil {
+		return
+	}
+
+	if state.Up = bmsr&(1<<BMSR_LSTATUS) != 0; !state.Up {
+		return
+	}
+
+	bmcr, err := eth.ReadPHY(MII_BMCR)
+
+	if err != nil {
+		return
+	}
+
+	if bmcr&(1<<BMCR_ANENABLE) == 0 {
+		switch {
+		case bmcr&(1<<BMCR_SPEED_SELECT1) != 0:
+			state.Speed = 1000
+		case bmcr&(1<<BMCR_SPEED_SELECT) != 0:
+			state.Speed = 100
+		default:
+			state.Speed = 10
+		}
+
+		state.FullDuplex = bmcr&(1<<BMCR_DUPLEX_MODE) != 0
+
+		return
+	}
+
+	// 1000BASE-T abilities are only present with extended status
+	if bmsr&(1<<BMSR_ESTATEN) != 0 {
+		ctrl1000, err := eth.ReadPHY(MII_CTRL1000)
+
+		if err != nil {
+			return state, err
+		}
+
+		stat1000, err := eth.ReadPHY(MII_STAT1000)
+
+		if err != nil {
+			return state, err
+		}
+
+		// link partner abilities are 2 bits above local ones
+		switch common := ctrl1000 & (stat1000 >> 2); {
+		case common&(1<<CTRL1000_1000FULL) != 0:
+			state.Speed, state.FullDuplex = 1000, true
+			return state, nil
+		case common&(1<<CTRL1000_1000HALF) != 0:
+			state.Speed, state.FullDuplex = 1000, false
+			return state, nil
+		}
+	}
+
+	anar, err := eth.ReadPHY(MII_ANAR)
+
+	if err != nil {
+		return
+	}
+
+	anlpar, err := eth.ReadPHY(MII_ANLPAR)
+
+	if err != nil {
+		return
+	}
+
+	// highest common denominator
+	switch common := anar & anlpar; {
+	case common&(1<<ANAR_100FULL) != 0:
+		state.Speed, state.FullDuplex = 100, true
+	case common&(1<<ANAR_100HALF) != 0:
+		state.Speed, state.FullDuplex = 100, false
+	case common&(1<<ANAR_10FULL) != 0:
+		state.Speed, state.FullDuplex = 10, true
+	case common&(1<<ANAR_10HALF) != 0:
+		state.Speed, state.FullDuplex = 10, false
+	}
+
+	return
+}
+
+// LinkState returns the Ethernet interface link status.
+func (iface *Interface) LinkState() (LinkState, error) {
+	return iface.NIC.LinkState()
+}
+
+// LinkUp returns whether the Ethernet interface link is established, it does
+// not block.
+func (iface *Interface) LinkUp() bool {
+	state, err := iface.NIC.LinkState()
+	return err == nil && state.Up
+}
+
+// WaitLinkUp polls the Ethernet PHY link status until the link is established
+// or the argument context expires, the negotiated speed and duplex mode can
+// then be retrieved with LinkState().
+func (iface *Interface) WaitLinkUp(ctx context.Context) error {
+	ticker := time.NewTicker(linkPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if state, err := iface.NIC.LinkState(); err != nil || state.Up {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// monitorLink polls the Ethernet PHY link status, invoking link change
+// handlers on each transition, until the interface is closed.
+func (iface *Interface) monitorLink() {
+	for {
+		if state, err := iface.NIC.LinkState(); err == nil {
+			iface.link.Lock()
+
+			changed := iface.link.state == nil || *iface.link.state != state
+			handlers := iface.link.handlers
+			iface.link.state = &state
+
+			iface.link.Unlock()
+
+			if changed {
+				for _, fn := range handlers {
+					fn(state)
+				}
+			}
+		}
+
+		if !iface.sleep(LinkMonitorInterval) {
+			return
+		}
+	}
+}
+
+// OnLinkChange registers a handler invoked, in the background, with the
+// Ethernet PHY link status whenever it changes (up/down, speed or duplex
+// mode). The handler is first invoked with the current status.
+//
+// The link monitor polls the PHY every LinkMonitorInterval, it is started
+// with the first handler registration and stopped by Close().
+func (iface *Interface) OnLinkChange(fn func(LinkState)) error {
+	if iface.NIC.Device == nil {
+		return errors.New("missing physical interface")
+	}
+
+	iface.link.Lock()
+	defer iface.link.Unlock()
+
+	iface.link.handlers = append(iface.link.handlers, fn)
+
+	switch {
+	case len(iface.link.handlers) == 1:
+		go iface.monitorLink()
+	case iface.link.state != nil:
+		go fn(*iface.link.state)
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"time"
+)
+
+// phyResetTimeout is the maximum time waited for a PHY software reset
+// completion.
+const phyResetTimeout = 500 * time.Millisecond
+
+// PHYDriver represents an Ethernet PHY driver, handling model specific
+// initialization and link status reporting.
+type PHYDriver interface {
+	// Init configures the PHY, it is invoked after the ENET device
+	// initialization, and therefore after its board specific EnablePHY
+	// function.
+	Init(eth *NIC) error
+	// LinkState returns the PHY link status, the speed and duplex mode
+	// are only reported when the link is up.
+	LinkState(eth *NIC) (LinkState, error)
+}
+
+// GenericPHY implements a PHYDriver for IEEE 802.3 Clause 22 compliant PHYs,
+// its initialization leaves the board specific configuration untouched.
+type GenericPHY struct{}
+
+// Init implements PHYDriver.Init().
+func (GenericPHY) Init(eth *NIC) error {
+	return nil
+}
+
+// resetPHY performs an Ethernet PHY software reset.
+func resetPHY(eth *NIC) (err error) {
+	if err = eth.WritePHY(MII_BMCR, 1<<BMCR_RESET); err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(phyResetTimeout)
+
+	for time.Now().Before(deadline) {
+		bmcr, err := eth.ReadPHY(MII_BMCR)
+
+		if err != nil {
+			return err
+		}
+
+		if bmcr&(1<<BMCR_RESET) == 0 {
+			return nil
+		}
+
+		time.Sleep(linkPollInterval)
+	}
+
+	return errors.New("PHY reset timeout")
+}
+
+// Qualcomm Atheros AR8035 registers
+const (
+	AR8035_SPECIFIC_STATUS   = 0x11
+	SPECIFIC_STATUS_SPEED    = 14
+	SPECIFIC_STATUS_DUPLEX   = 13
+	SPECIFIC_STATUS_RESOLVED = 11
+	SPECIFIC_STATUS_LINK     = 10
+
+	AR8035_DEBUG_ADDR = 0x1d
+	AR8035_DEBUG_DATA = 0x1e
+
+	AR8035_DEBUG_ANALOG_TEST = 0x00
+	ANALOG_TEST_RX_CLK_DLY   = 15
+	AR8035_DEBUG_SERDES_TEST = 0x05
+	SERDES_TEST_TX_CLK_DLY   = 8
+
+	AR8035_MMD3_SMARTEEE_CTL3 = 0x805d
+	SMARTEEE_CTL3_LPI_EN      = 8
+
+	AR8035_MMD7_CLK25M    = 0x8016
+	CLK25M_SEL            = 2
+	CLK25M_SEL_MASK       = 0b111
+	CLK25M_SEL_125MHZ_PLL = 0b110
+)
+
+// AR8035 implements a PHYDriver for the Qualcomm Atheros AR8035 Gigabit PHY,
+// found on i.MX6 boards (e.g. SABRE, Nitrogen6) connected through RGMII. Its
+// initialization resets the PHY.
+type AR8035 struct {
+	// RxDelay enables the RGMII receive clock delay.
+	RxDelay bool
+	// TxDelay enables the RGMII transmit clock delay.
+	TxDelay bool
+	// Clock125MHz selects the 125MHz PLL output on the CLK_25M pin, for
+	// boards using it as ENET reference clock.
+	Clock125MHz bool
+	// DisableSmartEEE disables the PHY autonomous Energy Efficient
+	// Ethernet, which causes link instability with some link partners.
+	DisableSmartEEE bool
+}
+
+// setDebug updates an AR8035 debug register.
+func (phy *AR8035) setDebug(eth *NIC, ra uint16, mask uint16, val uint16) (err error) {
+	if err = eth.WritePHY(AR8035_DEBUG_ADDR, ra); err != nil {
+		return
+	}
+
+	data, err := eth.ReadPHY(AR8035_DEBUG_DATA)
+
+	if err != nil {
+		return
+	}
+
+	return eth.WritePHY(AR8035_DEBUG_DATA, data&^mask|val)
+}
+
+// setMMD updates an AR8035 MMD register.
+func (phy *AR8035) setMMD(eth *NIC, devad int, ra uint16, mask uint16, val uint16) (err error) {
+	data, err := eth.ReadMMD(devad, ra)
+
+	if err != nil {
+		return
+	}
+
+	return eth.WriteMMD(devad, ra, data&^mask|val)
+}
+
+// Init implements PHYDriver.Init().
+func (phy *AR8035) Init(eth *NIC) (err error) {
+	if err = resetPHY(eth); err != nil {
+		return
+	}
+
+	if phy.Clock125MHz {
+		if err = phy.setMMD(eth, 7, AR8035_MMD7_CLK25M, CLK25M_SEL_MASK<<CLK25M_SEL, CLK25M_SEL_125MHZ_PLL<<CLK25M_SEL); err != nil {
+			return
+		}
+	}
+
+	if phy.DisableSmartEEE {
+		if err = phy.setMMD(eth, 3, AR8035_MMD3_SMARTEEE_CTL3, 1<<SMARTEEE_CTL3_LPI_EN, 0); err != nil {
+			return
+		}
+	}
+
+	var rx, tx uint16
+
+	if phy.RxDelay {
+		rx = 1 << ANALOG_TEST_RX_CLK_DLY
+	}
+
+	if phy.TxDelay {
+		tx = 1 << SERDES_TEST_TX_CLK_DLY
+	}
+
+	if err = phy.setDebug(eth, AR8035_DEBUG_ANALOG_TEST, 1<<ANALOG_TEST_RX_CLK_DLY, rx); err != nil {
+		return
+	}
+
+	return phy.setDebug(eth, AR8035_DEBUG_SERDES_TEST, 1<<SERDES_TEST_TX_CLK_DLY, tx)
+}
+
+// LinkState implements PHYDriver.LinkState(), the link status is reported
+// from the PHY specific status register, which includes Gigabit speed
+// resolution.
+func (phy *AR8035) LinkState(eth *NIC) (state LinkState, err error) {
+	status, err := eth.ReadPHY(AR8035_SPECIFIC_STATUS)
+
+	if err != nil {
+		return
+	}
+
+	if status&(1<<SPECIFIC_STATUS_LINK) == 0 || status&(1<<SPECIFIC_STATUS_RESOLVED) == 0 {
+		return
+	}
+
+	state.Up = true
+	state.FullDuplex = status&(1<<SPECIFIC_STATUS_DUPLEX) != 0
+
+	switch (status >> SPECIFIC_STATUS_SPEED) & 0b11 {
+	case 0b00:
+		state.Speed = 10
+	case 0b01:
+		state.Speed = 100
+	case 0b10:
+		state.Speed = 1000
+	}
+
+	return
+}
+
+// Micrel KSZ8081 registers
+const (
+	KSZ8081_PHY_CTRL1      = 0x1e
+	PHY_CTRL1_LINK         = 8
+	PHY_CTRL1_MODE         = 0
+	PHY_CTRL1_MODE_MASK    = 0b111
+	PHY_CTRL1_MODE_10HALF  = 0b001
+	PHY_CTRL1_MODE_100HALF = 0b010
+	PHY_CTRL1_MODE_10FULL  = 0b101
+	PHY_CTRL1_MODE_100FULL = 0b110
+
+	KSZ8081_PHY_CTRL2  = 0x1f
+	PHY_CTRL2_HP_MDIX  = 15
+	PHY_CTRL2_RMII_50M = 7
+	PHY_CTRL2_LED      = 4
+	PHY_CTRL2_LED_MASK = 0b11
+)
+
+// KSZ8081 LED modes
+const (
+	// LED0: Link/Activity, LED1: Speed
+	KSZ8081LEDLinkActivity = 0b00
+	// LED0: Link, LED1: Activity
+	KSZ8081LEDLink = 0b01
+)
+
+// KSZ8081 implements a PHYDriver for the Micrel KSZ8081 10/100 PHY, found on
+// i.MX6UL/i.MX6ULL boards (e.g. MCIMX6ULL-EVK) connected through RMII. Its
+// initialization resets the PHY, restoring strapped (e.g. auto-negotiation)
+// defaults, and enables HP Auto MDI/MDI-X.
+type KSZ8081 struct {
+	// RMII50MHz selects the 50MHz RMII reference clock input (KSZ8081RNB
+	// only), rather than the 25MHz crystal.
+	RMII50MHz bool
+	// LEDMode selects the LED pins function.
+	LEDMode int
+}
+
+// Init implements PHYDriver.Init().
+func (phy *KSZ8081) Init(eth *NIC) (err error) {
+	if phy.LEDMode < 0 || phy.LEDMode > PHY_CTRL2_LED_MASK {
+		return errors.New("invalid LED mode")
+	}
+
+	if err = resetPHY(eth); err != nil {
+		return
+	}
+
+	ctrl2, err := eth.ReadPHY(KSZ8081_PHY_CTRL2)
+
+	if err != nil {
+		return
+	}
+
+	// preserve remaining fields (e.g. jabber, interrupt level)
+	ctrl2 &^= 1<<PHY_CTRL2_RMII_50M | PHY_CTRL2_LED_MASK<<PHY_CTRL2_LED
+	ctrl2 |= uint16(1<<PHY_CTRL2_HP_MDIX | phy.LEDMode<<PHY_CTRL2_LED)
+
+	if phy.RMII50MHz {
+		ctrl2 |= 1 << PHY_CTRL2_RMII_50M
+	}
+
+	return eth.WritePHY(KSZ8081_PHY_CTRL2, ctrl2)
+}
+
+// LinkState implements PHYDriver.LinkState(), the link status is reported
+// from the PHY control 1 register operation mode indication.
+func (phy *KSZ8081) LinkState(eth *NIC) (state LinkState, err error) {
+	ctrl1, err := eth.ReadPHY(KSZ8081_PHY_CTRL1)
+
+	if err != nil || ctrl1&(1<<PHY_CTRL1_LINK) == 0 {
+		return
+	}
+
+	state.Up = true
+
+	switch (ctrl1 >> PHY_CTRL1_MODE) & PHY_CTRL1_MODE_MASK {
+	case PHY_CTRL1_MODE_10HALF:
+		state.Speed = 10
+	case PHY_CTRL1_MODE_100HALF:
+		state.Speed = 100
+	case PHY_CTRL1_MODE_10FULL:
+		state.Speed, state.FullDuplex = 10, true
+	case PHY_CTRL1_MODE_100FULL:
+		state.Speed, state.FullDuplex = 100, true
+	}
+
+	return
+}
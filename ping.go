@@ -0,0 +1,213 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// Ping defaults
+var (
+	// PingInterval is the interval between successive echo requests.
+	PingInterval = 1 * time.Second
+	// PingTimeout is the timeout for each echo reply.
+	PingTimeout = 1 * time.Second
+)
+
+// pingPayloadSize matches the default data size of ping(8).
+const pingPayloadSize = 56
+
+// PingStats represents ICMP echo statistics.
+type PingStats struct {
+	// Address is the pinged IP address.
+	Address string
+
+	// Sent is the number of echo requests sent.
+	Sent int
+	// Received is the number of echo replies received.
+	Received int
+
+	// Min is the minimum round-trip time.
+	Min time.Duration
+	// Max is the maximum round-trip time.
+	Max time.Duration
+	// Avg is the average round-trip time.
+	Avg time.Duration
+}
+
+func (s *PingStats) add(rtt time.Duration) {
+	if s.Received == 0 || rtt < s.Min {
+		s.Min = rtt
+	}
+
+	if rtt > s.Max {
+		s.Max = rtt
+	}
+
+	s.Avg = (s.Avg*time.Duration(s.Received) + rtt) / time.Duration(s.Received+1)
+	s.Received++
+}
+
+// Loss returns the packet loss percentage.
+func (s *PingStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+
+	return float64(s.Sent-s.Received) / float64(s.Sent) * 100
+}
+
+// echoRequest returns an ICMP echo request message, its identifier and
+// checksum are set by the stack.
+func echoRequest(proto tcpip.NetworkProtocolNumber, seq uint16) []byte {
+	if proto == ipv4.ProtocolNumber {
+		msg := header.ICMPv4(make([]byte, header.ICMPv4MinimumSize+pingPayloadSize))
+		msg.SetType(header.ICMPv4Echo)
+		msg.SetSequence(seq)
+		return msg
+	}
+
+	msg := header.ICMPv6(make([]byte, header.ICMPv6EchoMinimumSize+pingPayloadSize))
+	msg.SetType(header.ICMPv6EchoRequest)
+	msg.SetSequence(seq)
+
+	return msg
+}
+
+// isEchoReply returns whether the argument ICMP message is the echo reply
+// for the argument sequence number.
+func isEchoReply(proto tcpip.NetworkProtocolNumber, buf []byte, seq uint16) bool {
+	if len(buf) < header.ICMPv4MinimumSize {
+		return false
+	}
+
+	if proto == ipv4.ProtocolNumber {
+		msg := header.ICMPv4(buf)
+		return msg.Type() == header.ICMPv4EchoReply && msg.Sequence() == seq
+	}
+
+	msg := header.ICMPv6(buf)
+
+	return msg.Type() == header.ICMPv6EchoReply && msg.Sequence() == seq
+}
+
+func echo(ctx context.Context, conn *gonet.UDPConn, proto tcpip.NetworkProtocolNumber, seq uint16, buf []byte) (rtt time.Duration, err error) {
+	deadline := time.Now().Add(PingTimeout)
+
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn.SetDeadline(deadline)
+	start := time.Now()
+
+	if _, err = conn.Write(echoRequest(proto, seq)); err != nil {
+		return
+	}
+
+	for {
+		n, err := conn.Read(buf)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if isEchoReply(proto, buf[:n], seq) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// Ping sends count ICMP echo requests, spaced by PingInterval, to the
+// argument host and returns the resulting round-trip statistics. The host
+// can be either an IP address or a name resolved through LookupHost().
+//
+// Unanswered requests, within PingTimeout, are accounted as lost. Statistics
+// are returned, along with the context error, also when the context is
+// cancelled.
+func (iface *Interface) Ping(ctx context.Context, host string, count int) (stats *PingStats, err error) {
+	if count <= 0 {
+		return nil, errors.New("invalid count")
+	}
+
+	addrs, err := iface.dialAddresses(ctx, "ip", host)
+
+	if err != nil {
+		return
+	}
+
+	ip := addrs[0]
+	proto, transport := ipv4.ProtocolNumber, icmp.ProtocolNumber4
+
+	if ip.To4() == nil {
+		proto, transport = ipv6.ProtocolNumber, icmp.ProtocolNumber6
+	}
+
+	var wq waiter.Queue
+
+	ep, tcpErr := iface.Stack.NewEndpoint(transport, proto, &wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (icmp): %v", tcpErr)
+	}
+
+	if tcpErr := ep.Connect(tcpip.FullAddress{Addr: tcpip.Address(ip)}); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("connect error (icmp): %v", tcpErr)
+	}
+
+	conn := gonet.NewUDPConn(iface.Stack, &wq, ep)
+	defer conn.Close()
+
+	stats = &PingStats{Address: ip.String()}
+	buf := make([]byte, MaxMTU)
+
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+				return stats, ctx.Err()
+			case <-time.After(PingInterval):
+			}
+		}
+
+		rtt, err := echo(ctx, conn, proto, uint16(seq), buf)
+		stats.Sent++
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+
+			var netErr net.Error
+
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			return stats, err
+		}
+
+		stats.add(rtt)
+	}
+
+	return
+}
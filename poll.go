@@ -0,0 +1,99 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"runtime"
+)
+
+// ENET receive descriptor active register
+const (
+	enetRDAR       = 0x0010
+	enetRDARActive = 24
+)
+
+// DefaultBusyPollSpin is the default number of empty polls performed by
+// BusyPoll() before yielding the processor.
+const DefaultBusyPollSpin = 64
+
+// Poll processes all frames pending in the ENET receive ring, passing them
+// to the device RxHandler, and returns their number. It never blocks.
+//
+// Poll allows caller driven reception, in place of enet.ENET.Start(), which
+// must not be used concurrently as frames would be split between the two.
+func (eth *NIC) Poll() (n int) {
+	dev := eth.Device
+
+	if dev == nil {
+		return
+	}
+
+	writeRegister(dev.Base+enetRDAR, 1<<enetRDARActive)
+
+	for {
+		buf := dev.Rx()
+
+		if buf == nil {
+			return
+		}
+
+		if handler := dev.RxHandler; handler != nil {
+			handler(buf)
+		}
+
+		n++
+	}
+}
+
+// Poll processes all frames pending on the interface (see NIC.Poll()).
+func (iface *Interface) Poll() int {
+	return iface.NIC.Poll()
+}
+
+// BusyPoll continuously polls the interface for received frames (see
+// NIC.Poll()), yielding the processor only after spin consecutive empty
+// polls, until the context is done or the interface is closed. A zero spin
+// selects DefaultBusyPollSpin.
+//
+// Compared to enet.ENET.Start(), which yields after every poll, reception
+// latency is traded for processor time and it is therefore meant for
+// latency critical applications running it on a dedicated goroutine.
+func (iface *Interface) BusyPoll(ctx context.Context, spin int) error {
+	if iface.NIC.Device == nil {
+		return errors.New("missing physical interface")
+	}
+
+	if spin <= 0 {
+		spin = DefaultBusyPollSpin
+	}
+
+	for idle := 0; ; {
+		if iface.NIC.Poll() > 0 {
+			idle = 0
+			continue
+		}
+
+		if idle++; idle < spin {
+			continue
+		}
+
+		idle = 0
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-iface.done:
+			return errors.New("interface closed")
+		default:
+			runtime.Gosched()
+		}
+	}
+}
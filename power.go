@@ -0,0 +1,133 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+// IEEE 802.3 Clause 45 Energy Efficient Ethernet registers
+const (
+	MMD_PCS          = 3
+	PCS_EEE_ABLE     = 0x14
+	MMD_AN           = 7
+	AN_EEE_ADV       = 0x3c
+	AN_EEE_LPABLE    = 0x3d
+	EEE_100BASE_TX   = 1
+	EEE_1000BASE_T   = 2
+	eeeSupportedMask = 1<<EEE_100BASE_TX | 1<<EEE_1000BASE_T
+)
+
+// restartAutoNegotiation restarts auto-negotiation, when enabled, to apply
+// advertisement changes.
+func (eth *NIC) restartAutoNegotiation() (err error) {
+	bmcr, err := eth.ReadPHY(MII_BMCR)
+
+	if err != nil || bmcr&(1<<BMCR_ANENABLE) == 0 {
+		return
+	}
+
+	return eth.WritePHY(MII_BMCR, bmcr|1<<BMCR_ANRESTART)
+}
+
+// SetEEE enables, or disables, advertisement of Energy Efficient Ethernet
+// (IEEE 802.3az) for all modes supported by the PHY, restarting
+// auto-negotiation.
+//
+// The ENET MAC does not signal Low Power Idle, EEE is therefore only effective
+// with PHYs entering it autonomously (e.g. AR8035 SmartEEE). The PHY must
+// implement Clause 45 register access (see ReadMMD()).
+func (eth *NIC) SetEEE(enable bool) (err error) {
+	var adv uint16
+
+	if enable {
+		if adv, err = eth.ReadMMD(MMD_PCS, PCS_EEE_ABLE); err != nil {
+			return
+		}
+
+		adv &= eeeSupportedMask
+	}
+
+	if err = eth.WriteMMD(MMD_AN, AN_EEE_ADV, adv); err != nil {
+		return
+	}
+
+	return eth.restartAutoNegotiation()
+}
+
+// EEEActive returns whether Energy Efficient Ethernet has been negotiated
+// with the link partner.
+func (eth *NIC) EEEActive() (active bool, err error) {
+	state, err := eth.LinkState()
+
+	if err != nil || !state.Up {
+		return
+	}
+
+	adv, err := eth.ReadMMD(MMD_AN, AN_EEE_ADV)
+
+	if err != nil {
+		return
+	}
+
+	lp, err := eth.ReadMMD(MMD_AN, AN_EEE_LPABLE)
+
+	if err != nil {
+		return
+	}
+
+	switch common := adv & lp; state.Speed {
+	case 100:
+		active = common&(1<<EEE_100BASE_TX) != 0
+	case 1000:
+		active = common&(1<<EEE_1000BASE_T) != 0
+	}
+
+	return
+}
+
+// PowerDown puts the Ethernet PHY in power-down mode, the link is dropped
+// until PowerUp() is invoked. The PHY remains accessible through MDIO.
+func (eth *NIC) PowerDown() (err error) {
+	bmcr, err := eth.ReadPHY(MII_BMCR)
+
+	if err != nil {
+		return
+	}
+
+	return eth.WritePHY(MII_BMCR, bmcr|1<<BMCR_POWER_DOWN)
+}
+
+// PowerUp resumes normal operation of the Ethernet PHY, after PowerDown(),
+// restarting auto-negotiation when enabled.
+func (eth *NIC) PowerUp() (err error) {
+	bmcr, err := eth.ReadPHY(MII_BMCR)
+
+	if err != nil {
+		return
+	}
+
+	if err = eth.WritePHY(MII_BMCR, bmcr&^(1<<BMCR_POWER_DOWN)); err != nil {
+		return
+	}
+
+	return eth.restartAutoNegotiation()
+}
+
+// SetEEE enables, or disables, Energy Efficient Ethernet advertisement (see
+// NIC.SetEEE()).
+func (iface *Interface) SetEEE(enable bool) error {
+	return iface.NIC.SetEEE(enable)
+}
+
+// PowerDown puts the Ethernet PHY in power-down mode (see NIC.PowerDown()).
+func (iface *Interface) PowerDown() error {
+	return iface.NIC.PowerDown()
+}
+
+// PowerUp resumes normal operation of the Ethernet PHY (see NIC.PowerUp()).
+func (iface *Interface) PowerUp() error {
+	return iface.NIC.PowerUp()
+}
@@ -0,0 +1,542 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// PTP constants (IEEE 1588-2008)
+const (
+	// PTPProtocolNumber is the PTP over IEEE 802.3 EtherType (Annex F).
+	PTPProtocolNumber tcpip.NetworkProtocolNumber = 0x88f7
+
+	// DefaultPTPStepThreshold is the default offset above which the
+	// clock is stepped rather than slewed.
+	DefaultPTPStepThreshold = 1 * time.Millisecond
+	// DefaultPTPAnnounceTimeout is the default announce receipt timeout,
+	// after which the master is considered lost.
+	DefaultPTPAnnounceTimeout = 6 * time.Second
+
+	// PI servo constants
+	ptpKp = 0.7
+	ptpKi = 0.3
+
+	// minimum Ethernet frame length, excluding the FCS
+	ptpMinFrameLength = 60
+
+	// received messages queue length
+	ptpQueueLength = 16
+)
+
+// PTPMulticastAddress is the PTP primary multicast address for IEEE 802.3
+// transport (Annex F.3).
+var PTPMulticastAddress = net.HardwareAddr{0x01, 0x1b, 0x19, 0x00, 0x00, 0x00}
+
+// IEEE 1588-2008 - 13.3 message header
+const (
+	ptpVersion      = 2
+	ptpHeaderLength = 34
+
+	ptpSync      = 0x0
+	ptpDelayReq  = 0x1
+	ptpFollowUp  = 0x8
+	ptpDelayResp = 0x9
+	ptpAnnounce  = 0xb
+
+	ptpTwoStep = 1 << 9
+
+	ptpTimestampLength = 10
+	ptpPortIDLength    = 10
+
+	ptpSyncLength      = ptpHeaderLength + ptpTimestampLength
+	ptpDelayRespLength = ptpSyncLength + ptpPortIDLength
+	ptpAnnounceLength  = 64
+
+	// IEEE 1588-2008 - 13.5 Announce message, from grandmasterPriority1
+	// to grandmasterIdentity, in data set comparison order (9.3.4)
+	ptpAnnounceDataset    = 47
+	ptpAnnounceDatasetEnd = 61
+)
+
+// PTPState represents the PTP port state.
+type PTPState int
+
+// PTP port states (IEEE 1588-2008 - 9.2.5)
+const (
+	PTPStateListening PTPState = iota
+	PTPStateUncalibrated
+	PTPStateSlave
+)
+
+// String returns the port state name.
+func (s PTPState) String() string {
+	switch s {
+	case PTPStateListening:
+		return "LISTENING"
+	case PTPStateUncalibrated:
+		return "UNCALIBRATED"
+	case PTPStateSlave:
+		return "SLAVE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// PTPOptions represents PTP ordinary clock configuration options.
+type PTPOptions struct {
+	// Domain is the PTP domain number.
+	Domain uint8
+
+	// StepThreshold is the offset above which the clock is stepped, 0
+	// selects DefaultPTPStepThreshold.
+	StepThreshold time.Duration
+	// AnnounceTimeout is the announce receipt timeout, 0 selects
+	// DefaultPTPAnnounceTimeout.
+	AnnounceTimeout time.Duration
+}
+
+// PTPStatus represents the PTP ordinary clock synchronization status.
+type PTPStatus struct {
+	// State is the port state.
+	State PTPState
+	// Master is the master port identity, empty when no master is
+	// selected.
+	Master string
+
+	// Offset is the last measured offset from master.
+	Offset time.Duration
+	// Delay is the mean path delay to master.
+	Delay time.Duration
+	// Frequency is the clock frequency adjustment, in parts per billion.
+	Frequency float64
+
+	// Updated is the last synchronization time.
+	Updated time.Time
+}
+
+type ptpMessage struct {
+	buf []byte
+	// receive timestamp
+	ts int64
+}
+
+// PTPSlave represents a PTP ordinary clock, in slave-only mode, using the
+// ENET IEEE 1588 timer as local clock.
+//
+// The ordinary clock implements the end-to-end delay mechanism, with one-step
+// and two-step masters, over IEEE 802.3 transport (Annex F). The master is
+// selected among announcing ones with the best master clock data set
+// comparison.
+//
+// Event message timestamps are timer-sampled (software) timestamps, taken
+// from the timer by the driver on frame reception and transmission.
+//
+// ENET per-frame hardware timestamping is not supported, as it requires
+// ECR.EN1588 and enhanced buffer descriptors, while the tamago driver clears
+// the former and its private DMA rings use legacy descriptors. The
+// synchronization accuracy is therefore bound by the jitter of the driver
+// receive and transmit latency and sub-microsecond accuracy is not
+// achievable.
+type PTPSlave struct {
+	sync.Mutex
+
+	iface *Interface
+	clock *PTPClock
+	opts  PTPOptions
+
+	// local port identity
+	identity []byte
+
+	// selected master port identity and data set
+	master    []byte
+	dataset   []byte
+	announced time.Time
+
+	// two-step Sync awaiting Follow_Up
+	syncSeq  uint16
+	syncCorr int64
+	syncRx   int64
+	pending  bool
+
+	// last Sync origin and receive timestamps
+	t1   int64
+	t2   int64
+	last int64
+
+	// outstanding Delay_Req
+	reqSeq     uint16
+	reqT1      int64
+	reqT2      int64
+	reqTx      int64
+	reqPending bool
+
+	// mean path delay
+	delay     int64
+	haveDelay bool
+	// servo integral term
+	drift float64
+
+	status PTPStatus
+
+	rx   chan ptpMessage
+	done chan struct{}
+	once sync.Once
+}
+
+// ptpTimestamp decodes a PTP timestamp in nanoseconds.
+func ptpTimestamp(buf []byte) int64 {
+	sec := uint64(binary.BigEndian.Uint16(buf[0:2]))<<32 | uint64(binary.BigEndian.Uint32(buf[2:6]))
+	return int64(sec)*int64(time.Second) + int64(binary.BigEndian.Uint32(buf[6:10]))
+}
+
+// putPTPTimestamp encodes a PTP timestamp from nanoseconds.
+func putPTPTimestamp(buf []byte, t int64) {
+	sec := uint64(t / int64(time.Second))
+
+	binary.BigEndian.PutUint16(buf[0:2], uint16(sec>>32))
+	binary.BigEndian.PutUint32(buf[2:6], uint32(sec))
+	binary.BigEndian.PutUint32(buf[6:10], uint32(t%int64(time.Second)))
+}
+
+// StartPTP starts a PTP ordinary clock, in slave-only mode, synchronizing
+// the ENET IEEE 1588 timer to the best master on the link. The timer is
+// enabled with its default rate when not already enabled (see
+// EnablePTPClock()).
+func (iface *Interface) StartPTP(opts PTPOptions) (s *PTPSlave, err error) {
+	if iface.NIC == nil || iface.NIC.Device == nil {
+		return nil, errors.New("missing physical interface")
+	}
+
+	if opts.StepThreshold == 0 {
+		opts.StepThreshold = DefaultPTPStepThreshold
+	}
+
+	if opts.AnnounceTimeout == 0 {
+		opts.AnnounceTimeout = DefaultPTPAnnounceTimeout
+	}
+
+	clock := iface.NIC.PTPClock()
+
+	if clock == nil {
+		if clock, err = iface.NIC.EnablePTPClock(0); err != nil {
+			return
+		}
+	}
+
+	mac := iface.NIC.MAC
+
+	s = &PTPSlave{
+		iface: iface,
+		clock: clock,
+		opts:  opts,
+		// EUI-64 clock identity (7.5.2.2.2) and port number 1
+		identity: []byte{mac[0], mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5], 0x00, 0x01},
+		rx:       make(chan ptpMessage, ptpQueueLength),
+		done:     make(chan struct{}),
+	}
+
+	err = iface.HandleEtherType(PTPProtocolNumber, func(frame []byte, _ func([]byte) error) {
+		// sample the receive timestamp as early as possible
+		ts := clock.timestamp()
+
+		select {
+		case s.rx <- ptpMessage{buf: append([]byte{}, frame...), ts: ts}:
+		default:
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	iface.NIC.AddMulticast(PTPMulticastAddress)
+
+	go s.run()
+
+	return
+}
+
+func (s *PTPSlave) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case m := <-s.rx:
+			s.handle(m)
+		case <-ticker.C:
+			s.Lock()
+
+			if s.master != nil && time.Since(s.announced) > s.opts.AnnounceTimeout {
+				s.selectMaster(nil, nil)
+			}
+
+			s.Unlock()
+		}
+	}
+}
+
+// selectMaster selects a new master port, resetting the synchronization
+// state, the caller must hold the slave lock.
+func (s *PTPSlave) selectMaster(id []byte, dataset []byte) {
+	s.master = id
+	s.dataset = dataset
+	s.pending = false
+	s.reqPending = false
+	s.last = 0
+	s.delay = 0
+	s.haveDelay = false
+	s.drift = 0
+
+	s.status = PTPStatus{
+		State:     PTPStateListening,
+		Frequency: s.status.Frequency,
+	}
+
+	if id != nil {
+		s.status.State = PTPStateUncalibrated
+		s.status.Master = hex.EncodeToString(id[0:8]) + "-" + hex.EncodeToString(id[8:10])
+	}
+}
+
+func (s *PTPSlave) handle(m ptpMessage) {
+	if len(m.buf) < header.EthernetMinimumSize+ptpHeaderLength {
+		return
+	}
+
+	msg := m.buf[header.EthernetMinimumSize:]
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+
+	if msg[1]&0x0f != ptpVersion || msg[4] != s.opts.Domain || length < ptpHeaderLength || length > len(msg) {
+		return
+	}
+
+	msg = msg[:length]
+	src := msg[20:30]
+	seq := binary.BigEndian.Uint16(msg[30:32])
+	flags := binary.BigEndian.Uint16(msg[6:8])
+	corr := int64(binary.BigEndian.Uint64(msg[8:16])) >> 16
+
+	s.Lock()
+	defer s.Unlock()
+
+	if bytes.Equal(src[0:8], s.identity[0:8]) {
+		return
+	}
+
+	msgType := msg[0] & 0x0f
+
+	if msgType == ptpAnnounce {
+		s.announce(src, msg)
+		return
+	}
+
+	if !bytes.Equal(src, s.master) {
+		return
+	}
+
+	switch msgType {
+	case ptpSync:
+		if length < ptpSyncLength {
+			return
+		}
+
+		if flags&ptpTwoStep == 0 {
+			s.pending = false
+			s.synchronize(ptpTimestamp(msg[34:44])+corr, m.ts)
+			return
+		}
+
+		s.syncSeq = seq
+		s.syncCorr = corr
+		s.syncRx = m.ts
+		s.pending = true
+	case ptpFollowUp:
+		if length < ptpSyncLength || !s.pending || seq != s.syncSeq {
+			return
+		}
+
+		s.pending = false
+		s.synchronize(ptpTimestamp(msg[34:44])+s.syncCorr+corr, s.syncRx)
+	case ptpDelayResp:
+		if length < ptpDelayRespLength || !s.reqPending || seq != s.reqSeq {
+			return
+		}
+
+		if !bytes.Equal(msg[44:54], s.identity) {
+			return
+		}
+
+		s.reqPending = false
+		t4 := ptpTimestamp(msg[34:44]) - corr
+
+		delay := ((s.reqT2 - s.reqT1) + (t4 - s.reqTx)) / 2
+
+		// timestamping jitter can exceed very short path delays
+		if delay < 0 {
+			delay = 0
+		}
+
+		if !s.haveDelay {
+			s.delay = delay
+			s.haveDelay = true
+		} else {
+			s.delay = (7*s.delay + delay) / 8
+		}
+
+		s.status.Delay = time.Duration(s.delay)
+	}
+}
+
+// announce processes an Announce message, selecting its sender as master
+// when it has a better data set than the current one, the caller must hold
+// the slave lock.
+func (s *PTPSlave) announce(src []byte, msg []byte) {
+	if len(msg) < ptpAnnounceLength {
+		return
+	}
+
+	dataset := msg[ptpAnnounceDataset:ptpAnnounceDatasetEnd]
+
+	switch {
+	case bytes.Equal(src, s.master):
+	case s.master == nil || bytes.Compare(dataset, s.dataset) < 0:
+		s.selectMaster(append([]byte{}, src...), nil)
+	default:
+		return
+	}
+
+	s.dataset = append(s.dataset[:0], dataset...)
+	s.announced = time.Now()
+}
+
+// synchronize processes a Sync origin and receive timestamp pair, the caller
+// must hold the slave lock.
+func (s *PTPSlave) synchronize(t1 int64, t2 int64) {
+	prev := s.last
+	s.t1 = t1
+	s.t2 = t2
+	s.last = t1
+
+	if !s.haveDelay {
+		s.delayRequest()
+		return
+	}
+
+	offset := t2 - t1 - s.delay
+
+	s.status.Offset = time.Duration(offset)
+	s.status.Updated = time.Now()
+
+	if prev == 0 || offset > int64(s.opts.StepThreshold) || offset < -int64(s.opts.StepThreshold) {
+		s.clock.Adjust(-time.Duration(offset))
+		s.status.State = PTPStateUncalibrated
+		// discard the Sync and Delay_Req timestamps taken before the
+		// step
+		s.last = 0
+		s.reqPending = false
+		return
+	}
+
+	defer s.delayRequest()
+
+	interval := float64(t1-prev) / float64(time.Second)
+
+	if interval <= 0 {
+		return
+	}
+
+	s.drift += ptpKi * float64(offset) / interval
+	ppb := -(ptpKp*float64(offset)/interval + s.drift)
+
+	switch {
+	case ppb > MaxPTPFrequencyAdjustment:
+		ppb = MaxPTPFrequencyAdjustment
+	case ppb < -MaxPTPFrequencyAdjustment:
+		ppb = -MaxPTPFrequencyAdjustment
+	}
+
+	if err := s.clock.AdjustFrequency(ppb); err != nil {
+		return
+	}
+
+	s.status.State = PTPStateSlave
+	s.status.Frequency = ppb
+}
+
+// delayRequest transmits a Delay_Req message, the caller must hold the slave
+// lock.
+func (s *PTPSlave) delayRequest() {
+	nic := s.iface.NIC
+
+	// padded to the minimum Ethernet frame size
+	frame := make([]byte, ptpMinFrameLength)
+
+	copy(frame[0:6], PTPMulticastAddress)
+	copy(frame[6:12], nic.MAC)
+	binary.BigEndian.PutUint16(frame[12:14], uint16(PTPProtocolNumber))
+
+	msg := frame[header.EthernetMinimumSize:]
+
+	s.reqSeq++
+
+	msg[0] = ptpDelayReq
+	msg[1] = ptpVersion
+	binary.BigEndian.PutUint16(msg[2:4], ptpSyncLength)
+	msg[4] = s.opts.Domain
+	copy(msg[20:30], s.identity)
+	binary.BigEndian.PutUint16(msg[30:32], s.reqSeq)
+	msg[32] = 0x01 // controlField (Delay_Req)
+	msg[33] = 0x7f // logMessageInterval (unspecified)
+	putPTPTimestamp(msg[34:44], s.clock.timestamp())
+
+	ts, err := nic.TransmitTimestamp(frame)
+
+	if err != nil {
+		return
+	}
+
+	s.reqTx = ts.UnixNano()
+	s.reqT1 = s.t1
+	s.reqT2 = s.t2
+	s.reqPending = true
+}
+
+// Status returns the ordinary clock synchronization status.
+func (s *PTPSlave) Status() PTPStatus {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.status
+}
+
+// Close stops the ordinary clock, the ENET IEEE 1588 timer is left running
+// (see DisablePTPClock()).
+func (s *PTPSlave) Close() (err error) {
+	s.once.Do(func() {
+		close(s.done)
+
+		s.iface.RemoveEtherTypeHandler(PTPProtocolNumber)
+		s.iface.NIC.RemoveMulticast(PTPMulticastAddress)
+	})
+
+	return
+}
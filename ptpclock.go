@@ -0,0 +1,296 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/soc/nxp/enet"
+)
+
+// ENET IEEE 1588 timer registers
+const (
+	enetATCR     = 0x0400
+	ATCR_CAPTURE = 11
+	ATCR_PEREN   = 4
+	ATCR_EN      = 0
+
+	enetATVR  = 0x0404
+	enetATPER = 0x040c
+	enetATCOR = 0x0410
+
+	enetATINC     = 0x0414
+	ATINC_INCCORR = 8
+	ATINC_INC     = 0
+
+	// maximum timer increment (ATINC INC field)
+	maxPTPIncrement = 0x7f
+	// maximum correction period (ATCOR COR field)
+	maxPTPCorrection = 0x7fffffff
+)
+
+// MaxPTPFrequencyAdjustment is the maximum frequency adjustment, in parts per
+// billion, accepted by PTPClock.AdjustFrequency().
+const MaxPTPFrequencyAdjustment = 500000
+
+// ptpSampleInterval is the timer sampling interval for seconds tracking, it
+// must be lower than the timer period (1 second).
+const ptpSampleInterval = 250 * time.Millisecond
+
+// PTPClock represents the ENET IEEE 1588 timer, used as PTP local clock. The
+// clock time is read from the timer value register (ATVR), captured through
+// the timer control register (ATCR), and adjusted through the timer
+// correction registers (ATCOR, ATINC).
+//
+// The timer counts nanoseconds within a second, seconds are counted by
+// detecting the timer wrap on periodic captures, as the timer period event
+// flag (EIR.TS_TIMER) is cleared by the tamago driver MDIO transactions.
+//
+// Only the clock is provided by the hardware, frames are not timestamped by
+// it (see PTPSlave).
+type PTPClock struct {
+	sync.Mutex
+
+	dev *enet.ENET
+
+	// nominal timer increment, in nanoseconds
+	inc uint32
+	// nominal increment error, in parts per billion
+	base float64
+	// frequency adjustment, in parts per billion
+	ppb float64
+
+	// seconds count
+	sec int64
+	// last sampled timer value
+	last uint32
+
+	done chan struct{}
+}
+
+// EnablePTPClock enables the ENET IEEE 1588 timer, clocked at the argument
+// rate in Hz, and returns its PTP clock. A zero rate selects the ENET module
+// clock (enet.ENET.Clock()).
+//
+// The timer increment is rounded to whole nanoseconds, the resulting rate
+// error is compensated through the timer correction mechanism. The increment
+// is only exact with rates dividing 1 GHz (e.g. 25, 50 or 125 MHz).
+func (eth *NIC) EnablePTPClock(rate uint32) (c *PTPClock, err error) {
+	dev := eth.Device
+
+	if dev == nil {
+		return nil, errors.New("missing physical interface")
+	}
+
+	if eth.ptp != nil {
+		return nil, errors.New("PTP clock already enabled")
+	}
+
+	if rate == 0 {
+		if dev.Clock == nil {
+			return nil, errors.New("missing clock retrieval function")
+		}
+
+		rate = dev.Clock()
+	}
+
+	if rate == 0 {
+		return nil, errors.New("invalid clock rate")
+	}
+
+	inc := uint32((uint64(time.Second) + uint64(rate)/2) / uint64(rate))
+
+	// the corrected increment must fit the INC field as well
+	if inc < 2 || inc > maxPTPIncrement-1 {
+		return nil, errors.New("unsupported clock rate")
+	}
+
+	c = &PTPClock{
+		dev:  dev,
+		inc:  inc,
+		base: float64(inc)*float64(rate) - float64(time.Second),
+		done: make(chan struct{}),
+	}
+
+	dev.Lock()
+	writeRegister(dev.Base+enetATCR, 0)
+	writeRegister(dev.Base+enetATINC, inc<<ATINC_INCCORR|inc<<ATINC_INC)
+	writeRegister(dev.Base+enetATPER, uint32(time.Second))
+	writeRegister(dev.Base+enetATCOR, 0)
+	writeRegister(dev.Base+enetATVR, 0)
+	writeRegister(dev.Base+enetATCR, 1<<ATCR_PEREN|1<<ATCR_EN)
+	dev.Unlock()
+
+	if err = c.AdjustFrequency(0); err != nil {
+		return
+	}
+
+	eth.ptp = c
+
+	go c.run()
+
+	return
+}
+
+// DisablePTPClock disables the ENET IEEE 1588 timer.
+func (eth *NIC) DisablePTPClock() {
+	c := eth.ptp
+
+	if c == nil {
+		return
+	}
+
+	eth.ptp = nil
+	eth.rxTimestamps = false
+	eth.txTimestamps = false
+	close(c.done)
+
+	c.dev.Lock()
+	writeRegister(c.dev.Base+enetATCR, 0)
+	c.dev.Unlock()
+}
+
+// PTPClock returns the ENET IEEE 1588 timer PTP clock, nil when disabled
+// (see EnablePTPClock()).
+func (eth *NIC) PTPClock() *PTPClock {
+	return eth.ptp
+}
+
+// capture returns the current timer value, the caller must hold the device
+// lock.
+func (c *PTPClock) capture() uint32 {
+	atcr := c.dev.Base + enetATCR
+	writeRegister(atcr, readRegister(atcr)|1<<ATCR_CAPTURE)
+
+	// allow the capture to propagate across clock domains
+	for start := time.Now(); time.Since(start) < time.Microsecond; {
+	}
+
+	return readRegister(c.dev.Base + enetATVR)
+}
+
+// now returns the clock time in nanoseconds, the caller must hold the clock
+// lock.
+func (c *PTPClock) now() int64 {
+	c.dev.Lock()
+	ns := c.capture()
+	c.dev.Unlock()
+
+	if ns < c.last {
+		c.sec++
+	}
+
+	c.last = ns
+
+	return c.sec*int64(time.Second) + int64(ns)
+}
+
+// set sets the clock time in nanoseconds, the caller must hold the clock
+// lock.
+func (c *PTPClock) set(t int64) {
+	ns := uint32(t % int64(time.Second))
+
+	c.dev.Lock()
+	writeRegister(c.dev.Base+enetATVR, ns)
+	c.dev.Unlock()
+
+	c.sec = t / int64(time.Second)
+	c.last = ns
+}
+
+// timestamp returns the clock time in nanoseconds.
+func (c *PTPClock) timestamp() int64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now()
+}
+
+func (c *PTPClock) run() {
+	ticker := time.NewTicker(ptpSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.timestamp()
+		}
+	}
+}
+
+// Time returns the clock time.
+func (c *PTPClock) Time() time.Time {
+	return time.Unix(0, c.timestamp())
+}
+
+// SetTime sets the clock time.
+func (c *PTPClock) SetTime(t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.set(t.UnixNano())
+}
+
+// Adjust steps the clock time by the argument offset.
+func (c *PTPClock) Adjust(offset time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.set(c.now() + int64(offset))
+}
+
+// AdjustFrequency sets the clock frequency adjustment, in parts per billion,
+// relative to its nominal rate.
+func (c *PTPClock) AdjustFrequency(ppb float64) (err error) {
+	if math.Abs(ppb) > MaxPTPFrequencyAdjustment {
+		return errors.New("invalid frequency adjustment")
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	corr := ppb - c.base
+	inc := c.inc
+	period := math.Round(float64(time.Second) / (float64(c.inc) * math.Abs(corr)))
+
+	switch {
+	case corr == 0 || period > maxPTPCorrection:
+		period = 0
+	case corr > 0:
+		inc = c.inc + 1
+	default:
+		inc = c.inc - 1
+	}
+
+	if period != 0 && period < 1 {
+		period = 1
+	}
+
+	c.dev.Lock()
+	writeRegister(c.dev.Base+enetATCOR, uint32(period))
+	writeRegister(c.dev.Base+enetATINC, inc<<ATINC_INCCORR|c.inc<<ATINC_INC)
+	c.dev.Unlock()
+
+	c.ppb = ppb
+
+	return
+}
+
+// Frequency returns the clock frequency adjustment, in parts per billion.
+func (c *PTPClock) Frequency() float64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.ppb
+}
@@ -0,0 +1,204 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// QoS represents the priority marking of outgoing traffic.
+type QoS struct {
+	// PCP is the IEEE 802.1p Priority Code Point (0-7), frames are
+	// priority tagged (IEEE 802.1Q tag with VLAN ID 0) when not 0. On
+	// VLAN sub-interfaces (see AddVLAN()) it is set in the VLAN tag.
+	PCP uint8
+	// DSCP is the Differentiated Services Code Point (0-63) set in the
+	// IPv4 or IPv6 header (RFC 2474 - 3), the header is left unchanged
+	// when 0.
+	DSCP uint8
+}
+
+func (q *QoS) valid() bool {
+	return q.PCP <= 7 && q.DSCP <= 63
+}
+
+// qosFlow identifies the outgoing packets of a connection.
+type qosFlow struct {
+	transport tcpip.TransportProtocolNumber
+	srcAddr   tcpip.Address
+	srcPort   uint16
+	dstAddr   tcpip.Address
+	dstPort   uint16
+}
+
+type qos struct {
+	sync.RWMutex
+
+	// interface marking
+	def *QoS
+	// per connection marking
+	flows map[qosFlow]QoS
+}
+
+// lookup returns the marking of an outgoing frame, connection marking takes
+// precedence over the interface one.
+func (m *qos) lookup(f *frame) *QoS {
+	m.RLock()
+	defer m.RUnlock()
+
+	if f.isIP() && len(m.flows) > 0 {
+		flow := qosFlow{f.transport, f.srcAddr, f.srcPort, f.dstAddr, f.dstPort}
+
+		if q, ok := m.flows[flow]; ok {
+			return &q
+		}
+	}
+
+	return m.def
+}
+
+// setDSCP sets the DSCP of an IPv4 or IPv6 packet, preserving its ECN field.
+func setDSCP(proto tcpip.NetworkProtocolNumber, pkt []byte, dscp uint8) {
+	switch proto {
+	case header.IPv4ProtocolNumber:
+		ip := header.IPv4(pkt)
+		tos, _ := ip.TOS()
+
+		ip.SetTOS(dscp<<2|tos&0x03, 0)
+		ip.SetChecksum(0)
+		ip.SetChecksum(^ip.CalculateChecksum())
+	case header.IPv6ProtocolNumber:
+		ip := header.IPv6(pkt)
+		tc, label := ip.TOS()
+
+		ip.SetTOS(dscp<<2|tc&0x03, label)
+	}
+}
+
+// mark applies the QoS marking to an outgoing Ethernet frame.
+func (m *qos) mark(buf []byte) []byte {
+	f, ok := parseFrame(buf)
+
+	if !ok {
+		return buf
+	}
+
+	q := m.lookup(&f)
+
+	if q == nil {
+		return buf
+	}
+
+	if q.DSCP != 0 && f.isIP() {
+		setDSCP(f.proto, buf[header.EthernetMinimumSize:], q.DSCP)
+	}
+
+	if q.PCP == 0 {
+		return buf
+	}
+
+	tag := make([]byte, vlanTagLen)
+	binary.BigEndian.PutUint16(tag[0:2], uint16(VLANProtocolNumber))
+	binary.BigEndian.PutUint16(tag[2:4], uint16(q.PCP)<<13)
+
+	frame := make([]byte, 0, len(buf)+vlanTagLen)
+	frame = append(frame, buf[0:12]...)
+	frame = append(frame, tag...)
+	frame = append(frame, buf[12:]...)
+
+	return frame
+}
+
+// SetQoS sets the priority marking of all traffic sent on the interface, a
+// nil value disables it. Connection specific marking, set with
+// SetConnQoS(), takes precedence.
+func (iface *Interface) SetQoS(q *QoS) error {
+	m := &iface.NIC.qos
+
+	if q != nil && !q.valid() {
+		return errors.New("invalid QoS")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if q == nil {
+		m.def = nil
+		return nil
+	}
+
+	def := *q
+	m.def = &def
+
+	return nil
+}
+
+// SetConnQoS sets the priority marking of the traffic sent on a TCP or UDP
+// connection established over the interface, a nil value disables it. The
+// marking must be disabled once the connection is closed.
+func (iface *Interface) SetConnQoS(conn net.Conn, q *QoS) error {
+	var flow qosFlow
+
+	m := &iface.NIC.qos
+
+	if q != nil && !q.valid() {
+		return errors.New("invalid QoS")
+	}
+
+	switch laddr := conn.LocalAddr().(type) {
+	case *net.TCPAddr:
+		raddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+
+		if !ok {
+			return errors.New("invalid remote address")
+		}
+
+		flow = qosFlow{header.TCPProtocolNumber, qosAddress(laddr.IP), uint16(laddr.Port), qosAddress(raddr.IP), uint16(raddr.Port)}
+	case *net.UDPAddr:
+		raddr, ok := conn.RemoteAddr().(*net.UDPAddr)
+
+		if !ok {
+			return errors.New("invalid remote address")
+		}
+
+		flow = qosFlow{header.UDPProtocolNumber, qosAddress(laddr.IP), uint16(laddr.Port), qosAddress(raddr.IP), uint16(raddr.Port)}
+	default:
+		return errors.New("unsupported connection")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if q == nil {
+		delete(m.flows, flow)
+		return nil
+	}
+
+	if m.flows == nil {
+		m.flows = make(map[qosFlow]QoS)
+	}
+
+	m.flows[flow] = *q
+
+	return nil
+}
+
+func qosAddress(ip net.IP) tcpip.Address {
+	if ip4 := ip.To4(); ip4 != nil {
+		return tcpip.Address(ip4)
+	}
+
+	return tcpip.Address(ip.To16())
+}
@@ -0,0 +1,271 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// staticConfig returns the addresses, primary one first, and gateway of a
+// static IP configuration.
+func staticConfig(cfg *IPConfig, proto tcpip.NetworkProtocolNumber) (addrs []tcpip.AddressWithPrefix, gateway tcpip.Address, err error) {
+	if cfg == nil {
+		return
+	}
+
+	if len(cfg.Address) > 0 {
+		addr, err := parseAddress(cfg.Address, proto)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	for _, s := range cfg.Addresses {
+		addr, err := parseAddress(s, proto)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	gateway, err = parseGateway(cfg.Gateway, proto)
+
+	return
+}
+
+func containsAddress(addrs []tcpip.AddressWithPrefix, addr tcpip.AddressWithPrefix) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// probeAddresses performs Address Conflict Detection (RFC 5227 - 2.1.1), in
+// parallel, on the argument IPv4 addresses not yet configured.
+func (iface *Interface) probeAddresses(addrs []tcpip.AddressWithPrefix) error {
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(addrs))
+
+	ctx, cancel := iface.context()
+	defer cancel()
+
+	for i, addr := range addrs {
+		if iface.hasAddress(ipv4.ProtocolNumber, addr.Address) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(i int, addr tcpip.Address) {
+			defer wg.Done()
+
+			mac, err := iface.detectConflict(ctx, addr)
+
+			switch {
+			case err != nil:
+				errs[i] = err
+			case mac != nil:
+				iface.addressConflict(addr, mac)
+				errs[i] = fmt.Errorf("address %s in use by %s", addr, mac)
+			}
+		}(i, addr.Address)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setIP replaces the static configuration of a network protocol on the live
+// stack. New addresses are added before old ones are removed, so that
+// connections on addresses retained across the change are preserved.
+func (iface *Interface) setIP(proto tcpip.NetworkProtocolNumber, cfg *IPConfig) (err error) {
+	iface.mu.RLock()
+	current, gateway := iface.opts.IPv4, iface.gateway
+
+	if proto == ipv6.ProtocolNumber {
+		current, gateway = iface.opts.IPv6, iface.gateway6
+	}
+
+	iface.mu.RUnlock()
+
+	if current != nil && (current.DHCP || current.SLAAC || current.LinkLocal) {
+		return errors.New("dynamic configuration enabled")
+	}
+
+	if cfg == nil {
+		cfg = &IPConfig{}
+	}
+
+	if cfg.DHCP || cfg.SLAAC || cfg.LinkLocal {
+		return errors.New("dynamic configuration not supported")
+	}
+
+	oldAddrs, _, err := staticConfig(current, proto)
+
+	if err != nil {
+		return
+	}
+
+	addrs, newGateway, err := staticConfig(cfg, proto)
+
+	if err != nil {
+		return
+	}
+
+	if len(newGateway) > 0 && len(addrs) == 0 {
+		return errors.New("gateway requires an address")
+	}
+
+	if proto == ipv4.ProtocolNumber && iface.opts.ACD {
+		if err = iface.probeAddresses(addrs); err != nil {
+			return
+		}
+	}
+
+	// addresses changing prefix length are replaced
+	for _, addr := range oldAddrs {
+		if containsAddress(addrs, addr) {
+			continue
+		}
+
+		for _, a := range addrs {
+			if a.Address == addr.Address {
+				iface.removeAddress(proto, addr)
+			}
+		}
+	}
+
+	for _, addr := range addrs {
+		if iface.hasAddress(proto, addr.Address) {
+			continue
+		}
+
+		if err = iface.configureProtocol(proto, addr, ""); err != nil {
+			return
+		}
+
+		if proto == ipv4.ProtocolNumber && iface.opts.ACD {
+			iface.acd.watch(addr.Address)
+		}
+	}
+
+	if newGateway != gateway {
+		subnet := header.IPv4EmptySubnet
+
+		if proto == ipv6.ProtocolNumber {
+			subnet = header.IPv6EmptySubnet
+		}
+
+		if len(gateway) > 0 {
+			iface.Stack.RemoveRoutes(func(rt tcpip.Route) bool {
+				return rt.NIC == iface.nicid && rt.Destination == subnet && rt.Gateway == gateway
+			})
+		}
+
+		if len(newGateway) > 0 {
+			iface.addRoute(tcpip.Route{
+				Destination: subnet,
+				Gateway:     newGateway,
+				NIC:         iface.nicid,
+			})
+		}
+	}
+
+	for _, addr := range oldAddrs {
+		if !containsAddress(addrs, addr) && iface.hasAddress(proto, addr.Address) {
+			iface.removeAddress(proto, addr)
+		}
+	}
+
+	var primary tcpip.AddressWithPrefix
+
+	if len(addrs) > 0 {
+		primary = addrs[0]
+	}
+
+	c := *cfg
+
+	iface.mu.Lock()
+	defer iface.mu.Unlock()
+
+	if proto == ipv4.ProtocolNumber {
+		iface.opts.IPv4 = &c
+		iface.address = primary
+		iface.gateway = newGateway
+
+		if newGateway != gateway {
+			iface.NIC.Gateway = header.EthernetBroadcastAddress
+		}
+
+		if len(primary.Address) > 0 {
+			go iface.announce(primary.Address, acdAnnounceNum)
+		}
+	} else {
+		iface.opts.IPv6 = &c
+		iface.address6 = primary
+		iface.gateway6 = newGateway
+	}
+
+	return
+}
+
+// SetIPv4 replaces, on the live interface, the static IPv4 address, additional
+// addresses and gateway with the argument configuration, along with their
+// subnet and default routes. A nil configuration removes them.
+//
+// Addresses present in both configurations, and connections established on
+// them, are preserved. The new primary address is announced with gratuitous
+// ARP. Interfaces using DHCP or link-local autoconfiguration cannot be
+// reconfigured.
+//
+// When Options.ACD is set new addresses are first probed with Address
+// Conflict Detection, the interface is left unchanged and an error is
+// returned if any of them is in use, otherwise they are defended once
+// configured.
+func (iface *Interface) SetIPv4(cfg *IPConfig) error {
+	return iface.setIP(ipv4.ProtocolNumber, cfg)
+}
+
+// SetIPv6 replaces, on the live interface, the static IPv6 address, additional
+// addresses and gateway with the argument configuration, along with their
+// subnet and default routes. A nil configuration removes them.
+//
+// Addresses present in both configurations, and connections established on
+// them, are preserved. IPv6 must have been enabled at initialization and
+// interfaces using SLAAC or DHCPv6 cannot be reconfigured.
+func (iface *Interface) SetIPv6(cfg *IPConfig) error {
+	if iface.opts.IPv6 == nil {
+		return errors.New("IPv6 not enabled")
+	}
+
+	return iface.setIP(ipv6.ProtocolNumber, cfg)
+}
@@ -0,0 +1,75 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func TestSetIPv4(t *testing.T) {
+	a, b := testPair(t, nil)
+
+	for i, iface := range []*Interface{a, b} {
+		cfg := &IPConfig{Address: []string{"10.0.2.7/24", "10.0.2.8/24"}[i]}
+
+		if err := iface.SetIPv4(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !a.hasAddress(ipv4.ProtocolNumber, testAddress("10.0.2.7")) {
+		t.Fatal("new address not configured")
+	}
+
+	if a.hasAddress(ipv4.ProtocolNumber, testAddress("10.0.0.1")) {
+		t.Error("old address not removed")
+	}
+
+	if addr := a.address.Address; addr != testAddress("10.0.2.7") {
+		t.Errorf("unexpected primary address %s", addr)
+	}
+
+	// traffic flows on the new addresses
+	server, err := a.ListenUDP("udp4", "10.0.2.7:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := b.DialUDP4("", "10.0.2.7:7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testEcho(t, client, server)
+}
+
+func TestSetIPv4Conflict(t *testing.T) {
+	a, _ := testPair(t, func(n int, opts *Options) {
+		opts.ACD = n == 1
+	})
+
+	// the peer answers the probe for its own address
+	if err := a.SetIPv4(&IPConfig{Address: "10.0.0.2/24"}); err == nil {
+		t.Fatal("conflicting address configured")
+	}
+
+	if a.hasAddress(ipv4.ProtocolNumber, testAddress("10.0.0.2")) {
+		t.Error("conflicting address configured")
+	}
+
+	if addr := a.address.Address; addr != testAddress("10.0.0.1") {
+		t.Errorf("unexpected primary address %s", addr)
+	}
+}
@@ -0,0 +1,173 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// serializes route table updates, the stack can be shared by several
+// interfaces
+var routeMu sync.Mutex
+
+// Route represents an IP route.
+type Route struct {
+	// Destination is the destination subnet in CIDR notation.
+	Destination string
+	// Gateway is the next hop address, an empty value selects an on-link
+	// route.
+	Gateway string
+}
+
+// parseRoute converts a route to its stack representation on the interface.
+func (iface *Interface) parseRoute(r Route) (rt tcpip.Route, err error) {
+	_, subnet, err := net.ParseCIDR(r.Destination)
+
+	if err != nil {
+		return
+	}
+
+	proto := ipv4.ProtocolNumber
+	ip := subnet.IP.To4()
+
+	if ip == nil {
+		if iface.opts.IPv6 == nil {
+			return rt, errors.New("IPv6 not enabled")
+		}
+
+		proto = ipv6.ProtocolNumber
+		ip = subnet.IP.To16()
+	}
+
+	dest, err := tcpip.NewSubnet(tcpip.Address(ip), tcpip.AddressMask(subnet.Mask))
+
+	if err != nil {
+		return rt, fmt.Errorf("invalid destination %q", r.Destination)
+	}
+
+	gateway, err := parseGateway(r.Gateway, proto)
+
+	if err != nil {
+		return
+	}
+
+	return tcpip.Route{
+		Destination: dest,
+		Gateway:     gateway,
+		NIC:         iface.nicid,
+	}, nil
+}
+
+// hasRoute returns whether a route is present in the argument route table.
+func hasRoute(table []tcpip.Route, rt tcpip.Route) bool {
+	for _, r := range table {
+		if r.Equal(rt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// insertRoute adds a route to the argument route table, before any less
+// specific one, as the stack selects the first matching route.
+func insertRoute(table []tcpip.Route, rt tcpip.Route) []tcpip.Route {
+	prefix := rt.Destination.Prefix()
+
+	for i, r := range table {
+		if r.Destination.Prefix() < prefix {
+			table = append(table[:i], append([]tcpip.Route{rt}, table[i:]...)...)
+			return table
+		}
+	}
+
+	return append(table, rt)
+}
+
+// addRoute adds a route to the stack route table, if not already present.
+func (iface *Interface) addRoute(rt tcpip.Route) bool {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+
+	table := iface.Stack.GetRouteTable()
+
+	if hasRoute(table, rt) {
+		return false
+	}
+
+	iface.Stack.SetRouteTable(insertRoute(table, rt))
+
+	return true
+}
+
+// AddRoute adds a route through the interface, more specific routes take
+// precedence regardless of the order of addition.
+func (iface *Interface) AddRoute(r Route) error {
+	rt, err := iface.parseRoute(r)
+
+	if err != nil {
+		return err
+	}
+
+	if !iface.addRoute(rt) {
+		return errors.New("route already present")
+	}
+
+	return nil
+}
+
+// RemoveRoute removes a route through the interface.
+func (iface *Interface) RemoveRoute(r Route) error {
+	rt, err := iface.parseRoute(r)
+
+	if err != nil {
+		return err
+	}
+
+	routeMu.Lock()
+	defer routeMu.Unlock()
+
+	if !hasRoute(iface.Stack.GetRouteTable(), rt) {
+		return errors.New("route not found")
+	}
+
+	iface.Stack.RemoveRoutes(func(route tcpip.Route) bool {
+		return route.Equal(rt)
+	})
+
+	return nil
+}
+
+// Routes returns the routes through the interface, in order of precedence.
+func (iface *Interface) Routes() (routes []Route) {
+	for _, rt := range iface.Stack.GetRouteTable() {
+		if rt.NIC != iface.nicid {
+			continue
+		}
+
+		r := Route{
+			Destination: rt.Destination.String(),
+		}
+
+		if len(rt.Gateway) > 0 {
+			r.Gateway = rt.Gateway.String()
+		}
+
+		routes = append(routes, r)
+	}
+
+	return
+}
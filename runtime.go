@@ -0,0 +1,178 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+// socketAddr converts a TCP or UDP address to the argument protocol address
+// family, IPv4 addresses are mapped to IPv6 ones (RFC 4291 - 2.5.5.2) for
+// IPv6 sockets.
+func socketAddr(addr net.Addr, proto tcpip.NetworkProtocolNumber) (fullAddr tcpip.FullAddress, err error) {
+	var ip net.IP
+
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+		fullAddr.Port = uint16(a.Port)
+	case *net.UDPAddr:
+		ip = a.IP
+		fullAddr.Port = uint16(a.Port)
+	default:
+		return fullAddr, fmt.Errorf("unsupported address %s", addr)
+	}
+
+	// unspecified addresses bind to all local ones
+	if len(ip) == 0 || ip.IsUnspecified() {
+		return
+	}
+
+	switch {
+	case proto == ipv4.ProtocolNumber && ip.To4() != nil:
+		fullAddr.Addr = tcpip.Address(ip.To4())
+	case proto == ipv6.ProtocolNumber:
+		fullAddr.Addr = tcpip.Address(ip.To16())
+	default:
+		return fullAddr, fmt.Errorf("invalid address %s for address family", addr)
+	}
+
+	return
+}
+
+// Socket can be used as net.SocketFunc under GOOS=tamago to allow its use
+// within the Go runtime net package.
+//
+// Connections are bound to the argument local address when not nil, the
+// argument context bounds TCP connection establishment and is checked before
+// creating UDP endpoints. AF_INET6 sockets are supported when IPv6 is
+// enabled on the interface.
+func (iface *Interface) Socket(ctx context.Context, network string, family, sotype int, laddr, raddr net.Addr) (c interface{}, err error) {
+	var proto tcpip.NetworkProtocolNumber
+	var lFullAddr tcpip.FullAddress
+	var rFullAddr tcpip.FullAddress
+
+	switch family {
+	case syscall.AF_INET:
+		proto = ipv4.ProtocolNumber
+	case syscall.AF_INET6:
+		if iface.opts.IPv6 == nil {
+			return nil, errors.New("IPv6 not enabled")
+		}
+
+		proto = ipv6.ProtocolNumber
+	default:
+		return nil, errors.New("unsupported address family")
+	}
+
+	if laddr != nil {
+		if lFullAddr, err = socketAddr(laddr, proto); err != nil {
+			return
+		}
+
+		if len(lFullAddr.Addr) > 0 && !iface.hasAddress(proto, lFullAddr.Addr) {
+			return nil, ErrAddressNotAvailable
+		}
+	}
+
+	if raddr != nil {
+		if rFullAddr, err = socketAddr(raddr, proto); err != nil {
+			return
+		}
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		var l *tcpip.FullAddress
+		var r *tcpip.FullAddress
+
+		if laddr != nil {
+			lFullAddr.NIC = iface.nicid
+			l = &lFullAddr
+		}
+
+		if raddr != nil {
+			r = &rFullAddr
+		}
+
+		c, err = gonet.DialUDP(iface.Stack, l, r, proto)
+	case "tcp", "tcp4", "tcp6":
+		if raddr == nil {
+			lFullAddr.NIC = iface.nicid
+			c, err = gonet.ListenTCP(iface.Stack, lFullAddr, proto)
+		} else {
+			c, err = gonet.DialTCPWithBind(ctx, iface.Stack, lFullAddr, rFullAddr, proto)
+		}
+	default:
+		return nil, errors.New("unsupported network")
+	}
+
+	return
+}
+
+// Resolver returns a resolver which performs DNS queries, through the Go
+// resolver, over the Ethernet interface to the DNS servers returned by
+// DNSServers(). The servers, which are rotated across successive queries,
+// replace the ones the Go resolver would read from resolv.conf.
+func (iface *Interface) Resolver() *net.Resolver {
+	var next uint32
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			servers := iface.DNSServers()
+
+			if len(servers) == 0 {
+				return nil, errors.New("no DNS servers configured")
+			}
+
+			n := atomic.AddUint32(&next, 1) - 1
+			server := net.JoinHostPort(servers[n%uint32(len(servers))], strconv.Itoa(DNSPort))
+
+			switch network {
+			case "udp", "udp4", "udp6":
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				return iface.dialUDP("", server, addressProtocol(server), nil)
+			case "tcp", "tcp4", "tcp6":
+				return iface.DialContextTCP(ctx, "", server)
+			default:
+				return nil, errors.New("unsupported network")
+			}
+		},
+	}
+}
+
+// SetDefaultResolver sets net.DefaultResolver to the interface Resolver(),
+// so that name resolution performed by the Go runtime net package (e.g.
+// net.Dial, http.Get) takes place over the Ethernet interface.
+//
+// It should be used together with Socket() as net.SocketFunc, DNS servers
+// are evaluated at query time so that those obtained through DHCP are used
+// once available.
+func (iface *Interface) SetDefaultResolver() {
+	net.DefaultResolver = iface.Resolver()
+}
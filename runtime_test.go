@@ -0,0 +1,112 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSocketContext(t *testing.T) {
+	iface := testInterface(t, &Options{
+		MAC: testMAC(1),
+		IPv4: &IPConfig{
+			Address:   "10.0.0.1/24",
+			Addresses: []string{"10.0.0.3/24"},
+		},
+	})
+
+	raddr := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 7}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := iface.Socket(ctx, "udp4", syscall.AF_INET, syscall.SOCK_DGRAM, nil, raddr); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error for canceled context, %v", err)
+	}
+
+	c, err := iface.Socket(context.Background(), "udp4", syscall.AF_INET, syscall.SOCK_DGRAM, nil, raddr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.(net.Conn).Close()
+
+	// connection establishment, towards an unreachable peer, is bounded
+	// by the context
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	tcpAddr := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80}
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := iface.Socket(ctx, "tcp4", syscall.AF_INET, syscall.SOCK_STREAM, nil, tcpAddr)
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatal("connection established to unreachable peer")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection establishment not interrupted by context")
+	}
+
+	// local addresses must be configured on the interface
+
+	for _, test := range []struct {
+		network string
+		sotype  int
+		laddr   net.Addr
+		raddr   net.Addr
+		valid   bool
+	}{
+		{"udp4", syscall.SOCK_DGRAM, &net.UDPAddr{IP: net.ParseIP("10.0.0.9")}, raddr, false},
+		{"udp4", syscall.SOCK_DGRAM, &net.UDPAddr{IP: net.ParseIP("10.0.0.3")}, raddr, true},
+		{"tcp4", syscall.SOCK_STREAM, &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 80}, nil, false},
+		{"tcp4", syscall.SOCK_STREAM, &net.TCPAddr{IP: net.ParseIP("10.0.0.3"), Port: 80}, nil, true},
+	} {
+		c, err := iface.Socket(context.Background(), test.network, syscall.AF_INET, test.sotype, test.laddr, test.raddr)
+
+		if !test.valid {
+			if !errors.Is(err, ErrAddressNotAvailable) {
+				t.Errorf("unexpected error for %s %s, %v", test.network, test.laddr, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var addr net.Addr
+
+		switch c := c.(type) {
+		case net.Conn:
+			addr = c.LocalAddr()
+			defer c.Close()
+		case net.Listener:
+			addr = c.Addr()
+			defer c.Close()
+		}
+
+		if addr == nil || !strings.HasPrefix(addr.String(), "10.0.0.3:") {
+			t.Errorf("unexpected %s local address %v", test.network, addr)
+		}
+	}
+}
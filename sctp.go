@@ -0,0 +1,593 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// SCTPUDPPort is the IANA assigned SCTP over UDP encapsulation port
+// (RFC 6951).
+const SCTPUDPPort = 9899
+
+const (
+	sctpHeaderLen      = 12
+	sctpChunkHeaderLen = 4
+	sctpDataHeaderLen  = 16
+	sctpStreams        = 16
+	sctpWindow         = 65535
+	sctpRTO            = 1 * time.Second
+	sctpMaxRetransmit  = 5
+	sctpQueueSize      = 64
+	sctpPacketSize     = 65535
+)
+
+// SCTP chunk types (RFC 4960 - 3.2)
+const (
+	sctpData             = 0
+	sctpInit             = 1
+	sctpInitAck          = 2
+	sctpSack             = 3
+	sctpHeartbeat        = 4
+	sctpHeartbeatAck     = 5
+	sctpAbort            = 6
+	sctpShutdown         = 7
+	sctpShutdownAck      = 8
+	sctpCookieEcho       = 10
+	sctpCookieAck        = 11
+	sctpShutdownComplete = 14
+)
+
+// SCTP DATA chunk flags (RFC 4960 - 3.3.1)
+const (
+	sctpDataEnding    = 1 << 0
+	sctpDataBeginning = 1 << 1
+)
+
+// SCTP INIT ACK State Cookie parameter type (RFC 4960 - 3.3.3.1)
+const sctpStateCookie = 7
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type sctpChunk struct {
+	Type  uint8
+	Flags uint8
+	Value []byte
+}
+
+type sctpMessage struct {
+	streamID uint16
+	data     []byte
+}
+
+// SCTPConn represents a minimal SCTP (RFC 4960) association over UDP
+// encapsulation (RFC 6951), messages are sent one at a time and
+// acknowledged before returning.
+type SCTPConn struct {
+	sync.Mutex
+
+	conn  *gonet.UDPConn
+	raddr *net.UDPAddr
+
+	srcPort uint16
+	dstPort uint16
+
+	localTag uint32
+	peerTag  uint32
+
+	// next TSN to transmit and highest TSN acknowledged by peer, the
+	// latter is guarded by the association mutex
+	tsn    uint32
+	acked  uint32
+	ackCh  chan uint32
+	seq    map[uint16]uint16
+	sendMu sync.Mutex
+
+	// last in-sequence TSN received from peer
+	peerTSN uint32
+	partial map[uint16][]byte
+	recvCh  chan sctpMessage
+
+	// association state
+	ctrl   chan sctpChunk
+	done   chan struct{}
+	err    error
+	closed sync.Once
+}
+
+func marshalSCTPChunks(chunks []sctpChunk) (buf []byte) {
+	for _, c := range chunks {
+		hdr := make([]byte, sctpChunkHeaderLen)
+		hdr[0] = c.Type
+		hdr[1] = c.Flags
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(sctpChunkHeaderLen+len(c.Value)))
+
+		buf = append(buf, hdr...)
+		buf = append(buf, c.Value...)
+
+		// chunks are padded to 4 bytes boundary
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+
+	return
+}
+
+func unmarshalSCTPChunks(buf []byte) (chunks []sctpChunk, err error) {
+	for len(buf) >= sctpChunkHeaderLen {
+		n := int(binary.BigEndian.Uint16(buf[2:4]))
+
+		if n < sctpChunkHeaderLen || n > len(buf) {
+			return nil, errors.New("invalid chunk length")
+		}
+
+		chunks = append(chunks, sctpChunk{
+			Type:  buf[0],
+			Flags: buf[1],
+			Value: buf[sctpChunkHeaderLen:n],
+		})
+
+		if n = (n + 3) &^ 3; n > len(buf) {
+			break
+		}
+
+		buf = buf[n:]
+	}
+
+	return
+}
+
+func (c *SCTPConn) write(tag uint32, chunks ...sctpChunk) (err error) {
+	pkt := make([]byte, sctpHeaderLen)
+
+	binary.BigEndian.PutUint16(pkt[0:2], c.srcPort)
+	binary.BigEndian.PutUint16(pkt[2:4], c.dstPort)
+	binary.BigEndian.PutUint32(pkt[4:8], tag)
+
+	pkt = append(pkt, marshalSCTPChunks(chunks)...)
+	binary.LittleEndian.PutUint32(pkt[8:12], crc32.Checksum(pkt, crc32c))
+
+	_, err = c.conn.WriteTo(pkt, c.raddr)
+
+	return
+}
+
+func (c *SCTPConn) read(buf []byte) (chunks []sctpChunk, tag uint32, err error) {
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if src, ok := addr.(*net.UDPAddr); !ok || !src.IP.Equal(c.raddr.IP) || n < sctpHeaderLen {
+			continue
+		}
+
+		pkt := buf[:n]
+
+		if binary.BigEndian.Uint16(pkt[0:2]) != c.dstPort || binary.BigEndian.Uint16(pkt[2:4]) != c.srcPort {
+			continue
+		}
+
+		sum := binary.LittleEndian.Uint32(pkt[8:12])
+		binary.LittleEndian.PutUint32(pkt[8:12], 0)
+
+		if crc32.Checksum(pkt, crc32c) != sum {
+			continue
+		}
+
+		if chunks, err = unmarshalSCTPChunks(pkt[sctpHeaderLen:]); err != nil {
+			continue
+		}
+
+		return chunks, binary.BigEndian.Uint32(pkt[4:8]), nil
+	}
+}
+
+func (c *SCTPConn) init() []byte {
+	// Initiate Tag, a_rwnd, Outbound/Inbound Streams, Initial TSN
+	// (RFC 4960 - 3.3.2)
+	buf := make([]byte, 16)
+
+	binary.BigEndian.PutUint32(buf[0:4], c.localTag)
+	binary.BigEndian.PutUint32(buf[4:8], sctpWindow)
+	binary.BigEndian.PutUint16(buf[8:10], sctpStreams)
+	binary.BigEndian.PutUint16(buf[10:12], sctpStreams)
+	binary.BigEndian.PutUint32(buf[12:16], c.tsn)
+
+	return buf
+}
+
+// handshake performs the association four-way handshake (RFC 4960 - 5.1).
+func (c *SCTPConn) handshake(ctx context.Context) (err error) {
+	var cookie []byte
+
+	buf := make([]byte, sctpPacketSize)
+
+	for i := 0; ; i++ {
+		if i > sctpMaxRetransmit {
+			return errors.New("association timeout")
+		}
+
+		if cookie == nil {
+			err = c.write(0, sctpChunk{Type: sctpInit, Value: c.init()})
+		} else {
+			err = c.write(c.peerTag, sctpChunk{Type: sctpCookieEcho, Value: cookie})
+		}
+
+		if err != nil {
+			return
+		}
+
+		deadline := time.Now().Add(sctpRTO)
+
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+
+		c.conn.SetReadDeadline(deadline)
+
+		for {
+			chunks, tag, err := c.read(buf)
+
+			if err != nil {
+				break
+			}
+
+			if tag != c.localTag {
+				continue
+			}
+
+			ack := false
+
+			for _, chunk := range chunks {
+				switch {
+				case chunk.Type == sctpInitAck && cookie == nil && len(chunk.Value) >= 16:
+					ack = true
+					c.peerTag = binary.BigEndian.Uint32(chunk.Value[0:4])
+					c.peerTSN = binary.BigEndian.Uint32(chunk.Value[12:16]) - 1
+
+					if cookie = parseSCTPCookie(chunk.Value[16:]); cookie == nil {
+						return errors.New("missing state cookie")
+					}
+				case chunk.Type == sctpCookieAck && cookie != nil:
+					c.conn.SetReadDeadline(time.Time{})
+					return nil
+				case chunk.Type == sctpAbort:
+					return errors.New("association aborted")
+				}
+			}
+
+			if ack {
+				// transmit COOKIE ECHO right away
+				i = -1
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+}
+
+func parseSCTPCookie(params []byte) []byte {
+	for len(params) >= 4 {
+		t := binary.BigEndian.Uint16(params[0:2])
+		n := int(binary.BigEndian.Uint16(params[2:4]))
+
+		if n < 4 || n > len(params) {
+			return nil
+		}
+
+		if t == sctpStateCookie {
+			return append([]byte{}, params[4:n]...)
+		}
+
+		if n = (n + 3) &^ 3; n > len(params) {
+			break
+		}
+
+		params = params[n:]
+	}
+
+	return nil
+}
+
+// DialSCTPOverUDP establishes an SCTP (RFC 4960) association, encapsulated
+// in UDP (RFC 6951), with the SCTP endpoint at the argument address (in
+// host:port format, with the SCTP destination port).
+func (iface *Interface) DialSCTPOverUDP(ctx context.Context, addr string) (c *SCTPConn, err error) {
+	host, port, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+
+	if err != nil {
+		return
+	}
+
+	ip := net.ParseIP(host).To4()
+
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", host)
+	}
+
+	local, err := iface.localAddress()
+
+	if err != nil {
+		return
+	}
+
+	laddr := &tcpip.FullAddress{Addr: local, NIC: iface.nicid}
+	conn, err := gonet.DialUDP(iface.Stack, laddr, nil, ipv4.ProtocolNumber)
+
+	if err != nil {
+		return
+	}
+
+	rng := iface.Stack.Rand()
+
+	c = &SCTPConn{
+		conn:     conn,
+		raddr:    &net.UDPAddr{IP: ip, Port: SCTPUDPPort},
+		srcPort:  uint16(rng.Intn(0xffff-1024) + 1024),
+		dstPort:  uint16(p),
+		localTag: rng.Uint32() | 1,
+		tsn:      rng.Uint32(),
+		ackCh:    make(chan uint32, 1),
+		seq:      make(map[uint16]uint16),
+		partial:  make(map[uint16][]byte),
+		recvCh:   make(chan sctpMessage, sctpQueueSize),
+		ctrl:     make(chan sctpChunk, 1),
+		done:     make(chan struct{}),
+	}
+
+	c.acked = c.tsn - 1
+
+	if err = c.handshake(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.handle()
+
+	return
+}
+
+func (c *SCTPConn) sack() sctpChunk {
+	// Cumulative TSN Ack, a_rwnd, no gap blocks or duplicates
+	// (RFC 4960 - 3.3.4)
+	buf := make([]byte, 12)
+
+	c.Lock()
+	binary.BigEndian.PutUint32(buf[0:4], c.peerTSN)
+	c.Unlock()
+
+	binary.BigEndian.PutUint32(buf[4:8], sctpWindow)
+
+	return sctpChunk{Type: sctpSack, Value: buf}
+}
+
+func (c *SCTPConn) data(chunk sctpChunk) {
+	if len(chunk.Value) < sctpDataHeaderLen-sctpChunkHeaderLen {
+		return
+	}
+
+	tsn := binary.BigEndian.Uint32(chunk.Value[0:4])
+	streamID := binary.BigEndian.Uint16(chunk.Value[4:6])
+	payload := chunk.Value[12:]
+
+	c.Lock()
+
+	// only in-sequence chunks are accepted, others are discarded and
+	// retransmitted by the peer
+	if tsn != c.peerTSN+1 {
+		c.Unlock()
+		return
+	}
+
+	c.peerTSN = tsn
+
+	if chunk.Flags&sctpDataBeginning != 0 {
+		c.partial[streamID] = nil
+	}
+
+	msg := append(c.partial[streamID], payload...)
+	c.partial[streamID] = msg
+
+	if chunk.Flags&sctpDataEnding == 0 {
+		c.Unlock()
+		return
+	}
+
+	delete(c.partial, streamID)
+	c.Unlock()
+
+	select {
+	case c.recvCh <- sctpMessage{streamID: streamID, data: msg}:
+	case <-c.done:
+	}
+}
+
+func (c *SCTPConn) handle() {
+	buf := make([]byte, sctpPacketSize)
+
+	for {
+		chunks, tag, err := c.read(buf)
+
+		if err != nil {
+			c.close(err)
+			return
+		}
+
+		if tag != c.localTag {
+			continue
+		}
+
+		sack := false
+
+		for _, chunk := range chunks {
+			switch chunk.Type {
+			case sctpData:
+				c.data(chunk)
+				sack = true
+			case sctpSack:
+				if len(chunk.Value) >= 4 {
+					select {
+					case c.ackCh <- binary.BigEndian.Uint32(chunk.Value[0:4]):
+					default:
+					}
+				}
+			case sctpHeartbeat:
+				c.write(c.peerTag, sctpChunk{Type: sctpHeartbeatAck, Value: chunk.Value})
+			case sctpShutdown:
+				c.write(c.peerTag, sctpChunk{Type: sctpShutdownAck})
+			case sctpShutdownAck:
+				c.write(c.peerTag, sctpChunk{Type: sctpShutdownComplete})
+				select {
+				case c.ctrl <- chunk:
+				default:
+				}
+			case sctpShutdownComplete, sctpAbort:
+				c.close(errors.New("association closed by peer"))
+				return
+			}
+		}
+
+		if sack {
+			c.write(c.peerTag, c.sack())
+		}
+	}
+}
+
+// Send transmits a message on the argument stream, it returns once the
+// message is acknowledged by the peer.
+func (c *SCTPConn) Send(streamID uint16, data []byte) (err error) {
+	if streamID >= sctpStreams {
+		return errors.New("invalid stream")
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	tsn := c.tsn
+	c.tsn++
+
+	seq := c.seq[streamID]
+	c.seq[streamID]++
+
+	// TSN, Stream Identifier, Stream Sequence Number, Payload Protocol
+	// Identifier (RFC 4960 - 3.3.1)
+	buf := make([]byte, sctpDataHeaderLen-sctpChunkHeaderLen)
+	binary.BigEndian.PutUint32(buf[0:4], tsn)
+	binary.BigEndian.PutUint16(buf[4:6], streamID)
+	binary.BigEndian.PutUint16(buf[6:8], seq)
+
+	chunk := sctpChunk{
+		Type:  sctpData,
+		Flags: sctpDataBeginning | sctpDataEnding,
+		Value: append(buf, data...),
+	}
+
+	for i := 0; i <= sctpMaxRetransmit; i++ {
+		if err = c.write(c.peerTag, chunk); err != nil {
+			return
+		}
+
+		timeout := time.After(sctpRTO)
+
+		for {
+			select {
+			case ack := <-c.ackCh:
+				// serial number arithmetic (RFC 1982)
+				if int32(ack-tsn) >= 0 {
+					c.Lock()
+					c.acked = ack
+					c.Unlock()
+
+					return nil
+				}
+
+				continue
+			case <-timeout:
+			case <-c.done:
+				return c.err
+			}
+
+			break
+		}
+	}
+
+	return errors.New("retransmission timeout")
+}
+
+// Recv receives a message, it blocks until one is available or the
+// association is closed.
+func (c *SCTPConn) Recv() (streamID uint16, data []byte, err error) {
+	select {
+	case msg := <-c.recvCh:
+		return msg.streamID, msg.data, nil
+	case <-c.done:
+		return 0, nil, c.err
+	}
+}
+
+func (c *SCTPConn) close(err error) {
+	c.closed.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// Close performs a graceful association shutdown (RFC 4960 - 9.2).
+func (c *SCTPConn) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	c.Lock()
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, c.peerTSN)
+	c.Unlock()
+
+	c.write(c.peerTag, sctpChunk{Type: sctpShutdown, Value: buf})
+
+	select {
+	case <-c.ctrl:
+	case <-c.done:
+	case <-time.After(sctpRTO):
+	}
+
+	c.close(errors.New("association closed"))
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+// shutdownPollInterval is the interval between checks for active
+// connections during Shutdown().
+const shutdownPollInterval = 100 * time.Millisecond
+
+// sharedStack returns whether the interface stack is used by other
+// interfaces (e.g. VLAN or GENEVE).
+func (iface *Interface) sharedStack() bool {
+	for _, v := range Interfaces() {
+		if v != iface && v.Stack == iface.Stack {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tcpEndpoints returns the TCP endpoints bound, or connected, through the
+// interface.
+func (iface *Interface) tcpEndpoints() (eps []tcpip.Endpoint) {
+	shared := iface.sharedStack()
+
+	for _, te := range iface.Stack.RegisteredEndpoints() {
+		ep, ok := te.(tcpip.Endpoint)
+
+		if !ok {
+			continue
+		}
+
+		info, ok := ep.Info().(*stack.TransportEndpointInfo)
+
+		if !ok || info.TransProto != tcp.ProtocolNumber {
+			continue
+		}
+
+		if shared && info.BindNICID != iface.nicid && info.RegisterNICID != iface.nicid &&
+			!iface.hasAddress(info.NetProto, info.ID.LocalAddress) {
+			continue
+		}
+
+		eps = append(eps, ep)
+	}
+
+	return
+}
+
+// activeConnections returns the number of TCP connections not yet closed by
+// the application, or with unacknowledged data.
+func (iface *Interface) activeConnections() (n int) {
+	for _, ep := range iface.tcpEndpoints() {
+		switch tcp.EndpointState(ep.State()) {
+		case tcp.StateEstablished, tcp.StateSynSent, tcp.StateSynRecv, tcp.StateCloseWait,
+			tcp.StateFinWait1, tcp.StateClosing, tcp.StateLastAck:
+			n++
+		}
+	}
+
+	return
+}
+
+// Shutdown gracefully shuts the interface down: all TCP listeners are closed,
+// so that no new connection is accepted, then established connections are
+// waited for until closed, by either peer, before closing the interface (see
+// Close()).
+//
+// When the context expires before all connections are closed, the
+// interface is closed anyway, aborting them, and the context error is
+// returned.
+func (iface *Interface) Shutdown(ctx context.Context) (err error) {
+	for _, ep := range iface.tcpEndpoints() {
+		if tcp.EndpointState(ep.State()) == tcp.StateListen {
+			ep.Close()
+		}
+	}
+
+	for err == nil && iface.activeConnections() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(shutdownPollInterval):
+		}
+	}
+
+	if e := iface.Close(); err == nil {
+		err = e
+	}
+
+	return
+}
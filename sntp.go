@@ -0,0 +1,338 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SNTP constants (RFC 4330)
+const (
+	// SNTPPort is the NTP server UDP port.
+	SNTPPort = 123
+
+	// DefaultSNTPInterval is the default clock synchronization interval.
+	DefaultSNTPInterval = 1 * time.Hour
+	// DefaultSNTPRetryInterval is the default interval between
+	// synchronization attempts after a failure.
+	DefaultSNTPRetryInterval = 1 * time.Minute
+
+	ntpPacketLength = 48
+	ntpVersion      = 4
+
+	ntpModeClient = 3
+	ntpModeServer = 4
+
+	// leap indicator alarm condition (clock not synchronized)
+	ntpLeapAlarm = 3
+
+	// maximum valid stratum
+	ntpMaxStratum = 15
+
+	// seconds between the NTP (1900) and Unix (1970) epochs
+	ntpEpochOffset = 2208988800
+)
+
+// SNTPTimeout is the timeout of each SNTP query.
+var SNTPTimeout = 5 * time.Second
+
+// SNTPResult represents the result of an SNTP query.
+type SNTPResult struct {
+	// Server is the queried server address.
+	Server string
+	// Stratum is the server stratum.
+	Stratum int
+
+	// Offset is the local clock offset from the server clock, the server
+	// time can be obtained with time.Now().Add(Offset).
+	Offset time.Duration
+	// Delay is the round-trip delay to the server.
+	Delay time.Duration
+}
+
+// ntpTime decodes an NTP timestamp, timestamps with the most significant
+// bit cleared are assumed to belong to NTP era 1 (RFC 4330 - 3).
+func ntpTime(buf []byte) time.Time {
+	sec := int64(binary.BigEndian.Uint32(buf[0:4]))
+	frac := int64(binary.BigEndian.Uint32(buf[4:8]))
+
+	if sec&0x80000000 == 0 {
+		sec += 1 << 32
+	}
+
+	return time.Unix(sec-ntpEpochOffset, (frac*int64(time.Second))>>32)
+}
+
+// putNTPTime encodes an NTP timestamp.
+func putNTPTime(buf []byte, t time.Time) {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+
+	binary.BigEndian.PutUint32(buf[0:4], uint32(sec))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(frac))
+}
+
+// sntpAddress returns the UDP address for an SNTP server, in host or
+// host:port form, resolving host names through LookupHost().
+func (iface *Interface) sntpAddress(ctx context.Context, server string) (addr string, err error) {
+	host, port := server, strconv.Itoa(SNTPPort)
+
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+
+	addrs, err := iface.dialAddresses(ctx, "udp", host)
+
+	if err != nil {
+		return
+	}
+
+	return net.JoinHostPort(addrs[0].String(), port), nil
+}
+
+// QuerySNTP queries an SNTP server, in host or host:port form, and returns
+// the local clock offset from it.
+func (iface *Interface) QuerySNTP(ctx context.Context, server string) (res *SNTPResult, err error) {
+	addr, err := iface.sntpAddress(ctx, server)
+
+	if err != nil {
+		return
+	}
+
+	conn, err := iface.dialUDP("", addr, addressProtocol(addr), nil)
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(SNTPTimeout)
+
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn.SetDeadline(deadline)
+
+	req := make([]byte, ntpPacketLength)
+	req[0] = ntpVersion<<3 | ntpModeClient
+
+	t1 := time.Now()
+	putNTPTime(req[40:48], t1)
+
+	if _, err = conn.Write(req); err != nil {
+		return
+	}
+
+	buf := make([]byte, ntpPacketLength*2)
+
+	for {
+		n, err := conn.Read(buf)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t4 := time.Now()
+
+		// discard responses to other requests (RFC 4330 - 5)
+		if n < ntpPacketLength || buf[0]&0x07 != ntpModeServer || !bytes.Equal(buf[24:32], req[40:48]) {
+			continue
+		}
+
+		stratum := int(buf[1])
+
+		switch {
+		case stratum == 0:
+			return nil, fmt.Errorf("kiss-o'-death from %s (%s)", server, strings.TrimRight(string(buf[12:16]), "\x00"))
+		case stratum > ntpMaxStratum || buf[0]>>6 == ntpLeapAlarm:
+			return nil, fmt.Errorf("server %s not synchronized", server)
+		case binary.BigEndian.Uint64(buf[40:48]) == 0:
+			return nil, fmt.Errorf("invalid response from %s", server)
+		}
+
+		t2 := ntpTime(buf[32:40])
+		t3 := ntpTime(buf[40:48])
+
+		res = &SNTPResult{
+			Server:  addr,
+			Stratum: stratum,
+			Offset:  (t2.Sub(t1) + t3.Sub(t4)) / 2,
+			Delay:   t4.Sub(t1) - t3.Sub(t2),
+		}
+
+		return res, nil
+	}
+}
+
+// SyncClock queries the interface NTP servers (see NTPServers()), in order,
+// and passes the time of the first responding one to the argument function,
+// which is responsible for setting the system time (e.g.
+// imx6ul.ARM.SetTimer() under TamaGo).
+func (iface *Interface) SyncClock(ctx context.Context, setTime func(time.Time)) (res *SNTPResult, err error) {
+	return iface.syncClock(ctx, iface.NTPServers(), setTime)
+}
+
+func (iface *Interface) syncClock(ctx context.Context, servers []string, setTime func(time.Time)) (res *SNTPResult, err error) {
+	if setTime == nil {
+		return nil, errors.New("missing time setting function")
+	}
+
+	if len(servers) == 0 {
+		return nil, errors.New("no NTP servers")
+	}
+
+	var errs []string
+
+	for _, server := range servers {
+		if res, err = iface.QuerySNTP(ctx, server); err == nil {
+			setTime(time.Now().Add(res.Offset))
+			return
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	return nil, fmt.Errorf("SNTP error: %s", strings.Join(errs, "; "))
+}
+
+// SNTPOptions represents SNTP client configuration options.
+type SNTPOptions struct {
+	// Servers are the queried servers, in host or host:port form, when
+	// empty the interface NTP servers (see NTPServers()) are used.
+	Servers []string
+
+	// Interval is the synchronization interval, 0 selects
+	// DefaultSNTPInterval.
+	Interval time.Duration
+	// RetryInterval is the interval between attempts after a failed
+	// synchronization, 0 selects DefaultSNTPRetryInterval.
+	RetryInterval time.Duration
+
+	// SetTime is invoked on each synchronization to set the system time
+	// (e.g. with imx6ul.ARM.SetTimer() under TamaGo).
+	SetTime func(time.Time)
+}
+
+// SNTPClient represents an SNTP client instance, periodically synchronizing
+// the system time.
+type SNTPClient struct {
+	sync.Mutex
+
+	iface *Interface
+	opts  SNTPOptions
+
+	last    *SNTPResult
+	lastErr error
+
+	done chan struct{}
+	once sync.Once
+}
+
+// StartSNTP starts an SNTP client, synchronizing the system time
+// immediately and then periodically.
+func (iface *Interface) StartSNTP(opts SNTPOptions) (c *SNTPClient, err error) {
+	if opts.SetTime == nil {
+		return nil, errors.New("missing time setting function")
+	}
+
+	if opts.Interval == 0 {
+		opts.Interval = DefaultSNTPInterval
+	}
+
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = DefaultSNTPRetryInterval
+	}
+
+	if opts.Interval < 0 || opts.RetryInterval < 0 {
+		return nil, errors.New("invalid interval")
+	}
+
+	c = &SNTPClient{
+		iface: iface,
+		opts:  opts,
+		done:  make(chan struct{}),
+	}
+
+	go c.run()
+
+	return
+}
+
+func (c *SNTPClient) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-c.done
+		cancel()
+	}()
+
+	for {
+		servers := c.opts.Servers
+
+		if len(servers) == 0 {
+			servers = c.iface.NTPServers()
+		}
+
+		res, err := c.iface.syncClock(ctx, servers, c.opts.SetTime)
+
+		c.Lock()
+		c.lastErr = err
+
+		if err == nil {
+			c.last = res
+		}
+
+		c.Unlock()
+
+		interval := c.opts.Interval
+
+		if err != nil && c.opts.RetryInterval < interval {
+			interval = c.opts.RetryInterval
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Last returns the result of the last successful synchronization, if any,
+// and the error of the last attempt.
+func (c *SNTPClient) Last() (res *SNTPResult, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.last, c.lastErr
+}
+
+// Close stops the SNTP client.
+func (c *SNTPClient) Close() (err error) {
+	c.once.Do(func() {
+		close(c.done)
+	})
+
+	return
+}
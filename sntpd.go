@@ -0,0 +1,225 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSNTPServerStratum is the default SNTP server stratum, for a
+	// server directly synchronized to a reference clock.
+	DefaultSNTPServerStratum = 1
+
+	// unsynchronized server stratum (RFC 5905 - 7.3)
+	ntpUnsynchronized = 16
+	// server clock precision, as log2 seconds (~1 µs)
+	ntpPrecision = -20
+)
+
+// SNTPServerOptions represents SNTP server configuration options.
+type SNTPServerOptions struct {
+	// Stratum is the advertised server stratum, 0 selects
+	// DefaultSNTPServerStratum.
+	Stratum int
+	// ReferenceID is the reference clock identifier (e.g. "GPS", "PPS",
+	// "PTP") for stratum 1 servers, or the IPv4 address of the upstream
+	// server otherwise.
+	ReferenceID string
+
+	// Time returns the served time, when nil time.Now() is used. It can
+	// be set to a more accurate source (e.g. PTPClock.Time()).
+	Time func() time.Time
+	// Synchronized, when not nil, reports whether the served time is
+	// synchronized to its reference, unsynchronized servers advertise the
+	// alarm condition to clients.
+	Synchronized func() bool
+}
+
+// SNTPServer represents an SNTP server instance.
+type SNTPServer struct {
+	sync.Mutex
+
+	iface *Interface
+	opts  SNTPServerOptions
+	refID []byte
+
+	// last reference clock update time
+	updated time.Time
+
+	conns []net.PacketConn
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// StartSNTPServer starts an SNTP server (RFC 4330 - 6) on the interface
+// IPv4 and, when enabled, IPv6 addresses, serving time to unicast client
+// requests.
+func (iface *Interface) StartSNTPServer(opts SNTPServerOptions) (s *SNTPServer, err error) {
+	if opts.Stratum == 0 {
+		opts.Stratum = DefaultSNTPServerStratum
+	}
+
+	if opts.Stratum < 1 || opts.Stratum > ntpMaxStratum {
+		return nil, errors.New("invalid stratum")
+	}
+
+	if opts.Time == nil {
+		opts.Time = time.Now
+	}
+
+	s = &SNTPServer{
+		iface: iface,
+		opts:  opts,
+		refID: make([]byte, 4),
+		done:  make(chan struct{}),
+	}
+
+	if opts.Stratum == 1 {
+		if len(opts.ReferenceID) > 4 {
+			return nil, errors.New("invalid reference identifier")
+		}
+
+		copy(s.refID, opts.ReferenceID)
+	} else if len(opts.ReferenceID) > 0 {
+		ip := net.ParseIP(opts.ReferenceID).To4()
+
+		if ip == nil {
+			return nil, errors.New("invalid reference identifier")
+		}
+
+		copy(s.refID, ip)
+	}
+
+	address := net.JoinHostPort("", strconv.Itoa(SNTPPort))
+
+	conn, err := iface.DialUDP4(address, "")
+
+	if err != nil {
+		return
+	}
+
+	s.conns = append(s.conns, conn)
+
+	if iface.opts.IPv6 != nil {
+		conn, err := iface.DialUDP6(address, "")
+
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+
+		s.conns = append(s.conns, conn)
+	}
+
+	for _, conn := range s.conns {
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+
+	return
+}
+
+func (s *SNTPServer) serve(conn net.PacketConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, MaxMTU)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		// receive timestamp
+		t2 := s.opts.Time()
+
+		if res := s.handle(buf[:n], t2); res != nil {
+			conn.WriteTo(res, addr)
+		}
+	}
+}
+
+// handle returns the response to an SNTP client request.
+func (s *SNTPServer) handle(req []byte, t2 time.Time) (res []byte) {
+	if len(req) < ntpPacketLength || req[0]&0x07 != ntpModeClient {
+		return
+	}
+
+	version := req[0] >> 3 & 0x07
+
+	if version < 1 || version > ntpVersion {
+		return
+	}
+
+	synchronized := s.opts.Synchronized == nil || s.opts.Synchronized()
+
+	s.Lock()
+
+	if synchronized {
+		s.updated = t2
+	}
+
+	updated := s.updated
+
+	s.Unlock()
+
+	res = make([]byte, ntpPacketLength)
+	res[0] = version<<3 | ntpModeServer
+	res[1] = byte(s.opts.Stratum)
+	res[2] = req[2]
+	res[3] = byte(ntpPrecision & 0xff)
+
+	copy(res[12:16], s.refID)
+
+	if !synchronized {
+		res[0] |= ntpLeapAlarm << 6
+		res[1] = ntpUnsynchronized
+	}
+
+	if !updated.IsZero() {
+		putNTPTime(res[16:24], updated)
+	}
+
+	// originate timestamp, copied from the request transmit one
+	copy(res[24:32], req[40:48])
+	putNTPTime(res[32:40], t2)
+	putNTPTime(res[40:48], s.opts.Time())
+
+	return
+}
+
+// Close stops the SNTP server.
+func (s *SNTPServer) Close() (err error) {
+	s.once.Do(func() {
+		close(s.done)
+
+		for _, conn := range s.conns {
+			if e := conn.Close(); e != nil {
+				err = e
+			}
+		}
+
+		s.wg.Wait()
+	})
+
+	return
+}
@@ -0,0 +1,270 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// SSDP constants (UPnP Device Architecture 1.1 - 1)
+const (
+	// SSDPPort is the SSDP UDP port.
+	SSDPPort = 1900
+	// SSDPIPv4Address is the SSDP IPv4 multicast address.
+	SSDPIPv4Address = "239.255.255.250"
+
+	// DefaultSSDPMaxAge is the default advertisement validity.
+	DefaultSSDPMaxAge = 1800 * time.Second
+
+	ssdpRootDevice = "upnp:rootdevice"
+	ssdpAll        = "ssdp:all"
+	ssdpMaxMX      = 5
+)
+
+// SSDPDevice represents a UPnP root device advertised through SSDP.
+type SSDPDevice struct {
+	// UUID is the device unique identifier, without "uuid:" prefix.
+	UUID string
+	// Location is the URL of the device description document.
+	Location string
+	// Server is the SERVER header value, in "OS/version UPnP/1.1
+	// product/version" form.
+	Server string
+	// Types are the device and service types advertised by the device
+	// (e.g. "urn:schemas-upnp-org:device:Basic:1").
+	Types []string
+	// MaxAge is the advertisement validity, 0 selects DefaultSSDPMaxAge.
+	MaxAge time.Duration
+}
+
+// targets returns the device notification types (UPnP Device Architecture
+// 1.1 - 1.1.2), in NT/ST and USN pairs.
+func (d *SSDPDevice) targets() (targets [][2]string) {
+	uuid := "uuid:" + d.UUID
+
+	targets = append(targets, [2]string{ssdpRootDevice, uuid + "::" + ssdpRootDevice})
+	targets = append(targets, [2]string{uuid, uuid})
+
+	for _, t := range d.Types {
+		targets = append(targets, [2]string{t, uuid + "::" + t})
+	}
+
+	return
+}
+
+// SSDPResponder represents an SSDP responder instance.
+type SSDPResponder struct {
+	iface  *Interface
+	device SSDPDevice
+	conn   net.PacketConn
+	group  *net.UDPAddr
+
+	done chan struct{}
+	once sync.Once
+}
+
+// header writes the headers shared by responses and alive advertisements.
+func (r *SSDPResponder) header(buf *bytes.Buffer, usn string) {
+	fmt.Fprintf(buf, "CACHE-CONTROL: max-age=%d\r\n", int(r.device.MaxAge.Seconds()))
+	fmt.Fprintf(buf, "LOCATION: %s\r\n", r.device.Location)
+	fmt.Fprintf(buf, "SERVER: %s\r\n", r.device.Server)
+	fmt.Fprintf(buf, "USN: %s\r\n", usn)
+}
+
+// response returns the M-SEARCH response for a search target (UPnP Device
+// Architecture 1.1 - 1.3.3).
+func (r *SSDPResponder) response(st string, usn string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("HTTP/1.1 200 OK\r\n")
+	r.header(&buf, usn)
+	fmt.Fprintf(&buf, "ST: %s\r\n", st)
+	buf.WriteString("EXT:\r\n\r\n")
+
+	return buf.Bytes()
+}
+
+// notify returns the advertisement for a notification type (UPnP Device
+// Architecture 1.1 - 1.2.2, 1.2.3).
+func (r *SSDPResponder) notify(nt string, usn string, nts string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("NOTIFY * HTTP/1.1\r\n")
+	fmt.Fprintf(&buf, "HOST: %s\r\n", r.group)
+
+	if nts == "ssdp:alive" {
+		r.header(&buf, usn)
+	} else {
+		fmt.Fprintf(&buf, "USN: %s\r\n", usn)
+	}
+
+	fmt.Fprintf(&buf, "NT: %s\r\n", nt)
+	fmt.Fprintf(&buf, "NTS: %s\r\n\r\n", nts)
+
+	return buf.Bytes()
+}
+
+// handle answers M-SEARCH requests (UPnP Device Architecture 1.1 - 1.3.2).
+func (r *SSDPResponder) handle(buf []byte, src *net.UDPAddr) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf)))
+
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+		return
+	}
+
+	st := req.Header.Get("ST")
+	mx, err := strconv.Atoi(req.Header.Get("MX"))
+
+	// unicast searches have no MX header
+	if err != nil || mx < 1 {
+		mx = 1
+	}
+
+	if mx > ssdpMaxMX {
+		mx = ssdpMaxMX
+	}
+
+	var responses [][]byte
+
+	for _, t := range r.device.targets() {
+		if st == ssdpAll || st == t[0] {
+			responses = append(responses, r.response(t[0], t[1]))
+		}
+	}
+
+	if len(responses) == 0 {
+		return
+	}
+
+	delay := time.Duration(rand.Int63n(int64(mx) * int64(time.Second)))
+
+	go func() {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+
+		for _, res := range responses {
+			r.conn.WriteTo(res, src)
+		}
+	}()
+}
+
+func (r *SSDPResponder) serve() {
+	buf := make([]byte, MaxMTU)
+
+	for {
+		n, addr, err := r.conn.ReadFrom(buf)
+
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		if src, ok := addr.(*net.UDPAddr); ok {
+			r.handle(buf[:n], src)
+		}
+	}
+}
+
+// announce sends advertisements for all device notification types.
+func (r *SSDPResponder) announce(nts string) {
+	for _, t := range r.device.targets() {
+		r.conn.WriteTo(r.notify(t[0], t[1], nts), r.group)
+	}
+}
+
+// advertise periodically refreshes the device advertisements, well before
+// their expiration.
+func (r *SSDPResponder) advertise() {
+	for {
+		r.announce("ssdp:alive")
+
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.device.MaxAge / 3):
+		}
+	}
+}
+
+// StartSSDP starts a Simple Service Discovery Protocol responder, over IPv4,
+// which advertises the argument UPnP root device and answers M-SEARCH
+// queries from control points. The device description document, referenced
+// by SSDPDevice.Location, must be served separately (e.g. with net/http).
+func (iface *Interface) StartSSDP(device SSDPDevice) (r *SSDPResponder, err error) {
+	if len(device.UUID) == 0 || len(device.Location) == 0 {
+		return nil, errors.New("missing device UUID or location")
+	}
+
+	if device.MaxAge == 0 {
+		device.MaxAge = DefaultSSDPMaxAge
+	}
+
+	if len(device.Server) == 0 {
+		device.Server = "tamago UPnP/1.1 imx-enet/1.0"
+	}
+
+	group := net.ParseIP(SSDPIPv4Address).To4()
+	conn, err := iface.ListenMulticastUDP(tcpip.Address(group), SSDPPort)
+
+	if err != nil {
+		return
+	}
+
+	r = &SSDPResponder{
+		iface:  iface,
+		device: device,
+		conn:   conn,
+		group:  &net.UDPAddr{IP: group, Port: SSDPPort},
+		done:   make(chan struct{}),
+	}
+
+	// UPnP Device Architecture 1.1 - 1.1.2
+	if c, ok := conn.(*multicastConn); ok {
+		c.ep.SetSockOptInt(tcpip.MulticastTTLOption, 2)
+	}
+
+	go r.serve()
+	go r.advertise()
+
+	return
+}
+
+// Device returns the advertised device.
+func (r *SSDPResponder) Device() SSDPDevice {
+	return r.device
+}
+
+// Close sends ssdp:byebye advertisements and stops the responder.
+func (r *SSDPResponder) Close() (err error) {
+	r.once.Do(func() {
+		r.announce("ssdp:byebye")
+		close(r.done)
+		err = r.conn.Close()
+	})
+
+	return
+}
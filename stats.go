@@ -0,0 +1,332 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// sliding window used to compute traffic rates
+	operStatsWindow = 10 * time.Second
+	// maximum number of samples held within the sliding window
+	operStatsSamples = 64
+)
+
+// OperationalStats represents the operational statistics of an interface,
+// suitable for encoding/json serialization.
+type OperationalStats struct {
+	// Stack holds the stack wide counters, indexed by their tcpip.Stats
+	// field names (e.g. Stack["TCP"]["CurrentEstablished"]).
+	Stack map[string]interface{}
+	// NIC holds the interface counters, indexed by their tcpip.NICStats
+	// field names (e.g. NIC["Rx"]["Packets"]).
+	NIC map[string]interface{}
+
+	// UptimeSeconds is the time elapsed since interface initialization.
+	UptimeSeconds float64
+
+	// RxPPS is the received packets per second rate.
+	RxPPS float64
+	// TxPPS is the transmitted packets per second rate.
+	TxPPS float64
+	// RxBandwidthBps is the received bytes per second rate.
+	RxBandwidthBps float64
+	// TxBandwidthBps is the transmitted bytes per second rate.
+	TxBandwidthBps float64
+}
+
+type operSample struct {
+	time      time.Time
+	rxPackets uint64
+	txPackets uint64
+	rxBytes   uint64
+	txBytes   uint64
+}
+
+type operSamples struct {
+	sync.Mutex
+	samples []operSample
+}
+
+// add records a sample and returns the oldest one within the sliding window.
+func (s *operSamples) add(sample operSample) (oldest operSample, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	for len(s.samples) >= operStatsSamples || len(s.samples) > 1 && sample.time.Sub(s.samples[1].time) >= operStatsWindow {
+		s.samples = s.samples[1:]
+	}
+
+	if len(s.samples) > 0 {
+		oldest, ok = s.samples[0], true
+	}
+
+	s.samples = append(s.samples, sample)
+
+	return
+}
+
+// statsMap converts a gVisor statistics structure to a map of counter values.
+func statsMap(v reflect.Value) map[string]interface{} {
+	m := make(map[string]interface{})
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		val := v.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		switch c := val.Addr().Interface().(type) {
+		case **tcpip.StatCounter:
+			if *c != nil {
+				m[field.Name] = (*c).Value()
+			}
+		case *tcpip.StatCounter:
+			m[field.Name] = c.Value()
+		default:
+			if val.Kind() == reflect.Struct {
+				m[field.Name] = statsMap(val)
+			}
+		}
+	}
+
+	return m
+}
+
+// OperStats returns the interface operational statistics, traffic rates are
+// computed over a sliding window of successive invocations and are therefore
+// zero on the first one.
+func (iface *Interface) OperStats() (stats OperationalStats) {
+	now := time.Now()
+
+	stackStats := iface.Stack.Stats()
+	stats.Stack = statsMap(reflect.ValueOf(&stackStats).Elem())
+
+	info, ok := iface.Stack.NICInfo()[iface.nicid]
+
+	if !ok {
+		return
+	}
+
+	nicStats := info.Stats
+	stats.NIC = statsMap(reflect.ValueOf(&nicStats).Elem())
+	stats.UptimeSeconds = now.Sub(iface.started).Seconds()
+
+	sample := operSample{
+		time:      now,
+		rxPackets: nicStats.Rx.Packets.Value(),
+		txPackets: nicStats.Tx.Packets.Value(),
+		rxBytes:   nicStats.Rx.Bytes.Value(),
+		txBytes:   nicStats.Tx.Bytes.Value(),
+	}
+
+	prev, ok := iface.operSamples.add(sample)
+
+	if !ok {
+		return
+	}
+
+	if elapsed := now.Sub(prev.time).Seconds(); elapsed > 0 {
+		stats.RxPPS = float64(sample.rxPackets-prev.rxPackets) / elapsed
+		stats.TxPPS = float64(sample.txPackets-prev.txPackets) / elapsed
+		stats.RxBandwidthBps = float64(sample.rxBytes-prev.rxBytes) / elapsed
+		stats.TxBandwidthBps = float64(sample.txBytes-prev.txBytes) / elapsed
+	}
+
+	return
+}
+
+// Stats represents a snapshot of the interface and stack counters relevant
+// to network health monitoring (see Interface.Stats()).
+type Stats struct {
+	// RxPackets is the number of packets received by the interface.
+	RxPackets uint64
+	// RxBytes is the number of bytes received by the interface.
+	RxBytes uint64
+	// TxPackets is the number of packets transmitted by the interface.
+	TxPackets uint64
+	// TxBytes is the number of bytes transmitted by the interface.
+	TxBytes uint64
+	// TxDropped is the number of packets dropped as the transmit queue
+	// was full.
+	TxDropped uint64
+	// UnreachableNeighbors is the number of lookups of unreachable
+	// neighbor entries.
+	UnreachableNeighbors uint64
+
+	// DroppedPackets is the number of packets dropped by the stack.
+	DroppedPackets uint64
+
+	IP   IPStats
+	ARP  ARPStats
+	ICMP ICMPStats
+	TCP  TCPStats
+	UDP  UDPStats
+}
+
+// IPStats represents the IPv4 and IPv6 counters.
+type IPStats struct {
+	PacketsReceived                     uint64
+	PacketsDelivered                    uint64
+	PacketsSent                         uint64
+	MalformedPacketsReceived            uint64
+	MalformedFragmentsReceived          uint64
+	InvalidDestinationAddressesReceived uint64
+	OutgoingPacketErrors                uint64
+}
+
+// ARPStats represents the ARP counters.
+type ARPStats struct {
+	RequestsSent             uint64
+	RequestsReceived         uint64
+	RepliesSent              uint64
+	RepliesReceived          uint64
+	MalformedPacketsReceived uint64
+	// RequestErrors is the number of requests dropped or which could not
+	// be sent for lack of a valid local address.
+	RequestErrors uint64
+}
+
+// ICMPStats represents the ICMPv4 and ICMPv6 counters.
+type ICMPStats struct {
+	EchoRequestsReceived   uint64
+	EchoRepliesReceived    uint64
+	DstUnreachableReceived uint64
+	TimeExceededReceived   uint64
+	DstUnreachableSent     uint64
+	TimeExceededSent       uint64
+	InvalidPacketsReceived uint64
+	DroppedPacketsSent     uint64
+	RateLimitedPacketsSent uint64
+}
+
+// TCPStats represents the TCP counters.
+type TCPStats struct {
+	ActiveConnectionOpenings  uint64
+	PassiveConnectionOpenings uint64
+	CurrentEstablished        uint64
+	EstablishedResets         uint64
+	EstablishedTimedout       uint64
+	FailedConnectionAttempts  uint64
+	SegmentsReceived          uint64
+	InvalidSegmentsReceived   uint64
+	SegmentsSent              uint64
+	SegmentSendErrors         uint64
+	ResetsSent                uint64
+	ResetsReceived            uint64
+	Retransmits               uint64
+	Timeouts                  uint64
+	ChecksumErrors            uint64
+	ListenOverflowDrops       uint64
+}
+
+// UDPStats represents the UDP counters.
+type UDPStats struct {
+	PacketsReceived          uint64
+	PacketsSent              uint64
+	UnknownPortErrors        uint64
+	ReceiveBufferErrors      uint64
+	MalformedPacketsReceived uint64
+	PacketSendErrors         uint64
+	ChecksumErrors           uint64
+}
+
+// Stats returns a snapshot of the interface and stack counters. Interface
+// counters refer to the interface NIC, while protocol counters are stack
+// wide and therefore shared with interfaces using the same stack (e.g. VLAN
+// sub-interfaces).
+func (iface *Interface) Stats() (stats Stats) {
+	s := iface.Stack.Stats()
+
+	if info, ok := iface.Stack.NICInfo()[iface.nicid]; ok {
+		n := info.Stats
+
+		stats.RxPackets = n.Rx.Packets.Value()
+		stats.RxBytes = n.Rx.Bytes.Value()
+		stats.TxPackets = n.Tx.Packets.Value()
+		stats.TxBytes = n.Tx.Bytes.Value()
+		stats.TxDropped = n.TxPacketsDroppedNoBufferSpace.Value()
+		stats.UnreachableNeighbors = n.Neighbor.UnreachableEntryLookups.Value()
+	}
+
+	stats.DroppedPackets = s.DroppedPackets.Value()
+
+	stats.IP = IPStats{
+		PacketsReceived:                     s.IP.PacketsReceived.Value(),
+		PacketsDelivered:                    s.IP.PacketsDelivered.Value(),
+		PacketsSent:                         s.IP.PacketsSent.Value(),
+		MalformedPacketsReceived:            s.IP.MalformedPacketsReceived.Value(),
+		MalformedFragmentsReceived:          s.IP.MalformedFragmentsReceived.Value(),
+		InvalidDestinationAddressesReceived: s.IP.InvalidDestinationAddressesReceived.Value(),
+		OutgoingPacketErrors:                s.IP.OutgoingPacketErrors.Value(),
+	}
+
+	stats.ARP = ARPStats{
+		RequestsSent:             s.ARP.OutgoingRequestsSent.Value(),
+		RequestsReceived:         s.ARP.RequestsReceived.Value(),
+		RepliesSent:              s.ARP.OutgoingRepliesSent.Value(),
+		RepliesReceived:          s.ARP.RepliesReceived.Value(),
+		MalformedPacketsReceived: s.ARP.MalformedPacketsReceived.Value(),
+		RequestErrors: s.ARP.OutgoingRequestsDropped.Value() +
+			s.ARP.OutgoingRequestBadLocalAddressErrors.Value() +
+			s.ARP.OutgoingRequestInterfaceHasNoLocalAddressErrors.Value(),
+	}
+
+	v4, v6 := s.ICMP.V4, s.ICMP.V6
+
+	stats.ICMP = ICMPStats{
+		EchoRequestsReceived:   v4.PacketsReceived.EchoRequest.Value() + v6.PacketsReceived.EchoRequest.Value(),
+		EchoRepliesReceived:    v4.PacketsReceived.EchoReply.Value() + v6.PacketsReceived.EchoReply.Value(),
+		DstUnreachableReceived: v4.PacketsReceived.DstUnreachable.Value() + v6.PacketsReceived.DstUnreachable.Value(),
+		TimeExceededReceived:   v4.PacketsReceived.TimeExceeded.Value() + v6.PacketsReceived.TimeExceeded.Value(),
+		DstUnreachableSent:     v4.PacketsSent.DstUnreachable.Value() + v6.PacketsSent.DstUnreachable.Value(),
+		TimeExceededSent:       v4.PacketsSent.TimeExceeded.Value() + v6.PacketsSent.TimeExceeded.Value(),
+		InvalidPacketsReceived: v4.PacketsReceived.Invalid.Value() + v6.PacketsReceived.Invalid.Value(),
+		DroppedPacketsSent:     v4.PacketsSent.Dropped.Value() + v6.PacketsSent.Dropped.Value(),
+		RateLimitedPacketsSent: v4.PacketsSent.RateLimited.Value() + v6.PacketsSent.RateLimited.Value(),
+	}
+
+	stats.TCP = TCPStats{
+		ActiveConnectionOpenings:  s.TCP.ActiveConnectionOpenings.Value(),
+		PassiveConnectionOpenings: s.TCP.PassiveConnectionOpenings.Value(),
+		CurrentEstablished:        s.TCP.CurrentEstablished.Value(),
+		EstablishedResets:         s.TCP.EstablishedResets.Value(),
+		EstablishedTimedout:       s.TCP.EstablishedTimedout.Value(),
+		FailedConnectionAttempts:  s.TCP.FailedConnectionAttempts.Value(),
+		SegmentsReceived:          s.TCP.ValidSegmentsReceived.Value(),
+		InvalidSegmentsReceived:   s.TCP.InvalidSegmentsReceived.Value(),
+		SegmentsSent:              s.TCP.SegmentsSent.Value(),
+		SegmentSendErrors:         s.TCP.SegmentSendErrors.Value(),
+		ResetsSent:                s.TCP.ResetsSent.Value(),
+		ResetsReceived:            s.TCP.ResetsReceived.Value(),
+		Retransmits:               s.TCP.Retransmits.Value(),
+		Timeouts:                  s.TCP.Timeouts.Value(),
+		ChecksumErrors:            s.TCP.ChecksumErrors.Value(),
+		ListenOverflowDrops:       s.TCP.ListenOverflowSynDrop.Value() + s.TCP.ListenOverflowAckDrop.Value(),
+	}
+
+	stats.UDP = UDPStats{
+		PacketsReceived:          s.UDP.PacketsReceived.Value(),
+		PacketsSent:              s.UDP.PacketsSent.Value(),
+		UnknownPortErrors:        s.UDP.UnknownPortErrors.Value(),
+		ReceiveBufferErrors:      s.UDP.ReceiveBufferErrors.Value(),
+		MalformedPacketsReceived: s.UDP.MalformedPacketsReceived.Value(),
+		PacketSendErrors:         s.UDP.PacketSendErrors.Value(),
+		ChecksumErrors:           s.UDP.ChecksumErrors.Value(),
+	}
+
+	return
+}
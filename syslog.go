@@ -0,0 +1,315 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog constants (RFC 5424)
+const (
+	// SyslogPort is the syslog UDP and TCP port (RFC 5426, RFC 6587).
+	SyslogPort = 514
+	// SyslogTLSPort is the syslog TLS port (RFC 5425).
+	SyslogTLSPort = 6514
+
+	// DefaultSyslogFacility is the default facility (user-level
+	// messages).
+	DefaultSyslogFacility = 1
+
+	// maximum UDP message size (RFC 5426 - 3.2)
+	syslogMaxUDPSize = 1180
+	// nil value (RFC 5424 - 6)
+	syslogNil = "-"
+)
+
+// Syslog severities (RFC 5424 - 6.2.1)
+const (
+	SyslogEmergency = iota
+	SyslogAlert
+	SyslogCritical
+	SyslogError
+	SyslogWarning
+	SyslogNotice
+	SyslogInfo
+	SyslogDebug
+)
+
+// SyslogTimeout is the timeout for syslog connection establishment and
+// message transmission.
+var SyslogTimeout = 5 * time.Second
+
+// SyslogOptions represents syslog client configuration options.
+type SyslogOptions struct {
+	// Server is the syslog server address, in host or host:port form, the
+	// port defaults to the transport one.
+	Server string
+	// Network is the transport, "udp" (default), "tcp" or "tls".
+	Network string
+	// TLSConfig is the TLS client configuration for the "tls" transport.
+	TLSConfig *tls.Config
+
+	// Facility is the message facility code, 0 selects
+	// DefaultSyslogFacility.
+	Facility int
+	// Severity is the severity of messages sent through Write(), 0
+	// selects SyslogInfo.
+	Severity int
+
+	// Hostname is the message hostname, when empty the interface IPv4
+	// address is used.
+	Hostname string
+	// AppName is the message application name.
+	AppName string
+}
+
+// Syslog represents an RFC 5424 syslog client, it implements io.Writer to
+// allow its use as log output (e.g. with log.SetOutput()).
+type Syslog struct {
+	sync.Mutex
+
+	iface *Interface
+	opts  SyslogOptions
+
+	conn net.Conn
+}
+
+// DialSyslog returns a syslog client sending messages to the argument
+// server over the interface.
+//
+// Stream transports (TCP and TLS) use octet-counting framing (RFC 6587 -
+// 3.4.1, RFC 5425 - 4.3) and are re-established on transmission errors.
+func (iface *Interface) DialSyslog(opts SyslogOptions) (s *Syslog, err error) {
+	if len(opts.Network) == 0 {
+		opts.Network = "udp"
+	}
+
+	switch opts.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, errors.New("unsupported network")
+	}
+
+	if opts.Facility == 0 {
+		opts.Facility = DefaultSyslogFacility
+	}
+
+	if opts.Severity == 0 {
+		opts.Severity = SyslogInfo
+	}
+
+	if opts.Facility < 0 || opts.Facility > 23 || opts.Severity < 0 || opts.Severity > SyslogDebug {
+		return nil, errors.New("invalid facility or severity")
+	}
+
+	s = &Syslog{
+		iface: iface,
+		opts:  opts,
+	}
+
+	if err = s.dial(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (s *Syslog) dial() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SyslogTimeout)
+	defer cancel()
+
+	host, port := s.opts.Server, ""
+
+	if h, p, err := net.SplitHostPort(s.opts.Server); err == nil {
+		host, port = h, p
+	}
+
+	if len(port) == 0 {
+		port = strconv.Itoa(SyslogPort)
+
+		if s.opts.Network == "tls" {
+			port = strconv.Itoa(SyslogTLSPort)
+		}
+	}
+
+	if s.opts.Network != "udp" {
+		conn, err := s.iface.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+
+		if err != nil {
+			return err
+		}
+
+		if s.opts.Network == "tls" {
+			cfg := s.opts.TLSConfig
+
+			if cfg == nil {
+				cfg = &tls.Config{ServerName: host}
+			}
+
+			tlsConn := tls.Client(conn, cfg)
+
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return err
+			}
+
+			conn = tlsConn
+		}
+
+		s.conn = conn
+
+		return nil
+	}
+
+	addrs, err := s.iface.dialAddresses(ctx, "udp", host)
+
+	if err != nil {
+		return
+	}
+
+	addr := net.JoinHostPort(addrs[0].String(), port)
+
+	conn, err := s.iface.dialUDP("", addr, addressProtocol(addr), nil)
+
+	if err != nil {
+		return
+	}
+
+	s.conn = conn
+
+	return
+}
+
+// format returns an RFC 5424 message.
+func (s *Syslog) format(severity int, msg string) []byte {
+	hostname := s.opts.Hostname
+	appName := s.opts.AppName
+
+	if len(hostname) == 0 {
+		if addr := s.iface.address.Address; len(addr) > 0 {
+			hostname = addr.String()
+		}
+	}
+
+	if len(hostname) == 0 {
+		hostname = syslogNil
+	}
+
+	if len(appName) == 0 {
+		appName = syslogNil
+	}
+
+	// PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
+	// SP STRUCTURED-DATA SP MSG
+	buf := fmt.Sprintf("<%d>1 %s %s %s - - - %s",
+		s.opts.Facility*8+severity,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		hostname, appName, msg)
+
+	if s.opts.Network == "udp" && len(buf) > syslogMaxUDPSize {
+		buf = buf[:syslogMaxUDPSize]
+	}
+
+	if s.opts.Network != "udp" {
+		buf = strconv.Itoa(len(buf)) + " " + buf
+	}
+
+	return []byte(buf)
+}
+
+// Log sends a message with the argument severity.
+func (s *Syslog) Log(severity int, msg string) (err error) {
+	if severity < SyslogEmergency || severity > SyslogDebug {
+		return errors.New("invalid severity")
+	}
+
+	buf := s.format(severity, strings.TrimRight(msg, "\r\n"))
+
+	s.Lock()
+	defer s.Unlock()
+
+	for retry := s.opts.Network != "udp"; ; retry = false {
+		if s.conn == nil {
+			err = s.dial()
+		}
+
+		if err == nil {
+			s.conn.SetWriteDeadline(time.Now().Add(SyslogTimeout))
+
+			if _, err = s.conn.Write(buf); err == nil {
+				return
+			}
+		}
+
+		if s.conn != nil && s.opts.Network != "udp" {
+			s.conn.Close()
+			s.conn = nil
+		}
+
+		if !retry {
+			return
+		}
+	}
+}
+
+// Write sends a message with the configured severity (see
+// SyslogOptions.Severity), it implements io.Writer.
+func (s *Syslog) Write(p []byte) (n int, err error) {
+	if err = s.Log(s.opts.Severity, string(p)); err != nil {
+		return
+	}
+
+	return len(p), nil
+}
+
+// Writer returns an io.Writer sending messages with the argument severity.
+func (s *Syslog) Writer(severity int) io.Writer {
+	return &syslogWriter{s, severity}
+}
+
+// Logger returns a log.Logger sending messages with the argument severity.
+func (s *Syslog) Logger(severity int) *log.Logger {
+	return log.New(s.Writer(severity), "", 0)
+}
+
+// Close closes the syslog client connection.
+func (s *Syslog) Close() (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn != nil {
+		err = s.conn.Close()
+		s.conn = nil
+	}
+
+	return
+}
+
+type syslogWriter struct {
+	s        *Syslog
+	severity int
+}
+
+func (w *syslogWriter) Write(p []byte) (n int, err error) {
+	if err = w.s.Log(w.severity, string(p)); err != nil {
+		return
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,138 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// FrameInfo represents the metadata of a frame observed by a tap (see
+// OnRxFrame() and OnTxFrame()).
+type FrameInfo struct {
+	// Time is the frame observation time.
+	Time time.Time
+	// Timestamp is the frame timer-sampled (software) timestamp, taken
+	// from the PTP clock by the driver, it is only set when timestamping
+	// is enabled for the frame direction (see SetTimestamping()).
+	Timestamp time.Time
+	// Tx is true for transmitted frames.
+	Tx bool
+	// Length is the frame length, excluding the FCS.
+	Length int
+
+	// Dst is the destination hardware address.
+	Dst net.HardwareAddr
+	// Src is the source hardware address.
+	Src net.HardwareAddr
+	// EtherType is the frame EtherType.
+	EtherType uint16
+
+	// SrcIP is the IP source address, only set for IP frames.
+	SrcIP net.IP
+	// DstIP is the IP destination address, only set for IP frames.
+	DstIP net.IP
+	// Protocol is the IP transport protocol, only set for IP frames.
+	Protocol tcpip.TransportProtocolNumber
+	// SrcPort is the TCP or UDP source port.
+	SrcPort uint16
+	// DstPort is the TCP or UDP destination port.
+	DstPort uint16
+}
+
+type taps struct {
+	sync.RWMutex
+
+	rx []func(FrameInfo, []byte)
+	tx []func(FrameInfo, []byte)
+}
+
+// frameInfo returns the metadata of an Ethernet frame.
+func frameInfo(buf []byte, tx bool, ts time.Time) (info FrameInfo) {
+	info.Time = time.Now()
+	info.Timestamp = ts
+	info.Tx = tx
+	info.Length = len(buf)
+
+	f, ok := parseFrame(buf)
+
+	if !ok {
+		return
+	}
+
+	info.Dst = net.HardwareAddr(f.dst)
+	info.Src = net.HardwareAddr(f.src)
+	info.EtherType = uint16(f.proto)
+
+	if f.isIP() {
+		info.SrcIP = net.IP(f.srcAddr)
+		info.DstIP = net.IP(f.dstAddr)
+		info.Protocol = f.transport
+		info.SrcPort = f.srcPort
+		info.DstPort = f.dstPort
+	}
+
+	return
+}
+
+// invoke passes a frame, and its timestamp, to the registered taps
+// for its direction.
+func (t *taps) invoke(buf []byte, tx bool, ts time.Time) {
+	if len(buf) == 0 {
+		return
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	handlers := t.rx
+
+	if tx {
+		handlers = t.tx
+	}
+
+	if len(handlers) == 0 {
+		return
+	}
+
+	info := frameInfo(buf, tx, ts)
+
+	for _, fn := range handlers {
+		fn(info, buf)
+	}
+}
+
+// OnRxFrame registers a tap handler invoked with every Ethernet frame
+// received by the interface, before any filtering or processing.
+//
+// Handlers are invoked synchronously on the receive path and must therefore
+// return quickly, the frame payload view must not be modified or retained
+// (it must be copied instead).
+func (iface *Interface) OnRxFrame(fn func(FrameInfo, []byte)) {
+	iface.NIC.taps.Lock()
+	defer iface.NIC.taps.Unlock()
+
+	iface.NIC.taps.rx = append(iface.NIC.taps.rx, fn)
+}
+
+// OnTxFrame registers a tap handler invoked with every Ethernet frame
+// transmitted by the interface, as passed to the device.
+//
+// Handlers are invoked synchronously on the transmit path and must therefore
+// return quickly, the frame payload view must not be modified or retained
+// (it must be copied instead).
+func (iface *Interface) OnTxFrame(fn func(FrameInfo, []byte)) {
+	iface.NIC.taps.Lock()
+	defer iface.NIC.taps.Unlock()
+
+	iface.NIC.taps.tx = append(iface.NIC.taps.tx, fn)
+}
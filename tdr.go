@@ -0,0 +1,227 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"time"
+)
+
+// cableDiagTimeout is the maximum time waited for a single pair Time Domain
+// Reflectometry test completion.
+const cableDiagTimeout = 1 * time.Second
+
+// CableStatus represents the Time Domain Reflectometry result of a cable
+// pair.
+type CableStatus int
+
+// Cable pair status
+const (
+	CableOK CableStatus = iota
+	CableOpen
+	CableShort
+	CableTestFailed
+)
+
+func (s CableStatus) String() string {
+	switch s {
+	case CableOK:
+		return "ok"
+	case CableOpen:
+		return "open"
+	case CableShort:
+		return "short"
+	default:
+		return "test failed"
+	}
+}
+
+// CablePair represents the cable diagnostics result of a twisted pair.
+type CablePair struct {
+	// Pair is the MDI pair index (0 to 3 for pairs A to D).
+	Pair int
+	// Status is the pair test result.
+	Status CableStatus
+	// Length is the estimated distance, in meters, to the fault, only
+	// reported on open or short pairs.
+	Length float64
+}
+
+// CableTester is implemented by PHY drivers supporting cable diagnostics
+// through Time Domain Reflectometry (TDR).
+type CableTester interface {
+	// CableDiag performs the cable test on all supported pairs.
+	CableDiag(eth *NIC) ([]CablePair, error)
+}
+
+// CableDiag performs Ethernet cable diagnostics, through the PHY Time Domain
+// Reflectometry capability, reporting open and short pairs along with the
+// estimated distance to the fault.
+//
+// The PHY driver (see PHYDriver) must implement CableTester. The test
+// disrupts the link, which is re-established on completion.
+func (eth *NIC) CableDiag() ([]CablePair, error) {
+	tester, ok := eth.PHY.(CableTester)
+
+	if !ok {
+		return nil, errors.New("cable diagnostics not supported by PHY driver")
+	}
+
+	return tester.CableDiag(eth)
+}
+
+// CableDiag performs Ethernet cable diagnostics (see NIC.CableDiag()).
+func (iface *Interface) CableDiag() ([]CablePair, error) {
+	return iface.NIC.CableDiag()
+}
+
+// waitPHY polls a PHY register until the argument bit is cleared.
+func waitPHY(eth *NIC, ra int, bit int) (data uint16, err error) {
+	deadline := time.Now().Add(cableDiagTimeout)
+
+	for time.Now().Before(deadline) {
+		if data, err = eth.ReadPHY(ra); err != nil || data&(1<<bit) == 0 {
+			return
+		}
+
+		time.Sleep(linkPollInterval)
+	}
+
+	return 0, errors.New("cable test timeout")
+}
+
+// AR8035 cable diagnostics registers
+const (
+	AR8035_CDT_CTRL   = 0x16
+	CDT_CTRL_MDI_PAIR = 8
+	CDT_CTRL_ENABLE   = 0
+
+	AR8035_CDT_STATUS      = 0x1c
+	CDT_STATUS_STAT        = 8
+	CDT_STATUS_STAT_MASK   = 0b11
+	CDT_STATUS_DELTA_MASK  = 0xff
+	CDT_STATUS_STAT_NORMAL = 0b00
+	CDT_STATUS_STAT_SHORT  = 0b01
+	CDT_STATUS_STAT_OPEN   = 0b10
+)
+
+// CableDiag implements CableTester.CableDiag(), all four pairs are tested.
+func (phy *AR8035) CableDiag(eth *NIC) (pairs []CablePair, err error) {
+	for pair := 0; pair < 4; pair++ {
+		if err = eth.WritePHY(AR8035_CDT_CTRL, uint16(pair<<CDT_CTRL_MDI_PAIR|1<<CDT_CTRL_ENABLE)); err != nil {
+			return
+		}
+
+		if _, err = waitPHY(eth, AR8035_CDT_CTRL, CDT_CTRL_ENABLE); err != nil {
+			return
+		}
+
+		status, err := eth.ReadPHY(AR8035_CDT_STATUS)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res := CablePair{
+			Pair: pair,
+		}
+
+		switch (status >> CDT_STATUS_STAT) & CDT_STATUS_STAT_MASK {
+		case CDT_STATUS_STAT_NORMAL:
+			res.Status = CableOK
+		case CDT_STATUS_STAT_SHORT:
+			res.Status = CableShort
+		case CDT_STATUS_STAT_OPEN:
+			res.Status = CableOpen
+		default:
+			res.Status = CableTestFailed
+		}
+
+		if res.Status == CableShort || res.Status == CableOpen {
+			res.Length = float64(status&CDT_STATUS_DELTA_MASK) * 0.824
+		}
+
+		pairs = append(pairs, res)
+	}
+
+	return
+}
+
+// KSZ8081 LinkMD cable diagnostics registers
+const (
+	KSZ8081_LINKMD         = 0x1d
+	LINKMD_ENABLE          = 15
+	LINKMD_RESULT          = 13
+	LINKMD_RESULT_MASK     = 0b11
+	LINKMD_RESULT_NORMAL   = 0b00
+	LINKMD_RESULT_OPEN     = 0b01
+	LINKMD_RESULT_SHORT    = 0b10
+	LINKMD_FAULT_MASK      = 0x1ff
+	PHY_CTRL2_DISABLE_MDIX = 13
+)
+
+// CableDiag implements CableTester.CableDiag(), the test requires the link
+// to be forced at 100 Mbps without Auto MDI/MDI-X, therefore only the
+// transmit pair (0) is tested. The PHY configuration is restored on
+// completion.
+func (phy *KSZ8081) CableDiag(eth *NIC) (pairs []CablePair, err error) {
+	bmcr, err := eth.ReadPHY(MII_BMCR)
+
+	if err != nil {
+		return
+	}
+
+	ctrl2, err := eth.ReadPHY(KSZ8081_PHY_CTRL2)
+
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		eth.WritePHY(KSZ8081_PHY_CTRL2, ctrl2)
+		eth.WritePHY(MII_BMCR, bmcr)
+	}()
+
+	if err = eth.WritePHY(MII_BMCR, 1<<BMCR_SPEED_SELECT|1<<BMCR_DUPLEX_MODE); err != nil {
+		return
+	}
+
+	if err = eth.WritePHY(KSZ8081_PHY_CTRL2, ctrl2&^(1<<PHY_CTRL2_HP_MDIX)|1<<PHY_CTRL2_DISABLE_MDIX); err != nil {
+		return
+	}
+
+	if err = eth.WritePHY(KSZ8081_LINKMD, 1<<LINKMD_ENABLE); err != nil {
+		return
+	}
+
+	status, err := waitPHY(eth, KSZ8081_LINKMD, LINKMD_ENABLE)
+
+	if err != nil {
+		return
+	}
+
+	res := CablePair{}
+
+	switch (status >> LINKMD_RESULT) & LINKMD_RESULT_MASK {
+	case LINKMD_RESULT_NORMAL:
+		res.Status = CableOK
+	case LINKMD_RESULT_OPEN:
+		res.Status = CableOpen
+	case LINKMD_RESULT_SHORT:
+		res.Status = CableShort
+	default:
+		res.Status = CableTestFailed
+	}
+
+	if res.Status == CableShort || res.Status == CableOpen {
+		res.Length = float64(status&LINKMD_FAULT_MASK) * 0.38
+	}
+
+	return append(pairs, res), nil
+}
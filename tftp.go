@@ -0,0 +1,378 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// TFTP constants (RFC 1350, RFC 2347, RFC 2348, RFC 2349)
+const (
+	// TFTPPort is the TFTP server UDP port.
+	TFTPPort = 69
+
+	// DefaultTFTPBlockSize is the block size requested by default, the
+	// largest one fitting an Ethernet frame without IP fragmentation.
+	DefaultTFTPBlockSize = 1428
+	// DefaultTFTPTimeout is the default retransmission timeout.
+	DefaultTFTPTimeout = 1 * time.Second
+	// DefaultTFTPRetries is the default number of retransmissions.
+	DefaultTFTPRetries = 5
+
+	tftpRRQ   = 1
+	tftpWRQ   = 2
+	tftpDATA  = 3
+	tftpACK   = 4
+	tftpERROR = 5
+	tftpOACK  = 6
+
+	tftpErrorUndefined = 0
+	tftpErrorNotFound  = 1
+	tftpErrorAccess    = 2
+	tftpErrorIllegal   = 4
+	tftpErrorUnknownID = 5
+	tftpErrorOption    = 8
+
+	tftpHeaderLength = 4
+	// RFC 1350 block size
+	tftpBlockSize = 512
+	// RFC 2348 block size range
+	tftpMinBlockSize = 8
+	tftpMaxBlockSize = 65464
+
+	tftpOptionBlockSize    = "blksize"
+	tftpOptionTransferSize = "tsize"
+)
+
+// TFTPOptions represents TFTP transfer options.
+type TFTPOptions struct {
+	// BlockSize is the requested block size (RFC 2348), 0 selects
+	// DefaultTFTPBlockSize. Servers not supporting option negotiation
+	// fall back to 512 bytes blocks.
+	BlockSize int
+	// Timeout is the retransmission timeout, 0 selects
+	// DefaultTFTPTimeout.
+	Timeout time.Duration
+	// Retries is the number of retransmissions before a transfer is
+	// aborted, 0 selects DefaultTFTPRetries.
+	Retries int
+}
+
+func (opts *TFTPOptions) defaults() (o TFTPOptions, err error) {
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.BlockSize == 0 {
+		o.BlockSize = DefaultTFTPBlockSize
+	}
+
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTFTPTimeout
+	}
+
+	if o.Retries == 0 {
+		o.Retries = DefaultTFTPRetries
+	}
+
+	if o.BlockSize < tftpMinBlockSize || o.BlockSize > tftpMaxBlockSize || o.Timeout < 0 || o.Retries < 0 {
+		return o, errors.New("invalid TFTP options")
+	}
+
+	return
+}
+
+// TFTPError represents an error reported by a TFTP peer.
+type TFTPError struct {
+	Code    int
+	Message string
+}
+
+// Error returns the error message.
+func (e *TFTPError) Error() string {
+	return fmt.Sprintf("TFTP error %d (%s)", e.Code, e.Message)
+}
+
+// tftpRequest returns a read or write request.
+func tftpRequest(op uint16, filename string, opts map[string]string, order []string) []byte {
+	buf := make([]byte, 2, 2+len(filename)+7)
+	binary.BigEndian.PutUint16(buf, op)
+
+	buf = append(buf, filename...)
+	buf = append(buf, 0)
+	buf = append(buf, "octet"...)
+	buf = append(buf, 0)
+
+	return appendTFTPOptions(buf, opts, order)
+}
+
+// appendTFTPOptions appends name/value option pairs, in the argument order.
+func appendTFTPOptions(buf []byte, opts map[string]string, order []string) []byte {
+	for _, name := range order {
+		if val, ok := opts[name]; ok {
+			buf = append(buf, name...)
+			buf = append(buf, 0)
+			buf = append(buf, val...)
+			buf = append(buf, 0)
+		}
+	}
+
+	return buf
+}
+
+// tftpStrings returns the NUL terminated strings of a request or option
+// acknowledgment.
+func tftpStrings(buf []byte) (s []string, err error) {
+	if len(buf) > 0 && buf[len(buf)-1] != 0 {
+		return nil, errors.New("invalid TFTP packet")
+	}
+
+	for _, b := range bytes.Split(buf, []byte{0}) {
+		s = append(s, string(b))
+	}
+
+	// drop the empty string following the last terminator
+	return s[:len(s)-1], nil
+}
+
+// tftpOptions parses name/value option pairs.
+func tftpOptions(s []string) (opts map[string]string) {
+	opts = make(map[string]string)
+
+	for i := 0; i+1 < len(s); i += 2 {
+		opts[string(bytes.ToLower([]byte(s[i])))] = s[i+1]
+	}
+
+	return
+}
+
+func tftpACKPacket(block uint16) []byte {
+	buf := make([]byte, tftpHeaderLength)
+	binary.BigEndian.PutUint16(buf[0:2], tftpACK)
+	binary.BigEndian.PutUint16(buf[2:4], block)
+	return buf
+}
+
+func tftpErrorPacket(code int, msg string) []byte {
+	buf := make([]byte, tftpHeaderLength, tftpHeaderLength+len(msg)+1)
+	binary.BigEndian.PutUint16(buf[0:2], tftpERROR)
+	binary.BigEndian.PutUint16(buf[2:4], uint16(code))
+	buf = append(buf, msg...)
+	return append(buf, 0)
+}
+
+// tftpPeerError returns the error carried by an ERROR packet.
+func tftpPeerError(buf []byte) error {
+	msg := bytes.TrimRight(buf[tftpHeaderLength:], "\x00")
+	return &TFTPError{Code: int(binary.BigEndian.Uint16(buf[2:4])), Message: string(msg)}
+}
+
+// tftpExchange sends a packet to the argument address, retransmitting it
+// until a valid response is received from the peer or retries are exhausted.
+// The peer transfer identifier is learnt from the first response when its
+// port is zero.
+func tftpExchange(ctx context.Context, conn net.PacketConn, dst net.Addr, peer *net.UDPAddr, pkt []byte, buf []byte, opts TFTPOptions, valid func([]byte) bool) (n int, err error) {
+	learn := peer.Port == 0
+
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		if _, err = conn.WriteTo(pkt, dst); err != nil {
+			return
+		}
+
+		deadline := time.Now().Add(opts.Timeout)
+
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+
+		conn.SetReadDeadline(deadline)
+
+		for {
+			var addr net.Addr
+
+			if n, addr, err = conn.ReadFrom(buf); err != nil {
+				break
+			}
+
+			src, ok := addr.(*net.UDPAddr)
+
+			if !ok || !src.IP.Equal(peer.IP) || n < tftpHeaderLength {
+				continue
+			}
+
+			if learn {
+				peer.Port = src.Port
+				learn = false
+			} else if src.Port != peer.Port {
+				// RFC 1350 - 4
+				conn.WriteTo(tftpErrorPacket(tftpErrorUnknownID, "unknown transfer ID"), src)
+				continue
+			}
+
+			if binary.BigEndian.Uint16(buf[0:2]) == tftpERROR {
+				return 0, tftpPeerError(buf[:n])
+			}
+
+			if valid(buf[:n]) {
+				return n, nil
+			}
+		}
+
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			return
+		}
+	}
+
+	return 0, errors.New("TFTP timeout")
+}
+
+// tftpDial returns the server address and an unconnected UDP endpoint for a
+// TFTP transfer.
+func (iface *Interface) tftpDial(ctx context.Context, server string) (peer *net.UDPAddr, conn *UDPConn, err error) {
+	host, port := server, strconv.Itoa(TFTPPort)
+
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+
+	addrs, err := iface.dialAddresses(ctx, "udp", host)
+
+	if err != nil {
+		return
+	}
+
+	addr := net.JoinHostPort(addrs[0].String(), port)
+
+	if peer, err = net.ResolveUDPAddr("udp", addr); err != nil {
+		return
+	}
+
+	conn, err = iface.dialUDP("", "", addressProtocol(addr), nil)
+
+	return
+}
+
+// TFTPGet fetches a file from a TFTP server, in host or host:port form,
+// writing its content to the argument writer. The transfer size is returned
+// once complete.
+//
+// The block size (RFC 2348) and transfer size (RFC 2349) options are
+// negotiated, files larger than 65535 blocks are supported through block
+// number roll over.
+func (iface *Interface) TFTPGet(ctx context.Context, server string, filename string, w io.Writer, opts *TFTPOptions) (size int64, err error) {
+	o, err := opts.defaults()
+
+	if err != nil {
+		return
+	}
+
+	peer, conn, err := iface.tftpDial(ctx, server)
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// the server transfer identifier is learnt from its first response
+	tid := *peer
+	tid.Port = 0
+
+	req := tftpRequest(tftpRRQ, filename, map[string]string{
+		tftpOptionBlockSize:    strconv.Itoa(o.BlockSize),
+		tftpOptionTransferSize: "0",
+	}, []string{tftpOptionBlockSize, tftpOptionTransferSize})
+
+	blockSize := tftpBlockSize
+	transferSize := int64(-1)
+	buf := make([]byte, tftpHeaderLength+tftpMaxBlockSize)
+	block := uint16(1)
+
+	// other packets, including duplicates of the previous block, are
+	// ignored and eventually trigger retransmission
+	expected := func(b []byte) bool {
+		return binary.BigEndian.Uint16(b[0:2]) == tftpDATA && binary.BigEndian.Uint16(b[2:4]) == block
+	}
+
+	// the option acknowledgment is only valid in response to the request
+	oack := func(b []byte) bool {
+		return binary.BigEndian.Uint16(b[0:2]) == tftpOACK || expected(b)
+	}
+
+	n, err := tftpExchange(ctx, conn, peer, &tid, req, buf, o, oack)
+
+	if err != nil {
+		return
+	}
+
+	if binary.BigEndian.Uint16(buf[0:2]) == tftpOACK {
+		s, err := tftpStrings(buf[2:n])
+
+		if err != nil {
+			return 0, err
+		}
+
+		accepted := tftpOptions(s)
+
+		if val, ok := accepted[tftpOptionBlockSize]; ok {
+			if blockSize, err = strconv.Atoi(val); err != nil || blockSize < tftpMinBlockSize || blockSize > o.BlockSize {
+				conn.WriteTo(tftpErrorPacket(tftpErrorOption, "invalid block size"), &tid)
+				return 0, errors.New("invalid negotiated block size")
+			}
+		}
+
+		if val, ok := accepted[tftpOptionTransferSize]; ok {
+			if transferSize, err = strconv.ParseInt(val, 10, 64); err != nil || transferSize < 0 {
+				transferSize = -1
+			}
+		}
+
+		if n, err = tftpExchange(ctx, conn, &tid, &tid, tftpACKPacket(0), buf, o, expected); err != nil {
+			return 0, err
+		}
+	}
+
+	for {
+		data := buf[tftpHeaderLength:n]
+
+		if _, err = w.Write(data); err != nil {
+			conn.WriteTo(tftpErrorPacket(tftpErrorUndefined, "write error"), &tid)
+			return
+		}
+
+		size += int64(len(data))
+		ack := tftpACKPacket(block)
+		block++
+
+		if len(data) < blockSize {
+			// the final acknowledgment is not retransmitted, the
+			// server resends the last block if it is lost
+			if _, err = conn.WriteTo(ack, &tid); err == nil && transferSize >= 0 && size != transferSize {
+				err = fmt.Errorf("transfer size mismatch (%d != %d)", size, transferSize)
+			}
+
+			return
+		}
+
+		if n, err = tftpExchange(ctx, conn, &tid, &tid, ack, buf, o, expected); err != nil {
+			return
+		}
+	}
+}
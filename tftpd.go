@@ -0,0 +1,280 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TFTPServerOptions represents TFTP server configuration options.
+type TFTPServerOptions struct {
+	// Port is the listening UDP port, 0 selects TFTPPort.
+	Port uint16
+
+	// FS is the file system serving read requests, file names are
+	// interpreted relative to its root.
+	FS fs.FS
+	// Open, when not nil, is invoked instead of FS to serve read
+	// requests, it returns the requested file content. The transfer size
+	// option (RFC 2349) is only supported for readers implementing
+	// Stat() (e.g. fs.File).
+	Open func(filename string, remote net.Addr) (io.ReadCloser, error)
+
+	// TFTPOptions sets the maximum block size accepted in negotiation,
+	// the retransmission timeout and retries.
+	TFTPOptions
+}
+
+// TFTPServer represents a TFTP server instance.
+type TFTPServer struct {
+	iface *Interface
+	opts  TFTPOptions
+	open  func(filename string, remote net.Addr) (io.ReadCloser, error)
+
+	conns []net.PacketConn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// StartTFTPServer starts a read-only TFTP server (RFC 1350) on the interface
+// IPv4 and, when enabled, IPv6 addresses, serving files from the argument
+// file system or callback.
+//
+// Transfers are always performed in octet mode, the block size (RFC 2348)
+// and transfer size (RFC 2349) options are supported. Write requests are
+// rejected.
+func (iface *Interface) StartTFTPServer(opts TFTPServerOptions) (s *TFTPServer, err error) {
+	if opts.FS == nil && opts.Open == nil {
+		return nil, errors.New("missing file system")
+	}
+
+	if opts.Port == 0 {
+		opts.Port = TFTPPort
+	}
+
+	o, err := opts.TFTPOptions.defaults()
+
+	if err != nil {
+		return
+	}
+
+	s = &TFTPServer{
+		iface: iface,
+		opts:  o,
+		open:  opts.Open,
+	}
+
+	if s.open == nil {
+		fsys := opts.FS
+
+		s.open = func(filename string, _ net.Addr) (io.ReadCloser, error) {
+			return fsys.Open(strings.TrimPrefix(filename, "/"))
+		}
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	address := net.JoinHostPort("", strconv.Itoa(int(opts.Port)))
+
+	conn, err := iface.DialUDP4(address, "")
+
+	if err != nil {
+		return
+	}
+
+	s.conns = append(s.conns, conn)
+
+	if iface.opts.IPv6 != nil {
+		conn, err := iface.DialUDP6(address, "")
+
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+
+		s.conns = append(s.conns, conn)
+	}
+
+	for _, conn := range s.conns {
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+
+	return
+}
+
+func (s *TFTPServer) serve(conn net.PacketConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, MaxMTU)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+
+			continue
+		}
+
+		remote, ok := addr.(*net.UDPAddr)
+
+		if !ok || n < tftpHeaderLength {
+			continue
+		}
+
+		req := append([]byte{}, buf[:n]...)
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			s.transfer(conn, remote, req)
+		}()
+	}
+}
+
+// transfer serves a request, from a dedicated transfer identifier.
+func (s *TFTPServer) transfer(listener net.PacketConn, remote *net.UDPAddr, req []byte) {
+	switch binary.BigEndian.Uint16(req[0:2]) {
+	case tftpRRQ:
+	case tftpWRQ:
+		listener.WriteTo(tftpErrorPacket(tftpErrorAccess, "write not supported"), remote)
+		return
+	default:
+		listener.WriteTo(tftpErrorPacket(tftpErrorIllegal, "illegal operation"), remote)
+		return
+	}
+
+	fields, err := tftpStrings(req[2:])
+
+	if err != nil || len(fields) < 2 {
+		listener.WriteTo(tftpErrorPacket(tftpErrorIllegal, "invalid request"), remote)
+		return
+	}
+
+	proto := addressProtocol(remote.String())
+	conn, err := s.iface.dialUDP("", "", proto, nil)
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	f, err := s.open(fields[0], remote)
+
+	if err != nil {
+		code := tftpErrorUndefined
+
+		if errors.Is(err, fs.ErrNotExist) {
+			code = tftpErrorNotFound
+		} else if errors.Is(err, fs.ErrPermission) {
+			code = tftpErrorAccess
+		}
+
+		conn.WriteTo(tftpErrorPacket(code, err.Error()), remote)
+		return
+	}
+	defer f.Close()
+
+	blockSize := tftpBlockSize
+	requested := tftpOptions(fields[2:])
+	accepted := make(map[string]string)
+
+	if val, ok := requested[tftpOptionBlockSize]; ok {
+		if size, err := strconv.Atoi(val); err == nil && size >= tftpMinBlockSize {
+			if size > s.opts.BlockSize {
+				size = s.opts.BlockSize
+			}
+
+			blockSize = size
+			accepted[tftpOptionBlockSize] = strconv.Itoa(size)
+		}
+	}
+
+	if _, ok := requested[tftpOptionTransferSize]; ok {
+		if st, ok := f.(interface{ Stat() (fs.FileInfo, error) }); ok {
+			if info, err := st.Stat(); err == nil && info.Mode().IsRegular() {
+				accepted[tftpOptionTransferSize] = strconv.FormatInt(info.Size(), 10)
+			}
+		}
+	}
+
+	buf := make([]byte, tftpHeaderLength+tftpMaxBlockSize)
+	block := uint16(0)
+
+	acknowledged := func(b []byte) bool {
+		return binary.BigEndian.Uint16(b[0:2]) == tftpACK && binary.BigEndian.Uint16(b[2:4]) == block
+	}
+
+	if len(accepted) > 0 {
+		oack := make([]byte, 2)
+		binary.BigEndian.PutUint16(oack, tftpOACK)
+		oack = appendTFTPOptions(oack, accepted, []string{tftpOptionBlockSize, tftpOptionTransferSize})
+
+		if _, err = tftpExchange(s.ctx, conn, remote, remote, oack, buf, s.opts, acknowledged); err != nil {
+			return
+		}
+	}
+
+	data := make([]byte, tftpHeaderLength+blockSize)
+	binary.BigEndian.PutUint16(data[0:2], tftpDATA)
+
+	for {
+		n, err := io.ReadFull(f, data[tftpHeaderLength:])
+
+		switch err {
+		case nil, io.EOF, io.ErrUnexpectedEOF:
+		default:
+			conn.WriteTo(tftpErrorPacket(tftpErrorUndefined, "read error"), remote)
+			return
+		}
+
+		block++
+		binary.BigEndian.PutUint16(data[2:4], block)
+
+		if _, err = tftpExchange(s.ctx, conn, remote, remote, data[:tftpHeaderLength+n], buf, s.opts, acknowledged); err != nil {
+			return
+		}
+
+		if n < blockSize {
+			return
+		}
+	}
+}
+
+// Close stops the TFTP server, aborting transfers in progress.
+func (s *TFTPServer) Close() (err error) {
+	s.once.Do(func() {
+		s.cancel()
+
+		for _, conn := range s.conns {
+			if e := conn.Close(); e != nil {
+				err = e
+			}
+		}
+
+		s.wg.Wait()
+	})
+
+	return
+}
@@ -0,0 +1,66 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"errors"
+	"time"
+)
+
+// SetTimestamping enables or disables timer-sampled (software) timestamping
+// of received and transmitted frames, timestamps are sampled by the driver
+// from the ENET IEEE 1588 timer (see EnablePTPClock()) and reported to taps
+// (see FrameInfo).
+//
+// Received frames are timestamped as soon as they are handed over by the
+// device, transmitted ones right before being handed over to it, as ENET
+// per-frame hardware timestamps are not supported (see PTPSlave).
+// Timestamps therefore include the driver receive and transmit latency. Each
+// timestamp requires a timer capture, therefore timestamping should only be
+// enabled when required.
+func (eth *NIC) SetTimestamping(rx bool, tx bool) (err error) {
+	if (rx || tx) && eth.ptp == nil {
+		return errors.New("PTP clock not enabled")
+	}
+
+	eth.rxTimestamps = rx
+	eth.txTimestamps = tx
+
+	return
+}
+
+// timestamp returns the timer-sampled timestamp for a frame in the argument
+// direction, the zero time is returned when timestamping is disabled.
+func (eth *NIC) timestamp(tx bool) (ts time.Time) {
+	c := eth.ptp
+
+	if c == nil || (tx && !eth.txTimestamps) || (!tx && !eth.rxTimestamps) {
+		return
+	}
+
+	return c.Time()
+}
+
+// TransmitTimestamp transmits a fully-formed Ethernet frame, like
+// Transmit(), and returns its timer-sampled (software) transmit timestamp,
+// sampled from the ENET IEEE 1588 timer (see EnablePTPClock()) right before
+// the frame is handed over to the device.
+func (eth *NIC) TransmitTimestamp(frame []byte) (ts time.Time, err error) {
+	if eth.ptp == nil {
+		return ts, errors.New("PTP clock not enabled")
+	}
+
+	return eth.transmit(frame, true)
+}
+
+// SetTimestamping enables or disables timer-sampled (software) timestamping
+// of received and transmitted frames (see NIC.SetTimestamping()).
+func (iface *Interface) SetTimestamping(rx bool, tx bool) error {
+	return iface.NIC.SetTimestamping(rx, tx)
+}
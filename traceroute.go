@@ -0,0 +1,243 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// TracerouteMaxHops is the maximum number of hops probed by Traceroute().
+var TracerouteMaxHops = 30
+
+// TracerouteHop represents a Traceroute() hop.
+type TracerouteHop struct {
+	// TTL is the probe time-to-live (or hop limit).
+	TTL int
+	// Address is the IP address of the hop, it is empty when no reply was
+	// received within PingTimeout.
+	Address string
+	// RTT is the probe round-trip time.
+	RTT time.Duration
+}
+
+// probe represents the outcome of a traceroute probe.
+type probe struct {
+	reached     bool
+	unreachable bool
+}
+
+// matchProbe returns whether an ICMP message is related to the echo request
+// with the argument identifier and sequence number, either as its reply or
+// as an error quoting it.
+func matchProbe(proto tcpip.NetworkProtocolNumber, msg []byte, ident uint16, seq uint16) (p probe, ok bool) {
+	var quoted []byte
+
+	if len(msg) < header.ICMPv4MinimumSize {
+		return
+	}
+
+	if proto == ipv4.ProtocolNumber {
+		switch h := header.ICMPv4(msg); h.Type() {
+		case header.ICMPv4EchoReply:
+			return probe{reached: true}, h.Ident() == ident && h.Sequence() == seq
+		case header.ICMPv4TimeExceeded:
+		case header.ICMPv4DstUnreachable:
+			p.unreachable = true
+		default:
+			return
+		}
+
+		ip := header.IPv4(msg[header.ICMPv4MinimumSize:])
+
+		if len(ip) < header.IPv4MinimumSize || len(ip) < int(ip.HeaderLength()) {
+			return
+		}
+
+		quoted = ip[ip.HeaderLength():]
+	} else {
+		switch h := header.ICMPv6(msg); h.Type() {
+		case header.ICMPv6EchoReply:
+			return probe{reached: true}, h.Ident() == ident && h.Sequence() == seq
+		case header.ICMPv6TimeExceeded:
+		case header.ICMPv6DstUnreachable:
+			p.unreachable = true
+		default:
+			return
+		}
+
+		// extension headers are not expected on quoted echo requests
+		ip := header.IPv6(msg[header.ICMPv6MinimumSize:])
+
+		if len(ip) < header.IPv6MinimumSize || ip.TransportProtocol() != header.ICMPv6ProtocolNumber {
+			return
+		}
+
+		quoted = ip[header.IPv6MinimumSize:]
+	}
+
+	// the echo identifier and sequence fields share the same offset in
+	// ICMPv4 and ICMPv6
+	if len(quoted) < header.ICMPv4MinimumSize {
+		return
+	}
+
+	echo := header.ICMPv4(quoted)
+
+	return p, echo.Ident() == ident && echo.Sequence() == seq
+}
+
+func (iface *Interface) traceProbe(ctx context.Context, conn *gonet.UDPConn, ep tcpip.Endpoint, dst *net.UDPAddr, ttl int, ident uint16, buf []byte) (hop TracerouteHop, p probe, err error) {
+	proto := ipv4.ProtocolNumber
+
+	if dst.IP.To4() == nil {
+		proto = ipv6.ProtocolNumber
+	}
+
+	hop.TTL = ttl
+	seq := uint16(ttl)
+	msg := echoRequest(proto, seq)
+
+	if proto == ipv4.ProtocolNumber {
+		h := header.ICMPv4(msg)
+		h.SetIdent(ident)
+		h.SetChecksum(header.ICMPv4Checksum(h, 0))
+
+		if tcpErr := ep.SetSockOptInt(tcpip.IPv4TTLOption, ttl); tcpErr != nil {
+			return hop, p, fmt.Errorf("setsockopt error (icmp): %v", tcpErr)
+		}
+	} else {
+		// the ICMPv6 checksum is set by the stack
+		header.ICMPv6(msg).SetIdent(ident)
+
+		if tcpErr := ep.SetSockOptInt(tcpip.IPv6HopLimitOption, ttl); tcpErr != nil {
+			return hop, p, fmt.Errorf("setsockopt error (icmp): %v", tcpErr)
+		}
+	}
+
+	deadline := time.Now().Add(PingTimeout)
+
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn.SetDeadline(deadline)
+	start := time.Now()
+
+	if _, err = conn.WriteTo(msg, dst); err != nil {
+		return
+	}
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			var netErr net.Error
+
+			if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+				err = nil
+			}
+
+			return hop, p, err
+		}
+
+		res := buf[:n]
+
+		// raw IPv4 endpoints return the IP header
+		if proto == ipv4.ProtocolNumber {
+			ip := header.IPv4(res)
+
+			if len(ip) < header.IPv4MinimumSize || len(ip) < int(ip.HeaderLength()) {
+				continue
+			}
+
+			res = ip[ip.HeaderLength():]
+		}
+
+		if p, ok := matchProbe(proto, res, ident, seq); ok {
+			hop.RTT = time.Since(start)
+
+			if udpAddr, ok := addr.(*net.UDPAddr); ok {
+				hop.Address = udpAddr.IP.String()
+			}
+
+			return hop, p, nil
+		}
+	}
+}
+
+// Traceroute discovers the path to the argument host by sending ICMP echo
+// requests with increasing time-to-live (or hop limit), up to
+// TracerouteMaxHops, and collecting the ICMP time exceeded errors returned
+// by each hop. The host can be either an IP address or a name resolved
+// through LookupHost().
+//
+// The probe is repeated once per hop, hops not replying within PingTimeout
+// are returned with an empty address. The hops probed so far are returned,
+// along with the context error, when the context is cancelled.
+func (iface *Interface) Traceroute(ctx context.Context, host string) (hops []TracerouteHop, err error) {
+	addrs, err := iface.dialAddresses(ctx, "ip", host)
+
+	if err != nil {
+		return
+	}
+
+	ip := addrs[0]
+	proto, transport := ipv4.ProtocolNumber, icmp.ProtocolNumber4
+
+	if ip.To4() == nil {
+		proto, transport = ipv6.ProtocolNumber, icmp.ProtocolNumber6
+	}
+
+	var wq waiter.Queue
+
+	ep, tcpErr := iface.Stack.NewRawEndpoint(transport, proto, &wq, true)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (icmp): %v", tcpErr)
+	}
+
+	// the endpoint is left unconnected to receive errors from any hop
+	conn := gonet.NewUDPConn(iface.Stack, &wq, ep)
+	defer conn.Close()
+
+	ident := uint16(iface.Stack.Rand().Uint32())
+	buf := make([]byte, MaxMTU)
+
+	for ttl := 1; ttl <= TracerouteMaxHops; ttl++ {
+		hop, p, err := iface.traceProbe(ctx, conn, ep, &net.UDPAddr{IP: ip}, ttl, ident, buf)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return hops, ctx.Err()
+			}
+
+			return hops, err
+		}
+
+		hops = append(hops, hop)
+
+		if p.reached || p.unreachable {
+			break
+		}
+	}
+
+	return
+}
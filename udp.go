@@ -0,0 +1,243 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// UDPConn represents a UDP connection over the Ethernet interface.
+type UDPConn struct {
+	*gonet.UDPConn
+
+	ep tcpip.Endpoint
+}
+
+// SetMulticastLoopback controls whether multicast datagrams sent on the
+// connection are looped back to local subscribers of the same group
+// (IP_MULTICAST_LOOP). Broadcast datagrams are always looped back.
+func (c *UDPConn) SetMulticastLoopback(enabled bool) {
+	c.ep.SocketOptions().SetMulticastLoop(enabled)
+}
+
+// MulticastLoopback returns whether multicast datagrams sent on the
+// connection are looped back to local subscribers.
+func (c *UDPConn) MulticastLoopback() bool {
+	return c.ep.SocketOptions().GetMulticastLoop()
+}
+
+// Write implements net.Conn.Write(). Datagrams to multicast groups are
+// explicitly addressed, as the stack loops them back according to their
+// route, which connected endpoints otherwise only resolve on connection.
+func (c *UDPConn) Write(b []byte) (int, error) {
+	if addr, ok := c.RemoteAddr().(*net.UDPAddr); ok && addr.IP.IsMulticast() {
+		return c.UDPConn.WriteTo(b, addr)
+	}
+
+	return c.UDPConn.Write(b)
+}
+
+// SetBroadcast controls whether datagrams can be sent on the connection to
+// the limited (255.255.255.255) or subnet broadcast addresses
+// (SO_BROADCAST), it is disabled by default.
+func (c *UDPConn) SetBroadcast(enabled bool) {
+	c.ep.SocketOptions().SetBroadcast(enabled)
+}
+
+// Broadcast returns whether datagrams can be sent on the connection to
+// broadcast addresses.
+func (c *UDPConn) Broadcast() bool {
+	return c.ep.SocketOptions().GetBroadcast()
+}
+
+// SetReadBuffer sets the connection receive buffer size, it mirrors
+// net.UDPConn.SetReadBuffer().
+func (c *UDPConn) SetReadBuffer(bytes int) error {
+	if bytes < 0 {
+		return errors.New("invalid buffer size")
+	}
+
+	c.ep.SocketOptions().SetReceiveBufferSize(int64(bytes), true)
+
+	return nil
+}
+
+// SetWriteBuffer sets the connection send buffer size, it mirrors
+// net.UDPConn.SetWriteBuffer().
+func (c *UDPConn) SetWriteBuffer(bytes int) error {
+	if bytes < 0 {
+		return errors.New("invalid buffer size")
+	}
+
+	c.ep.SocketOptions().SetSendBufferSize(int64(bytes), true)
+
+	return nil
+}
+
+// DialUDP4 creates a UDP connection to the remote IPv4 address, over the
+// Ethernet interface, bound to the local one. An empty local address selects
+// an ephemeral port, while an empty remote address leaves the connection
+// unconnected.
+//
+// Multicast loopback is enabled, matching Linux defaults, unless disabled
+// through Options.DisableMulticastLoopback. Sending to broadcast addresses
+// requires SetBroadcast(), while connections bound to an unspecified local
+// address also receive broadcast datagrams.
+func (iface *Interface) DialUDP4(lAddr, rAddr string) (c *UDPConn, err error) {
+	return iface.dialUDP(lAddr, rAddr, ipv4.ProtocolNumber, nil)
+}
+
+// DialUDP6 creates a UDP connection to the remote IPv6 address, over the
+// Ethernet interface, bound to the local one, with the same semantics of
+// DialUDP4.
+func (iface *Interface) DialUDP6(lAddr, rAddr string) (c *UDPConn, err error) {
+	if iface.opts.IPv6 == nil {
+		return nil, errors.New("IPv6 not enabled")
+	}
+
+	return iface.dialUDP(lAddr, rAddr, ipv6.ProtocolNumber, nil)
+}
+
+// dialUDP creates a UDP connection, the control function, when not nil, is
+// invoked on the endpoint before binding it.
+func (iface *Interface) dialUDP(lAddr, rAddr string, proto tcpip.NetworkProtocolNumber, control func(ep tcpip.Endpoint) error) (c *UDPConn, err error) {
+	var wq waiter.Queue
+
+	ep, tcpErr := iface.Stack.NewEndpoint(udp.ProtocolNumber, proto, &wq)
+
+	if tcpErr != nil {
+		return nil, fmt.Errorf("endpoint error (udp): %v", tcpErr)
+	}
+
+	ep.SocketOptions().SetMulticastLoop(!iface.opts.DisableMulticastLoopback)
+
+	// the limited broadcast address is only routed through the bound
+	// device
+	if tcpErr := ep.SocketOptions().SetBindToDevice(int32(iface.nicid)); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("bind error (udp): %v", tcpErr)
+	}
+
+	if control != nil {
+		if err = control(ep); err != nil {
+			ep.Close()
+			return
+		}
+	}
+
+	if len(lAddr) > 0 {
+		addr, err := fullAddr(lAddr, proto)
+
+		if err != nil {
+			ep.Close()
+			return nil, err
+		}
+
+		addr.NIC = iface.nicid
+
+		if tcpErr := ep.Bind(addr); tcpErr != nil {
+			ep.Close()
+			return nil, fmt.Errorf("bind error (udp): %v", tcpErr)
+		}
+	}
+
+	if len(rAddr) > 0 {
+		addr, err := fullAddr(rAddr, proto)
+
+		if err != nil {
+			ep.Close()
+			return nil, err
+		}
+
+		if addr.Addr == header.IPv4Broadcast {
+			addr.NIC = iface.nicid
+		}
+
+		if tcpErr := ep.Connect(addr); tcpErr != nil {
+			ep.Close()
+			return nil, fmt.Errorf("connect error (udp): %v", tcpErr)
+		}
+	}
+
+	return &UDPConn{
+		UDPConn: gonet.NewUDPConn(iface.Stack, &wq, ep),
+		ep:      ep,
+	}, nil
+}
+
+// ListenUDP4 returns a net.PacketConn receiving UDP datagrams for the
+// argument port on any IPv4 address of the Ethernet interface, broadcast
+// ones included.
+//
+// The returned connection can be type asserted to *UDPConn, to access its
+// broadcast and multicast options.
+func (iface *Interface) ListenUDP4(port uint16) (net.PacketConn, error) {
+	return iface.ListenUDP4Address(net.JoinHostPort("", strconv.Itoa(int(port))))
+}
+
+// ListenUDP4Address returns a net.PacketConn receiving UDP datagrams for the
+// argument IPv4 local address, in host:port form, on the Ethernet interface.
+// An empty host selects any interface address, while port 0 selects an
+// ephemeral port.
+func (iface *Interface) ListenUDP4Address(address string) (net.PacketConn, error) {
+	if len(address) == 0 {
+		return nil, errors.New("invalid address")
+	}
+
+	conn, err := iface.DialUDP4(address, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return (net.PacketConn)(conn), nil
+}
+
+// DialUDPContext creates a UDP connection to the argument remote address, in
+// host:port form, on the argument network ("udp", "udp4" or "udp6"). The
+// host can be either an IP address or a name resolved through LookupHost(),
+// the first suitable address is used (see DialContext()).
+//
+// The returned connection implements net.PacketConn and net.Conn, allowing
+// its use by QUIC and DTLS clients.
+func (iface *Interface) DialUDPContext(ctx context.Context, network string, address string) (c *UDPConn, err error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, errors.New("unsupported network")
+	}
+
+	host, port, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return
+	}
+
+	addrs, err := iface.dialAddresses(ctx, network, host)
+
+	if err != nil {
+		return
+	}
+
+	addr := net.JoinHostPort(addrs[0].String(), port)
+
+	return iface.dialUDP("", addr, addressProtocol(addr), nil)
+}
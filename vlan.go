@@ -0,0 +1,236 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// IEEE 802.1Q constants
+const (
+	// VLANProtocolNumber is the IEEE 802.1Q Tag Protocol Identifier.
+	VLANProtocolNumber tcpip.NetworkProtocolNumber = 0x8100
+
+	vlanTagLen = 4
+	vlanMaxVID = 4094
+)
+
+type vlanTable struct {
+	sync.RWMutex
+
+	// VLAN sub-interfaces NICs, indexed by VLAN identifier
+	nics map[uint16]*NIC
+}
+
+func (t *vlanTable) get(vid uint16) *NIC {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.nics[vid]
+}
+
+// untag returns a copy of an IEEE 802.1Q tagged frame without its tag, other
+// frames are returned unmodified.
+func untag(buf []byte) []byte {
+	if len(buf) < header.EthernetMinimumSize+vlanTagLen || binary.BigEndian.Uint16(buf[12:14]) != uint16(VLANProtocolNumber) {
+		return buf
+	}
+
+	frame := make([]byte, 0, len(buf)-vlanTagLen)
+	frame = append(frame, buf[0:12]...)
+	frame = append(frame, buf[12+vlanTagLen:]...)
+
+	return frame
+}
+
+// vlanRx strips the IEEE 802.1Q tag from a received frame and passes it to
+// the matching VLAN sub-interface, frames for unknown VLANs are discarded
+// while priority tagged ones (VID 0) are passed to the parent interface.
+func (eth *NIC) vlanRx(buf []byte) {
+	if len(buf) < header.EthernetMinimumSize+vlanTagLen {
+		return
+	}
+
+	vid := binary.BigEndian.Uint16(buf[14:16]) & 0x0fff
+	frame := untag(buf)
+
+	// the frame has already been captured and filtered as tagged
+	if vid == 0 {
+		eth.receive(frame)
+		return
+	}
+
+	if nic := eth.vlans.get(vid); nic != nil {
+		nic.Rx(frame)
+	}
+}
+
+type vlanNotification struct {
+	nic    *NIC
+	parent *NIC
+	vid    uint16
+}
+
+// WriteNotify inserts the IEEE 802.1Q tag in frames transmitted by the VLAN
+// sub-interface and sends them out of the parent device, serialized with its
+// transmission and subject to its Access Control List, capture and taps.
+func (n *vlanNotification) WriteNotify() {
+	buf := n.nic.Tx()
+
+	if len(buf) < header.EthernetMinimumSize+vlanTagLen {
+		return
+	}
+
+	// priority tagged frames (see SetQoS()) carry the tag already
+	if binary.BigEndian.Uint16(buf[12:14]) == uint16(VLANProtocolNumber) {
+		tci := binary.BigEndian.Uint16(buf[14:16])
+		binary.BigEndian.PutUint16(buf[14:16], tci&0xf000|n.vid)
+		n.parent.transmit(buf, false)
+		return
+	}
+
+	tag := make([]byte, vlanTagLen)
+	binary.BigEndian.PutUint16(tag[0:2], uint16(VLANProtocolNumber))
+	binary.BigEndian.PutUint16(tag[2:4], n.vid)
+
+	frame := make([]byte, 0, len(buf)+vlanTagLen)
+	frame = append(frame, buf[0:12]...)
+	frame = append(frame, tag...)
+	frame = append(frame, buf[12:]...)
+
+	n.parent.transmit(frame, false)
+}
+
+// AddVLAN creates an IEEE 802.1Q VLAN sub-interface, on the same stack and
+// with the same hardware address, on top of the Ethernet interface. Frames
+// transmitted by the sub-interface are tagged with the argument VLAN
+// identifier, received frames with a matching tag are untagged and passed to
+// it.
+//
+// The sub-interface is configured with the argument IPv4 configuration
+// (static or through DHCP), a nil configuration leaves it unconfigured. Its
+// MTU is reduced by the tag length to fit the maximum ENET frame size.
+func (iface *Interface) AddVLAN(vid uint16, cfg *IPConfig) (vlan *Interface, err error) {
+	if vid == 0 || vid > vlanMaxVID {
+		return nil, errors.New("invalid VLAN ID")
+	}
+
+	if iface.NIC.Device == nil {
+		return nil, errors.New("VLANs require a physical interface")
+	}
+
+	if cfg != nil && cfg.SLAAC {
+		return nil, errors.New("SLAAC is not supported for IPv4")
+	}
+
+	iface.NIC.vlans.Lock()
+	defer iface.NIC.vlans.Unlock()
+
+	if iface.NIC.vlans.nics[vid] != nil {
+		return nil, fmt.Errorf("VLAN %d already exists", vid)
+	}
+
+	vlan = &Interface{
+		nicid:   iface.nextNICID(),
+		Stack:   iface.Stack,
+		started: time.Now(),
+		done:    make(chan struct{}),
+		opts: Options{
+			MAC:             iface.opts.MAC,
+			IPv4:            cfg,
+			ChecksumOffload: iface.opts.ChecksumOffload,
+		},
+	}
+
+	if cfg != nil && !cfg.DHCP && (len(cfg.Address) > 0 || !cfg.LinkLocal) {
+		if vlan.address, err = parseAddress(cfg.Address, ipv4.ProtocolNumber); err != nil {
+			return nil, err
+		}
+
+		if vlan.gateway, err = parseGateway(cfg.Gateway, ipv4.ProtocolNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	mtu := uint32(iface.MTU() - vlanTagLen)
+
+	vlan.Link = channel.New(256, mtu, iface.Link.LinkAddress())
+	vlan.Link.LinkEPCapabilities |= stack.CapabilityResolutionRequired
+
+	if iface.opts.ChecksumOffload {
+		vlan.Link.LinkEPCapabilities |= checksumOffloadCapabilities
+	}
+	vlan.endpoint = newLinkEndpoint(vlan.Link, mtu)
+
+	if err := vlan.Stack.CreateNIC(vlan.nicid, vlan.endpoint); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+
+	if len(vlan.address.Address) > 0 {
+		if err = vlan.configureProtocol(ipv4.ProtocolNumber, vlan.address, vlan.gateway); err != nil {
+			return nil, err
+		}
+	}
+
+	vlan.NIC = &NIC{
+		MAC:             iface.NIC.MAC,
+		Link:            vlan.Link,
+		Gateway:         header.EthernetBroadcastAddress,
+		checksumOffload: iface.NIC.checksumOffload,
+	}
+
+	vlan.NIC.arpHandler = vlan.handleARP
+
+	var dhcp *dhcpClient
+
+	if dhcpEnabled(&vlan.opts) {
+		dhcp = newDHCPClient(vlan)
+		vlan.NIC.dhcpHandler = dhcp.handle
+	}
+
+	if err = vlan.NIC.Init(); err != nil {
+		return nil, err
+	}
+
+	vlan.Link.AddNotify(&vlanNotification{
+		nic:    vlan.NIC,
+		parent: iface.NIC,
+		vid:    vid,
+	})
+
+	if iface.NIC.vlans.nics == nil {
+		iface.NIC.vlans.nics = make(map[uint16]*NIC)
+	}
+
+	iface.NIC.vlans.nics[vid] = vlan.NIC
+
+	switch {
+	case dhcp != nil:
+		go dhcp.run()
+	case cfg != nil && len(vlan.address.Address) == 0:
+		vlan.startLinkLocal()
+	case cfg != nil:
+		go vlan.announce(vlan.address.Address, acdAnnounceNum)
+	}
+
+	vlan.SetName(fmt.Sprintf("%s.%d", iface.Name(), vid))
+	register(vlan)
+
+	return
+}
@@ -0,0 +1,286 @@
+// i.MX Ethernet (ENET) driver
+//
+// Copyright (c) WithSecure Corporation
+// https://foundry.withsecure.com
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package enet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// WakeOnLANProtocolNumber is the EtherType used for Wake-on-LAN magic
+// packets sent as raw Ethernet frames.
+const WakeOnLANProtocolNumber = 0x0842
+
+// ENET magic packet detection registers
+const (
+	enetEIR        = 0x0004
+	enetEIMR       = 0x0008
+	enetEIRWakeup  = 17
+	enetECRMagicEn = 2
+	enetECRSleep   = 3
+)
+
+// WakeOnLANer is implemented by PHY drivers supporting magic packet
+// detection, allowing wake-up while the ENET MAC is not clocked.
+type WakeOnLANer interface {
+	// SetWakeOnLAN enables, or disables, magic packet detection for the
+	// NIC MAC address.
+	SetWakeOnLAN(eth *NIC, enable bool) error
+	// WakeEvent returns, and clears, the magic packet detection status.
+	WakeEvent(eth *NIC) (bool, error)
+}
+
+// EnableWakeOnLAN arms the interface for wake-up on reception of a magic
+// packet addressed to its MAC address.
+//
+// The ENET MAC is put in sleep mode with magic packet detection enabled: all
+// other frames are discarded until a magic packet is received, at which point
+// the MAC resumes normal operation and a wake event is flagged (see
+// WakeEvent()), raising the ENET interrupt when enabled. When the PHY driver
+// implements WakeOnLANer, PHY magic packet detection is armed as well.
+func (eth *NIC) EnableWakeOnLAN() (err error) {
+	if eth.Device == nil {
+		return errors.New("missing physical interface")
+	}
+
+	if phy, ok := eth.PHY.(WakeOnLANer); ok {
+		if err = phy.SetWakeOnLAN(eth, true); err != nil {
+			return
+		}
+	}
+
+	dev := eth.Device
+
+	dev.Lock()
+	defer dev.Unlock()
+
+	writeRegister(dev.Base+enetEIR, 1<<enetEIRWakeup)
+	writeRegister(dev.Base+enetEIMR, readRegister(dev.Base+enetEIMR)|1<<enetEIRWakeup)
+
+	ecr := dev.Base + enetECR
+	writeRegister(ecr, readRegister(ecr)|1<<enetECRMagicEn|1<<enetECRSleep)
+
+	return
+}
+
+// DisableWakeOnLAN disarms magic packet detection and resumes normal
+// operation.
+func (eth *NIC) DisableWakeOnLAN() (err error) {
+	if eth.Device == nil {
+		return errors.New("missing physical interface")
+	}
+
+	if phy, ok := eth.PHY.(WakeOnLANer); ok {
+		if err = phy.SetWakeOnLAN(eth, false); err != nil {
+			return
+		}
+	}
+
+	dev := eth.Device
+
+	dev.Lock()
+	defer dev.Unlock()
+
+	ecr := dev.Base + enetECR
+	writeRegister(ecr, readRegister(ecr)&^(1<<enetECRMagicEn|1<<enetECRSleep))
+	writeRegister(dev.Base+enetEIMR, readRegister(dev.Base+enetEIMR)&^(1<<enetEIRWakeup))
+
+	return
+}
+
+// WakeEvent returns, and clears, whether a magic packet has been received,
+// by either the ENET MAC or the PHY, since Wake-on-LAN was armed.
+//
+// As MDIO transactions clear pending ENET events, MAC detection is latched
+// by the sleep mode status, which the MAC clears on magic packet reception.
+// The event is cleared by disabling MAC magic packet detection, Wake-on-LAN
+// must therefore be re-armed (see EnableWakeOnLAN()) to detect further
+// events.
+func (eth *NIC) WakeEvent() (woken bool, err error) {
+	if eth.Device == nil {
+		return false, errors.New("missing physical interface")
+	}
+
+	dev := eth.Device
+
+	// serialize with MDIO transactions, which modify EIR
+	eth.mii.Lock()
+	dev.Lock()
+
+	eir := dev.Base + enetEIR
+	ecr := dev.Base + enetECR
+	val := readRegister(ecr)
+
+	if readRegister(eir)&(1<<enetEIRWakeup) != 0 || val&(1<<enetECRMagicEn) != 0 && val&(1<<enetECRSleep) == 0 {
+		writeRegister(eir, 1<<enetEIRWakeup)
+		writeRegister(ecr, val&^(1<<enetECRMagicEn))
+		woken = true
+	}
+
+	dev.Unlock()
+	eth.mii.Unlock()
+
+	if phy, ok := eth.PHY.(WakeOnLANer); ok {
+		var phyWoken bool
+
+		if phyWoken, err = phy.WakeEvent(eth); err != nil {
+			return
+		}
+
+		woken = woken || phyWoken
+	}
+
+	return
+}
+
+// EnableWakeOnLAN arms the interface for wake-up on magic packet reception
+// (see NIC.EnableWakeOnLAN()).
+func (iface *Interface) EnableWakeOnLAN() error {
+	return iface.NIC.EnableWakeOnLAN()
+}
+
+// DisableWakeOnLAN disarms magic packet detection (see
+// NIC.DisableWakeOnLAN()).
+func (iface *Interface) DisableWakeOnLAN() error {
+	return iface.NIC.DisableWakeOnLAN()
+}
+
+// WaitWake blocks until a magic packet is received, the context is done or
+// the interface is closed. Wake-on-LAN is disarmed before returning.
+func (iface *Interface) WaitWake(ctx context.Context) (err error) {
+	if err = iface.EnableWakeOnLAN(); err != nil {
+		return
+	}
+
+	defer iface.DisableWakeOnLAN()
+
+	for {
+		if woken, err := iface.NIC.WakeEvent(); err != nil || woken {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-iface.done:
+			return errors.New("interface closed")
+		case <-time.After(linkPollInterval):
+		}
+	}
+}
+
+// MagicPacket returns a Wake-on-LAN magic packet payload for the argument MAC
+// address: 6 bytes of 0xff followed by 16 repetitions of the address and,
+// when not empty, a 4 or 6 bytes SecureOn password.
+func MagicPacket(mac net.HardwareAddr, password []byte) (buf []byte, err error) {
+	if len(mac) != 6 {
+		return nil, errors.New("invalid MAC address")
+	}
+
+	if n := len(password); n != 0 && n != 4 && n != 6 {
+		return nil, errors.New("invalid password length")
+	}
+
+	buf = bytes.Repeat([]byte{0xff}, 6)
+
+	for i := 0; i < 16; i++ {
+		buf = append(buf, mac...)
+	}
+
+	return append(buf, password...), nil
+}
+
+// WakeHost broadcasts, on the interface segment, a Wake-on-LAN magic packet
+// for the argument MAC address (see MagicPacket()). The packet is sent as a
+// raw Ethernet frame, therefore it does not require IP configuration and it
+// is not forwarded by routers.
+func (iface *Interface) WakeHost(mac net.HardwareAddr, password []byte) (err error) {
+	buf, err := MagicPacket(mac, password)
+
+	if err != nil {
+		return
+	}
+
+	payload := bufferv2.MakeWithData(buf)
+	dst := header.EthernetBroadcastAddress
+
+	if tcpErr := iface.Stack.WritePacketToRemote(iface.nicid, dst, WakeOnLANProtocolNumber, payload); tcpErr != nil {
+		err = fmt.Errorf("%v", tcpErr)
+	}
+
+	return
+}
+
+// AR8035 Wake-on-LAN registers
+const (
+	AR8035_INTR_ENABLE = 0x12
+	AR8035_INTR_STATUS = 0x13
+	INTR_WOL           = 0
+
+	AR8035_MMD3_LOC_MAC_ADDR_0_15  = 0x804a
+	AR8035_MMD3_LOC_MAC_ADDR_16_31 = 0x804b
+	AR8035_MMD3_LOC_MAC_ADDR_32_47 = 0x804c
+)
+
+// SetWakeOnLAN implements WakeOnLANer.SetWakeOnLAN(), the PHY INT pin is
+// asserted on magic packet detection.
+func (phy *AR8035) SetWakeOnLAN(eth *NIC, enable bool) (err error) {
+	mac := eth.MAC
+
+	if enable && len(mac) != 6 {
+		return errors.New("invalid MAC address")
+	}
+
+	if enable {
+		for i, ra := range []uint16{
+			AR8035_MMD3_LOC_MAC_ADDR_32_47,
+			AR8035_MMD3_LOC_MAC_ADDR_16_31,
+			AR8035_MMD3_LOC_MAC_ADDR_0_15,
+		} {
+			if err = eth.WriteMMD(3, ra, uint16(mac[i*2])<<8|uint16(mac[i*2+1])); err != nil {
+				return
+			}
+		}
+	}
+
+	ier, err := eth.ReadPHY(AR8035_INTR_ENABLE)
+
+	if err != nil {
+		return
+	}
+
+	if enable {
+		ier |= 1 << INTR_WOL
+	} else {
+		ier &^= 1 << INTR_WOL
+	}
+
+	if err = eth.WritePHY(AR8035_INTR_ENABLE, ier); err != nil {
+		return
+	}
+
+	// clear pending events
+	_, err = eth.ReadPHY(AR8035_INTR_STATUS)
+
+	return
+}
+
+// WakeEvent implements WakeOnLANer.WakeEvent(), as the interrupt status is
+// cleared on read other pending PHY events are discarded.
+func (phy *AR8035) WakeEvent(eth *NIC) (bool, error) {
+	isr, err := eth.ReadPHY(AR8035_INTR_STATUS)
+	return isr&(1<<INTR_WOL) != 0, err
+}